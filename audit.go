@@ -0,0 +1,40 @@
+package encx
+
+import (
+	"context"
+	"time"
+)
+
+// observabilityHookProvider is implemented by crypto services reporting to an
+// observability hook, such as *Crypto
+type observabilityHookProvider interface {
+	GetObservabilityHook() ObservabilityHook
+}
+
+// ReportFieldDecryption reports the decryption of a struct field to the observability
+// hook of crypto, for access auditing. The generated Decrypt<Name>EncxFields functions
+// call it for each field they decrypt.
+//
+// The hook receives OnProcessComplete for the "DecryptField" operation, with the
+// "struct" and "field" metadata, and OnError if the decryption failed. Crypto services
+// without a hook are ignored.
+func ReportFieldDecryption(ctx context.Context, crypto CryptoService, structName, fieldName string, duration time.Duration, err error) {
+	provider, ok := crypto.(observabilityHookProvider)
+	if !ok {
+		return
+	}
+	hook := provider.GetObservabilityHook()
+	if hook == nil {
+		return
+	}
+
+	metadata := map[string]any{
+		"operation_type": "decrypt",
+		"struct":         structName,
+		"field":          fieldName,
+	}
+	hook.OnProcessComplete(ctx, "DecryptField", duration, err, metadata)
+	if err != nil {
+		hook.OnError(ctx, "DecryptField", err, metadata)
+	}
+}
@@ -0,0 +1,50 @@
+package encx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingHook records the operations reported to it
+type recordingHook struct {
+	ObservabilityHook
+	completed []map[string]any
+	errors    []error
+}
+
+func (h *recordingHook) OnProcessComplete(ctx context.Context, operation string, duration time.Duration, err error, metadata map[string]any) {
+	h.completed = append(h.completed, metadata)
+}
+
+func (h *recordingHook) OnError(ctx context.Context, operation string, err error, metadata map[string]any) {
+	h.errors = append(h.errors, err)
+}
+
+func TestReportFieldDecryption(t *testing.T) {
+	ctx := context.Background()
+	hook := &recordingHook{ObservabilityHook: NoOpObservabilityHook}
+	crypto, err := NewCrypto(ctx, NewSimpleTestKMS(), NewInMemorySecretStore(), Config{
+		KEKAlias:    "test-kek-alias",
+		PepperAlias: "test-service",
+	}, WithObservabilityHook(hook))
+	require.NoError(t, err)
+
+	ReportFieldDecryption(ctx, crypto, "User", "SSN", time.Millisecond, nil)
+	assert.Equal(t, []map[string]any{{"operation_type": "decrypt", "struct": "User", "field": "SSN"}}, hook.completed)
+	assert.Empty(t, hook.errors)
+
+	ReportFieldDecryption(ctx, crypto, "User", "Email", time.Millisecond, ErrDecryptionFailed)
+	assert.Len(t, hook.completed, 2)
+	require.Len(t, hook.errors, 1)
+	assert.True(t, errors.Is(hook.errors[0], ErrDecryptionFailed))
+
+	// Crypto services without a hook are ignored
+	assert.NotPanics(t, func() {
+		ReportFieldDecryption(ctx, nil, "User", "SSN", time.Millisecond, nil)
+	})
+}
@@ -0,0 +1,259 @@
+package encx
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/hengadev/encx/internal/crypto"
+	"github.com/hengadev/errsx"
+)
+
+// DefaultBatchConcurrency is the number of records processed concurrently by RunBatch
+const DefaultBatchConcurrency = 8
+
+// BatchOption configures RunBatch and the generated batch functions
+type BatchOption func(*batchOptions)
+
+type batchOptions struct {
+	concurrency int
+}
+
+// WithBatchConcurrency sets the number of records processed concurrently. Values below
+// 1 are ignored.
+func WithBatchConcurrency(concurrency int) BatchOption {
+	return func(o *batchOptions) {
+		if concurrency > 0 {
+			o.concurrency = concurrency
+		}
+	}
+}
+
+// RunBatch calls fn with the indexes 0 to n-1 from a bounded pool of workers, and
+// returns the errors of fn keyed by index. Indexes not yet started when ctx is done
+// fail with the error of ctx. The generated Process<Name>EncxBatch and
+// Decrypt<Name>EncxBatch functions use it.
+func RunBatch(ctx context.Context, n int, fn func(i int) error, opts ...BatchOption) errsx.Map {
+	options := batchOptions{concurrency: DefaultBatchConcurrency}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var (
+		errs    errsx.Map
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		indexes = make(chan int)
+	)
+	setErr := func(i int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs.Set(strconv.Itoa(i), err)
+	}
+
+	for range min(options.concurrency, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := fn(i); err != nil {
+					setErr(i, err)
+				}
+			}
+		}()
+	}
+
+	for i := range n {
+		if err := ctx.Err(); err != nil {
+			setErr(i, err)
+			continue
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return errs
+}
+
+// WithKEKCache returns crypto with the current KEK version and the KMS key IDs of the
+// KEK versions resolved once, so that the records of a batch do not query the key
+// metadata database each. DEKs wrapped after a rotation of the KEK still use the
+// version resolved first: use it for a single batch. The generated
+// Process<Name>EncxBatch and Decrypt<Name>EncxBatch functions use it.
+//
+// Only crypto services resolving KEK versions with a given version manager, such as
+// *Crypto, benefit from the cache. Other services are called as they are.
+func WithKEKCache(crypto CryptoService) CryptoService {
+	return &kekCache{CryptoService: crypto, versions: make(map[string]int), keyIDs: make(map[string]string)}
+}
+
+// kekVersionResolver is implemented by crypto services wrapping and unwrapping DEKs with
+// the KEK versions of a given version manager, such as *Crypto
+type kekVersionResolver interface {
+	encryptDEKVersioned(ctx context.Context, plaintextDEK []byte, versionManager crypto.KMSVersionManager) ([]byte, int, error)
+	decryptDEKWithVersion(ctx context.Context, ciphertextDEK []byte, kekVersion int, versionManager crypto.KMSVersionManager) ([]byte, error)
+}
+
+// kekCache is a CryptoService caching the KEK versions it resolves
+type kekCache struct {
+	CryptoService
+	mu       sync.Mutex
+	versions map[string]int    // current version by alias
+	keyIDs   map[string]string // KMS key ID by alias and version
+}
+
+// EncryptDEKVersioned wraps a DEK with the current KEK, resolved once
+func (c *kekCache) EncryptDEKVersioned(ctx context.Context, plaintextDEK []byte) ([]byte, int, error) {
+	if resolver, ok := c.CryptoService.(kekVersionResolver); ok {
+		return resolver.encryptDEKVersioned(ctx, plaintextDEK, c)
+	}
+	return c.CryptoService.EncryptDEKVersioned(ctx, plaintextDEK)
+}
+
+// EncryptDEK wraps a DEK with the current KEK, resolved once
+func (c *kekCache) EncryptDEK(ctx context.Context, plaintextDEK []byte) ([]byte, error) {
+	ciphertextDEK, _, err := c.EncryptDEKVersioned(ctx, plaintextDEK)
+	return ciphertextDEK, err
+}
+
+// DecryptDEKWithVersion unwraps a DEK with the KMS key of its KEK version, resolved once
+func (c *kekCache) DecryptDEKWithVersion(ctx context.Context, ciphertextDEK []byte, kekVersion int) ([]byte, error) {
+	if resolver, ok := c.CryptoService.(kekVersionResolver); ok {
+		return resolver.decryptDEKWithVersion(ctx, ciphertextDEK, kekVersion, c)
+	}
+	return c.CryptoService.DecryptDEKWithVersion(ctx, ciphertextDEK, kekVersion)
+}
+
+// GetCurrentKEKVersion returns the current version of a KEK. Errors are not cached, so
+// the next call retries.
+func (c *kekCache) GetCurrentKEKVersion(ctx context.Context, alias string) (int, error) {
+	c.mu.Lock()
+	version, found := c.versions[alias]
+	c.mu.Unlock()
+	if found {
+		return version, nil
+	}
+
+	version, err := c.CryptoService.GetCurrentKEKVersion(ctx, alias)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Concurrent calls all use the version resolved first
+	if first, found := c.versions[alias]; found {
+		return first, nil
+	}
+	c.versions[alias] = version
+	return version, nil
+}
+
+// GetKMSKeyIDForVersion returns the KMS key ID of a KEK version. Errors are not cached,
+// so the next call retries.
+func (c *kekCache) GetKMSKeyIDForVersion(ctx context.Context, alias string, version int) (string, error) {
+	key := strconv.Itoa(version) + ":" + alias
+
+	c.mu.Lock()
+	keyID, found := c.keyIDs[key]
+	c.mu.Unlock()
+	if found {
+		return keyID, nil
+	}
+
+	keyID, err := c.CryptoService.GetKMSKeyIDForVersion(ctx, alias, version)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keyIDs[key] = keyID
+	return keyID, nil
+}
+
+// GetObservabilityHook returns the observability hook of the wrapped service, if any
+func (c *kekCache) GetObservabilityHook() ObservabilityHook {
+	if provider, ok := c.CryptoService.(observabilityHookProvider); ok {
+		return provider.GetObservabilityHook()
+	}
+	return nil
+}
+
+// WithDEKCache returns crypto with the DEKs it unwraps cached, so that records sharing
+// a wrapped DEK unwrap it with the KMS once. The plaintext DEKs stay in memory as long
+// as the returned service: use it for a single batch. The generated
+// Decrypt<Name>EncxBatch functions use it.
+//
+// The generated Process<Name>Encx functions give each record its own DEK, so only
+// records sharing a wrapped DEK, such as copies of a record or records encrypted with
+// the same DEK by other code, unwrap it once.
+func WithDEKCache(crypto CryptoService) CryptoService {
+	return &dekCache{CryptoService: crypto, entries: make(map[string]*dekCacheEntry)}
+}
+
+// dekCache is a CryptoService caching the DEKs it unwraps
+type dekCache struct {
+	CryptoService
+	mu      sync.Mutex
+	entries map[string]*dekCacheEntry
+}
+
+// dekCacheEntry is a DEK being unwrapped, done once the unwrap returned. Entries of
+// failed unwraps are removed, so that only DEKs are cached.
+type dekCacheEntry struct {
+	done chan struct{}
+	dek  []byte
+}
+
+// DecryptDEKWithVersion unwraps a DEK, or waits for the result of a concurrent call
+// with the same wrapped DEK and KEK version. If that call fails, for instance because
+// its context was canceled, the DEK is unwrapped again with the context of this call.
+func (c *dekCache) DecryptDEKWithVersion(ctx context.Context, ciphertextDEK []byte, kekVersion int) ([]byte, error) {
+	key := strconv.Itoa(kekVersion) + ":" + string(ciphertextDEK)
+
+	for {
+		c.mu.Lock()
+		entry, found := c.entries[key]
+		if !found {
+			entry = &dekCacheEntry{done: make(chan struct{})}
+			c.entries[key] = entry
+		}
+		c.mu.Unlock()
+
+		if !found {
+			dek, err := c.CryptoService.DecryptDEKWithVersion(ctx, ciphertextDEK, kekVersion)
+			if err != nil {
+				c.mu.Lock()
+				delete(c.entries, key)
+				c.mu.Unlock()
+			} else {
+				entry.dek = dek
+			}
+			close(entry.done)
+			if err != nil {
+				return nil, err
+			}
+			return bytes.Clone(dek), nil
+		}
+
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if entry.dek != nil {
+			return bytes.Clone(entry.dek), nil
+		}
+	}
+}
+
+// GetObservabilityHook returns the observability hook of the wrapped service, if any
+func (c *dekCache) GetObservabilityHook() ObservabilityHook {
+	if provider, ok := c.CryptoService.(observabilityHookProvider); ok {
+		return provider.GetObservabilityHook()
+	}
+	return nil
+}
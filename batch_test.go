@@ -0,0 +1,184 @@
+package encx
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunBatch(t *testing.T) {
+	ctx := context.Background()
+
+	var running, maxRunning atomic.Int32
+	var calls atomic.Int32
+	errs := RunBatch(ctx, 20, func(i int) error {
+		calls.Add(1)
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			current := maxRunning.Load()
+			if n <= current || maxRunning.CompareAndSwap(current, n) {
+				break
+			}
+		}
+		if i%7 == 3 {
+			return ErrOperationFailed
+		}
+		return nil
+	}, WithBatchConcurrency(3))
+
+	assert.Equal(t, int32(20), calls.Load())
+	assert.LessOrEqual(t, maxRunning.Load(), int32(3))
+	// Errors are keyed by index
+	assert.Len(t, errs, 3)
+	assert.True(t, errors.Is(errs["3"], ErrOperationFailed))
+	assert.True(t, errors.Is(errs["17"], ErrOperationFailed))
+
+	// Nothing is started once the context is done
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	calls.Store(0)
+	errs = RunBatch(canceled, 5, func(i int) error {
+		calls.Add(1)
+		return nil
+	})
+	assert.Zero(t, calls.Load())
+	assert.Len(t, errs, 5)
+	assert.True(t, errors.Is(errs["0"], context.Canceled))
+
+	assert.Nil(t, RunBatch(ctx, 0, func(i int) error { return nil }).AsError())
+}
+
+// countingKMS counts the DEKs unwrapped by a KMS, and fails them while failing is set
+type countingKMS struct {
+	KeyManagementService
+	decrypts atomic.Int32
+	failing  atomic.Bool
+}
+
+func (k *countingKMS) DecryptDEK(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	k.decrypts.Add(1)
+	if k.failing.Load() {
+		return nil, ErrKMSUnavailable
+	}
+	return k.KeyManagementService.DecryptDEK(ctx, keyID, ciphertext)
+}
+
+func TestWithDEKCache(t *testing.T) {
+	ctx := context.Background()
+	kms := &countingKMS{KeyManagementService: NewSimpleTestKMS()}
+	crypto, err := NewTestCrypto(t, WithTestKMS(kms))
+	require.NoError(t, err)
+
+	var wrapped [][]byte
+	var version int
+	for range 2 {
+		dek, err := crypto.GenerateDEK()
+		require.NoError(t, err)
+		var encryptedDEK []byte
+		encryptedDEK, version, err = crypto.EncryptDEKVersioned(ctx, dek)
+		require.NoError(t, err)
+		wrapped = append(wrapped, encryptedDEK)
+	}
+
+	cached := WithDEKCache(crypto)
+	errs := RunBatch(ctx, 10, func(i int) error {
+		_, err := cached.DecryptDEKWithVersion(ctx, wrapped[i%2], version)
+		return err
+	})
+	require.Nil(t, errs.AsError())
+	assert.Equal(t, int32(2), kms.decrypts.Load())
+
+	// Callers get their own copy of the DEK
+	first, err := cached.DecryptDEKWithVersion(ctx, wrapped[0], version)
+	require.NoError(t, err)
+	first[0] ^= 0xff
+	second, err := cached.DecryptDEKWithVersion(ctx, wrapped[0], version)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+
+	assert.Equal(t, crypto.GetObservabilityHook(), cached.(*dekCache).GetObservabilityHook())
+
+	// Failed unwraps are not cached
+	dek, err := crypto.GenerateDEK()
+	require.NoError(t, err)
+	encryptedDEK, version, err := crypto.EncryptDEKVersioned(ctx, dek)
+	require.NoError(t, err)
+	kms.failing.Store(true)
+	_, err = cached.DecryptDEKWithVersion(ctx, encryptedDEK, version)
+	assert.ErrorIs(t, err, ErrKMSUnavailable)
+	kms.failing.Store(false)
+	unwrapped, err := cached.DecryptDEKWithVersion(ctx, encryptedDEK, version)
+	require.NoError(t, err)
+	assert.Equal(t, dek, unwrapped)
+
+	// Neither is the context of a canceled call
+	encryptedDEK, version, err = crypto.EncryptDEKVersioned(ctx, dek)
+	require.NoError(t, err)
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = cached.DecryptDEKWithVersion(canceled, encryptedDEK, version)
+	require.Error(t, err)
+	unwrapped, err = cached.DecryptDEKWithVersion(ctx, encryptedDEK, version)
+	require.NoError(t, err)
+	assert.Equal(t, dek, unwrapped)
+}
+
+// countingVersions counts the KEK versions resolved by a Crypto
+type countingVersions struct {
+	*Crypto
+	currentVersions atomic.Int32
+	keyIDs          atomic.Int32
+}
+
+func (c *countingVersions) GetCurrentKEKVersion(ctx context.Context, alias string) (int, error) {
+	c.currentVersions.Add(1)
+	return c.Crypto.GetCurrentKEKVersion(ctx, alias)
+}
+
+func (c *countingVersions) GetKMSKeyIDForVersion(ctx context.Context, alias string, version int) (string, error) {
+	c.keyIDs.Add(1)
+	return c.Crypto.GetKMSKeyIDForVersion(ctx, alias, version)
+}
+
+func TestWithKEKCache(t *testing.T) {
+	ctx := context.Background()
+	crypto, err := NewTestCrypto(t)
+	require.NoError(t, err)
+	counting := &countingVersions{Crypto: crypto}
+	cached := WithKEKCache(counting)
+
+	deks := make([][]byte, 10)
+	wrapped := make([][]byte, 10)
+	versions := make([]int, 10)
+	errs := RunBatch(ctx, 10, func(i int) error {
+		var err error
+		if deks[i], err = cached.GenerateDEK(); err != nil {
+			return err
+		}
+		wrapped[i], versions[i], err = cached.EncryptDEKVersioned(ctx, deks[i])
+		return err
+	}, WithBatchConcurrency(1))
+	require.Nil(t, errs.AsError())
+	assert.Equal(t, int32(1), counting.currentVersions.Load())
+	assert.Equal(t, int32(1), counting.keyIDs.Load())
+
+	errs = RunBatch(ctx, 10, func(i int) error {
+		dek, err := cached.DecryptDEKWithVersion(ctx, wrapped[i], versions[i])
+		if err == nil {
+			assert.Equal(t, deks[i], dek)
+		}
+		return err
+	})
+	require.Nil(t, errs.AsError())
+	assert.Equal(t, int32(1), counting.keyIDs.Load())
+
+	// The DEKs can be unwrapped without the cache
+	dek, err := crypto.DecryptDEKWithVersion(ctx, wrapped[3], versions[3])
+	require.NoError(t, err)
+	assert.Equal(t, deks[3], dek)
+}
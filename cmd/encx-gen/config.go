@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 
@@ -11,21 +13,49 @@ import (
 
 // Config represents the configuration for the code generator
 type Config struct {
-	Version    string                   `yaml:"version"`
-	Generation GenerationConfig         `yaml:"generation"`
-	Packages   map[string]PackageConfig `yaml:"packages"`
+	Version    string                     `yaml:"version"`
+	Generation GenerationConfig           `yaml:"generation"`
+	Packages   map[string]PackageConfig   `yaml:"packages"`
+	Operations map[string]OperationConfig `yaml:"operations,omitempty"`
 }
 
 // GenerationConfig holds general generation settings
 type GenerationConfig struct {
 	OutputSuffix string `yaml:"output_suffix"`
 	PackageName  string `yaml:"package_name"`
+	// TemplatesDir holds .tmpl files overriding the named code generation templates.
+	// A relative path is relative to the directory of the configuration file.
+	TemplatesDir string `yaml:"templates_dir,omitempty"`
+	// SQLHelpers generates the Columns, ScanRow and InsertArgs methods of the Encx structs
+	SQLHelpers bool `yaml:"sql_helpers,omitempty"`
+	// ProtoFieldOption is the number of the encx.field extension, when options.proto is
+	// compiled with another number than the default 50100
+	ProtoFieldOption int `yaml:"proto_field_option,omitempty"`
 }
 
 // PackageConfig holds per-package overrides
 type PackageConfig struct {
 	OutputDir string `yaml:"output_dir"`
 	Skip      bool   `yaml:"skip"`
+	// NamingStrategy names the columns and JSON fields of the fields without db or json
+	// tags, and of companion fields: lowercase (default), snake_case or camelCase
+	NamingStrategy string `yaml:"naming_strategy,omitempty"`
+	// Tags gives encx tags to fields whose struct tags cannot be edited, such as the fields
+	// of protobuf messages: struct name -> field name -> tags, e.g. "encrypt,hash_basic"
+	Tags map[string]map[string]string `yaml:"tags,omitempty"`
+}
+
+// OperationConfig defines a user-defined field operation, applied to the fields whose
+// encx tag is the key of the operation
+type OperationConfig struct {
+	// Function is called as Function(ctx, value) (Type, error), e.g. "github.com/acme/app/masking.Last4"
+	Function string `yaml:"function"`
+	// Suffix names the companion field holding the result, e.g. "Last4"
+	Suffix string `yaml:"suffix"`
+	// Type is the type of the companion field
+	Type string `yaml:"type"`
+	// ConflictsWith lists the tags that cannot be combined with the operation
+	ConflictsWith []string `yaml:"conflicts_with,omitempty"`
 }
 
 // LoadConfig loads configuration from a YAML file
@@ -49,6 +79,10 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
+	if config.Generation.TemplatesDir != "" && !filepath.IsAbs(config.Generation.TemplatesDir) {
+		config.Generation.TemplatesDir = filepath.Join(filepath.Dir(path), config.Generation.TemplatesDir)
+	}
+
 	return config, nil
 }
 
@@ -104,9 +138,41 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("output_suffix must start with underscore or letter")
 	}
 
+	// Extension numbers are field numbers, without the range reserved by protobuf
+	if option := c.Generation.ProtoFieldOption; option < 0 || option > 536870911 || option >= 19000 && option <= 19999 {
+		return fmt.Errorf("proto_field_option must be a valid protobuf field number, got %d", option)
+	}
+
+	// Validate user-defined operations
+	if _, err := c.OperationRegistry(); err != nil {
+		return fmt.Errorf("invalid operations: %w", err)
+	}
+
+	// Validate package naming strategies
+	for packagePath, pkgConfig := range c.Packages {
+		if _, err := codegen.ParseNamingStrategy(pkgConfig.NamingStrategy); err != nil {
+			return fmt.Errorf("package %s: %w", packagePath, err)
+		}
+	}
+
 	return nil
 }
 
+// OperationRegistry returns the registry of the user-defined operations
+func (c *Config) OperationRegistry() (*codegen.OperationRegistry, error) {
+	operations := make([]codegen.Operation, 0, len(c.Operations))
+	for tag, op := range c.Operations {
+		operations = append(operations, codegen.Operation{
+			Tag:           tag,
+			Function:      op.Function,
+			Suffix:        op.Suffix,
+			Type:          op.Type,
+			ConflictsWith: op.ConflictsWith,
+		})
+	}
+	return codegen.NewOperationRegistry(operations)
+}
+
 // isValidGoIdentifier checks if a string is a valid Go identifier
 func isValidGoIdentifier(s string) bool {
 	if s == "" {
@@ -140,10 +206,63 @@ func isValidOutputSuffix(s string) bool {
 	return (first >= 'a' && first <= 'z') || (first >= 'A' && first <= 'Z') || first == '_'
 }
 
-// ToCodegenConfig converts the YAML config to the codegen GenerationConfig
-func (gc GenerationConfig) ToCodegenConfig() (codegen.GenerationConfig, error) {
+// PackageConfig returns the overrides of a package. Package paths are compared once
+// cleaned, so that "./models" in the configuration matches the discovered "models".
+func (c *Config) PackageConfig(packagePath string) PackageConfig {
+	if pkgConfig, exists := c.Packages[packagePath]; exists {
+		return pkgConfig
+	}
+	for path, pkgConfig := range c.Packages {
+		if filepath.Clean(path) == filepath.Clean(packagePath) {
+			return pkgConfig
+		}
+	}
+	return PackageConfig{}
+}
+
+// DiscoveryConfig returns the struct discovery settings of a package
+func (c *Config) DiscoveryConfig(packagePath string) (*codegen.DiscoveryConfig, error) {
+	operations, err := c.OperationRegistry()
+	if err != nil {
+		return nil, fmt.Errorf("invalid operations: %w", err)
+	}
+
+	var tags map[string]map[string][]string
+	for structName, fieldTags := range c.PackageConfig(packagePath).Tags {
+		if tags == nil {
+			tags = make(map[string]map[string][]string)
+		}
+		tags[structName] = make(map[string][]string, len(fieldTags))
+		for fieldName, encxTags := range fieldTags {
+			// Tags may be separated by spaces too, e.g. "encrypt, hash_basic"
+			fieldTagList := strings.Split(encxTags, ",")
+			for i, tag := range fieldTagList {
+				fieldTagList[i] = strings.TrimSpace(tag)
+			}
+			tags[structName][fieldName] = fieldTagList
+		}
+	}
+
+	return &codegen.DiscoveryConfig{Operations: operations, Tags: tags, ProtoFieldOption: c.Generation.ProtoFieldOption}, nil
+}
+
+// ToCodegenConfig converts the YAML config to the codegen GenerationConfig of a package
+func (c *Config) ToCodegenConfig(packagePath string) (codegen.GenerationConfig, error) {
+	operations, err := c.OperationRegistry()
+	if err != nil {
+		return codegen.GenerationConfig{}, err
+	}
+
+	namingStrategy, err := codegen.ParseNamingStrategy(c.PackageConfig(packagePath).NamingStrategy)
+	if err != nil {
+		return codegen.GenerationConfig{}, fmt.Errorf("package %s: %w", packagePath, err)
+	}
+
 	return codegen.GenerationConfig{
-		OutputSuffix: gc.OutputSuffix,
-		PackageName:  gc.PackageName,
+		OutputSuffix:   c.Generation.OutputSuffix,
+		PackageName:    c.Generation.PackageName,
+		Operations:     operations,
+		SQLHelpers:     c.Generation.SQLHelpers,
+		NamingStrategy: namingStrategy,
 	}, nil
 }
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/hengadev/encx/internal/codegen"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -39,6 +40,23 @@ packages:
 	assert.True(t, config.Packages["./test"].Skip)
 }
 
+func TestLoadConfigTemplatesDir(t *testing.T) {
+	tempDir := t.TempDir()
+	configFile := filepath.Join(tempDir, "encx.yaml")
+
+	err := os.WriteFile(configFile, []byte(`
+generation:
+  output_suffix: "_encx"
+  package_name: "encx"
+  templates_dir: "templates"
+`), 0644)
+	require.NoError(t, err)
+
+	// Relative template directories are relative to the configuration file
+	config, err := LoadConfig(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(tempDir, "templates"), config.Generation.TemplatesDir)
+}
 func TestLoadConfigNonExistentFile(t *testing.T) {
 	_, err := LoadConfig("/nonexistent/config.yaml")
 	assert.Error(t, err)
@@ -122,6 +140,47 @@ func TestConfigValidation(t *testing.T) {
 			expectError: true,
 			errorMsg:    "package_name cannot be empty",
 		},
+		{
+			name: "Valid operations",
+			config: Config{
+				Generation: GenerationConfig{
+					OutputSuffix: "_encx",
+					PackageName:  "encx",
+				},
+				Operations: map[string]OperationConfig{
+					"mask_last4": {Function: "example.com/masking.Last4", Suffix: "Last4", Type: "string", ConflictsWith: []string{"hash_secure"}},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Invalid operation",
+			config: Config{
+				Generation: GenerationConfig{
+					OutputSuffix: "_encx",
+					PackageName:  "encx",
+				},
+				Operations: map[string]OperationConfig{
+					"mask_last4": {Function: "example.com/masking.Last4", Suffix: "Encrypted", Type: "string"},
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid operations: operation mask_last4: suffix Encrypted is already used",
+		},
+		{
+			name: "Invalid naming strategy",
+			config: Config{
+				Generation: GenerationConfig{
+					OutputSuffix: "_encx",
+					PackageName:  "encx",
+				},
+				Packages: map[string]PackageConfig{
+					"./models": {NamingStrategy: "kebab-case"},
+				},
+			},
+			expectError: true,
+			errorMsg:    `package ./models: unknown naming strategy "kebab-case"`,
+		},
 		{
 			name: "Invalid package name with special characters",
 			config: Config{
@@ -144,6 +203,29 @@ func TestConfigValidation(t *testing.T) {
 			expectError: true,
 			errorMsg:    "output_suffix must start with underscore or letter",
 		},
+		{
+			name: "Custom proto field option",
+			config: Config{
+				Generation: GenerationConfig{
+					OutputSuffix:     "_encx",
+					PackageName:      "encx",
+					ProtoFieldOption: 70123,
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Reserved proto field option",
+			config: Config{
+				Generation: GenerationConfig{
+					OutputSuffix:     "_encx",
+					PackageName:      "encx",
+					ProtoFieldOption: 19500,
+				},
+			},
+			expectError: true,
+			errorMsg:    "proto_field_option must be a valid protobuf field number",
+		},
 	}
 
 	for _, tt := range tests {
@@ -162,6 +244,56 @@ func TestConfigValidation(t *testing.T) {
 	}
 }
 
+func TestToCodegenConfigNamingStrategy(t *testing.T) {
+	config := DefaultConfig()
+	config.Packages["./models"] = PackageConfig{NamingStrategy: "snake_case"}
+
+	// Package paths match once cleaned
+	codegenConfig, err := config.ToCodegenConfig("models")
+	require.NoError(t, err)
+	assert.Equal(t, codegen.NamingSnakeCase, codegenConfig.NamingStrategy)
+
+	codegenConfig, err = config.ToCodegenConfig("./api")
+	require.NoError(t, err)
+	assert.Equal(t, codegen.NamingLowercase, codegenConfig.NamingStrategy)
+}
+
+func TestDiscoveryConfigTags(t *testing.T) {
+	config := DefaultConfig()
+	config.Packages["./models"] = PackageConfig{Tags: map[string]map[string]string{
+		"User": {"Email": "encrypt, hash_basic", "Phone": " hash_secure "},
+	}}
+
+	discoveryConfig, err := config.DiscoveryConfig("models")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[string][]string{
+		"User": {"Email": {"encrypt", "hash_basic"}, "Phone": {"hash_secure"}},
+	}, discoveryConfig.Tags)
+
+	discoveryConfig, err = config.DiscoveryConfig("./api")
+	require.NoError(t, err)
+	assert.Nil(t, discoveryConfig.Tags)
+	assert.Zero(t, discoveryConfig.ProtoFieldOption)
+
+	config.Generation.ProtoFieldOption = 70123
+	discoveryConfig, err = config.DiscoveryConfig("./api")
+	require.NoError(t, err)
+	assert.Equal(t, 70123, discoveryConfig.ProtoFieldOption)
+}
+
+func TestToCodegenConfigSQLHelpers(t *testing.T) {
+	config := DefaultConfig()
+
+	codegenConfig, err := config.ToCodegenConfig("./models")
+	require.NoError(t, err)
+	assert.False(t, codegenConfig.SQLHelpers)
+
+	config.Generation.SQLHelpers = true
+	codegenConfig, err = config.ToCodegenConfig("./models")
+	require.NoError(t, err)
+	assert.True(t, codegenConfig.SQLHelpers)
+}
+
 func TestSaveConfig(t *testing.T) {
 	tempDir := t.TempDir()
 	configFile := filepath.Join(tempDir, "test_config.yaml")
@@ -1,16 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/hengadev/encx/internal/codegen"
+	"github.com/pmezard/go-difflib/difflib"
 )
 
 // Generator handles the code generation process
@@ -18,6 +21,7 @@ type Generator struct {
 	config    *Config
 	outputDir string
 	verbose   bool
+	tests     bool // Also generate the round-trip and fuzz tests of the structs
 	cache     *GenerationCache
 }
 
@@ -60,6 +64,30 @@ func NewGenerator(configPath, outputDir string, verbose bool) *Generator {
 	}
 }
 
+// newTemplateEngine creates the template engine, with the custom templates of the
+// configuration if any
+func (g *Generator) newTemplateEngine() (*codegen.TemplateEngine, error) {
+	if g.config.Generation.TemplatesDir == "" {
+		return codegen.NewTemplateEngine()
+	}
+	return codegen.NewTemplateEngineFromDir(g.config.Generation.TemplatesDir)
+}
+
+// checkConfigHash clears the cached hashes if the templates or the settings of
+// the configuration changed since the last generation, so that every file is
+// regenerated with them
+func (g *Generator) checkConfigHash(templateEngine *codegen.TemplateEngine) {
+	settings, _ := json.Marshal([]any{g.config.Generation, g.config.Operations, g.config.Packages})
+	hash := sha256.Sum256(append([]byte(templateEngine.Hash()), settings...))
+
+	configHash := fmt.Sprintf("%x", hash)
+	if g.cache.ConfigHash != configHash {
+		g.cache.SourceHashes = make(map[string]string)
+		g.cache.GeneratedFiles = make(map[string]GeneratedFileInfo)
+		g.cache.ConfigHash = configHash
+	}
+}
+
 // discoverGoPackages recursively discovers all Go packages in subdirectories
 func (g *Generator) discoverGoPackages(rootPath string) ([]string, error) {
 	var packages []string
@@ -124,6 +152,16 @@ func (g *Generator) isGoPackage(dirPath string) bool {
 	return hasGoFiles
 }
 
+// generatedFile is the generated code of a source file
+type generatedFile struct {
+	sourcePath string
+	// dependencyPaths are the other source files defining the structs nested in the
+	// structs of the source file, whose changes also change the generated code
+	dependencyPaths []string
+	outputPath      string
+	code            []byte
+}
+
 // Generate performs code generation for the specified packages
 func (g *Generator) Generate(packages []string, dryRun bool) error {
 	if g.verbose {
@@ -139,155 +177,371 @@ func (g *Generator) Generate(packages []string, dryRun bool) error {
 	}
 
 	// Create template engine
-	templateEngine, err := codegen.NewTemplateEngine()
+	templateEngine, err := g.newTemplateEngine()
 	if err != nil {
 		return fmt.Errorf("failed to create template engine: %w", err)
 	}
+	g.checkConfigHash(templateEngine)
 
-	// If only "." is specified, recursively discover all Go packages
-	if len(packages) == 1 && packages[0] == "." {
-		if g.verbose {
-			fmt.Println("Discovering Go packages recursively...")
-		}
-		discoveredPackages, err := g.discoverGoPackages(".")
-		if err != nil {
-			return fmt.Errorf("failed to discover Go packages: %w", err)
-		}
-		packages = discoveredPackages
-		if g.verbose {
-			fmt.Printf("Found %d Go packages to process\n", len(packages))
-		}
+	packages, err = g.expandPackages(packages)
+	if err != nil {
+		return err
 	}
 
 	// Process each package
 	for _, packagePath := range packages {
-		if g.verbose {
-			fmt.Printf("Processing package: %s\n", packagePath)
+		files, err := g.generatePackage(templateEngine, packagePath)
+		if err != nil {
+			return err
 		}
 
-		// Skip packages marked to skip
-		if pkgConfig, exists := g.config.Packages[packagePath]; exists && pkgConfig.Skip {
-			if g.verbose {
-				fmt.Printf("Skipping package %s (marked as skip)\n", packagePath)
+		for _, file := range files {
+			if err := g.writeFile(file, dryRun); err != nil {
+				return err
 			}
-			continue
 		}
+	}
 
-		// Discover structs with encx tags
-		discoveryConfig := &codegen.DiscoveryConfig{}
-		structs, err := codegen.DiscoverStructs(packagePath, discoveryConfig)
-		if err != nil {
-			return fmt.Errorf("failed to discover structs in package %s: %w", packagePath, err)
+	// Save cache after successful generation
+	if !dryRun {
+		if err := g.saveCache(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save cache: %v\n", err)
 		}
+	}
 
-		if g.verbose {
-			fmt.Printf("Found %d structs with encx tags in %s\n", len(structs), packagePath)
-		}
+	fmt.Println("Code generation complete!")
+	return nil
+}
 
-		// Generate code for each struct
-		for _, structInfo := range structs {
-			if g.verbose {
-				fmt.Printf("Generating code for struct: %s\n", structInfo.StructName)
-			}
+// Check regenerates the code of the specified packages in memory and compares it with
+// the generated files on disk, ignoring the "// Generated:" stamp. The differences are
+// written to w as unified diffs. It reports whether any generated file is missing or
+// out of date.
+func (g *Generator) Check(packages []string, w io.Writer) (bool, error) {
+	templateEngine, err := g.newTemplateEngine()
+	if err != nil {
+		return false, fmt.Errorf("failed to create template engine: %w", err)
+	}
 
-			// Check for validation errors
-			hasErrors := false
-			for _, field := range structInfo.Fields {
-				if !field.IsValid {
-					hasErrors = true
-					for _, errMsg := range field.ValidationErrors {
-						fmt.Fprintf(os.Stderr, "Validation error in %s.%s: %s\n", structInfo.StructName, field.Name, errMsg)
-					}
-				}
-			}
+	packages, err = g.expandPackages(packages)
+	if err != nil {
+		return false, err
+	}
+
+	drift := false
+	for _, packagePath := range packages {
+		files, err := g.generatePackage(templateEngine, packagePath)
+		if err != nil {
+			return false, err
+		}
 
-			if hasErrors {
-				fmt.Fprintf(os.Stderr, "Skipping code generation for struct %s due to validation errors\n", structInfo.StructName)
+		for _, file := range files {
+			existing, err := os.ReadFile(file.outputPath)
+			if os.IsNotExist(err) {
+				drift = true
+				fmt.Fprintf(w, "%s: missing, generated from %s\n", file.outputPath, file.sourcePath)
 				continue
 			}
-
-			// Build template data
-			codegenConfig, err := g.config.Generation.ToCodegenConfig()
 			if err != nil {
-				return fmt.Errorf("failed to convert config for struct %s: %w", structInfo.StructName, err)
+				return false, fmt.Errorf("failed to read generated file %s: %w", file.outputPath, err)
 			}
-			templateData := codegen.BuildTemplateData(structInfo, codegenConfig)
 
-			// Generate code
-			code, err := templateEngine.GenerateCode(templateData)
+			diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A:        difflib.SplitLines(stripGeneratedStamp(string(existing))),
+				B:        difflib.SplitLines(stripGeneratedStamp(string(file.code))),
+				FromFile: file.outputPath,
+				ToFile:   file.outputPath + " (regenerated)",
+				Context:  3,
+			})
 			if err != nil {
-				return fmt.Errorf("failed to generate code for struct %s: %w", structInfo.StructName, err)
+				return false, fmt.Errorf("failed to diff generated file %s: %w", file.outputPath, err)
 			}
 
-			// Determine output file path
-			// Extract just the base filename from the source file
-			baseFileName := filepath.Base(structInfo.SourceFile)
-			baseFileName = strings.TrimSuffix(baseFileName, ".go")
+			if diff != "" {
+				drift = true
+				fmt.Fprint(w, diff)
+			} else if g.verbose {
+				fmt.Fprintf(w, "%s: up to date\n", file.outputPath)
+			}
+		}
+	}
 
-			// Construct the output filename with suffix
-			outputBaseName := baseFileName + g.config.Generation.OutputSuffix + ".go"
+	return drift, nil
+}
 
-			// Determine the output directory
-			outputDir := packagePath
-			if g.outputDir != "" {
-				outputDir = g.outputDir
-			}
+// stripGeneratedStamp removes the "// Generated:" stamp line from generated code.
+// Files generated by older versions of encx-gen are stamped with the generation time.
+func stripGeneratedStamp(code string) string {
+	lines := strings.SplitAfter(code, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "// Generated: ") {
+			return strings.Join(append(lines[:i:i], lines[i+1:]...), "")
+		}
+	}
+	return code
+}
+
+// expandPackages recursively discovers all Go packages if only "." is specified
+func (g *Generator) expandPackages(packages []string) ([]string, error) {
+	if len(packages) != 1 || packages[0] != "." {
+		return packages, nil
+	}
 
-			// Build the full output file path
-			outputFileName := filepath.Join(outputDir, outputBaseName)
+	if g.verbose {
+		fmt.Println("Discovering Go packages recursively...")
+	}
+	discoveredPackages, err := g.discoverGoPackages(".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover Go packages: %w", err)
+	}
+	if g.verbose {
+		fmt.Printf("Found %d Go packages to process\n", len(discoveredPackages))
+	}
+	return discoveredPackages, nil
+}
 
-			// Build the full source file path
-			sourceFilePath := filepath.Join(packagePath, structInfo.SourceFile)
+// discoverPackage discovers the structs with encx tags of a package. It returns no
+// structs for packages marked to skip.
+func (g *Generator) discoverPackage(packagePath string) ([]codegen.StructInfo, error) {
+	if g.verbose {
+		fmt.Printf("Processing package: %s\n", packagePath)
+	}
 
-			// Check if regeneration is needed (incremental generation)
-			needsRegen, err := g.needsRegeneration(sourceFilePath, outputFileName)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to check regeneration need for %s: %v\n", outputFileName, err)
-				needsRegen = true // Default to regeneration on error
-			}
+	// Skip packages marked to skip
+	if g.config.PackageConfig(packagePath).Skip {
+		if g.verbose {
+			fmt.Printf("Skipping package %s (marked as skip)\n", packagePath)
+		}
+		return nil, nil
+	}
+
+	// Discover structs with encx tags
+	discoveryConfig, err := g.config.DiscoveryConfig(packagePath)
+	if err != nil {
+		return nil, err
+	}
+	structs, err := codegen.DiscoverStructs(packagePath, discoveryConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover structs in package %s: %w", packagePath, err)
+	}
+
+	if g.verbose {
+		fmt.Printf("Found %d structs with encx tags in %s\n", len(structs), packagePath)
+	}
+	return structs, nil
+}
+
+// generatePackage generates the code of a package in memory, one file per source file
+func (g *Generator) generatePackage(templateEngine *codegen.TemplateEngine, packagePath string) ([]generatedFile, error) {
+	structs, err := g.discoverPackage(packagePath)
+	if err != nil {
+		return nil, err
+	}
 
-			if !needsRegen && !dryRun {
-				if g.verbose {
-					fmt.Printf("Skipping %s (up to date)\n", outputFileName)
-				}
+	// Group structs by source file, so that each source file gets a single
+	// generated file holding its structs and the structs nested in them
+	var sourceFiles []string
+	structsByFile := make(map[string][]codegen.StructInfo)
+	for _, structInfo := range structs {
+		if _, exists := structsByFile[structInfo.SourceFile]; !exists {
+			sourceFiles = append(sourceFiles, structInfo.SourceFile)
+		}
+		structsByFile[structInfo.SourceFile] = append(structsByFile[structInfo.SourceFile], structInfo)
+	}
+	sort.Strings(sourceFiles)
+
+	var files []generatedFile
+	for _, sourceFile := range sourceFiles {
+		generated, err := g.generateFile(templateEngine, packagePath, sourceFile, structsByFile[sourceFile])
+		if err != nil {
+			return nil, err
+		}
+		dependencyPaths := nestedSourcePaths(packagePath, sourceFile, structsByFile[sourceFile], structs)
+		for i := range generated {
+			generated[i].dependencyPaths = dependencyPaths
+		}
+		files = append(files, generated...)
+	}
+	return files, nil
+}
+
+// nestedSourcePaths returns the paths of the source files, other than sourceFile, that
+// define the structs nested in structs, directly or through other nested structs
+func nestedSourcePaths(packagePath, sourceFile string, structs, allStructs []codegen.StructInfo) []string {
+	byName := make(map[string]codegen.StructInfo, len(allStructs))
+	for _, structInfo := range allStructs {
+		byName[structInfo.StructName] = structInfo
+	}
+
+	seen := make(map[string]bool)
+	files := make(map[string]bool)
+	pending := append([]codegen.StructInfo(nil), structs...)
+	for len(pending) > 0 {
+		structInfo := pending[0]
+		pending = pending[1:]
+		for _, field := range structInfo.Fields {
+			nested, found := byName[field.NestedType]
+			if field.NestedType == "" || !found || seen[nested.StructName] {
 				continue
 			}
+			seen[nested.StructName] = true
+			if nested.SourceFile != sourceFile {
+				files[nested.SourceFile] = true
+			}
+			pending = append(pending, nested)
+		}
+	}
 
-			if dryRun {
-				if needsRegen {
-					fmt.Printf("Would generate: %s\n", outputFileName)
-				} else {
-					fmt.Printf("Would skip: %s (up to date)\n", outputFileName)
-				}
-				if g.verbose {
-					fmt.Printf("Generated code:\n%s\n", string(code))
-				}
-			} else {
-				// Write file
-				if err := os.WriteFile(outputFileName, code, 0644); err != nil {
-					return fmt.Errorf("failed to write generated file %s: %w", outputFileName, err)
-				}
-
-				// Update cache
-				if err := g.updateCache(sourceFilePath, outputFileName); err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: failed to update cache for %s: %v\n", outputFileName, err)
-				}
-
-				if g.verbose {
-					fmt.Printf("Generated: %s\n", outputFileName)
-				}
+	var paths []string
+	for file := range files {
+		paths = append(paths, filepath.Join(packagePath, file))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// reportValidationErrors prints the validation errors of the fields of a struct, and
+// reports whether it has any
+func reportValidationErrors(structInfo codegen.StructInfo) bool {
+	hasErrors := false
+	for _, field := range structInfo.Fields {
+		if !field.IsValid {
+			hasErrors = true
+			for _, errMsg := range field.ValidationErrors {
+				fmt.Fprintf(os.Stderr, "Validation error in %s.%s: %s\n", structInfo.StructName, field.Name, errMsg)
 			}
 		}
 	}
+	return hasErrors
+}
 
-	// Save cache after successful generation
-	if !dryRun {
-		if err := g.saveCache(); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to save cache: %v\n", err)
+// generateFile generates the code of the structs of a source file in memory, and their
+// tests if enabled. It returns no file if no struct of the file can be generated.
+func (g *Generator) generateFile(templateEngine *codegen.TemplateEngine, packagePath, sourceFile string, structs []codegen.StructInfo) ([]generatedFile, error) {
+	var templateData []codegen.TemplateData
+	for _, structInfo := range structs {
+		if g.verbose {
+			fmt.Printf("Generating code for struct: %s\n", structInfo.StructName)
+		}
+
+		if reportValidationErrors(structInfo) {
+			fmt.Fprintf(os.Stderr, "Skipping code generation for struct %s due to validation errors\n", structInfo.StructName)
+			continue
+		}
+
+		// Build template data
+		codegenConfig, err := g.config.ToCodegenConfig(packagePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert config for struct %s: %w", structInfo.StructName, err)
 		}
+		data, err := templateEngine.BuildTemplateData(structInfo, codegenConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build template data for struct %s: %w", structInfo.StructName, err)
+		}
+		templateData = append(templateData, data)
 	}
 
-	fmt.Println("Code generation complete!")
+	if len(templateData) == 0 {
+		return nil, nil
+	}
+
+	// Generate code
+	code, err := templateEngine.GenerateFile(templateData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate code for %s: %w", sourceFile, err)
+	}
+
+	// Determine output file path
+	// Extract just the base filename from the source file
+	baseFileName := filepath.Base(sourceFile)
+	baseFileName = strings.TrimSuffix(baseFileName, ".go")
+
+	// Construct the output filename with suffix
+	outputBaseName := baseFileName + g.config.Generation.OutputSuffix + ".go"
+
+	// Determine the output directory
+	outputDir := packagePath
+	if g.outputDir != "" {
+		outputDir = g.outputDir
+	}
+
+	files := []generatedFile{{
+		sourcePath: filepath.Join(packagePath, sourceFile),
+		outputPath: filepath.Join(outputDir, outputBaseName),
+		code:       code,
+	}}
+
+	// Generate the tests of the structs, next to the generated code. Tests generated by an
+	// earlier run are kept up to date without -tests too, so that they keep compiling.
+	testPath := filepath.Join(outputDir, baseFileName+g.config.Generation.OutputSuffix+"_test.go")
+	if g.tests || isGeneratedTestFile(testPath) {
+		testCode, err := templateEngine.GenerateTestFile(templateData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate tests for %s: %w", sourceFile, err)
+		}
+		if testCode != nil {
+			files = append(files, generatedFile{
+				sourcePath: filepath.Join(packagePath, sourceFile),
+				outputPath: testPath,
+				code:       testCode,
+			})
+		}
+	}
+	return files, nil
+}
+
+// isGeneratedTestFile reports whether path is a test file generated by encx-gen
+func isGeneratedTestFile(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return bytes.HasPrefix(data, []byte("// Code generated by encx-gen. DO NOT EDIT."))
+}
+
+// writeFile writes a generated file to disk, unless it is up to date
+func (g *Generator) writeFile(file generatedFile, dryRun bool) error {
+	outputFileName := file.outputPath
+
+	// Check if regeneration is needed (incremental generation)
+	needsRegen, err := g.needsRegeneration(file.sourcePath, outputFileName, file.dependencyPaths...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to check regeneration need for %s: %v\n", outputFileName, err)
+		needsRegen = true // Default to regeneration on error
+	}
+
+	if !needsRegen && !dryRun {
+		if g.verbose {
+			fmt.Printf("Skipping %s (up to date)\n", outputFileName)
+		}
+		return nil
+	}
+
+	if dryRun {
+		if needsRegen {
+			fmt.Printf("Would generate: %s\n", outputFileName)
+		} else {
+			fmt.Printf("Would skip: %s (up to date)\n", outputFileName)
+		}
+		if g.verbose {
+			fmt.Printf("Generated code:\n%s\n", string(file.code))
+		}
+		return nil
+	}
+
+	// Write file
+	if err := os.WriteFile(outputFileName, file.code, 0644); err != nil {
+		return fmt.Errorf("failed to write generated file %s: %w", outputFileName, err)
+	}
+
+	// Update cache
+	if err := g.updateCache(file.sourcePath, outputFileName, file.dependencyPaths...); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update cache for %s: %v\n", outputFileName, err)
+	}
+
+	if g.verbose {
+		fmt.Printf("Generated: %s\n", outputFileName)
+	}
 	return nil
 }
 
@@ -337,16 +591,39 @@ func (g *Generator) calculateFileHash(filePath string) (string, error) {
 	return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
 
-// needsRegeneration checks if a struct needs to be regenerated
-func (g *Generator) needsRegeneration(sourceFilePath string, outputPath string) (bool, error) {
-	// Check if source file hash changed
+// sourcesHash calculates the hash of a source file and of the source files defining
+// its nested structs
+func (g *Generator) sourcesHash(sourceFilePath string, dependencyPaths []string) (string, error) {
 	sourceHash, err := g.calculateFileHash(sourceFilePath)
+	if err != nil || len(dependencyPaths) == 0 {
+		return sourceHash, err
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(sourceHash))
+	for _, dependencyPath := range dependencyPaths {
+		dependencyHash, err := g.calculateFileHash(dependencyPath)
+		if err != nil {
+			return "", err
+		}
+		hash.Write([]byte(dependencyHash))
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// needsRegeneration checks if a struct needs to be regenerated, because its source
+// file or a source file defining one of its nested structs changed
+func (g *Generator) needsRegeneration(sourceFilePath string, outputPath string, dependencyPaths ...string) (bool, error) {
+	// Check if source file hash changed
+	sourceHash, err := g.sourcesHash(sourceFilePath, dependencyPaths)
 	if err != nil {
 		return true, err // If we can't read the file, regenerate
 	}
 
-	cachedHash, exists := g.cache.SourceHashes[sourceFilePath]
-	if !exists || cachedHash != sourceHash {
+	// Check if generated file info exists in cache. The hash is compared per output file,
+	// as a source file has several, e.g. its generated code and tests.
+	genInfo, exists := g.cache.GeneratedFiles[outputPath]
+	if !exists || genInfo.SourceHash != sourceHash {
 		return true, nil // Source file changed or not in cache
 	}
 
@@ -355,28 +632,24 @@ func (g *Generator) needsRegeneration(sourceFilePath string, outputPath string)
 		return true, nil // Output file doesn't exist
 	}
 
-	// Check if generated file info exists in cache
-	genInfo, exists := g.cache.GeneratedFiles[outputPath]
-	if !exists {
-		return true, nil // Not in cache
-	}
-
-	// Check if the source file is newer than generated file
-	sourceInfo, err := os.Stat(sourceFilePath)
-	if err != nil {
-		return true, err
-	}
+	// Check if the source files are newer than generated file
+	for _, path := range append([]string{sourceFilePath}, dependencyPaths...) {
+		sourceInfo, err := os.Stat(path)
+		if err != nil {
+			return true, err
+		}
 
-	if sourceInfo.ModTime().After(genInfo.GeneratedTime) {
-		return true, nil // Source file is newer
+		if sourceInfo.ModTime().After(genInfo.GeneratedTime) {
+			return true, nil // Source file is newer
+		}
 	}
 
 	return false, nil // No regeneration needed
 }
 
 // updateCache updates the cache with new file information
-func (g *Generator) updateCache(sourceFilePath string, outputPath string) error {
-	sourceHash, err := g.calculateFileHash(sourceFilePath)
+func (g *Generator) updateCache(sourceFilePath string, outputPath string, dependencyPaths ...string) error {
+	sourceHash, err := g.sourcesHash(sourceFilePath, dependencyPaths)
 	if err != nil {
 		return err
 	}
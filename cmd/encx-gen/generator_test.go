@@ -3,6 +3,8 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -111,6 +113,44 @@ type User struct {
 	assert.Contains(t, contentStr, "func DecryptUserEncx")
 }
 
+func TestGenerateMultipleStructsPerFile(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Create test source file with a nested struct and two top-level structs
+	sourceFile := filepath.Join(tempDir, "patient.go")
+	err := os.WriteFile(sourceFile, []byte(`package test
+
+type Address struct {
+	Street string `+"`encx:\"encrypt\"`"+`
+}
+
+type Patient struct {
+	SSN         string `+"`encx:\"encrypt\"`"+`
+	HomeAddress Address
+}
+
+type Visit struct {
+	Notes string `+"`encx:\"encrypt\"`"+`
+}
+`), 0644)
+	require.NoError(t, err)
+
+	generator := NewGenerator("", tempDir, false)
+
+	err = generator.Generate([]string{tempDir}, false)
+	require.NoError(t, err)
+
+	// All structs of the source file are generated into a single file
+	content, err := os.ReadFile(filepath.Join(tempDir, "patient_encx.go"))
+	require.NoError(t, err)
+
+	contentStr := string(content)
+	assert.Contains(t, contentStr, "func processAddressEncx")
+	assert.Contains(t, contentStr, "func ProcessPatientEncx")
+	assert.Contains(t, contentStr, "func ProcessVisitEncx")
+	assert.Contains(t, contentStr, "HomeAddress AddressEncx")
+}
+
 func TestGenerateWithValidationErrors(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -371,4 +411,257 @@ type User struct {
 
 	// File should have been modified (regeneration triggered by source change)
 	assert.True(t, info3.ModTime().After(info2.ModTime()), "File should be regenerated when source changes")
-}
\ No newline at end of file
+}
+func TestIncrementalGenerationWithNestedStructs(t *testing.T) {
+	tempDir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(tempDir, "patient.go"), []byte(`package test
+
+type Patient struct {
+	SSN  string `+"`encx:\"encrypt\"`"+`
+	Home Address
+}
+`), 0644)
+	require.NoError(t, err)
+
+	addressFile := filepath.Join(tempDir, "address.go")
+	writeAddress := func(tag string) {
+		err := os.WriteFile(addressFile, []byte(`package test
+
+type Address struct {
+	Street string `+tag+`
+	City   string
+}
+`), 0644)
+		require.NoError(t, err)
+	}
+	writeAddress("")
+
+	generator := NewGenerator("", tempDir, false)
+	require.NoError(t, generator.Generate([]string{tempDir}, false))
+
+	patientOutput := filepath.Join(tempDir, "patient_encx.go")
+	content, err := os.ReadFile(patientOutput)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "Home Address `")
+
+	// Tagging the struct in its own file makes it nested, and regenerates the enclosing struct
+	writeAddress("`encx:\"encrypt\"`")
+	generator = NewGenerator("", tempDir, false)
+	require.NoError(t, generator.Generate([]string{tempDir}, false))
+
+	content, err = os.ReadFile(patientOutput)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "Home AddressEncx `")
+	modTime := fileModTime(t, patientOutput)
+
+	// Later changes of the nested struct are tracked too
+	time.Sleep(10 * time.Millisecond)
+	writeAddress("`encx:\"encrypt,hash_basic\"`")
+	generator = NewGenerator("", tempDir, false)
+	require.NoError(t, generator.Generate([]string{tempDir}, false))
+	assert.True(t, fileModTime(t, patientOutput).After(modTime), "enclosing struct should be regenerated when a nested struct changes")
+}
+
+func fileModTime(t *testing.T, path string) time.Time {
+	t.Helper()
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	return info.ModTime()
+}
+
+func TestGenerateWithCustomTemplates(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceFile := filepath.Join(tempDir, "user.go")
+	err := os.WriteFile(sourceFile, []byte(`package test
+
+type User struct {
+	Email string `+"`json:\"email\" encx:\"encrypt\"`"+`
+}
+`), 0644)
+	require.NoError(t, err)
+
+	templatesDir := filepath.Join(tempDir, "templates")
+	require.NoError(t, os.Mkdir(templatesDir, 0755))
+	templateFile := filepath.Join(templatesDir, "decrypt_step.tmpl")
+	require.NoError(t, os.WriteFile(templateFile, []byte("\n\t// Custom decryption of {{.FieldName}}"), 0644))
+
+	configFile := filepath.Join(tempDir, "encx.yaml")
+	err = os.WriteFile(configFile, []byte(`
+generation:
+  output_suffix: "_encx"
+  package_name: "encx"
+  templates_dir: "templates"
+`), 0644)
+	require.NoError(t, err)
+
+	generator := NewGenerator(configFile, tempDir, false)
+	require.NoError(t, generator.Generate([]string{tempDir}, false))
+
+	generatedFile := filepath.Join(tempDir, "user_encx.go")
+	content, err := os.ReadFile(generatedFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "// Custom decryption of Email")
+
+	// Changing the templates regenerates unchanged sources
+	require.NoError(t, os.WriteFile(templateFile, []byte("\n\t// Updated decryption of {{.FieldName}}"), 0644))
+
+	generator = NewGenerator(configFile, tempDir, false)
+	require.NoError(t, generator.Generate([]string{tempDir}, false))
+
+	content, err = os.ReadFile(generatedFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "// Updated decryption of Email")
+}
+
+func TestGenerateWithTests(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceFile := filepath.Join(tempDir, "user.go")
+	err := os.WriteFile(sourceFile, []byte(`package test
+
+type User struct {
+	Email string `+"`json:\"email\" encx:\"encrypt,hash_basic\"`"+`
+}
+`), 0644)
+	require.NoError(t, err)
+
+	configFile := filepath.Join(tempDir, "encx.yaml")
+	err = os.WriteFile(configFile, []byte(`
+generation:
+  output_suffix: "_encx"
+  package_name: "encx"
+`), 0644)
+	require.NoError(t, err)
+
+	// Tests are opt-in
+	generator := NewGenerator(configFile, tempDir, false)
+	require.NoError(t, generator.Generate([]string{tempDir}, false))
+	assert.FileExists(t, filepath.Join(tempDir, "user_encx.go"))
+	assert.NoFileExists(t, filepath.Join(tempDir, "user_encx_test.go"))
+
+	generator = NewGenerator(configFile, tempDir, false)
+	generator.tests = true
+	require.NoError(t, generator.Generate([]string{tempDir}, false))
+
+	content, err := os.ReadFile(filepath.Join(tempDir, "user_encx_test.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "func TestUserEncxRoundTrip(t *testing.T)")
+	assert.Contains(t, string(content), "func FuzzUserEncx(f *testing.F)")
+
+	// Generated tests are kept in sync with the source without -tests
+	err = os.WriteFile(sourceFile, []byte(`package test
+
+type User struct {
+	Mail string `+"`json:\"email\" encx:\"encrypt,hash_basic\"`"+`
+}
+`), 0644)
+	require.NoError(t, err)
+	generator = NewGenerator(configFile, tempDir, false)
+	require.NoError(t, generator.Generate([]string{tempDir}, false))
+
+	content, err = os.ReadFile(filepath.Join(tempDir, "user_encx_test.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "source.Mail")
+	assert.NotContains(t, string(content), "source.Email")
+}
+
+func TestGenerateWithConfiguredTags(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceFile := filepath.Join(tempDir, "user.pb.go")
+	err := os.WriteFile(sourceFile, []byte(`package test
+
+type User struct {
+	Email string `+"`protobuf:\"bytes,1,opt,name=email,proto3\" json:\"email,omitempty\"`"+`
+}
+`), 0644)
+	require.NoError(t, err)
+
+	configFile := filepath.Join(tempDir, "encx.yaml")
+	err = os.WriteFile(configFile, []byte(`
+generation:
+  output_suffix: "_encx"
+  package_name: "encx"
+packages:
+  `+tempDir+`:
+    tags:
+      User:
+        Email: encrypt,hash_basic
+`), 0644)
+	require.NoError(t, err)
+
+	generator := NewGenerator(configFile, tempDir, false)
+	require.NoError(t, generator.Generate([]string{tempDir}, false))
+
+	content, err := os.ReadFile(filepath.Join(tempDir, "user.pb_encx.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "EmailEncrypted []byte")
+	assert.Contains(t, string(content), "EmailHash string")
+}
+
+func TestCheck(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceFile := filepath.Join(tempDir, "user.go")
+	err := os.WriteFile(sourceFile, []byte(`package test
+
+type User struct {
+	Email string `+"`json:\"email\" encx:\"encrypt\"`"+`
+}
+`), 0644)
+	require.NoError(t, err)
+
+	generator := NewGenerator("", tempDir, false)
+	generatedFile := filepath.Join(tempDir, "user_encx.go")
+
+	// A missing generated file is drift
+	var out strings.Builder
+	drift, err := generator.Check([]string{tempDir}, &out)
+	require.NoError(t, err)
+	assert.True(t, drift)
+	assert.Contains(t, out.String(), generatedFile+": missing")
+
+	require.NoError(t, generator.Generate([]string{tempDir}, false))
+
+	out.Reset()
+	drift, err = generator.Check([]string{tempDir}, &out)
+	require.NoError(t, err)
+	assert.False(t, drift)
+	assert.Empty(t, out.String())
+
+	// The stamp of files generated by older versions is ignored
+	content, err := os.ReadFile(generatedFile)
+	require.NoError(t, err)
+	stamped := regexp.MustCompile(`// Generated: .*`).ReplaceAll(content, []byte("// Generated: 2024-01-01T00:00:00Z"))
+	require.NoError(t, os.WriteFile(generatedFile, stamped, 0644))
+
+	drift, err = generator.Check([]string{tempDir}, &out)
+	require.NoError(t, err)
+	assert.False(t, drift)
+
+	// A source change is reported as a unified diff
+	err = os.WriteFile(sourceFile, []byte(`package test
+
+type User struct {
+	Email string `+"`json:\"email\" encx:\"encrypt,hash_basic\"`"+`
+}
+`), 0644)
+	require.NoError(t, err)
+
+	out.Reset()
+	drift, err = generator.Check([]string{tempDir}, &out)
+	require.NoError(t, err)
+	assert.True(t, drift)
+	assert.Contains(t, out.String(), "--- "+generatedFile+"\n")
+	assert.Contains(t, out.String(), "+++ "+generatedFile+" (regenerated)\n")
+	assert.Contains(t, out.String(), "+\tEmailHash string")
+	assert.NotContains(t, out.String(), "// Generated:")
+}
+
+func TestStripGeneratedStamp(t *testing.T) {
+	code := "// Code generated by encx-gen. DO NOT EDIT.\n// Source: user.go\n// Generated: sha256:abc\n\npackage test\n"
+	assert.Equal(t, "// Code generated by encx-gen. DO NOT EDIT.\n// Source: user.go\n\npackage test\n", stripGeneratedStamp(code))
+	assert.Equal(t, "package test\n", stripGeneratedStamp("package test\n"))
+}
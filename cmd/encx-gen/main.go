@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/hengadev/encx/internal/codegen"
+	"github.com/hengadev/encx/internal/schema"
 )
 
 func main() {
@@ -20,6 +24,12 @@ func main() {
 		generateCommand(os.Args[2:])
 	case "validate":
 		validateCommand(os.Args[2:])
+	case "check":
+		checkCommand(os.Args[2:])
+	case "watch":
+		watchCommand(os.Args[2:])
+	case "schema":
+		schemaCommand(os.Args[2:])
 	case "init":
 		initCommand(os.Args[2:])
 	case "version":
@@ -36,6 +46,9 @@ func printUsage() {
 	fmt.Fprintf(os.Stderr, "\nCommands:\n")
 	fmt.Fprintf(os.Stderr, "  generate  Generate encx code for structs\n")
 	fmt.Fprintf(os.Stderr, "  validate  Validate configuration and struct tags\n")
+	fmt.Fprintf(os.Stderr, "  check     Check that generated files match their sources\n")
+	fmt.Fprintf(os.Stderr, "  watch     Regenerate encx code when source files change\n")
+	fmt.Fprintf(os.Stderr, "  schema    Generate SQL DDL and migrations for encx structs\n")
 	fmt.Fprintf(os.Stderr, "  init      Initialize configuration file\n")
 	fmt.Fprintf(os.Stderr, "  version   Show version information\n")
 	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for help on a specific command.\n", os.Args[0])
@@ -47,6 +60,7 @@ func generateCommand(args []string) {
 	outputDir := fs.String("output", "", "Override output directory")
 	verbose := fs.Bool("v", false, "Verbose output")
 	dryRun := fs.Bool("dry-run", false, "Show what would be generated without writing files")
+	tests := fs.Bool("tests", false, "Also generate round-trip and fuzz tests for each struct")
 
 	fs.Parse(args)
 
@@ -56,6 +70,7 @@ func generateCommand(args []string) {
 	}
 
 	generator := NewGenerator(*configPath, *outputDir, *verbose)
+	generator.tests = *tests
 	err := generator.Generate(packages, *dryRun)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Generation failed: %v\n", err)
@@ -93,14 +108,28 @@ func validateCommand(args []string) {
 		fmt.Println("✓ Configuration file is valid")
 	}
 
-	// Validate struct tags in packages
+	// Validate custom templates
 	hasErrors := false
+	if config.Generation.TemplatesDir != "" {
+		templateEngine, err := codegen.NewTemplateEngineFromDir(config.Generation.TemplatesDir)
+		if err == nil {
+			err = templateEngine.Validate()
+		}
+		if err != nil {
+			fmt.Printf("✗ Custom templates in %s: %v\n", config.Generation.TemplatesDir, err)
+			hasErrors = true
+		} else {
+			fmt.Printf("✓ Custom templates in %s are valid\n", config.Generation.TemplatesDir)
+		}
+	}
+
+	// Validate struct tags in packages
 	for _, pkg := range packages {
 		if *verbose {
 			fmt.Printf("Validating package: %s\n", pkg)
 		}
 
-		discoveryConfig := &codegen.DiscoveryConfig{}
+		discoveryConfig, _ := config.DiscoveryConfig(pkg) // Validated with the configuration
 		structs, err := codegen.DiscoverStructs(pkg, discoveryConfig)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to discover structs in %s: %v\n", pkg, err)
@@ -150,6 +179,129 @@ func validateCommand(args []string) {
 	fmt.Println("\n✓ All validations passed!")
 }
 
+func checkCommand(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	configPath := fs.String("config", "encx.yaml", "Path to configuration file")
+	outputDir := fs.String("output", "", "Override output directory")
+	verbose := fs.Bool("v", false, "Verbose output")
+	tests := fs.Bool("tests", false, "Also check the generated round-trip and fuzz tests")
+
+	fs.Parse(args)
+
+	packages := fs.Args()
+	if len(packages) == 0 {
+		packages = []string{"."} // Current directory
+	}
+
+	generator := NewGenerator(*configPath, *outputDir, *verbose)
+	generator.tests = *tests
+	drift, err := generator.Check(packages, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Check failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	if drift {
+		fmt.Fprintf(os.Stderr, "\nGenerated files are out of date. Run 'encx-gen generate' and commit the result.\n")
+		os.Exit(1)
+	}
+
+	fmt.Println("✓ All generated files are up to date")
+}
+
+func watchCommand(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	configPath := fs.String("config", "encx.yaml", "Path to configuration file")
+	outputDir := fs.String("output", "", "Override output directory")
+	verbose := fs.Bool("v", false, "Verbose output")
+	debounce := fs.Duration("debounce", DefaultWatchDebounce, "Time to wait after the last change before regenerating")
+	tests := fs.Bool("tests", false, "Also generate round-trip and fuzz tests for each struct")
+
+	fs.Parse(args)
+
+	packages := fs.Args()
+	if len(packages) == 0 {
+		packages = []string{"."} // Current directory
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	generator := NewGenerator(*configPath, *outputDir, *verbose)
+	generator.tests = *tests
+	if err := generator.Watch(ctx, packages, *debounce); err != nil {
+		fmt.Fprintf(os.Stderr, "Watch failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func schemaCommand(args []string) {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	configPath := fs.String("config", "encx.yaml", "Path to configuration file")
+	dialectName := fs.String("dialect", "postgres", "SQL dialect: postgres, mysql or sqlite")
+	snapshotPath := fs.String("snapshot", "", "Schema snapshot to migrate from, updated after generation")
+	outputPath := fs.String("o", "", "Write the migration to a file instead of stdout")
+	verbose := fs.Bool("v", false, "Verbose output")
+
+	fs.Parse(args)
+
+	packages := fs.Args()
+	if len(packages) == 0 {
+		packages = []string{"."} // Current directory
+	}
+
+	dialect := schema.ParseDatabaseType(*dialectName)
+	if !dialect.IsValid() {
+		fmt.Fprintf(os.Stderr, "Unsupported dialect: %s (expected postgres, mysql or sqlite)\n", *dialectName)
+		os.Exit(1)
+	}
+
+	var previous *schema.Snapshot
+	if *snapshotPath != "" {
+		var err error
+		previous, err = loadSnapshot(*snapshotPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load snapshot: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	generator := NewGenerator(*configPath, "", *verbose)
+	current, err := generator.Schema(packages, dialect)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Schema generation failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	statements, err := schema.Migrate(previous, current)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	output := os.Stdout
+	if *outputPath != "" {
+		output, err = os.Create(*outputPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create output file: %v\n", err)
+			os.Exit(1)
+		}
+		defer output.Close()
+	}
+
+	if err := writeMigration(output, dialect, statements); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write migration: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *snapshotPath != "" {
+		if err := saveSnapshot(current, *snapshotPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save snapshot: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
 func initCommand(args []string) {
 	fs := flag.NewFlagSet("init", flag.ExitOnError)
 	force := fs.Bool("force", false, "Overwrite existing configuration file")
@@ -180,11 +332,12 @@ func versionCommand() {
 	fmt.Println("Code generator for encx encryption library")
 	fmt.Println("")
 	fmt.Println("Features:")
-	fmt.Println("  - AST-based struct discovery")
+	fmt.Println("  - Type-checked struct discovery")
 	fmt.Println("  - Incremental generation with caching")
 	fmt.Println("  - Comprehensive tag validation")
 	fmt.Println("  - Cross-database JSON metadata support")
 	fmt.Println("  - Template-based code generation")
+	fmt.Println("  - SQL schema and migration generation")
 	fmt.Println("")
 	fmt.Println("Supported tags: encrypt, hash_basic, hash_secure")
 	fmt.Println("Supported databases: PostgreSQL, SQLite, MySQL")
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hengadev/encx/internal/codegen"
+	"github.com/hengadev/encx/internal/schema"
+)
+
+// Schema returns the schema of the tables storing the Encx types of the top-level
+// structs of the specified packages. Each table is named after the table option of
+// the struct, e.g. //encx:options table=users, or after its Encx type, e.g. user_encx.
+func (g *Generator) Schema(packages []string, dialect schema.DatabaseType) (schema.Snapshot, error) {
+	snapshot := schema.Snapshot{Dialect: dialect}
+
+	templateEngine, err := g.newTemplateEngine()
+	if err != nil {
+		return snapshot, fmt.Errorf("failed to create template engine: %w", err)
+	}
+	packages, err = g.expandPackages(packages)
+	if err != nil {
+		return snapshot, err
+	}
+
+	tableStructs := make(map[string]string)
+	for _, packagePath := range packages {
+		structs, err := g.discoverPackage(packagePath)
+		if err != nil {
+			return snapshot, err
+		}
+		codegenConfig, err := g.config.ToCodegenConfig(packagePath)
+		if err != nil {
+			return snapshot, fmt.Errorf("failed to convert config: %w", err)
+		}
+
+		for _, structInfo := range structs {
+			// Nested structs are stored in the tables of the structs they are nested in
+			if structInfo.IsNested {
+				continue
+			}
+			if reportValidationErrors(structInfo) {
+				fmt.Fprintf(os.Stderr, "Skipping table of struct %s due to validation errors\n", structInfo.StructName)
+				continue
+			}
+
+			data, err := templateEngine.BuildTemplateData(structInfo, codegenConfig)
+			if err != nil {
+				return snapshot, fmt.Errorf("failed to build template data for struct %s: %w", structInfo.StructName, err)
+			}
+
+			table := buildTable(data, tableName(structInfo), dialect)
+			if other, exists := tableStructs[table.Name]; exists {
+				return snapshot, fmt.Errorf("structs %s and %s are both stored in table %s", other, structInfo.StructName, table.Name)
+			}
+			tableStructs[table.Name] = structInfo.StructName
+			snapshot.Tables = append(snapshot.Tables, table)
+		}
+	}
+
+	sort.Slice(snapshot.Tables, func(i, j int) bool {
+		return snapshot.Tables[i].Name < snapshot.Tables[j].Name
+	})
+	return snapshot, nil
+}
+
+// tableName returns the table storing the Encx type of a struct
+func tableName(structInfo codegen.StructInfo) string {
+	if table := structInfo.GenerationOptions["table"]; table != "" {
+		return table
+	}
+	return codegen.ToSnakeCase(structInfo.StructName) + "_encx"
+}
+
+// buildTable returns the table storing the columns of the Encx type of a struct
+func buildTable(data codegen.TemplateData, name string, dialect schema.DatabaseType) schema.Table {
+	table := schema.Table{Name: name}
+
+	for _, field := range data.PlainFields {
+		if field.DBColumn == "-" {
+			continue // Not stored, as in the source struct
+		}
+		column := dialect.ColumnForGoType(field.DBColumn, field.StoredType())
+		if field.DBColumn == "id" {
+			column.PrimaryKey = true
+			if dialect == schema.MySQL && column.Type == "TEXT" {
+				column.Type = "VARCHAR(255)" // MySQL cannot index TEXT columns without a prefix length
+			}
+		}
+		table.Columns = append(table.Columns, column)
+	}
+
+	// Companion fields are named after their field and the suffix of their tag, whatever
+	// the naming strategy of their columns
+	for _, field := range data.EncryptedFields {
+		switch {
+		case strings.HasSuffix(field.Name, "Encrypted"):
+			table.Columns = append(table.Columns, schema.Column{Name: field.DBColumn, Type: dialect.GetBlobColumnType()})
+		case strings.HasSuffix(field.Name, "HashSecure"):
+			table.Columns = append(table.Columns, schema.Column{Name: field.DBColumn, Type: "TEXT"})
+		case strings.HasSuffix(field.Name, "Hash"):
+			table.Columns = append(table.Columns, schema.Column{Name: field.DBColumn, Type: dialect.GetHashColumnType()})
+			table.Indexes = append(table.Indexes, schema.Index{Name: "idx_" + name + "_" + field.DBColumn, Column: field.DBColumn})
+		default:
+			// Companion fields of user-defined operations
+			table.Columns = append(table.Columns, dialect.ColumnForGoType(field.DBColumn, field.Type))
+		}
+	}
+
+	for _, field := range data.NestedFields {
+		table.Columns = append(table.Columns, schema.Column{
+			Name:  field.DBColumn,
+			Type:  dialect.GetJSONColumnType(),
+			Check: dialect.GetNullableJSONValidationConstraint(dialect.QuoteIdentifier(field.DBColumn)),
+		})
+	}
+
+	table.Columns = append(table.Columns,
+		schema.Column{Name: "dek_encrypted", Type: dialect.GetBlobColumnType(), NotNull: true},
+		schema.Column{Name: "key_version", Type: dialect.GetIntegerColumnType(), NotNull: true},
+		schema.Column{
+			Name:    "metadata",
+			Type:    dialect.GetJSONColumnType(),
+			NotNull: true,
+			Default: dialect.GetJSONDefault(),
+			Check:   dialect.GetJSONValidationConstraint("metadata"),
+		},
+	)
+
+	return table
+}
+
+// loadSnapshot loads a schema snapshot. It returns nil if the file does not exist.
+func loadSnapshot(path string) (*schema.Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var snapshot schema.Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", path, err)
+	}
+	return &snapshot, nil
+}
+
+// saveSnapshot saves a schema snapshot
+func saveSnapshot(snapshot schema.Snapshot, path string) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// writeMigration writes the statements of a migration as a SQL script
+func writeMigration(w io.Writer, dialect schema.DatabaseType, statements []string) error {
+	script := fmt.Sprintf("-- Generated by encx-gen schema for %s\n", dialect)
+	if len(statements) == 0 {
+		script += "-- No schema changes\n"
+	}
+	for _, statement := range statements {
+		script += "\n" + statement + "\n"
+	}
+
+	_, err := io.WriteString(w, script)
+	return err
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hengadev/encx/internal/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchema(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceFile := filepath.Join(tempDir, "user.go")
+	err := os.WriteFile(sourceFile, []byte(`package test
+
+type Address struct {
+	Street string `+"`encx:\"encrypt\"`"+`
+}
+
+//encx:options table=users
+type User struct {
+	ID       int
+	Email    string `+"`encx:\"encrypt,hash_basic\"`"+`
+	Password string `+"`encx:\"hash_secure\"`"+`
+	Home     Address
+}
+
+type AuditLog struct {
+	Message string `+"`encx:\"encrypt\"`"+`
+}
+`), 0644)
+	require.NoError(t, err)
+
+	generator := NewGenerator("", tempDir, false)
+	snapshot, err := generator.Schema([]string{tempDir}, schema.SQLite)
+	require.NoError(t, err)
+
+	// Nested structs are stored in the tables of their enclosing structs
+	require.Len(t, snapshot.Tables, 2)
+	assert.Equal(t, "audit_log_encx", snapshot.Tables[0].Name)
+
+	users := snapshot.Tables[1]
+	assert.Equal(t, "users", users.Name)
+	assert.Equal(t, []schema.Column{
+		{Name: "id", Type: "INTEGER", PrimaryKey: true},
+		{Name: "email_encrypted", Type: "BLOB"},
+		{Name: "email_hash", Type: "TEXT"},
+		{Name: "password_hash_secure", Type: "TEXT"},
+		{Name: "home", Type: "TEXT", Check: "CHECK (home IS NULL OR json_valid(home))"},
+		{Name: "dek_encrypted", Type: "BLOB", NotNull: true},
+		{Name: "key_version", Type: "INTEGER", NotNull: true},
+		{Name: "metadata", Type: "TEXT", NotNull: true, Default: "'{}'", Check: "CHECK (json_valid(metadata))"},
+	}, users.Columns)
+	assert.Equal(t, []schema.Index{{Name: "idx_users_email_hash", Column: "email_hash"}}, users.Indexes)
+
+	// Snapshots round-trip and diff into incremental migrations
+	snapshotPath := filepath.Join(tempDir, "schema.json")
+	previous, err := loadSnapshot(snapshotPath)
+	require.NoError(t, err)
+	assert.Nil(t, previous)
+
+	require.NoError(t, saveSnapshot(snapshot, snapshotPath))
+	previous, err = loadSnapshot(snapshotPath)
+	require.NoError(t, err)
+	assert.Equal(t, snapshot, *previous)
+
+	err = os.WriteFile(sourceFile, []byte(`package test
+
+//encx:options table=users
+type User struct {
+	ID    int
+	Email string `+"`encx:\"encrypt,hash_basic\"`"+`
+	Phone string `+"`encx:\"encrypt,hash_basic\"`"+`
+}
+`), 0644)
+	require.NoError(t, err)
+
+	current, err := generator.Schema([]string{tempDir}, schema.SQLite)
+	require.NoError(t, err)
+	statements, err := schema.Migrate(previous, current)
+	require.NoError(t, err)
+
+	var out strings.Builder
+	require.NoError(t, writeMigration(&out, schema.SQLite, statements))
+	migration := out.String()
+	assert.Contains(t, migration, "-- Generated by encx-gen schema for sqlite\n")
+	assert.Contains(t, migration, "ALTER TABLE users ADD COLUMN phone_encrypted BLOB;")
+	assert.Contains(t, migration, "CREATE INDEX idx_users_phone_hash ON users (phone_hash);")
+	assert.Contains(t, migration, "-- ALTER TABLE users DROP COLUMN home;")
+	assert.Contains(t, migration, "-- DROP TABLE audit_log_encx;")
+}
+
+func TestSchemaColumnTypes(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "go.mod"), []byte("module example.com/test\n\ngo 1.23\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "user.go"), []byte(`package test
+
+import "database/sql"
+
+type Status string
+
+type User struct {
+	Email   string `+"`encx:\"encrypt\"`"+`
+	Status  Status
+	Nick    sql.NullString
+	Deleted sql.NullTime
+	Tags    []string
+}
+`), 0644))
+
+	generator := NewGenerator("", tempDir, false)
+	snapshot, err := generator.Schema([]string{tempDir}, schema.PostgreSQL)
+	require.NoError(t, err)
+	require.Len(t, snapshot.Tables, 1)
+
+	// Columns are mapped from the resolved types, as the SQL helpers store them
+	columns := map[string]string{}
+	for _, column := range snapshot.Tables[0].Columns {
+		columns[column.Name] = column.Type
+	}
+	assert.Equal(t, "TEXT", columns["status"])
+	assert.Equal(t, "TEXT", columns["nick"])
+	assert.Equal(t, "TIMESTAMP WITH TIME ZONE", columns["deleted"])
+	assert.Equal(t, "JSONB", columns["tags"])
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/hengadev/encx/internal/codegen"
+)
+
+// DefaultWatchDebounce is the time to wait after the last change before regenerating
+const DefaultWatchDebounce = 300 * time.Millisecond
+
+// Watch generates code for the specified packages, then watches their directories and
+// regenerates the packages whose source files change, until ctx is cancelled.
+//
+// Changes are debounced, so that saving several files at once regenerates once, and
+// source files that did not change are skipped through the generation cache.
+// Discovery and validation errors are printed, and watching continues.
+func (g *Generator) Watch(ctx context.Context, packages []string, debounce time.Duration) error {
+	templateEngine, err := g.newTemplateEngine()
+	if err != nil {
+		return fmt.Errorf("failed to create template engine: %w", err)
+	}
+
+	packages, err = g.expandPackages(packages)
+	if err != nil {
+		return err
+	}
+
+	if err := g.loadCache(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to load cache: %v\n", err)
+	}
+	g.checkConfigHash(templateEngine)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	// Map the watched directories back to the package paths they were given as
+	packagesByDir := make(map[string]string, len(packages))
+	for _, packagePath := range packages {
+		if err := watcher.Add(packagePath); err != nil {
+			return fmt.Errorf("failed to watch package %s: %w", packagePath, err)
+		}
+		packagesByDir[filepath.Clean(packagePath)] = packagePath
+	}
+
+	g.regenerate(templateEngine, packages)
+	fmt.Printf("Watching %d packages for changes...\n", len(packages))
+
+	pending := make(map[string]bool)
+	var timer *time.Timer
+	var fire <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod || !g.isWatchedSource(event.Name) {
+				continue
+			}
+
+			packagePath, found := packagesByDir[filepath.Dir(event.Name)]
+			if !found {
+				continue
+			}
+			pending[packagePath] = true
+
+			// Restart the debounce period on every change
+			if timer == nil {
+				timer = time.NewTimer(debounce)
+			} else {
+				timer.Stop()
+				timer.Reset(debounce)
+			}
+			fire = timer.C
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "Watch error: %v\n", err)
+
+		case <-fire:
+			fire = nil
+
+			var changed []string
+			for packagePath := range pending {
+				changed = append(changed, packagePath)
+			}
+			sort.Strings(changed)
+			pending = make(map[string]bool)
+
+			fmt.Printf("[%s] Change detected in %s\n", time.Now().Format("15:04:05"), strings.Join(changed, ", "))
+			g.regenerate(templateEngine, changed)
+		}
+	}
+}
+
+// regenerate generates the code of the packages and saves the cache. Errors are
+// printed rather than returned, so that watching continues.
+func (g *Generator) regenerate(templateEngine *codegen.TemplateEngine, packages []string) {
+	for _, packagePath := range packages {
+		files, err := g.generatePackage(templateEngine, packagePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			continue
+		}
+
+		for _, file := range files {
+			if err := g.writeFile(file, false); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+		}
+	}
+
+	if err := g.saveCache(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save cache: %v\n", err)
+	}
+}
+
+// isWatchedSource reports whether a file is a Go source file that generation depends on.
+// Test files and generated files are ignored, so that writing generated code does not
+// trigger another generation.
+func (g *Generator) isWatchedSource(path string) bool {
+	return strings.HasSuffix(path, ".go") &&
+		!strings.HasSuffix(path, "_test.go") &&
+		!strings.HasSuffix(path, g.config.Generation.OutputSuffix+".go")
+}
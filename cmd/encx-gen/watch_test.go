@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceFile := filepath.Join(tempDir, "user.go")
+	writeSource := func(tags string) {
+		err := os.WriteFile(sourceFile, []byte(`package test
+
+type User struct {
+	Email string `+"`json:\"email\" encx:\""+tags+"\"`"+`
+}
+`), 0644)
+		require.NoError(t, err)
+	}
+	writeSource("encrypt")
+
+	generator := NewGenerator("", tempDir, false)
+	generatedFile := filepath.Join(tempDir, "user_encx.go")
+	generatedContains := func(s string) func() bool {
+		return func() bool {
+			content, err := os.ReadFile(generatedFile)
+			return err == nil && strings.Contains(string(content), s)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- generator.Watch(ctx, []string{tempDir}, 10*time.Millisecond)
+	}()
+
+	// Code is generated when watching starts
+	require.Eventually(t, generatedContains("EmailEncrypted"), 5*time.Second, 10*time.Millisecond)
+
+	// Source changes are regenerated
+	writeSource("encrypt,hash_basic")
+	require.Eventually(t, generatedContains("EmailHash"), 5*time.Second, 10*time.Millisecond)
+
+	// Validation errors do not stop watching
+	writeSource("encrypt,unknown")
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("watch stopped on a validation error: %v", err)
+	default:
+	}
+
+	writeSource("hash_secure")
+	require.Eventually(t, generatedContains("EmailHashSecure"), 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not stop when the context was cancelled")
+	}
+}
+
+func TestWatchNestedStructInOtherFile(t *testing.T) {
+	tempDir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(tempDir, "patient.go"), []byte(`package test
+
+type Patient struct {
+	SSN  string `+"`encx:\"encrypt\"`"+`
+	Home Address
+}
+`), 0644)
+	require.NoError(t, err)
+
+	addressFile := filepath.Join(tempDir, "address.go")
+	writeAddress := func(tag string) {
+		err := os.WriteFile(addressFile, []byte(`package test
+
+type Address struct {
+	Street string `+tag+`
+}
+`), 0644)
+		require.NoError(t, err)
+	}
+	writeAddress("")
+
+	generator := NewGenerator("", tempDir, false)
+	patientOutput := filepath.Join(tempDir, "patient_encx.go")
+	patientContains := func(s string) func() bool {
+		return func() bool {
+			content, err := os.ReadFile(patientOutput)
+			return err == nil && strings.Contains(string(content), s)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- generator.Watch(ctx, []string{tempDir}, 10*time.Millisecond)
+	}()
+
+	require.Eventually(t, patientContains("Home Address `"), 5*time.Second, 10*time.Millisecond)
+
+	// Editing the nested struct in its own file regenerates the enclosing struct
+	writeAddress("`encx:\"encrypt\"`")
+	require.Eventually(t, patientContains("Home AddressEncx `"), 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not stop when the context was cancelled")
+	}
+}
+
+func TestIsWatchedSource(t *testing.T) {
+	generator := NewGenerator("", "", false)
+
+	assert.True(t, generator.isWatchedSource("models/user.go"))
+	assert.False(t, generator.isWatchedSource("models/user_encx.go"))
+	assert.False(t, generator.isWatchedSource("models/user_test.go"))
+	assert.False(t, generator.isWatchedSource("models/.encx-gen-cache.json"))
+	assert.False(t, generator.isWatchedSource("models/user.go.swp"))
+}
@@ -0,0 +1,32 @@
+package encx_test
+
+import (
+	"testing"
+
+	"github.com/hengadev/encx"
+	"github.com/hengadev/encx/encxtest"
+)
+
+func TestSimpleTestKMS_Conformance(t *testing.T) {
+	encxtest.RunKMSConformance(t, func(t *testing.T) encx.KeyManagementService {
+		return encx.NewSimpleTestKMS()
+	})
+}
+
+func TestInMemorySecretStore_Conformance(t *testing.T) {
+	encxtest.RunSecretStoreConformance(t, func(t *testing.T) encx.SecretManagementService {
+		return encx.NewInMemorySecretStore()
+	})
+}
+
+func TestFaultyKMS_Conformance(t *testing.T) {
+	encxtest.RunKMSConformance(t, func(t *testing.T) encx.KeyManagementService {
+		return encx.NewFaultyKMS(nil, encx.FaultConfig{})
+	})
+}
+
+func TestFaultySecretStore_Conformance(t *testing.T) {
+	encxtest.RunSecretStoreConformance(t, func(t *testing.T) encx.SecretManagementService {
+		return encx.NewFaultySecretStore(nil, encx.FaultConfig{})
+	})
+}
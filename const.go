@@ -13,6 +13,10 @@ const (
 	SuffixHashed    = "Hash"
 )
 
+// Redacted replaces the values of the fields with encx tags in the String, GoString,
+// LogValue and MarshalJSON methods generated for structs with //encx:options redact=true
+const Redacted = "[REDACTED]"
+
 // Tag constants for struct field annotations
 const (
 	StructTag     = "encx"
@@ -52,6 +52,18 @@ const (
 	// Example: "secret/data/encx/user-service/pepper"
 	// Note: This follows the KV v2 API path convention where "secret/data/" is the mount point.
 	VaultPepperPathTemplate = "secret/data/encx/%s/pepper"
+
+	// FilePepperNameTemplate is the file name template for storing peppers on disk.
+	// The %s placeholder is replaced with the pepper alias (service identifier).
+	// Example: "user-service.pepper"
+	// Note: The name is also a valid Kubernetes Secret key, so peppers can be mounted as files.
+	FilePepperNameTemplate = "%s.pepper"
+
+	// EnvPepperVariableTemplate is the environment variable template for reading peppers.
+	// The %s placeholder is replaced with the upper-cased pepper alias, with characters
+	// other than letters and digits replaced by underscores.
+	// Example: "ENCX_PEPPER_USER_SERVICE"
+	EnvPepperVariableTemplate = "ENCX_PEPPER_%s"
 )
 
 // KEK constraints
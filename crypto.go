@@ -43,6 +43,9 @@ type CryptoService interface {
 	EncryptData(ctx context.Context, plaintext []byte, dek []byte) ([]byte, error)
 	DecryptData(ctx context.Context, ciphertext []byte, dek []byte) ([]byte, error)
 	EncryptDEK(ctx context.Context, plaintextDEK []byte) ([]byte, error)
+	// EncryptDEKVersioned encrypts a DEK with the current KEK, and returns the version of
+	// that KEK, to store with the encrypted DEK
+	EncryptDEKVersioned(ctx context.Context, plaintextDEK []byte) ([]byte, int, error)
 	DecryptDEKWithVersion(ctx context.Context, ciphertextDEK []byte, kekVersion int) ([]byte, error)
 	RotateKEK(ctx context.Context) error
 	HashBasic(ctx context.Context, value []byte) string
@@ -415,10 +418,24 @@ func (c *Crypto) EncryptDEK(ctx context.Context, plaintextDEK []byte) ([]byte, e
 	return c.dekOps.EncryptDEK(ctx, plaintextDEK, c)
 }
 
+func (c *Crypto) EncryptDEKVersioned(ctx context.Context, plaintextDEK []byte) ([]byte, int, error) {
+	return c.dekOps.EncryptDEKVersioned(ctx, plaintextDEK, c)
+}
+
 func (c *Crypto) DecryptDEKWithVersion(ctx context.Context, ciphertextDEK []byte, kekVersion int) ([]byte, error) {
 	return c.dekOps.DecryptDEKWithVersion(ctx, ciphertextDEK, kekVersion, c)
 }
 
+// encryptDEKVersioned and decryptDEKWithVersion resolve the KEK versions with
+// versionManager, e.g. the cache of WithKEKCache
+func (c *Crypto) encryptDEKVersioned(ctx context.Context, plaintextDEK []byte, versionManager crypto.KMSVersionManager) ([]byte, int, error) {
+	return c.dekOps.EncryptDEKVersioned(ctx, plaintextDEK, versionManager)
+}
+
+func (c *Crypto) decryptDEKWithVersion(ctx context.Context, ciphertextDEK []byte, kekVersion int, versionManager crypto.KMSVersionManager) ([]byte, error) {
+	return c.dekOps.DecryptDEKWithVersion(ctx, ciphertextDEK, kekVersion, versionManager)
+}
+
 func (c *Crypto) HashBasic(ctx context.Context, value []byte) string {
 	return c.hashingOps.HashBasic(ctx, value)
 }
@@ -477,6 +494,10 @@ func (c *Crypto) GetAlias() string {
 	return c.kekAlias
 }
 
+func (c *Crypto) GetObservabilityHook() ObservabilityHook {
+	return c.observabilityHook
+}
+
 // Internal interface implementations
 func (c *Crypto) GetCurrentKEKVersion(ctx context.Context, alias string) (int, error) {
 	return c.getCurrentKEKVersion(ctx, alias)
@@ -428,6 +428,26 @@ func TestEncryptDEK(t *testing.T) {
 	assert.NotEqual(t, dek, encryptedDEK)
 }
 
+// TestEncryptDEKVersioned tests that DEKs are encrypted with the KEK of the returned version
+func TestEncryptDEKVersioned(t *testing.T) {
+	ctx := context.Background()
+	crypto, err := encx.NewTestCrypto(nil)
+	require.NoError(t, err)
+
+	dek, err := crypto.GenerateDEK()
+	require.NoError(t, err)
+
+	encryptedDEK, version, err := crypto.EncryptDEKVersioned(ctx, dek)
+	require.NoError(t, err)
+	currentVersion, err := crypto.GetCurrentKEKVersion(ctx, crypto.GetAlias())
+	require.NoError(t, err)
+	assert.Equal(t, currentVersion, version)
+
+	decryptedDEK, err := crypto.DecryptDEKWithVersion(ctx, encryptedDEK, version)
+	require.NoError(t, err)
+	assert.Equal(t, dek, decryptedDEK)
+}
+
 // TestDecryptDEKWithVersion tests DEK decryption with version
 func TestDecryptDEKWithVersion(t *testing.T) {
 	ctx := context.Background()
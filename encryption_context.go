@@ -0,0 +1,77 @@
+package encx
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// encryptionContextKey is the context key under which the encryption context is stored.
+type encryptionContextKey struct{}
+
+// WithEncryptionContext returns a copy of ctx carrying the given encryption context.
+//
+// The encryption context is a set of non-secret key-value pairs bound to every DEK
+// wrapped by the KMS while ctx is in use. KMS providers supporting it forward it
+// to the KMS (AWS KMS EncryptionContext, Vault Transit derived key context), where
+// it can scope IAM policies and appears in audit logs (e.g., CloudTrail).
+//
+// The exact same encryption context must be supplied again when decrypting the DEK,
+// otherwise the KMS refuses to decrypt it.
+//
+// Pairs are merged with any encryption context already carried by ctx; on conflict
+// the new value wins.
+//
+// Example:
+//
+//	ctx = encx.WithEncryptionContext(ctx, map[string]string{"tenant": tenantID})
+//	userEncx, err := ProcessUserEncx(ctx, crypto, user)
+//	...
+//	user, err := DecryptUserEncx(ctx, crypto, userEncx) // same ctx pairs required
+func WithEncryptionContext(ctx context.Context, encryptionContext map[string]string) context.Context {
+	if len(encryptionContext) == 0 {
+		return ctx
+	}
+
+	existing, _ := ctx.Value(encryptionContextKey{}).(map[string]string)
+	merged := make(map[string]string, len(existing)+len(encryptionContext))
+	for k, v := range existing {
+		merged[k] = v
+	}
+	for k, v := range encryptionContext {
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, encryptionContextKey{}, merged)
+}
+
+// EncryptionContextFromContext returns a copy of the encryption context carried by ctx,
+// or nil if there is none.
+//
+// KeyManagementService implementations call this in EncryptDEK and DecryptDEK.
+func EncryptionContextFromContext(ctx context.Context) map[string]string {
+	existing, _ := ctx.Value(encryptionContextKey{}).(map[string]string)
+	if len(existing) == 0 {
+		return nil
+	}
+
+	encryptionContext := make(map[string]string, len(existing))
+	for k, v := range existing {
+		encryptionContext[k] = v
+	}
+	return encryptionContext
+}
+
+// MarshalEncryptionContext returns the canonical serialization of an encryption context:
+// a JSON object with keys in sorted order. It returns nil for an empty encryption context.
+//
+// Providers without a native map representation use it to bind the encryption
+// context to a ciphertext (e.g., as AEAD additional data or a key derivation context).
+func MarshalEncryptionContext(encryptionContext map[string]string) []byte {
+	if len(encryptionContext) == 0 {
+		return nil
+	}
+
+	// encoding/json sorts map keys, which makes the output canonical
+	data, _ := json.Marshal(encryptionContext)
+	return data
+}
@@ -0,0 +1,56 @@
+package encx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithEncryptionContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Nil(t, EncryptionContextFromContext(ctx))
+
+	// Empty maps leave the context untouched
+	assert.Equal(t, ctx, WithEncryptionContext(ctx, nil))
+
+	ctx = WithEncryptionContext(ctx, map[string]string{"table": "users", "tenant": "acme"})
+	ctx = WithEncryptionContext(ctx, map[string]string{"tenant": "globex"})
+
+	assert.Equal(t, map[string]string{"table": "users", "tenant": "globex"}, EncryptionContextFromContext(ctx))
+
+	// Returned maps are copies
+	ec := EncryptionContextFromContext(ctx)
+	ec["table"] = "orders"
+	assert.Equal(t, "users", EncryptionContextFromContext(ctx)["table"])
+}
+
+func TestMarshalEncryptionContext(t *testing.T) {
+	assert.Nil(t, MarshalEncryptionContext(nil))
+	assert.Equal(t,
+		`{"a":"1","b":"2","c":"3"}`,
+		string(MarshalEncryptionContext(map[string]string{"c": "3", "a": "1", "b": "2"})),
+	)
+}
+
+func TestSimpleTestKMS_EncryptionContext(t *testing.T) {
+	kms := NewSimpleTestKMS()
+	dek := []byte("0123456789abcdef0123456789abcdef")
+
+	ctx := WithEncryptionContext(context.Background(), map[string]string{"table": "users"})
+	ciphertext, err := kms.EncryptDEK(ctx, "test-key-id", dek)
+	require.NoError(t, err)
+
+	plaintext, err := kms.DecryptDEK(ctx, "test-key-id", ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, dek, plaintext)
+
+	// A different or missing encryption context must not decrypt
+	_, err = kms.DecryptDEK(context.Background(), "test-key-id", ciphertext)
+	assert.Error(t, err)
+
+	otherCtx := WithEncryptionContext(context.Background(), map[string]string{"table": "orders"})
+	_, err = kms.DecryptDEK(otherCtx, "test-key-id", ciphertext)
+	assert.Error(t, err)
+}
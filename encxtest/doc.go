@@ -0,0 +1,41 @@
+// Package encxtest provides conformance test suites for encx provider implementations.
+//
+// Anyone implementing encx.KeyManagementService or encx.SecretManagementService can
+// check their implementation against the contract encx relies on, instead of guessing
+// at it: round-trips, non-deterministic encryption, wrong-key and tampering failures,
+// concurrency, context cancellation, and error classification against the sentinel
+// errors of the encx package.
+//
+// # Usage
+//
+//	package mykms_test
+//
+//	import (
+//	    "testing"
+//
+//	    "github.com/hengadev/encx"
+//	    "github.com/hengadev/encx/encxtest"
+//	)
+//
+//	func TestKMSConformance(t *testing.T) {
+//	    encxtest.RunKMSConformance(t, func(t *testing.T) encx.KeyManagementService {
+//	        return mykms.New(testConfig(t))
+//	    })
+//	}
+//
+//	func TestSecretStoreConformance(t *testing.T) {
+//	    encxtest.RunSecretStoreConformance(t, func(t *testing.T) encx.SecretManagementService {
+//	        return mystore.New(testConfig(t))
+//	    })
+//	}
+//
+// Every provider bundled with encx runs these suites.
+package encxtest
+
+const (
+	// concurrency is the number of goroutines used by the concurrency checks.
+	concurrency = 8
+
+	// iterations is the number of operations per goroutine in the concurrency checks.
+	iterations = 10
+)
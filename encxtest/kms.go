@@ -0,0 +1,300 @@
+package encxtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/hengadev/encx"
+)
+
+// KMSFactory creates the KeyManagementService under test.
+//
+// It is called once per subtest, so that subtests do not share state. Register
+// any cleanup with t.Cleanup.
+type KMSFactory func(t *testing.T) encx.KeyManagementService
+
+// KMSOption configures RunKMSConformance.
+type KMSOption func(*kmsOptions)
+
+type kmsOptions struct {
+	encryptionContext bool
+}
+
+// WithoutEncryptionContextBinding skips the checks that DecryptDEK fails when the
+// encryption context differs from the one used by EncryptDEK.
+//
+// Use it for providers that cannot bind the encryption context, such as Vault
+// Transit keys created without key derivation.
+func WithoutEncryptionContextBinding() KMSOption {
+	return func(o *kmsOptions) {
+		o.encryptionContext = false
+	}
+}
+
+// RunKMSConformance checks that a KeyManagementService honors the contract encx relies on.
+//
+// Keys are created with CreateKey. The suite checks that:
+//   - GetKeyID rejects an empty alias with encx.ErrInvalidConfiguration
+//   - CreateKey returns distinct, non-empty key IDs
+//   - EncryptDEK/DecryptDEK round-trip a DEK, and EncryptDEK is non-deterministic
+//   - ciphertexts do not contain the DEK
+//   - DecryptDEK fails with encx.ErrDecryptionFailed for the wrong key, an empty
+//     ciphertext, or a different encryption context
+//   - a tampered ciphertext never decrypts to a different DEK: DecryptDEK fails with
+//     encx.ErrDecryptionFailed, or returns the original DEK if the provider holds a
+//     redundant, intact copy (such as providers/keys/multi)
+//   - EncryptDEK fails with encx.ErrEncryptionFailed for an empty DEK, and with
+//     encx.ErrInvalidConfiguration or encx.ErrEncryptionFailed for an empty key ID
+//   - concurrent use is safe
+//   - operations with a cancelled context fail with an error wrapping context.Canceled
+//
+// Usage:
+//
+//	func TestConformance(t *testing.T) {
+//	    encxtest.RunKMSConformance(t, func(t *testing.T) encx.KeyManagementService {
+//	        return newTestKMS(t)
+//	    })
+//	}
+func RunKMSConformance(t *testing.T, factory KMSFactory, opts ...KMSOption) {
+	t.Helper()
+
+	options := kmsOptions{encryptionContext: true}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	t.Run("GetKeyID/EmptyAlias", func(t *testing.T) {
+		kms := factory(t)
+
+		_, err := kms.GetKeyID(context.Background(), "")
+		requireErrorIs(t, err, encx.ErrInvalidConfiguration)
+	})
+
+	t.Run("CreateKey", func(t *testing.T) {
+		kms := factory(t)
+
+		keyA := createKey(t, kms, "encxtest-key-a")
+		keyB := createKey(t, kms, "encxtest-key-b")
+		if keyA == keyB {
+			t.Fatalf("CreateKey returned the same key ID %q for two keys", keyA)
+		}
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		kms := factory(t)
+		ctx := context.Background()
+		keyID := createKey(t, kms, "encxtest-key")
+
+		dek := newDEK(t)
+		ciphertext := encryptDEK(t, kms, ctx, keyID, dek)
+		if got := decryptDEK(t, kms, ctx, keyID, ciphertext); !bytes.Equal(got, dek) {
+			t.Fatal("DecryptDEK did not return the original DEK")
+		}
+	})
+
+	t.Run("NonDeterministic", func(t *testing.T) {
+		kms := factory(t)
+		ctx := context.Background()
+		keyID := createKey(t, kms, "encxtest-key")
+
+		dek := newDEK(t)
+		first := encryptDEK(t, kms, ctx, keyID, dek)
+		second := encryptDEK(t, kms, ctx, keyID, dek)
+		if bytes.Equal(first, second) {
+			t.Fatal("EncryptDEK returned the same ciphertext twice for the same DEK")
+		}
+		for _, ciphertext := range [][]byte{first, second} {
+			if got := decryptDEK(t, kms, ctx, keyID, ciphertext); !bytes.Equal(got, dek) {
+				t.Fatal("DecryptDEK did not return the original DEK")
+			}
+		}
+	})
+
+	t.Run("CiphertextHidesDEK", func(t *testing.T) {
+		kms := factory(t)
+		keyID := createKey(t, kms, "encxtest-key")
+
+		dek := newDEK(t)
+		ciphertext := encryptDEK(t, kms, context.Background(), keyID, dek)
+		if bytes.Contains(ciphertext, dek) {
+			t.Fatal("ciphertext contains the DEK")
+		}
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		kms := factory(t)
+		ctx := context.Background()
+		keyA := createKey(t, kms, "encxtest-key-a")
+		keyB := createKey(t, kms, "encxtest-key-b")
+
+		ciphertext := encryptDEK(t, kms, ctx, keyA, newDEK(t))
+		_, err := kms.DecryptDEK(ctx, keyB, ciphertext)
+		requireErrorIs(t, err, encx.ErrDecryptionFailed)
+	})
+
+	t.Run("TamperedCiphertext", func(t *testing.T) {
+		kms := factory(t)
+		ctx := context.Background()
+		keyID := createKey(t, kms, "encxtest-key")
+
+		dek := newDEK(t)
+		ciphertext := encryptDEK(t, kms, ctx, keyID, dek)
+		for _, i := range []int{0, len(ciphertext) / 2, len(ciphertext) - 1} {
+			tampered := bytes.Clone(ciphertext)
+			tampered[i] ^= 0x01
+
+			got, err := kms.DecryptDEK(ctx, keyID, tampered)
+			if err == nil {
+				if !bytes.Equal(got, dek) {
+					t.Fatalf("DecryptDEK returned a different DEK for a ciphertext tampered at byte %d", i)
+				}
+				continue
+			}
+			requireErrorIs(t, err, encx.ErrDecryptionFailed)
+		}
+	})
+
+	t.Run("EmptyInputs", func(t *testing.T) {
+		kms := factory(t)
+		ctx := context.Background()
+		keyID := createKey(t, kms, "encxtest-key")
+
+		_, err := kms.EncryptDEK(ctx, keyID, nil)
+		requireErrorIs(t, err, encx.ErrEncryptionFailed)
+
+		_, err = kms.DecryptDEK(ctx, keyID, nil)
+		requireErrorIs(t, err, encx.ErrDecryptionFailed)
+
+		_, err = kms.EncryptDEK(ctx, "", newDEK(t))
+		if !errors.Is(err, encx.ErrInvalidConfiguration) && !errors.Is(err, encx.ErrEncryptionFailed) {
+			t.Fatalf("EncryptDEK with an empty key ID: expected encx.ErrInvalidConfiguration or encx.ErrEncryptionFailed, got %v", err)
+		}
+	})
+
+	if options.encryptionContext {
+		t.Run("EncryptionContext", func(t *testing.T) {
+			kms := factory(t)
+			keyID := createKey(t, kms, "encxtest-key")
+
+			dek := newDEK(t)
+			encCtx := encx.WithEncryptionContext(context.Background(), map[string]string{"table": "users"})
+			ciphertext := encryptDEK(t, kms, encCtx, keyID, dek)
+
+			if got := decryptDEK(t, kms, encCtx, keyID, ciphertext); !bytes.Equal(got, dek) {
+				t.Fatal("DecryptDEK did not return the original DEK")
+			}
+
+			otherCtx := encx.WithEncryptionContext(context.Background(), map[string]string{"table": "orders"})
+			_, err := kms.DecryptDEK(otherCtx, keyID, ciphertext)
+			requireErrorIs(t, err, encx.ErrDecryptionFailed)
+
+			_, err = kms.DecryptDEK(context.Background(), keyID, ciphertext)
+			requireErrorIs(t, err, encx.ErrDecryptionFailed)
+		})
+	}
+
+	t.Run("Concurrency", func(t *testing.T) {
+		kms := factory(t)
+		ctx := context.Background()
+		keyID := createKey(t, kms, "encxtest-key")
+
+		var wg sync.WaitGroup
+		errs := make(chan error, concurrency*iterations)
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < iterations; j++ {
+					dek := make([]byte, 32)
+					rand.Read(dek)
+
+					ciphertext, err := kms.EncryptDEK(ctx, keyID, dek)
+					if err != nil {
+						errs <- err
+						return
+					}
+					got, err := kms.DecryptDEK(ctx, keyID, ciphertext)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if !bytes.Equal(got, dek) {
+						errs <- errors.New("DecryptDEK did not return the original DEK")
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Errorf("concurrent round trip: %v", err)
+		}
+	})
+
+	t.Run("ContextCancellation", func(t *testing.T) {
+		kms := factory(t)
+		keyID := createKey(t, kms, "encxtest-key")
+		ciphertext := encryptDEK(t, kms, context.Background(), keyID, newDEK(t))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := kms.EncryptDEK(ctx, keyID, newDEK(t))
+		requireErrorIs(t, err, context.Canceled)
+
+		_, err = kms.DecryptDEK(ctx, keyID, ciphertext)
+		requireErrorIs(t, err, context.Canceled)
+	})
+}
+
+func createKey(t *testing.T, kms encx.KeyManagementService, description string) string {
+	t.Helper()
+
+	keyID, err := kms.CreateKey(context.Background(), description)
+	if err != nil {
+		t.Fatalf("CreateKey(%q): %v", description, err)
+	}
+	if keyID == "" {
+		t.Fatalf("CreateKey(%q) returned an empty key ID", description)
+	}
+	return keyID
+}
+
+func encryptDEK(t *testing.T, kms encx.KeyManagementService, ctx context.Context, keyID string, dek []byte) []byte {
+	t.Helper()
+
+	ciphertext, err := kms.EncryptDEK(ctx, keyID, dek)
+	if err != nil {
+		t.Fatalf("EncryptDEK: %v", err)
+	}
+	if len(ciphertext) == 0 {
+		t.Fatal("EncryptDEK returned an empty ciphertext")
+	}
+	return ciphertext
+}
+
+func decryptDEK(t *testing.T, kms encx.KeyManagementService, ctx context.Context, keyID string, ciphertext []byte) []byte {
+	t.Helper()
+
+	dek, err := kms.DecryptDEK(ctx, keyID, ciphertext)
+	if err != nil {
+		t.Fatalf("DecryptDEK: %v", err)
+	}
+	return dek
+}
+
+func newDEK(t *testing.T) []byte {
+	t.Helper()
+
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		t.Fatalf("failed to generate DEK: %v", err)
+	}
+	return dek
+}
@@ -0,0 +1,296 @@
+package encxtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/hengadev/encx"
+)
+
+// SecretStoreFactory creates the SecretManagementService under test.
+//
+// It is called once per subtest and must return an empty store, so that subtests
+// do not share state. Register any cleanup with t.Cleanup.
+type SecretStoreFactory func(t *testing.T) encx.SecretManagementService
+
+// ProvisionFunc stores a pepper out of band, for stores that cannot write peppers.
+type ProvisionFunc func(t *testing.T, store encx.SecretManagementService, alias string, pepper []byte)
+
+// SecretStoreOption configures RunSecretStoreConformance.
+type SecretStoreOption func(*secretStoreOptions)
+
+type secretStoreOptions struct {
+	provision ProvisionFunc
+}
+
+// WithReadOnlyStore declares that StorePepper always fails with encx.ErrInvalidConfiguration.
+//
+// Peppers are then stored with provision (e.g. by setting an environment variable or
+// writing a mounted file) instead of StorePepper.
+func WithReadOnlyStore(provision ProvisionFunc) SecretStoreOption {
+	return func(o *secretStoreOptions) {
+		o.provision = provision
+	}
+}
+
+// RunSecretStoreConformance checks that a SecretManagementService honors the contract encx relies on.
+//
+// The suite checks that:
+//   - GetStoragePath returns distinct, non-empty paths per alias
+//   - PepperExists returns false (and no error) for a missing alias, and GetPepper
+//     fails with encx.ErrSecretStorageUnavailable
+//   - stored peppers round-trip, can be overwritten, and are isolated per alias
+//   - StorePepper rejects peppers that are not encx.PepperLength bytes with
+//     encx.ErrInvalidConfiguration (read-only stores reject every write with it)
+//   - GetPepper returns a copy that callers may modify
+//   - concurrent use is safe
+//   - operations with a cancelled context fail with an error wrapping context.Canceled
+//
+// Usage:
+//
+//	func TestConformance(t *testing.T) {
+//	    encxtest.RunSecretStoreConformance(t, func(t *testing.T) encx.SecretManagementService {
+//	        return newTestStore(t)
+//	    })
+//	}
+func RunSecretStoreConformance(t *testing.T, factory SecretStoreFactory, opts ...SecretStoreOption) {
+	t.Helper()
+
+	var options secretStoreOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	readOnly := options.provision != nil
+
+	// store writes a pepper through StorePepper or the provisioner of read-only stores
+	store := func(t *testing.T, s encx.SecretManagementService, alias string, pepper []byte) {
+		t.Helper()
+		if readOnly {
+			options.provision(t, s, alias, pepper)
+			return
+		}
+		if err := s.StorePepper(context.Background(), alias, pepper); err != nil {
+			t.Fatalf("StorePepper(%q): %v", alias, err)
+		}
+	}
+
+	t.Run("GetStoragePath", func(t *testing.T) {
+		s := factory(t)
+
+		a := s.GetStoragePath("encxtest-a")
+		b := s.GetStoragePath("encxtest-b")
+		if a == "" || b == "" {
+			t.Fatal("GetStoragePath returned an empty path")
+		}
+		if a == b {
+			t.Fatalf("GetStoragePath returned the same path %q for two aliases", a)
+		}
+	})
+
+	t.Run("MissingAlias", func(t *testing.T) {
+		s := factory(t)
+		ctx := context.Background()
+
+		exists, err := s.PepperExists(ctx, "encxtest-missing")
+		if err != nil {
+			t.Fatalf("PepperExists on a missing alias: %v", err)
+		}
+		if exists {
+			t.Fatal("PepperExists returned true for a missing alias")
+		}
+
+		_, err = s.GetPepper(ctx, "encxtest-missing")
+		requireErrorIs(t, err, encx.ErrSecretStorageUnavailable)
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		s := factory(t)
+		ctx := context.Background()
+
+		pepper := newPepper(t)
+		store(t, s, "encxtest-svc", pepper)
+
+		exists, err := s.PepperExists(ctx, "encxtest-svc")
+		if err != nil {
+			t.Fatalf("PepperExists: %v", err)
+		}
+		if !exists {
+			t.Fatal("PepperExists returned false for a stored pepper")
+		}
+
+		requirePepper(t, s, "encxtest-svc", pepper)
+	})
+
+	if readOnly {
+		t.Run("ReadOnly", func(t *testing.T) {
+			s := factory(t)
+
+			err := s.StorePepper(context.Background(), "encxtest-svc", newPepper(t))
+			requireErrorIs(t, err, encx.ErrInvalidConfiguration)
+		})
+	} else {
+		t.Run("Overwrite", func(t *testing.T) {
+			s := factory(t)
+
+			store(t, s, "encxtest-svc", newPepper(t))
+			second := newPepper(t)
+			store(t, s, "encxtest-svc", second)
+
+			requirePepper(t, s, "encxtest-svc", second)
+		})
+
+		t.Run("InvalidLength", func(t *testing.T) {
+			s := factory(t)
+			ctx := context.Background()
+
+			for _, length := range []int{0, encx.PepperLength - 1, encx.PepperLength + 1} {
+				err := s.StorePepper(ctx, "encxtest-svc", make([]byte, length))
+				requireErrorIs(t, err, encx.ErrInvalidConfiguration)
+			}
+
+			exists, err := s.PepperExists(ctx, "encxtest-svc")
+			if err != nil {
+				t.Fatalf("PepperExists: %v", err)
+			}
+			if exists {
+				t.Fatal("an invalid pepper was stored")
+			}
+		})
+	}
+
+	t.Run("AliasIsolation", func(t *testing.T) {
+		s := factory(t)
+
+		a, b := newPepper(t), newPepper(t)
+		store(t, s, "encxtest-a", a)
+		store(t, s, "encxtest-b", b)
+
+		requirePepper(t, s, "encxtest-a", a)
+		requirePepper(t, s, "encxtest-b", b)
+	})
+
+	t.Run("ReturnsCopy", func(t *testing.T) {
+		s := factory(t)
+		ctx := context.Background()
+
+		pepper := newPepper(t)
+		store(t, s, "encxtest-svc", pepper)
+
+		got, err := s.GetPepper(ctx, "encxtest-svc")
+		if err != nil {
+			t.Fatalf("GetPepper: %v", err)
+		}
+		for i := range got {
+			got[i] = 0
+		}
+
+		requirePepper(t, s, "encxtest-svc", pepper)
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		s := factory(t)
+		ctx := context.Background()
+
+		peppers := make([][]byte, concurrency)
+		for i := range peppers {
+			peppers[i] = newPepper(t)
+			if readOnly {
+				store(t, s, fmt.Sprintf("encxtest-%d", i), peppers[i])
+			}
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, concurrency*iterations)
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				alias := fmt.Sprintf("encxtest-%d", i)
+
+				if !readOnly {
+					if err := s.StorePepper(ctx, alias, peppers[i]); err != nil {
+						errs <- err
+						return
+					}
+				}
+				for j := 0; j < iterations; j++ {
+					got, err := s.GetPepper(ctx, alias)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if !bytes.Equal(got, peppers[i]) {
+						errs <- fmt.Errorf("GetPepper(%q) returned the wrong pepper", alias)
+						return
+					}
+					if _, err := s.PepperExists(ctx, alias); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Errorf("concurrent access: %v", err)
+		}
+	})
+
+	t.Run("ContextCancellation", func(t *testing.T) {
+		s := factory(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := s.GetPepper(ctx, "encxtest-svc")
+		requireErrorIs(t, err, context.Canceled)
+
+		_, err = s.PepperExists(ctx, "encxtest-svc")
+		requireErrorIs(t, err, context.Canceled)
+
+		if !readOnly {
+			err = s.StorePepper(ctx, "encxtest-svc", newPepper(t))
+			requireErrorIs(t, err, context.Canceled)
+		}
+	})
+}
+
+func requirePepper(t *testing.T, s encx.SecretManagementService, alias string, want []byte) {
+	t.Helper()
+
+	got, err := s.GetPepper(context.Background(), alias)
+	if err != nil {
+		t.Fatalf("GetPepper(%q): %v", alias, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("GetPepper(%q) did not return the stored pepper", alias)
+	}
+}
+
+func newPepper(t *testing.T) []byte {
+	t.Helper()
+
+	pepper := make([]byte, encx.PepperLength)
+	if _, err := rand.Read(pepper); err != nil {
+		t.Fatalf("failed to generate pepper: %v", err)
+	}
+	return pepper
+}
+
+func requireErrorIs(t *testing.T, err, target error) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatalf("expected an error wrapping %q, got nil", target)
+	}
+	if !errors.Is(err, target) {
+		t.Fatalf("expected an error wrapping %q, got %v", target, err)
+	}
+}
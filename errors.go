@@ -26,6 +26,7 @@ var (
 	ErrMissingTargetField = errors.New("missing required target field")
 	ErrInvalidFieldType   = errors.New("invalid field type")
 	ErrUnsupportedType    = errors.New("unsupported type")
+	ErrUnknownField       = errors.New("unknown field")
 
 	// Conversion errors
 	ErrTypeConversion = errors.New("type conversion failed")
@@ -0,0 +1,28 @@
+package encx
+
+// Re-export health check types and constructors for public use
+import "github.com/hengadev/encx/internal/health"
+
+// Type aliases
+type (
+	HealthStatus   = health.HealthStatus
+	HealthCheck    = health.HealthCheck
+	HealthChecker  = health.HealthChecker
+	HealthReport   = health.HealthReport
+	HealthResult   = health.HealthResult
+	HealthEndpoint = health.HealthEndpoint
+)
+
+// Health status constants
+const (
+	HealthStatusHealthy   = health.StatusHealthy
+	HealthStatusUnhealthy = health.StatusUnhealthy
+	HealthStatusDegraded  = health.StatusDegraded
+	HealthStatusUnknown   = health.StatusUnknown
+)
+
+// Constructor functions
+var (
+	NewHealthChecker  = health.NewHealthChecker
+	NewHealthEndpoint = health.NewHealthEndpoint
+)
@@ -89,6 +89,28 @@ type KeyManagementService interface {
 	DecryptDEK(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error)
 }
 
+// KeyRotator is an optional interface for KeyManagementService implementations
+// whose keys are versioned by the KMS itself.
+//
+// When the KMS service passed to NewCrypto implements KeyRotator, RotateKEK rotates
+// the key backing the current KEK version in place instead of calling CreateKey,
+// and records the returned key ID as the new KEK version.
+//
+// Implementations:
+//   - HashiCorp Vault Transit: github.com/hengadev/encx/providers/keys/hashicorp.TransitService
+type KeyRotator interface {
+	// RotateKey creates a new version of the key identified by keyID.
+	//
+	// Parameters:
+	//   - ctx: Context for the operation
+	//   - keyID: The KMS key ID recorded for the current KEK version
+	//
+	// Returns:
+	//   - The key ID identifying the new key version
+	//   - Error if rotation fails
+	RotateKey(ctx context.Context, keyID string) (string, error)
+}
+
 // SecretManagementService defines the contract for secret storage and retrieval operations.
 //
 // This interface is implemented by secret storage providers (AWS Secrets Manager,
@@ -102,6 +124,9 @@ type KeyManagementService interface {
 // Implementations:
 //   - AWS Secrets Manager: github.com/hengadev/encx/providers/aws.SecretsManagerStore
 //   - HashiCorp Vault KV v2: github.com/hengadev/encx/providers/hashicorp.KVStore
+//   - Files / Kubernetes Secret volumes: github.com/hengadev/encx/providers/secrets/file.FileStore
+//   - Environment variables (read-only): github.com/hengadev/encx/providers/secrets/env.EnvStore
+//   - Caching decorator: github.com/hengadev/encx/providers/secrets/cache.CachingStore
 //   - In-Memory (testing): encx.InMemorySecretStore
 //
 // Example usage:
@@ -122,6 +147,8 @@ type KeyManagementService interface {
 // For example:
 //   - AWS Secrets Manager: "encx/{alias}/pepper"
 //   - Vault KV v2: "secret/data/encx/{alias}/pepper"
+//   - File: "{dir}/{alias}.pepper"
+//   - Environment: "ENCX_PEPPER_{ALIAS}"
 //   - In-Memory: "memory://{alias}/pepper"
 //
 // This allows for service isolation in microservices architectures where each
@@ -6,7 +6,6 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
-	"time"
 )
 
 // BenchmarkDiscoverStructs benchmarks the struct discovery performance
@@ -47,7 +46,6 @@ func BenchmarkTemplateGeneration(b *testing.B) {
 		PackageName:            "benchmark",
 		StructName:             "ComplexUser",
 		SourceFile:             "complex_user.go",
-		GeneratedTime:          time.Now().Format(time.RFC3339),
 		GeneratorVersion:       "1.0.0",
 		EncryptedFields: []TemplateField{
 			{Name: "EmailEncrypted", Type: "[]byte", DBColumn: "email_encrypted", JSONField: "email_encrypted"},
@@ -187,7 +185,6 @@ func BenchmarkMemoryUsage(b *testing.B) {
 		PackageName:            "benchmark",
 		StructName:             "LargeStruct",
 		SourceFile:             "large_struct.go",
-		GeneratedTime:          time.Now().Format(time.RFC3339),
 		GeneratorVersion:       "1.0.0",
 		EncryptedFields:        generateLargeFieldList(50), // 50 fields
 		ProcessingSteps:        generateLargeProcessingSteps(50),
@@ -218,6 +218,37 @@ func TestValidateGenerationOptions(t *testing.T) {
 			expectError: true,
 			errorMsg:    "serializer option is no longer supported",
 		},
+		{
+			name: "Encryption context options",
+			options: map[string]string{
+				"table":          "users",
+				"context.tenant": "acme",
+			},
+			expectError: false,
+		},
+		{
+			name: "Encryption context option without key",
+			options: map[string]string{
+				"context.": "acme",
+			},
+			expectError: true,
+			errorMsg:    "context option requires a key",
+		},
+		{
+			name: "Redact option",
+			options: map[string]string{
+				"redact": "true",
+			},
+			expectError: false,
+		},
+		{
+			name: "Invalid redact option",
+			options: map[string]string{
+				"redact": "yes",
+			},
+			expectError: true,
+			errorMsg:    `redact option must be true or false, got "yes"`,
+		},
 		{
 			name:        "Empty options",
 			options:     map[string]string{},
@@ -0,0 +1,408 @@
+package codegen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"slices"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// loadMode is the information go/packages loads for struct discovery.
+//
+// Dependencies are type-checked from source rather than loaded from export data, so
+// that discovery does not depend on the export data format of the installed toolchain.
+const loadMode = packages.NeedName | packages.NeedFiles | packages.NeedSyntax |
+	packages.NeedTypes | packages.NeedTypesInfo | packages.NeedImports | packages.NeedDeps
+
+// discoverStructsWithTypes discovers structs with encx tags using go/packages, so that
+// field types are resolved with full type information: named types and aliases from
+// other packages, generic instantiations, and embedded structs from other modules.
+//
+// Type errors do not prevent discovery, as packages commonly refer to generated code
+// that does not exist yet. Fields whose type cannot be resolved fall back to their
+// source representation.
+func discoverStructsWithTypes(packagePath string, config *DiscoveryConfig) ([]StructInfo, error) {
+	pkgs, err := packages.Load(&packages.Config{Mode: loadMode, Dir: packagePath}, ".")
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected one package in %s, found %d", packagePath, len(pkgs))
+	}
+
+	pkg := pkgs[0]
+	for _, pkgErr := range pkg.Errors {
+		if pkgErr.Kind != packages.TypeError {
+			return nil, pkgErr
+		}
+	}
+	if pkg.Types == nil || pkg.TypesInfo == nil || len(pkg.Syntax) == 0 {
+		return nil, fmt.Errorf("no type information for package %s", packagePath)
+	}
+
+	// Collect struct definitions for the fields whose type cannot be resolved
+	structDefs := make(map[string]*ast.StructType)
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.TYPE {
+				for _, spec := range genDecl.Specs {
+					typeSpec := spec.(*ast.TypeSpec)
+					if structType, ok := typeSpec.Type.(*ast.StructType); ok {
+						structDefs[typeSpec.Name.Name] = structType
+					}
+				}
+			}
+		}
+	}
+
+	files := make(map[string]*ast.File, len(pkg.Syntax))
+	for _, file := range pkg.Syntax {
+		files[pkg.Fset.Position(file.Package).Filename] = file
+	}
+	fieldTags, err := packageFieldTags(files, config)
+	if err != nil {
+		return nil, err
+	}
+
+	var structs []StructInfo
+	for _, file := range pkg.Syntax {
+		fileName := pkg.Fset.Position(file.Package).Filename
+		fileImports := extractImports(file)
+
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				structType, ok := typeSpec.Type.(*ast.StructType)
+				// Generic structs have no single Encx type
+				if !ok || typeSpec.TypeParams != nil {
+					continue
+				}
+
+				// Comments are typically on the GenDecl, not the TypeSpec
+				doc := typeSpec.Doc
+				if doc == nil {
+					doc = genDecl.Doc
+				}
+
+				resolver := &typeResolver{pkg: pkg.Types, info: pkg.TypesInfo, fileImports: fileImports, structDefs: structDefs, fieldTags: fieldTags[typeSpec.Name.Name]}
+				structs = append(structs, resolver.analyzeStruct(fileName, typeSpec.Name.Name, doc, structType))
+			}
+		}
+	}
+
+	var result []StructInfo
+	for _, structInfo := range resolveNestedStructs(structs) {
+		if structInfo.HasEncxTags {
+			result = append(result, structInfo)
+		}
+	}
+	return result, nil
+}
+
+// typeResolver analyzes the structs of a type-checked package
+type typeResolver struct {
+	pkg         *types.Package
+	info        *types.Info
+	fileImports map[string]string
+	structDefs  map[string]*ast.StructType
+	fieldTags   map[string][]string // Tags of the fields of the struct set outside of struct tags
+}
+
+// analyzeStruct analyzes a struct type for encx tags using its type information
+func (r *typeResolver) analyzeStruct(fileName, structName string, doc *ast.CommentGroup, structType *ast.StructType) StructInfo {
+	structInfo := StructInfo{
+		PackageName:       r.pkg.Name(),
+		StructName:        structName,
+		SourceFile:        filepath.Base(fileName),
+		Fields:            []FieldInfo{},
+		GenerationOptions: make(map[string]string),
+		RequiredImports:   make(map[string]string),
+	}
+
+	// Parse encx:options from struct-level comments
+	parseEncxOptions(doc, structInfo.GenerationOptions)
+
+	for _, field := range structType.Fields.List {
+		typ := r.info.TypeOf(field.Type)
+
+		// Handle embedded fields, which may be defined in other packages
+		if len(field.Names) == 0 {
+			var embeddedFields []FieldInfo
+			if isResolved(typ) {
+				embeddedFields = r.embeddedFields(typ, structInfo.RequiredImports, map[types.Type]bool{})
+			} else {
+				embeddedFields = resolveEmbeddedField(field, r.fileImports, r.structDefs)
+				r.trackSourceImports(embeddedFields, structInfo.RequiredImports)
+			}
+			structInfo.Fields = append(structInfo.Fields, embeddedFields...)
+			continue
+		}
+
+		// Internal fields of protobuf messages are not copied
+		if isProtoInternalField(field, r.fileImports) {
+			continue
+		}
+
+		for _, name := range field.Names {
+			fieldInfo := analyzeField(name.Name, field)
+			if encxTags, found := r.fieldTags[name.Name]; found {
+				fieldInfo.EncxTags = encxTags
+			}
+			if isResolved(typ) {
+				fieldInfo.Type = r.typeString(typ, structInfo.RequiredImports)
+				fieldInfo.ColumnType = columnGoType(typ)
+				checkSerializable(&fieldInfo, typ)
+			} else {
+				r.trackSourceImports([]FieldInfo{fieldInfo}, structInfo.RequiredImports)
+			}
+			structInfo.Fields = append(structInfo.Fields, fieldInfo)
+		}
+	}
+
+	for _, field := range structInfo.Fields {
+		if len(field.EncxTags) > 0 {
+			structInfo.HasEncxTags = true
+		}
+	}
+
+	return structInfo
+}
+
+// embeddedFields returns the fields promoted by an embedded struct type, recursively.
+// Unexported fields of structs from other packages are skipped, as generated code
+// cannot access them.
+func (r *typeResolver) embeddedFields(typ types.Type, imports map[string]string, seen map[types.Type]bool) []FieldInfo {
+	if pointer, ok := types.Unalias(typ).(*types.Pointer); ok {
+		typ = pointer.Elem()
+	}
+	structType, ok := typ.Underlying().(*types.Struct)
+	if !ok || seen[typ] {
+		return nil
+	}
+	seen[typ] = true
+
+	var fields []FieldInfo
+	for i := 0; i < structType.NumFields(); i++ {
+		field := structType.Field(i)
+		if field.Embedded() {
+			fields = append(fields, r.embeddedFields(field.Type(), imports, seen)...)
+			continue
+		}
+		if !field.Exported() && field.Pkg() != r.pkg {
+			continue
+		}
+
+		fieldInfo := newFieldInfo(field.Name(), r.typeString(field.Type(), imports), extractEncxTags(structType.Tag(i)))
+		fieldInfo.DBTag, fieldInfo.JSONTag = sourceTags(structType.Tag(i))
+		fieldInfo.ColumnType = columnGoType(field.Type())
+		checkSerializable(&fieldInfo, field.Type())
+		fields = append(fields, fieldInfo)
+	}
+	return fields
+}
+
+// typeString returns the type as written in the generated code, and tracks the
+// imports it requires. Aliases are resolved to the type they denote, so that
+// zero-value checks apply to aliases of time.Time or uuid.UUID.
+func (r *typeResolver) typeString(typ types.Type, imports map[string]string) string {
+	return types.TypeString(types.Unalias(typ), func(pkg *types.Package) string {
+		if pkg == r.pkg {
+			return ""
+		}
+		imports[pkg.Name()] = pkg.Path()
+		return pkg.Name()
+	})
+}
+
+// trackSourceImports tracks the imports of fields whose type was not resolved
+func (r *typeResolver) trackSourceImports(fields []FieldInfo, imports map[string]string) {
+	for _, field := range fields {
+		for _, pkgName := range extractPackageNamesFromType(field.Type) {
+			if importPath, found := r.fileImports[pkgName]; found {
+				imports[pkgName] = importPath
+			}
+		}
+	}
+}
+
+// isResolved reports whether the type checker resolved a type
+func isResolved(typ types.Type) bool {
+	if typ == nil {
+		return false
+	}
+	basic, ok := typ.(*types.Basic)
+	return !ok || basic.Kind() != types.Invalid
+}
+
+// checkSerializable marks a field with builtin encx tags invalid if encx.SerializeValue
+// does not support its type. User-defined operations receive the value as-is.
+func checkSerializable(field *FieldInfo, typ types.Type) {
+	if !slices.ContainsFunc(field.EncxTags, isBuiltinTag) || isSerializable(typ) {
+		return
+	}
+
+	field.IsValid = false
+	field.ValidationErrors = append(field.ValidationErrors, fmt.Sprintf(
+		"unsupported type '%s' on field '%s': encx tags require a string, bool, integer, float, time.Time, []byte, []string or [N]byte type, or a pointer to one",
+		field.Type, field.Name))
+}
+
+// isSerializable reports whether the compact serializer supports a type
+func isSerializable(typ types.Type) bool {
+	if isTimeType(typ) {
+		return true
+	}
+
+	switch t := typ.Underlying().(type) {
+	case *types.Basic:
+		return isSerializableBasic(t)
+	case *types.Pointer:
+		return isSerializable(t.Elem())
+	case *types.Array:
+		return isByteType(t.Elem())
+	case *types.Slice:
+		if isByteType(t.Elem()) {
+			return true
+		}
+		basic, ok := t.Elem().Underlying().(*types.Basic)
+		return ok && basic.Kind() == types.String
+	default:
+		return false
+	}
+}
+
+// isSerializableBasic reports whether the compact serializer supports a basic type
+func isSerializableBasic(basic *types.Basic) bool {
+	switch basic.Kind() {
+	case types.Bool, types.String,
+		types.Int, types.Int8, types.Int16, types.Int32, types.Int64,
+		types.Uint, types.Uint8, types.Uint16, types.Uint32, types.Uint64,
+		types.Float32, types.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// isByteType reports whether a type is byte or a type defined from it
+func isByteType(typ types.Type) bool {
+	basic, ok := typ.Underlying().(*types.Basic)
+	return ok && basic.Kind() == types.Uint8
+}
+
+// isTimeType reports whether a type is time.Time or an alias of it
+func isTimeType(typ types.Type) bool {
+	return isNamedType(typ, "time", "Time")
+}
+
+// isNamedType reports whether a type is the named type of a package, or an alias of it
+func isNamedType(typ types.Type, pkgPath, name string) bool {
+	named, ok := types.Unalias(typ).(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == pkgPath && obj.Name() == name
+}
+
+// columnGoType returns the Go type whose column stores values of a type, as passed to
+// schema.ColumnForGoType. Types implementing driver.Valuer, whose pointer implements
+// sql.Scanner, are stored natively: the sql.Null types in the column of the value they
+// hold, types defined from a basic type in its column, and other types as text. Other
+// types are stored by their underlying type, so that a type Status string is stored
+// as text, and as JSON if they have no native column.
+func columnGoType(typ types.Type) string {
+	typ = types.Unalias(typ)
+	if pointer, ok := typ.(*types.Pointer); ok {
+		typ = types.Unalias(pointer.Elem())
+	}
+
+	switch {
+	case isTimeType(typ):
+		return "time.Time"
+	case isNamedType(typ, "github.com/google/uuid", "UUID"):
+		return "uuid.UUID"
+	case isValuer(typ) && isScanner(types.NewPointer(typ)):
+		if value := nullValueType(typ); value != nil {
+			return columnGoType(value)
+		}
+		if basic, ok := typ.Underlying().(*types.Basic); ok {
+			return basic.Name()
+		}
+		if isByteSlice(typ) {
+			return "[]byte"
+		}
+		return "string"
+	}
+
+	if basic, ok := typ.Underlying().(*types.Basic); ok {
+		return basic.Name()
+	}
+	if isByteSlice(typ) {
+		return "[]byte"
+	}
+	return types.TypeString(typ, (*types.Package).Name)
+}
+
+// isByteSlice reports whether a type is []byte or a type defined from it
+func isByteSlice(typ types.Type) bool {
+	slice, ok := typ.Underlying().(*types.Slice)
+	return ok && isByteType(slice.Elem())
+}
+
+// isValuer reports whether a type implements driver.Valuer
+func isValuer(typ types.Type) bool {
+	method, ok := methodSignature(typ, "Value")
+	return ok && method.Params().Len() == 0 && method.Results().Len() == 2 &&
+		isNamedType(method.Results().At(0).Type(), "database/sql/driver", "Value") &&
+		isErrorType(method.Results().At(1).Type())
+}
+
+// isScanner reports whether a type implements sql.Scanner
+func isScanner(typ types.Type) bool {
+	method, ok := methodSignature(typ, "Scan")
+	if !ok || method.Params().Len() != 1 || method.Results().Len() != 1 {
+		return false
+	}
+	param, ok := method.Params().At(0).Type().Underlying().(*types.Interface)
+	return ok && param.Empty() && isErrorType(method.Results().At(0).Type())
+}
+
+// methodSignature returns the signature of an exported method in the method set of a type
+func methodSignature(typ types.Type, name string) (*types.Signature, bool) {
+	selection := types.NewMethodSet(typ).Lookup(nil, name)
+	if selection == nil {
+		return nil, false
+	}
+	signature, ok := selection.Type().(*types.Signature)
+	return signature, ok
+}
+
+// isErrorType reports whether a type is the error interface
+func isErrorType(typ types.Type) bool {
+	return types.Identical(typ, types.Universe.Lookup("error").Type())
+}
+
+// nullValueType returns the type of the value held by a type shaped like the sql.Null
+// types, a struct of the value and a Valid bool, or nil for other types
+func nullValueType(typ types.Type) types.Type {
+	structType, ok := typ.Underlying().(*types.Struct)
+	if !ok || structType.NumFields() != 2 {
+		return nil
+	}
+	for i := range 2 {
+		valid := structType.Field(i)
+		if basic, ok := valid.Type().Underlying().(*types.Basic); ok && valid.Name() == "Valid" && basic.Kind() == types.Bool {
+			return structType.Field(1 - i).Type()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package codegen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestModule writes a Go module with the given files and returns its directory
+func writeTestModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	moduleDir := t.TempDir()
+	files["go.mod"] = "module example.com/models\n\ngo 1.23\n"
+	for name, content := range files {
+		path := filepath.Join(moduleDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return moduleDir
+}
+
+func TestDiscoverStructsWithTypes(t *testing.T) {
+	moduleDir := writeTestModule(t, map[string]string{
+		"shared/shared.go": `package shared
+
+type Audit struct {
+	CreatedBy string ` + "`encx:\"encrypt\"`" + `
+	revision  int
+}
+
+type Status string
+
+type Wrapper[T any] struct {
+	Value T
+}
+`,
+		"record.go": `package models
+
+import (
+	"time"
+
+	"example.com/models/shared"
+)
+
+type Timestamp = time.Time
+
+type LegacyTime time.Time
+
+//encx:options table=records
+type Record struct {
+	shared.Audit
+
+	Status  shared.Status          ` + "`encx:\"encrypt\"`" + `
+	Created Timestamp              ` + "`encx:\"encrypt\"`" + `
+	Payload shared.Wrapper[string]
+}
+
+type Invalid struct {
+	Legacy LegacyTime        ` + "`encx:\"encrypt\"`" + `
+	Labels map[string]string ` + "`encx:\"hash_basic\"`" + `
+	Note   *string           ` + "`encx:\"encrypt\"`" + `
+}
+
+// Generic structs have no single Encx type
+type Box[T any] struct {
+	Value T ` + "`encx:\"encrypt\"`" + `
+}
+`,
+		// Refers to generated code that does not exist yet
+		"service.go": `package models
+
+func save(r *Record) (*RecordEncx, error) {
+	return nil, nil
+}
+`,
+	})
+
+	structs, err := DiscoverStructs(moduleDir, &DiscoveryConfig{})
+	require.NoError(t, err)
+	require.Len(t, structs, 2)
+
+	record := structs[0]
+	assert.Equal(t, "Record", record.StructName)
+	assert.Equal(t, "models", record.PackageName)
+	assert.Equal(t, "record.go", record.SourceFile)
+	assert.Equal(t, "records", record.GenerationOptions["table"])
+	assert.Equal(t, map[string]string{
+		"shared": "example.com/models/shared",
+		"time":   "time",
+	}, record.RequiredImports)
+
+	// Embedded structs from other packages are resolved, without their unexported fields
+	createdBy := findField(record.Fields, "CreatedBy")
+	require.NotNil(t, createdBy)
+	assert.Equal(t, []string{"encrypt"}, createdBy.EncxTags)
+	assert.Nil(t, findField(record.Fields, "revision"))
+
+	// Aliases resolve to the type they denote, and generic instantiations are kept
+	assert.Equal(t, "shared.Status", findField(record.Fields, "Status").Type)
+	assert.Equal(t, "time.Time", findField(record.Fields, "Created").Type)
+	assert.Equal(t, "shared.Wrapper[string]", findField(record.Fields, "Payload").Type)
+	for _, field := range record.Fields {
+		assert.True(t, field.IsValid, field.Name)
+	}
+
+	// Types the compact serializer does not support are reported
+	invalid := structs[1]
+	assert.Equal(t, "Invalid", invalid.StructName)
+	legacy := findField(invalid.Fields, "Legacy")
+	assert.False(t, legacy.IsValid)
+	assert.Contains(t, legacy.ValidationErrors[0], "unsupported type 'LegacyTime' on field 'Legacy'")
+	assert.False(t, findField(invalid.Fields, "Labels").IsValid)
+	assert.True(t, findField(invalid.Fields, "Note").IsValid)
+}
+
+func TestDiscoverStructsColumnTypes(t *testing.T) {
+	moduleDir := writeTestModule(t, map[string]string{
+		"record.go": `package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+)
+
+type Status string
+
+type Decimal struct {
+	digits string
+}
+
+func (d Decimal) Value() (driver.Value, error) { return d.digits, nil }
+
+func (d *Decimal) Scan(src any) error { return nil }
+
+type Meta struct {
+	Source string
+}
+
+type Record struct {
+	Email   string          ` + "`encx:\"encrypt\"`" + `
+	Status  Status
+	Pending *Status
+	Nick    sql.NullString
+	Deleted sql.NullTime
+	Count   sql.Null[int64]
+	Amount  Decimal
+	Tags    []string
+	Meta    Meta
+}
+`,
+	})
+
+	structs, err := DiscoverStructs(moduleDir, &DiscoveryConfig{})
+	require.NoError(t, err)
+	require.Len(t, structs, 1)
+
+	// Types implementing driver.Valuer and sql.Scanner are stored natively, and other
+	// types by their underlying type
+	columnTypes := map[string]string{}
+	for _, field := range structs[0].Fields {
+		columnTypes[field.Name] = field.ColumnType
+	}
+	assert.Equal(t, map[string]string{
+		"Email":   "string",
+		"Status":  "string",
+		"Pending": "string",
+		"Nick":    "string",
+		"Deleted": "time.Time",
+		"Count":   "int64",
+		"Amount":  "string",
+		"Tags":    "[]string",
+		"Meta":    "models.Meta",
+	}, columnTypes)
+
+	data := BuildTemplateData(structs[0], GenerationConfig{SQLHelpers: true})
+	assert.Equal(t, []SQLColumn{
+		{Name: "Status", DBColumn: "status"},
+		{Name: "Pending", DBColumn: "pending"},
+		{Name: "Nick", DBColumn: "nick"},
+		{Name: "Deleted", DBColumn: "deleted"},
+		{Name: "Count", DBColumn: "count"},
+		{Name: "Amount", DBColumn: "amount"},
+		{Name: "Tags", DBColumn: "tags", JSON: true},
+		{Name: "Meta", DBColumn: "meta", JSON: true},
+		{Name: "EmailEncrypted", DBColumn: "email_encrypted"},
+	}, data.SQLColumns)
+}
+
+func TestDiscoverStructsSourceOnly(t *testing.T) {
+	moduleDir := writeTestModule(t, map[string]string{
+		"record.go": `package models
+
+type LegacyTime struct{}
+
+type Record struct {
+	Legacy LegacyTime ` + "`encx:\"encrypt\"`" + `
+}
+`,
+	})
+
+	// Without type information, unsupported types are not detected
+	structs, err := DiscoverStructs(moduleDir, &DiscoveryConfig{SourceOnly: true})
+	require.NoError(t, err)
+	require.Len(t, structs, 1)
+	assert.True(t, structs[0].Fields[0].IsValid)
+
+	structs, err = DiscoverStructs(moduleDir, &DiscoveryConfig{})
+	require.NoError(t, err)
+	require.Len(t, structs, 1)
+	assert.False(t, structs[0].Fields[0].IsValid)
+}
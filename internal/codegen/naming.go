@@ -0,0 +1,148 @@
+package codegen
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// NamingStrategy derives the db column and JSON field names of the fields of the
+// generated structs whose source fields have no db or json tag, and of companion fields
+type NamingStrategy string
+
+const (
+	// NamingLowercase lowercases field names, e.g. "userid" and "userid_encrypted" for UserID.
+	// It is the default.
+	NamingLowercase NamingStrategy = "lowercase"
+	// NamingSnakeCase converts field names to snake case, e.g. "user_id" and "user_id_encrypted"
+	NamingSnakeCase NamingStrategy = "snake_case"
+	// NamingCamelCase converts field names to camel case, e.g. "userId" and "userIdEncrypted"
+	NamingCamelCase NamingStrategy = "camelCase"
+)
+
+// ParseNamingStrategy parses a naming strategy. An empty string is the default strategy.
+func ParseNamingStrategy(s string) (NamingStrategy, error) {
+	switch NamingStrategy(s) {
+	case "", NamingLowercase:
+		return NamingLowercase, nil
+	case NamingSnakeCase, NamingCamelCase:
+		return NamingStrategy(s), nil
+	default:
+		return "", fmt.Errorf("unknown naming strategy %q, expected %s, %s or %s", s, NamingLowercase, NamingSnakeCase, NamingCamelCase)
+	}
+}
+
+// name returns the name of a field
+func (ns NamingStrategy) name(fieldName string) string {
+	switch ns {
+	case NamingSnakeCase:
+		return ToSnakeCase(fieldName)
+	case NamingCamelCase:
+		words := splitWords(fieldName)
+		for i := 1; i < len(words); i++ {
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		}
+		return strings.Join(words, "")
+	default:
+		return strings.ToLower(fieldName)
+	}
+}
+
+// companionName returns the name of a companion field from the name of its field and
+// the suffix of its Go name, e.g. "email_hash_secure" for "email" and HashSecure. Names
+// from tags keep their style: "user_id" gives "user_id_encrypted" and "userId" gives
+// "userIdEncrypted", whatever the strategy.
+func (ns NamingStrategy) companionName(name, suffix string) string {
+	camelCase := ns == NamingCamelCase
+	if strings.Contains(name, "_") {
+		camelCase = false
+	} else if strings.ToLower(name) != name {
+		camelCase = true
+	}
+
+	if camelCase {
+		return name + suffix
+	}
+	return name + "_" + ToSnakeCase(suffix)
+}
+
+// fieldNames are the db column and JSON field names of a source field, from its tags
+// or its naming strategy
+type fieldNames struct {
+	dbColumn  string // Value of the db tag, e.g. "user_id" or "-"
+	jsonField string // Value of the json tag, e.g. "userId,omitempty" or "-"
+	dbBase    string // Name of the column, from which companion columns are named
+	jsonBase  string // Name of the JSON field, from which companion JSON fields are named
+}
+
+// namesOf returns the names of a field. Tags are carried over as-is to the fields copied
+// from the source struct, and their name part is used to name companion fields, unless
+// it is "-" or empty.
+func (ns NamingStrategy) namesOf(field FieldInfo) fieldNames {
+	names := fieldNames{dbColumn: field.DBTag, jsonField: field.JSONTag}
+
+	names.dbBase, _, _ = strings.Cut(field.DBTag, ",")
+	if names.dbBase == "" || names.dbBase == "-" {
+		names.dbBase = ns.name(field.Name)
+	}
+	names.jsonBase, _, _ = strings.Cut(field.JSONTag, ",")
+	if names.jsonBase == "" || names.jsonBase == "-" {
+		names.jsonBase = ns.name(field.Name)
+	}
+
+	if names.dbColumn == "" {
+		names.dbColumn = names.dbBase
+	}
+	if names.jsonField == "" || strings.HasPrefix(names.jsonField, ",") {
+		names.jsonField = names.jsonBase + names.jsonField
+	}
+	return names
+}
+
+// companionField returns the companion field of a field with the Go name suffix, e.g.
+// EmailHash for Email and Hash
+func (ns NamingStrategy) companionField(field FieldInfo, suffix, fieldType string) TemplateField {
+	names := ns.namesOf(field)
+	return TemplateField{
+		Name:      field.Name + suffix,
+		Type:      fieldType,
+		DBColumn:  ns.companionName(names.dbBase, suffix),
+		JSONField: ns.companionName(names.jsonBase, suffix),
+	}
+}
+
+// sourceTags returns the db and json tags of a struct tag
+func sourceTags(tag string) (dbTag, jsonTag string) {
+	structTag := reflect.StructTag(tag)
+	return structTag.Get("db"), structTag.Get("json")
+}
+
+// ToSnakeCase converts a Go identifier to snake case, keeping acronyms together,
+// e.g. "HashSecure" to "hash_secure" and "HTTPRequestLog" to "http_request_log"
+func ToSnakeCase(s string) string {
+	return strings.Join(splitWords(s), "_")
+}
+
+// splitWords splits a Go identifier into its lowercased words, keeping acronyms
+// together, e.g. "UserID" into "user" and "id"
+func splitWords(s string) []string {
+	runes := []rune(s)
+	var words []string
+	var word []rune
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+				words = append(words, string(word))
+				word = nil
+			}
+		}
+		word = append(word, unicode.ToLower(r))
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
@@ -0,0 +1,129 @@
+package codegen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNamingStrategy(t *testing.T) {
+	for input, want := range map[string]NamingStrategy{
+		"":           NamingLowercase,
+		"lowercase":  NamingLowercase,
+		"snake_case": NamingSnakeCase,
+		"camelCase":  NamingCamelCase,
+	} {
+		strategy, err := ParseNamingStrategy(input)
+		require.NoError(t, err)
+		assert.Equal(t, want, strategy)
+	}
+
+	_, err := ParseNamingStrategy("kebab-case")
+	assert.ErrorContains(t, err, `unknown naming strategy "kebab-case"`)
+}
+
+func TestToSnakeCase(t *testing.T) {
+	assert.Equal(t, "user", ToSnakeCase("User"))
+	assert.Equal(t, "user_profile", ToSnakeCase("UserProfile"))
+	assert.Equal(t, "user_id", ToSnakeCase("UserID"))
+	assert.Equal(t, "http_request_log", ToSnakeCase("HTTPRequestLog"))
+	assert.Equal(t, "hash_secure", ToSnakeCase("HashSecure"))
+	assert.Equal(t, "last4", ToSnakeCase("Last4"))
+}
+
+func TestNamingStrategyCompanionField(t *testing.T) {
+	field := FieldInfo{Name: "UserID", Type: "string"}
+
+	tests := []struct {
+		name     string
+		strategy NamingStrategy
+		field    FieldInfo
+		want     TemplateField
+	}{
+		{"lowercase", NamingLowercase, field, TemplateField{Name: "UserIDEncrypted", Type: "[]byte", DBColumn: "userid_encrypted", JSONField: "userid_encrypted"}},
+		{"snake case", NamingSnakeCase, field, TemplateField{Name: "UserIDEncrypted", Type: "[]byte", DBColumn: "user_id_encrypted", JSONField: "user_id_encrypted"}},
+		{"camel case", NamingCamelCase, field, TemplateField{Name: "UserIDEncrypted", Type: "[]byte", DBColumn: "userIdEncrypted", JSONField: "userIdEncrypted"}},
+		{
+			"tags",
+			NamingLowercase,
+			FieldInfo{Name: "UserID", Type: "string", DBTag: "user_id", JSONTag: "userId,omitempty"},
+			TemplateField{Name: "UserIDEncrypted", Type: "[]byte", DBColumn: "user_id_encrypted", JSONField: "userIdEncrypted"},
+		},
+		{
+			"ignored fields",
+			NamingSnakeCase,
+			FieldInfo{Name: "UserID", Type: "string", DBTag: "-", JSONTag: "-"},
+			TemplateField{Name: "UserIDEncrypted", Type: "[]byte", DBColumn: "user_id_encrypted", JSONField: "user_id_encrypted"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.strategy.companionField(tt.field, "Encrypted", "[]byte"))
+		})
+	}
+}
+
+func TestDiscoverStructsSourceTags(t *testing.T) {
+	moduleDir := writeTestModule(t, map[string]string{
+		"user.go": `package models
+
+type User struct {
+	UserID string ` + "`db:\"user_id\" json:\"userId,omitempty\" encx:\"encrypt\"`" + `
+	Name   string ` + "`json:\"name\"`" + `
+}
+`,
+	})
+
+	for _, sourceOnly := range []bool{false, true} {
+		structs, err := DiscoverStructs(moduleDir, &DiscoveryConfig{SourceOnly: sourceOnly})
+		require.NoError(t, err)
+		require.Len(t, structs, 1)
+
+		userID := findField(structs[0].Fields, "UserID")
+		assert.Equal(t, "user_id", userID.DBTag)
+		assert.Equal(t, "userId,omitempty", userID.JSONTag)
+		assert.Empty(t, findField(structs[0].Fields, "Name").DBTag)
+	}
+}
+
+func TestBuildTemplateDataNaming(t *testing.T) {
+	structInfo := StructInfo{
+		PackageName: "models",
+		StructName:  "Account",
+		SourceFile:  "account.go",
+		Fields: []FieldInfo{
+			{Name: "AccountID", Type: "int", DBTag: "account_id", JSONTag: "accountId", IsValid: true},
+			{Name: "OwnerName", Type: "string", JSONTag: ",omitempty", IsValid: true},
+			{Name: "Secret", Type: "string", DBTag: "-", JSONTag: "-", IsValid: true},
+			{Name: "TaxID", Type: "string", DBTag: "tax_id", EncxTags: []string{"encrypt", "hash_basic"}, IsValid: true},
+			{Name: "PhoneNumber", Type: "string", EncxTags: []string{"hash_secure"}, IsValid: true},
+		},
+	}
+
+	data, err := defaultEngine.BuildTemplateData(structInfo, GenerationConfig{NamingStrategy: NamingSnakeCase})
+	require.NoError(t, err)
+
+	// Source tags are carried over to plain fields, and name the companion fields
+	assert.Equal(t, []TemplateField{
+		{Name: "AccountID", Type: "int", DBColumn: "account_id", JSONField: "accountId"},
+		{Name: "OwnerName", Type: "string", DBColumn: "owner_name", JSONField: "owner_name,omitempty"},
+		{Name: "Secret", Type: "string", DBColumn: "-", JSONField: "-"},
+	}, data.PlainFields)
+	assert.Equal(t, []TemplateField{
+		{Name: "TaxIDEncrypted", Type: "[]byte", DBColumn: "tax_id_encrypted", JSONField: "tax_id_encrypted"},
+		{Name: "TaxIDHash", Type: "string", DBColumn: "tax_id_hash", JSONField: "tax_id_hash"},
+		{Name: "PhoneNumberHashSecure", Type: "string", DBColumn: "phone_number_hash_secure", JSONField: "phone_number_hash_secure"},
+	}, data.EncryptedFields)
+
+	code, err := defaultEngine.GenerateCode(data)
+	require.NoError(t, err)
+	assert.Contains(t, string(code), "`db:\"owner_name\" json:\"owner_name,omitempty\"`")
+
+	// Without a strategy, field names are lowercased
+	data, err = defaultEngine.BuildTemplateData(structInfo, GenerationConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, "ownername", data.PlainFields[1].DBColumn)
+	assert.Equal(t, "phonenumber_hash_secure", data.EncryptedFields[2].DBColumn)
+}
@@ -0,0 +1,153 @@
+package codegen
+
+import (
+	"fmt"
+	"go/token"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// builtinTags are the encx tags implemented by the generator itself
+var builtinTags = []string{"encrypt", "hash_basic", "hash_secure"}
+
+// isBuiltinTag reports whether a tag is implemented by the generator itself
+func isBuiltinTag(tag string) bool {
+	return slices.Contains(builtinTags, strings.TrimSpace(tag))
+}
+
+// reservedSuffixes are the suffixes of the companion fields of the builtin tags, and
+// of the local variables of the generated code
+var reservedSuffixes = []string{"Encrypted", "Hash", "HashSecure", "Bytes", "Encx", "Value"}
+
+// Operation is a user-defined field operation, such as masking or normalization.
+//
+// The generated Process functions apply it to the plaintext value of the fields tagged
+// with it, and store the result in a companion field of the Encx struct. Like hashes,
+// the result is not restored by the Decrypt functions.
+type Operation struct {
+	// Tag is the encx tag applying the operation, e.g. "mask_last4"
+	Tag string
+	// Function is called as Function(ctx, value) (Type, error) with the value of the
+	// field, dereferenced for pointer fields, which are skipped when nil. It is
+	// qualified by its import path, e.g. "github.com/acme/app/masking.Last4", whose
+	// last element must be the package name, or unqualified if it is defined in the
+	// package of the struct.
+	Function string
+	// Suffix names the companion field, e.g. "Last4" for a CardNumberLast4 field
+	Suffix string
+	// Type is the type of the companion field, and the result of Function
+	Type string
+	// ConflictsWith lists the tags that cannot be combined with the operation
+	ConflictsWith []string
+}
+
+// importPath returns the import path of the package of the function, empty if it
+// is defined in the package of the struct
+func (op Operation) importPath() string {
+	importPath, _ := op.splitFunction()
+	return importPath
+}
+
+// callExpr returns the expression calling the function from generated code
+func (op Operation) callExpr() string {
+	importPath, name := op.splitFunction()
+	if importPath == "" {
+		return name
+	}
+	return importPath[strings.LastIndex(importPath, "/")+1:] + "." + name
+}
+
+// splitFunction splits the function into its import path and name
+func (op Operation) splitFunction() (importPath, name string) {
+	lastSlash := strings.LastIndex(op.Function, "/")
+	dot := strings.LastIndex(op.Function, ".")
+	if dot <= lastSlash {
+		return "", op.Function
+	}
+	return op.Function[:dot], op.Function[dot+1:]
+}
+
+// OperationRegistry holds the user-defined operations, by tag
+type OperationRegistry struct {
+	operations map[string]Operation
+}
+
+// NewOperationRegistry creates a registry of user-defined operations, and validates
+// that their tags and companion fields do not collide with each other or with the
+// builtin tags
+func NewOperationRegistry(operations []Operation) (*OperationRegistry, error) {
+	registry := &OperationRegistry{operations: make(map[string]Operation, len(operations))}
+	suffixes := slices.Clone(reservedSuffixes)
+
+	for _, op := range operations {
+		if op.Tag == "" {
+			return nil, fmt.Errorf("operation tag cannot be empty")
+		}
+		if slices.Contains(builtinTags, op.Tag) {
+			return nil, fmt.Errorf("operation %s: tag is builtin", op.Tag)
+		}
+		if _, exists := registry.operations[op.Tag]; exists {
+			return nil, fmt.Errorf("operation %s: duplicate tag", op.Tag)
+		}
+		if strings.ContainsAny(op.Tag, ", \t") {
+			return nil, fmt.Errorf("operation %s: tag cannot contain commas or spaces", op.Tag)
+		}
+
+		importPath, name := op.splitFunction()
+		if !token.IsIdentifier(name) || strings.HasSuffix(importPath, "/") {
+			return nil, fmt.Errorf("operation %s: invalid function %q, expected an import path and function name such as example.com/pkg.Func", op.Tag, op.Function)
+		}
+
+		if !token.IsIdentifier(op.Suffix) || !unicode.IsUpper([]rune(op.Suffix)[0]) {
+			return nil, fmt.Errorf("operation %s: suffix %q must be an exported Go identifier", op.Tag, op.Suffix)
+		}
+		if slices.Contains(suffixes, op.Suffix) {
+			return nil, fmt.Errorf("operation %s: suffix %s is already used", op.Tag, op.Suffix)
+		}
+		suffixes = append(suffixes, op.Suffix)
+
+		if op.Type == "" {
+			return nil, fmt.Errorf("operation %s: type cannot be empty", op.Tag)
+		}
+
+		registry.operations[op.Tag] = op
+	}
+
+	// Conflicts may refer to operations registered after the operation
+	for _, op := range registry.operations {
+		for _, tag := range op.ConflictsWith {
+			if _, found := registry.Lookup(tag); !found && !slices.Contains(builtinTags, tag) {
+				return nil, fmt.Errorf("operation %s: conflicts with unknown tag %s", op.Tag, tag)
+			}
+		}
+	}
+
+	return registry, nil
+}
+
+// Lookup returns the operation registered for a tag. A nil registry has no operations.
+func (r *OperationRegistry) Lookup(tag string) (Operation, bool) {
+	if r == nil {
+		return Operation{}, false
+	}
+	op, found := r.operations[tag]
+	return op, found
+}
+
+// Operations returns the registered operations, sorted by tag
+func (r *OperationRegistry) Operations() []Operation {
+	if r == nil {
+		return nil
+	}
+
+	operations := make([]Operation, 0, len(r.operations))
+	for _, op := range r.operations {
+		operations = append(operations, op)
+	}
+	sort.Slice(operations, func(i, j int) bool {
+		return operations[i].Tag < operations[j].Tag
+	})
+	return operations
+}
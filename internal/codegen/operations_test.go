@@ -0,0 +1,176 @@
+package codegen
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testOperations = []Operation{
+	{
+		Tag:           "mask_last4",
+		Function:      "example.com/app/masking.Last4",
+		Suffix:        "Last4",
+		Type:          "string",
+		ConflictsWith: []string{"hash_secure"},
+	},
+	{
+		Tag:      "normalize_email",
+		Function: "normalizeEmail",
+		Suffix:   "Normalized",
+		Type:     "string",
+	},
+}
+
+func TestNewOperationRegistry(t *testing.T) {
+	registry, err := NewOperationRegistry(testOperations)
+	require.NoError(t, err)
+
+	op, found := registry.Lookup("mask_last4")
+	require.True(t, found)
+	assert.Equal(t, "example.com/app/masking", op.importPath())
+	assert.Equal(t, "masking.Last4", op.callExpr())
+
+	op, found = registry.Lookup("normalize_email")
+	require.True(t, found)
+	assert.Empty(t, op.importPath())
+	assert.Equal(t, "normalizeEmail", op.callExpr())
+
+	_, found = registry.Lookup("encrypt")
+	assert.False(t, found)
+
+	// A nil registry has no operations
+	var empty *OperationRegistry
+	_, found = empty.Lookup("mask_last4")
+	assert.False(t, found)
+	assert.Empty(t, empty.Operations())
+}
+
+func TestNewOperationRegistryErrors(t *testing.T) {
+	valid := Operation{Tag: "tokenize", Function: "example.com/tokens.Tokenize", Suffix: "Token", Type: "string"}
+
+	tests := []struct {
+		name   string
+		modify func(op *Operation)
+		errMsg string
+	}{
+		{"empty tag", func(op *Operation) { op.Tag = "" }, "tag cannot be empty"},
+		{"builtin tag", func(op *Operation) { op.Tag = "encrypt" }, "tag is builtin"},
+		{"tag with comma", func(op *Operation) { op.Tag = "a,b" }, "cannot contain commas"},
+		{"missing function name", func(op *Operation) { op.Function = "example.com/tokens" }, "invalid function"},
+		{"invalid function name", func(op *Operation) { op.Function = "example.com/tokens.1st" }, "invalid function"},
+		{"unexported suffix", func(op *Operation) { op.Suffix = "token" }, "must be an exported Go identifier"},
+		{"empty suffix", func(op *Operation) { op.Suffix = "" }, "must be an exported Go identifier"},
+		{"builtin suffix", func(op *Operation) { op.Suffix = "HashSecure" }, "suffix HashSecure is already used"},
+		{"reserved suffix", func(op *Operation) { op.Suffix = "Bytes" }, "suffix Bytes is already used"},
+		{"empty type", func(op *Operation) { op.Type = "" }, "type cannot be empty"},
+		{"unknown conflict", func(op *Operation) { op.ConflictsWith = []string{"mask"} }, "conflicts with unknown tag mask"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := valid
+			tt.modify(&op)
+			_, err := NewOperationRegistry([]Operation{op})
+			assert.ErrorContains(t, err, tt.errMsg)
+		})
+	}
+
+	_, err := NewOperationRegistry([]Operation{valid, valid})
+	assert.ErrorContains(t, err, "duplicate tag")
+
+	other := valid
+	other.Tag = "tokenize_v2"
+	_, err = NewOperationRegistry([]Operation{valid, other})
+	assert.ErrorContains(t, err, "suffix Token is already used")
+}
+
+func TestTagValidatorWithOperations(t *testing.T) {
+	registry, err := NewOperationRegistry(testOperations)
+	require.NoError(t, err)
+	validator := NewTagValidatorWithOperations(registry)
+
+	assert.Empty(t, validator.ValidateFieldTags("Card", []string{"encrypt", "mask_last4"}))
+	assert.Empty(t, validator.ValidateFieldTags("Email", []string{"hash_basic", "normalize_email"}))
+
+	errors := validator.ValidateFieldTags("Card", []string{"hash_secure", "mask_last4"})
+	require.Len(t, errors, 1)
+	assert.Contains(t, errors[0], "invalid tag combination on field 'Card': mask_last4,hash_secure")
+
+	// Without the registry, the tags are unknown
+	errors = NewTagValidator().ValidateFieldTags("Card", []string{"mask_last4"})
+	require.Len(t, errors, 1)
+	assert.Contains(t, errors[0], "unknown tag 'mask_last4'")
+}
+
+func TestDiscoverStructsWithOperations(t *testing.T) {
+	moduleDir := writeTestModule(t, map[string]string{
+		"card.go": `package models
+
+type Card struct {
+	Number string            ` + "`encx:\"encrypt,mask_last4\"`" + `
+	Labels map[string]string ` + "`encx:\"normalize_email\"`" + `
+}
+`,
+	})
+
+	registry, err := NewOperationRegistry(testOperations)
+	require.NoError(t, err)
+
+	structs, err := DiscoverStructs(moduleDir, &DiscoveryConfig{Operations: registry})
+	require.NoError(t, err)
+	require.Len(t, structs, 1)
+
+	// User-defined operations receive the value as-is, so any type is supported
+	for _, field := range structs[0].Fields {
+		assert.True(t, field.IsValid, field.Name)
+	}
+
+	structs, err = DiscoverStructs(moduleDir, &DiscoveryConfig{})
+	require.NoError(t, err)
+	require.Len(t, structs, 1)
+	assert.False(t, findField(structs[0].Fields, "Number").IsValid)
+	assert.Contains(t, findField(structs[0].Fields, "Number").ValidationErrors[0], "unknown tag 'mask_last4'")
+}
+
+func TestBuildTemplateDataWithOperations(t *testing.T) {
+	registry, err := NewOperationRegistry(testOperations)
+	require.NoError(t, err)
+
+	structInfo := StructInfo{
+		PackageName: "models",
+		StructName:  "Customer",
+		SourceFile:  "customer.go",
+		Fields: []FieldInfo{
+			{Name: "Card", Type: "string", EncxTags: []string{"encrypt", "hash_basic", "mask_last4"}, IsValid: true},
+			{Name: "Email", Type: "*string", EncxTags: []string{"normalize_email"}, IsValid: true},
+			// Companion field declared in the source struct
+			{Name: "CardLast4", Type: "string", IsValid: true},
+		},
+	}
+
+	data, err := defaultEngine.BuildTemplateData(structInfo, GenerationConfig{Operations: registry})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"example.com/app/masking"}, data.Imports)
+	assert.Empty(t, data.PlainFields)
+	assert.Contains(t, data.EncryptedFields, TemplateField{Name: "CardLast4", Type: "string", DBColumn: "card_last4", JSONField: "card_last4"})
+	assert.Contains(t, data.EncryptedFields, TemplateField{Name: "EmailNormalized", Type: "string", DBColumn: "email_normalized", JSONField: "email_normalized"})
+
+	code, err := defaultEngine.GenerateCode(data)
+	require.NoError(t, err)
+	codeStr := string(code)
+
+	// Builtin tags still serialize once, and operations are applied to the value
+	assert.Contains(t, codeStr, "// Process Card (encrypt + hash_basic)")
+	assert.Contains(t, codeStr, "CardLast4, err := masking.Last4(ctx, source.Card)")
+	assert.Contains(t, codeStr, `errs.Set("Card mask_last4", err)`)
+	assert.Contains(t, codeStr, "if source.Email != nil {")
+	assert.Contains(t, codeStr, "EmailNormalized, err := normalizeEmail(ctx, *source.Email)")
+
+	_, err = parser.ParseFile(token.NewFileSet(), "customer_encx.go", code, parser.AllErrors)
+	assert.NoError(t, err)
+}
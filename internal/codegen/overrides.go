@@ -0,0 +1,145 @@
+package codegen
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// TemplateExtension is the extension of the files of a templates directory
+const TemplateExtension = ".tmpl"
+
+// TemplateNames returns the names of the templates that a templates directory can override
+func TemplateNames() []string {
+	names := make([]string, len(defaultTemplates))
+	for i, def := range defaultTemplates {
+		names[i] = def.name
+	}
+	return names
+}
+
+// NewTemplateEngineFromDir creates a template engine whose templates are overridden by
+// the files of a directory. Each file is named after the template it overrides, e.g.
+// process.tmpl or encrypt_step.tmpl; templates without a file keep their default.
+func NewTemplateEngineFromDir(dir string) (*TemplateEngine, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates directory: %w", err)
+	}
+
+	names := TemplateNames()
+	overrides := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != TemplateExtension {
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), TemplateExtension)
+		if !slices.Contains(names, name) {
+			return nil, fmt.Errorf("unknown template %s in %s, expected one of: %s", entry.Name(), dir, strings.Join(names, ", "))
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template %s: %w", entry.Name(), err)
+		}
+		overrides[name] = string(content)
+	}
+
+	return newTemplateEngine(overrides)
+}
+
+// Validate renders sample structs with the templates of the engine, covering every
+// template, and checks that the generated code and tests parse as Go
+func (te *TemplateEngine) Validate() error {
+	operations, err := NewOperationRegistry([]Operation{sampleOperation})
+	if err != nil {
+		return err
+	}
+
+	var structs []TemplateData
+	for _, structInfo := range sampleStructs() {
+		data, err := te.BuildTemplateData(structInfo, GenerationConfig{Operations: operations, SQLHelpers: true})
+		if err != nil {
+			return err
+		}
+		structs = append(structs, data)
+	}
+
+	code, err := te.GenerateFile(structs)
+	if err != nil {
+		return err
+	}
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "customer_encx.go", code, parser.AllErrors); err != nil {
+		return fmt.Errorf("generated code is not valid Go: %w", err)
+	}
+
+	testCode, err := te.GenerateTestFile(structs)
+	if err != nil {
+		return err
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "customer_encx_test.go", testCode, parser.AllErrors); err != nil {
+		return fmt.Errorf("generated tests are not valid Go: %w", err)
+	}
+	return nil
+}
+
+// sampleOperation is the user-defined operation of the sample structs
+var sampleOperation = Operation{
+	Tag:      "mask",
+	Function: "example.com/masking.Mask",
+	Suffix:   "Masked",
+	Type:     "string",
+}
+
+// sampleStructs returns a top-level struct using every tag combination and nested
+// field shape, and the struct nested in it
+func sampleStructs() []StructInfo {
+	nestedField := func(name, fieldType string) FieldInfo {
+		field := newFieldInfo(name, fieldType, nil)
+		field.NestedType, field.NestedSlice, field.NestedPointer = parseNestedType(fieldType)
+		return field
+	}
+
+	address := StructInfo{
+		PackageName: "models",
+		StructName:  "Address",
+		SourceFile:  "customer.go",
+		HasEncxTags: true,
+		IsNested:    true,
+		Fields: []FieldInfo{
+			newFieldInfo("Street", "string", []string{"encrypt"}),
+			newFieldInfo("City", "string", nil),
+		},
+		GenerationOptions: map[string]string{},
+		RequiredImports:   map[string]string{},
+	}
+
+	customer := StructInfo{
+		PackageName: "models",
+		StructName:  "Customer",
+		SourceFile:  "customer.go",
+		HasEncxTags: true,
+		Fields: []FieldInfo{
+			newFieldInfo("ID", "int", nil),
+			newFieldInfo("Email", "string", []string{"encrypt", "hash_basic"}),
+			newFieldInfo("Password", "string", []string{"hash_secure"}),
+			newFieldInfo("Username", "string", []string{"hash_basic", "mask"}),
+			newFieldInfo("Phone", "*string", []string{"encrypt"}),
+			newFieldInfo("BirthDate", "time.Time", []string{"encrypt"}),
+			nestedField("Billing", "Address"),
+			nestedField("Shipping", "*Address"),
+			nestedField("Previous", "[]Address"),
+			nestedField("Contacts", "[]*Address"),
+		},
+		GenerationOptions: map[string]string{"table": "customers", "redact": "true"},
+		RequiredImports:   map[string]string{"time": "time"},
+	}
+
+	return []StructInfo{customer, address}
+}
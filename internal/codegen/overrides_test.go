@@ -0,0 +1,109 @@
+package codegen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTemplates writes template overrides to a directory and returns it
+func writeTemplates(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestNewTemplateEngineFromDir(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"imports.tmpl": `"log/slog"`,
+		"struct.tmpl": `
+// {{.StructName}}Encx is the encrypted {{.StructName}}
+type {{.StructName}}Encx struct {
+	{{range .PlainFields}}{{.Name}} {{.Type}}
+	{{end}}{{range .EncryptedFields}}{{.Name}} {{.Type}}
+	{{end}}{{range .NestedFields}}{{.Name}} {{.Type}}
+	{{end}}{{if not .IsNested}}DEKEncrypted []byte
+	KeyVersion int
+	Metadata encx.EncryptionMetadata
+	{{end}}
+}
+
+// TableName returns the table of {{.StructName}}Encx
+func ({{.StructName}}Encx) TableName() string { return "{{.StructName}}" }
+`,
+		"encrypt_step.tmpl": `
+	slog.DebugContext(ctx, "encrypting field", "field", {{printf "%q" .FieldName}})
+	{{.FieldName}}Bytes, err := encx.SerializeValue(source.{{.FieldName}})
+	if err != nil {
+		errs.Set({{.ErrPrefix}}{{.FieldName}} serialization", err)
+	} else if result.{{.FieldName}}Encrypted, err = crypto.EncryptData(ctx, {{.FieldName}}Bytes, dek); err != nil {
+		errs.Set({{.ErrPrefix}}{{.FieldName}} encryption", err)
+	}`,
+		"README.md": "Files without the .tmpl extension are ignored",
+	})
+
+	engine, err := NewTemplateEngineFromDir(dir)
+	require.NoError(t, err)
+	require.NoError(t, engine.Validate())
+
+	defaultEngine, err := NewTemplateEngine()
+	require.NoError(t, err)
+	assert.NotEqual(t, defaultEngine.Hash(), engine.Hash())
+
+	structInfo := StructInfo{
+		PackageName: "models",
+		StructName:  "User",
+		SourceFile:  "user.go",
+		Fields: []FieldInfo{
+			newFieldInfo("Email", "string", []string{"encrypt"}),
+			newFieldInfo("Phone", "string", []string{"encrypt", "hash_basic"}),
+		},
+	}
+	data, err := engine.BuildTemplateData(structInfo, GenerationConfig{})
+	require.NoError(t, err)
+
+	code, err := engine.GenerateCode(data)
+	require.NoError(t, err)
+	codeStr := string(code)
+
+	// Overridden templates are used, and the others keep their default
+	assert.Contains(t, codeStr, `"log/slog"`)
+	assert.Contains(t, codeStr, "func (UserEncx) TableName() string")
+	assert.Contains(t, codeStr, `slog.DebugContext(ctx, "encrypting field", "field", "Email")`)
+	assert.Contains(t, codeStr, "// Process Phone (encrypt + hash_basic)")
+	assert.Contains(t, codeStr, "func DecryptUserEncx(")
+}
+
+func TestNewTemplateEngineFromDirErrors(t *testing.T) {
+	_, err := NewTemplateEngineFromDir(filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorContains(t, err, "failed to read templates directory")
+
+	_, err = NewTemplateEngineFromDir(writeTemplates(t, map[string]string{"proces.tmpl": ""}))
+	assert.ErrorContains(t, err, "unknown template proces.tmpl")
+
+	_, err = NewTemplateEngineFromDir(writeTemplates(t, map[string]string{"process.tmpl": "{{if .IsNested}}"}))
+	assert.ErrorContains(t, err, "failed to parse process template")
+}
+
+func TestTemplateEngineValidate(t *testing.T) {
+	engine, err := NewTemplateEngine()
+	require.NoError(t, err)
+	assert.NoError(t, engine.Validate())
+
+	// Templates referring to data they do not receive fail to render
+	engine, err = NewTemplateEngineFromDir(writeTemplates(t, map[string]string{"decrypt_step.tmpl": "{{.StructName}}"}))
+	require.NoError(t, err)
+	assert.ErrorContains(t, engine.Validate(), "failed to render decrypt_step template")
+
+	// Templates rendering invalid Go are reported
+	engine, err = NewTemplateEngineFromDir(writeTemplates(t, map[string]string{"nested.tmpl": "func {"}))
+	require.NoError(t, err)
+	assert.ErrorContains(t, engine.Validate(), "generated code is not valid Go")
+}
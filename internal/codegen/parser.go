@@ -6,6 +6,7 @@ import (
 	"go/parser"
 	"go/token"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
@@ -16,6 +17,7 @@ type StructInfo struct {
 	SourceFile        string
 	Fields            []FieldInfo
 	HasEncxTags       bool
+	IsNested          bool              // Used as a field of other encx structs, and encrypted with their DEK
 	GenerationOptions map[string]string // From //encx:options comments
 	RequiredImports   map[string]string // package name -> import path
 }
@@ -25,17 +27,153 @@ type FieldInfo struct {
 	Name             string
 	Type             string
 	EncxTags         []string
+	DBTag            string // Value of the db tag of the source field, carried over to the generated struct
+	JSONTag          string // Value of the json tag of the source field, carried over to the generated struct
 	IsValid          bool
 	ValidationErrors []string
+
+	// ColumnType is the Go type whose column stores the field, resolved from type
+	// information, e.g. "string" for a type Status string or "time.Time" for a
+	// sql.NullTime. It is empty for fields discovered from source only.
+	ColumnType string
+
+	// NestedType is the local struct type of a field without encx tags whose
+	// struct has encx fields of its own, e.g. "Address" for a field of type
+	// Address, *Address, []Address or []*Address
+	NestedType    string
+	NestedSlice   bool // The field is a slice of NestedType
+	NestedPointer bool // The field, or the slice elements, are pointers to NestedType
 }
 
 // DiscoveryConfig holds configuration for struct discovery
 type DiscoveryConfig struct {
 	SkipPackages []string
+	// SourceOnly skips type-checking and discovers structs from the source files only
+	SourceOnly bool
+	// Operations are the user-defined operations whose tags are accepted besides the builtin ones
+	Operations *OperationRegistry
+	// Tags are the encx tags of fields whose struct tags cannot be edited, such as the
+	// fields of protobuf messages, by struct name and field name. They take precedence
+	// over struct tags and (encx.field) options.
+	Tags map[string]map[string][]string
+	// ProtoFieldOption is the number of the encx.field extension in options.proto, for
+	// modules where ProtoFieldOptionNumber is taken. Zero means ProtoFieldOptionNumber.
+	ProtoFieldOption int
+}
+
+// protoFieldOption returns the number of the encx.field extension
+func (c *DiscoveryConfig) protoFieldOption() int {
+	if c.ProtoFieldOption == 0 {
+		return ProtoFieldOptionNumber
+	}
+	return c.ProtoFieldOption
 }
 
-// DiscoverStructs discovers structs with encx tags in the given package path
+// DiscoverStructs discovers structs with encx tags in the given package path.
+//
+// The package is loaded and type-checked with golang.org/x/tools/go/packages, which
+// resolves field types from other packages and reports types the compact serializer
+// does not support. If the package cannot be loaded, for example because it is not
+// part of a Go module, discovery falls back to parsing the source files.
+//
+// Besides struct tags, the fields of protobuf messages generated by protoc-gen-go
+// take the tags of their (encx.field) options, and any field the tags of config.Tags.
 func DiscoverStructs(packagePath string, config *DiscoveryConfig) ([]StructInfo, error) {
+	if config == nil {
+		config = &DiscoveryConfig{}
+	}
+
+	var structs []StructInfo
+	var err error
+	if !config.SourceOnly {
+		structs, err = discoverStructsWithTypes(packagePath, config)
+	}
+	if config.SourceOnly || err != nil {
+		structs, err = discoverStructsFromSource(packagePath, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := checkConfiguredTags(structs, config.Tags); err != nil {
+		return nil, err
+	}
+
+	validateStructTags(structs, NewTagValidatorWithOperations(config.Operations))
+	return structs, nil
+}
+
+// packageFieldTags returns the encx tags of the fields of the structs of a package set
+// outside of struct tags, by struct name and field name: the (encx.field) options of
+// its protobuf messages, and the configured tags, which take precedence
+func packageFieldTags(files map[string]*ast.File, config *DiscoveryConfig) (map[string]map[string][]string, error) {
+	tags := make(map[string]map[string][]string)
+	for fileName, file := range files {
+		protoTags, err := protoFieldTags(file, config.protoFieldOption())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(fileName), err)
+		}
+		for structName, fieldTags := range protoTags {
+			tags[structName] = fieldTags
+		}
+	}
+	for structName, fieldTags := range config.Tags {
+		if tags[structName] == nil {
+			tags[structName] = make(map[string][]string)
+		}
+		for fieldName, encxTags := range fieldTags {
+			tags[structName][fieldName] = encxTags
+		}
+	}
+	return tags, nil
+}
+
+// applyFieldTags sets the encx tags of the fields of a struct set outside of struct tags
+func applyFieldTags(structInfo *StructInfo, fieldTags map[string][]string) {
+	for i := range structInfo.Fields {
+		if encxTags, found := fieldTags[structInfo.Fields[i].Name]; found {
+			structInfo.Fields[i].EncxTags = encxTags
+			structInfo.HasEncxTags = true
+		}
+	}
+}
+
+// checkConfiguredTags checks that the configured tags name fields of discovered structs,
+// so that a renamed field does not silently lose its encryption
+func checkConfiguredTags(structs []StructInfo, configTags map[string]map[string][]string) error {
+	for structName, fieldTags := range configTags {
+		index := slices.IndexFunc(structs, func(s StructInfo) bool { return s.StructName == structName })
+		if index < 0 {
+			return fmt.Errorf("tags: struct %s not found", structName)
+		}
+		for fieldName := range fieldTags {
+			if !slices.ContainsFunc(structs[index].Fields, func(f FieldInfo) bool { return f.Name == fieldName }) {
+				return fmt.Errorf("tags: struct %s has no field %s", structName, fieldName)
+			}
+		}
+	}
+	return nil
+}
+
+// validateStructTags validates the encx tags of the fields of the structs
+func validateStructTags(structs []StructInfo, validator *TagValidator) {
+	for i := range structs {
+		for j := range structs[i].Fields {
+			field := &structs[i].Fields[j]
+			if len(field.EncxTags) == 0 {
+				continue
+			}
+
+			if errors := validator.ValidateFieldTags(field.Name, field.EncxTags); len(errors) > 0 {
+				field.IsValid = false
+				field.ValidationErrors = append(errors, field.ValidationErrors...)
+			}
+		}
+	}
+}
+
+// discoverStructsFromSource discovers structs with encx tags by parsing the source
+// files of the given package path, without type information
+func discoverStructsFromSource(packagePath string, config *DiscoveryConfig) ([]StructInfo, error) {
 	var structs []StructInfo
 
 	// Parse all .go files in the package
@@ -72,10 +210,26 @@ func DiscoverStructs(packagePath string, config *DiscoveryConfig) ([]StructInfo,
 			})
 		}
 
+		fieldTags, err := packageFieldTags(pkg.Files, config)
+		if err != nil {
+			return nil, err
+		}
+
 		// Second pass: analyze structs with embedded field resolution
+		var pkgStructs []StructInfo
 		for fileName, file := range pkg.Files {
 			fileImports := fileImportsMap[fileName]
-			structs = append(structs, discoverStructsInFile(fset, fileName, file, pkgName, fileImports, structDefs)...)
+			for _, structInfo := range discoverStructsInFile(fset, fileName, file, pkgName, fileImports, structDefs) {
+				applyFieldTags(&structInfo, fieldTags[structInfo.StructName])
+				pkgStructs = append(pkgStructs, structInfo)
+			}
+		}
+
+		// Third pass: link nested structs and keep the structs with encx tags
+		for _, structInfo := range resolveNestedStructs(pkgStructs) {
+			if structInfo.HasEncxTags {
+				structs = append(structs, structInfo)
+			}
 		}
 	}
 
@@ -130,9 +284,7 @@ func discoverStructsInFile(fset *token.FileSet, fileName string, file *ast.File,
 						// Restore original doc to avoid side effects
 						typeSpec.Doc = originalDoc
 
-						if structInfo.HasEncxTags {
-							structs = append(structs, structInfo)
-						}
+						structs = append(structs, structInfo)
 					}
 				}
 			}
@@ -189,6 +341,11 @@ func analyzeStruct(fset *token.FileSet, fileName, pkgName string, typeSpec *ast.
 			continue
 		}
 
+		// Internal fields of protobuf messages are not copied
+		if isProtoInternalField(field, fileImports) {
+			continue
+		}
+
 		// Handle regular named fields
 		for _, name := range field.Names {
 			fieldInfo := analyzeField(name.Name, field)
@@ -212,6 +369,56 @@ func analyzeStruct(fset *token.FileSet, fileName, pkgName string, typeSpec *ast.
 	return structInfo
 }
 
+// resolveNestedStructs links the fields without encx tags whose type is a local struct
+// with encx tags (directly or through its own nested structs) to that struct.
+//
+// The enclosing struct is then considered to have encx tags, and the nested struct is
+// marked as nested, so that it is generated as a helper encrypted with the DEK of the
+// enclosing struct.
+func resolveNestedStructs(structs []StructInfo) []StructInfo {
+	index := make(map[string]int, len(structs))
+	for i := range structs {
+		index[structs[i].StructName] = i
+	}
+
+	// Repeat until no field is linked, as linking a field may give encx tags to a
+	// struct that is itself nested in another one
+	for changed := true; changed; {
+		changed = false
+		for i := range structs {
+			for j := range structs[i].Fields {
+				field := &structs[i].Fields[j]
+				if len(field.EncxTags) > 0 || field.NestedType != "" {
+					continue
+				}
+
+				typeName, isSlice, isPointer := parseNestedType(field.Type)
+				nested, found := index[typeName]
+				if !found || !structs[nested].HasEncxTags {
+					continue
+				}
+
+				field.NestedType = typeName
+				field.NestedSlice = isSlice
+				field.NestedPointer = isPointer
+				structs[nested].IsNested = true
+				structs[i].HasEncxTags = true
+				changed = true
+			}
+		}
+	}
+
+	return structs
+}
+
+// parseNestedType splits a field type into its base type name and whether it is a
+// slice and/or a pointer, e.g. "[]*Contact" -> ("Contact", true, true)
+func parseNestedType(typeStr string) (typeName string, isSlice, isPointer bool) {
+	typeStr, isSlice = strings.CutPrefix(typeStr, "[]")
+	typeStr, isPointer = strings.CutPrefix(typeStr, "*")
+	return typeStr, isSlice, isPointer
+}
+
 // resolveEmbeddedField resolves an embedded struct field by looking up its definition
 // and recursively extracting all its fields
 func resolveEmbeddedField(field *ast.Field, fileImports map[string]string, structDefs map[string]*ast.StructType) []FieldInfo {
@@ -291,33 +498,31 @@ func extractPackageNamesFromType(typeStr string) []string {
 
 // analyzeField analyzes a single field for encx tags
 func analyzeField(fieldName string, field *ast.Field) FieldInfo {
-	fieldInfo := FieldInfo{
-		Name:             fieldName,
-		Type:             getTypeString(field.Type),
-		EncxTags:         []string{},
-		IsValid:          true,
-		ValidationErrors: []string{},
-	}
-
 	// Extract encx tags from struct tags
+	encxTags := []string{}
+	var tagValue string
 	if field.Tag != nil {
-		tagValue := strings.Trim(field.Tag.Value, "`")
-		fieldInfo.EncxTags = extractEncxTags(tagValue)
-	}
-
-	// Validate tags if any exist
-	if len(fieldInfo.EncxTags) > 0 {
-		validator := NewTagValidator()
-		errors := validator.ValidateFieldTags(fieldName, fieldInfo.EncxTags)
-		if len(errors) > 0 {
-			fieldInfo.IsValid = false
-			fieldInfo.ValidationErrors = errors
-		}
+		tagValue = strings.Trim(field.Tag.Value, "`")
+		encxTags = extractEncxTags(tagValue)
 	}
 
+	fieldInfo := newFieldInfo(fieldName, getTypeString(field.Type), encxTags)
+	fieldInfo.DBTag, fieldInfo.JSONTag = sourceTags(tagValue)
 	return fieldInfo
 }
 
+// newFieldInfo creates the information of a field. Its encx tags are validated once
+// the structs are discovered, against the builtin and user-defined operations.
+func newFieldInfo(fieldName, fieldType string, encxTags []string) FieldInfo {
+	return FieldInfo{
+		Name:             fieldName,
+		Type:             fieldType,
+		EncxTags:         encxTags,
+		IsValid:          true,
+		ValidationErrors: []string{},
+	}
+}
+
 // getTypeString converts an ast.Expr to its string representation
 func getTypeString(expr ast.Expr) string {
 	switch t := expr.(type) {
@@ -403,6 +608,12 @@ func validateGenerationOptions(options map[string]string) error {
 		switch key {
 		case "serializer":
 			return fmt.Errorf("serializer option is no longer supported; ENCX now uses a built-in compact serializer")
+		case "context.":
+			return fmt.Errorf("context option requires a key (context.<key>=<value>)")
+		case "redact":
+			if value := options[key]; value != "true" && value != "false" {
+				return fmt.Errorf("redact option must be true or false, got %q", value)
+			}
 		default:
 			// For now, ignore unknown options to allow for future extensions
 			// Could be made stricter based on configuration
@@ -384,4 +384,86 @@ type Estimate struct {
 		}
 	}
 	assert.Len(t, fieldsWithEncxTags, 5, "Should have 5 fields with encx tags")
-}
\ No newline at end of file
+}
+func TestDiscoverStructsWithNestedStructs(t *testing.T) {
+	tempDir := t.TempDir()
+
+	testFile := filepath.Join(tempDir, "patient.go")
+	err := os.WriteFile(testFile, []byte(`package test
+
+type Address struct {
+	Street string `+"`encx:\"encrypt\"`"+`
+	City   string
+}
+
+type EmergencyContact struct {
+	Name    string
+	Phone   string `+"`encx:\"encrypt\"`"+`
+	Address *Address
+}
+
+// Record has no encx tags of its own, only a nested struct with encx tags
+type Record struct {
+	Patient Patient
+}
+
+type Patient struct {
+	ID          int
+	SSN         string `+"`encx:\"encrypt\"`"+`
+	HomeAddress Address
+	Contacts    []EmergencyContact
+	Others      []*EmergencyContact
+	Tags        []string
+	Plain       Plain
+}
+
+// Plain has no encx tags and is copied as-is
+type Plain struct {
+	Note string
+}
+`), 0644)
+	require.NoError(t, err)
+
+	structs, err := DiscoverStructs(tempDir, &DiscoveryConfig{})
+	require.NoError(t, err)
+
+	byName := make(map[string]StructInfo)
+	for _, s := range structs {
+		byName[s.StructName] = s
+	}
+	require.Len(t, byName, 4)
+	assert.NotContains(t, byName, "Plain")
+
+	assert.True(t, byName["Address"].IsNested)
+	assert.True(t, byName["EmergencyContact"].IsNested)
+	assert.True(t, byName["Patient"].IsNested)
+	assert.False(t, byName["Record"].IsNested)
+	assert.True(t, byName["Record"].HasEncxTags)
+
+	patient := byName["Patient"]
+	homeAddress := findField(patient.Fields, "HomeAddress")
+	require.NotNil(t, homeAddress)
+	assert.Equal(t, "Address", homeAddress.NestedType)
+	assert.False(t, homeAddress.NestedSlice)
+	assert.False(t, homeAddress.NestedPointer)
+
+	contacts := findField(patient.Fields, "Contacts")
+	require.NotNil(t, contacts)
+	assert.Equal(t, "EmergencyContact", contacts.NestedType)
+	assert.True(t, contacts.NestedSlice)
+	assert.False(t, contacts.NestedPointer)
+
+	others := findField(patient.Fields, "Others")
+	require.NotNil(t, others)
+	assert.Equal(t, "EmergencyContact", others.NestedType)
+	assert.True(t, others.NestedSlice)
+	assert.True(t, others.NestedPointer)
+
+	assert.Empty(t, findField(patient.Fields, "Tags").NestedType)
+	assert.Empty(t, findField(patient.Fields, "Plain").NestedType)
+
+	address := findField(byName["EmergencyContact"].Fields, "Address")
+	require.NotNil(t, address)
+	assert.Equal(t, "Address", address.NestedType)
+	assert.True(t, address.NestedPointer)
+}
@@ -0,0 +1,352 @@
+package codegen
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ProtoFieldOptionNumber is the default number of the encx.field extension of
+// google.protobuf.FieldOptions, declared in proto/encx/options.proto. It is in the
+// range reserved for extensions internal to an organization, so modules already
+// using it pick another number with DiscoveryConfig.ProtoFieldOption.
+const ProtoFieldOptionNumber = 50100
+
+// protoimplPath is the package of the internal fields of protobuf messages
+const protoimplPath = "google.golang.org/protobuf/runtime/protoimpl"
+
+// Field numbers of the descriptor.proto messages read from raw descriptors
+const (
+	fileMessageTypeNumber  = 4 // FileDescriptorProto.message_type
+	messageNameNumber      = 1 // DescriptorProto.name
+	messageFieldNumber     = 2 // DescriptorProto.field
+	messageNestedNumber    = 3 // DescriptorProto.nested_type
+	fieldNameNumber        = 1 // FieldDescriptorProto.name
+	fieldOptionsNumber     = 8 // FieldDescriptorProto.options
+	encxEncryptNumber      = 1 // encx.FieldOptions.encrypt
+	encxHashBasicNumber    = 2 // encx.FieldOptions.hash_basic
+	encxHashSecureNumber   = 3 // encx.FieldOptions.hash_secure
+	protoWireVarint        = 0
+	protoWireFixed64       = 1
+	protoWireLengthDelimit = 2
+	protoWireFixed32       = 5
+)
+
+// protoFieldTags returns the encx tags of the fields of the protobuf messages of a file
+// generated by protoc-gen-go, by struct name and field name, from the (encx.field)
+// options of the raw descriptor embedded in the file, the extension numbered
+// optionNumber. It returns nil for other files.
+func protoFieldTags(file *ast.File, optionNumber int) (map[string]map[string][]string, error) {
+	rawDesc := protoRawDescriptor(file)
+	if rawDesc == nil {
+		return nil, nil
+	}
+
+	// Tags by Go name of the message and proto name of the field
+	messageTags := make(map[string]map[string][]string)
+	err := readProtoFields(rawDesc, func(num, wireType int, _ uint64, value []byte) error {
+		if num != fileMessageTypeNumber || wireType != protoWireLengthDelimit {
+			return nil
+		}
+		return readProtoMessage(value, "", optionNumber, messageTags)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid protobuf descriptor: %w", err)
+	}
+	if len(messageTags) == 0 {
+		return nil, nil
+	}
+
+	// Match the proto names of the fields with the protobuf tags of the struct fields
+	tags := make(map[string]map[string][]string)
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			structType, ok := typeSpec.Type.(*ast.StructType)
+			fieldTags, found := messageTags[typeSpec.Name.Name]
+			if !ok || !found {
+				continue
+			}
+			for _, field := range structType.Fields.List {
+				if field.Tag == nil || len(field.Names) != 1 {
+					continue
+				}
+				tagValue, _ := strconv.Unquote(field.Tag.Value)
+				if encxTags, found := fieldTags[protoFieldName(tagValue)]; found {
+					if tags[typeSpec.Name.Name] == nil {
+						tags[typeSpec.Name.Name] = make(map[string][]string)
+					}
+					tags[typeSpec.Name.Name][field.Names[0].Name] = encxTags
+				}
+			}
+		}
+	}
+	return tags, nil
+}
+
+// protoRawDescriptor returns the raw descriptor of a file generated by protoc-gen-go,
+// declared as file_<name>_rawDesc, either as a []byte literal or a string constant
+func protoRawDescriptor(file *ast.File) []byte {
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || (genDecl.Tok != token.VAR && genDecl.Tok != token.CONST) {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			for i, name := range valueSpec.Names {
+				if !strings.HasPrefix(name.Name, "file_") || !strings.HasSuffix(name.Name, "_rawDesc") || i >= len(valueSpec.Values) {
+					continue
+				}
+				if data, ok := literalBytes(valueSpec.Values[i]); ok {
+					return data
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// literalBytes evaluates a []byte literal of integers, or a concatenation of string literals
+func literalBytes(expr ast.Expr) ([]byte, bool) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING {
+			return nil, false
+		}
+		value, err := strconv.Unquote(e.Value)
+		return []byte(value), err == nil
+	case *ast.BinaryExpr:
+		left, ok := literalBytes(e.X)
+		if !ok || e.Op != token.ADD {
+			return nil, false
+		}
+		right, ok := literalBytes(e.Y)
+		return append(left, right...), ok
+	case *ast.ParenExpr:
+		return literalBytes(e.X)
+	case *ast.CompositeLit:
+		data := make([]byte, 0, len(e.Elts))
+		for _, elt := range e.Elts {
+			lit, ok := elt.(*ast.BasicLit)
+			if !ok || lit.Kind != token.INT {
+				return nil, false
+			}
+			value, err := strconv.ParseUint(lit.Value, 0, 8)
+			if err != nil {
+				return nil, false
+			}
+			data = append(data, byte(value))
+		}
+		return data, true
+	default:
+		return nil, false
+	}
+}
+
+// readProtoMessage reads a DescriptorProto and its nested messages, and adds the encx
+// tags of their fields to tags by Go name of the message, e.g. "User_Address" for
+// the message Address nested in User
+func readProtoMessage(data []byte, parent string, optionNumber int, tags map[string]map[string][]string) error {
+	var name string
+	var fields, nested [][]byte
+	err := readProtoFields(data, func(num, wireType int, _ uint64, value []byte) error {
+		if wireType != protoWireLengthDelimit {
+			return nil
+		}
+		switch num {
+		case messageNameNumber:
+			name = string(value)
+		case messageFieldNumber:
+			fields = append(fields, value)
+		case messageNestedNumber:
+			nested = append(nested, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if parent != "" {
+		name = parent + "." + name
+	}
+
+	for _, field := range fields {
+		fieldName, encxTags, err := readProtoField(field, optionNumber)
+		if err != nil {
+			return err
+		}
+		if len(encxTags) > 0 {
+			goName := protoGoName(name)
+			if tags[goName] == nil {
+				tags[goName] = make(map[string][]string)
+			}
+			tags[goName][fieldName] = encxTags
+		}
+	}
+	for _, message := range nested {
+		if err := readProtoMessage(message, name, optionNumber, tags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readProtoField reads the name of a FieldDescriptorProto and the encx tags of its
+// (encx.field) option, the extension numbered optionNumber
+func readProtoField(data []byte, optionNumber int) (string, []string, error) {
+	var name string
+	var encxTags []string
+	err := readProtoFields(data, func(num, wireType int, _ uint64, value []byte) error {
+		if wireType != protoWireLengthDelimit {
+			return nil
+		}
+		switch num {
+		case fieldNameNumber:
+			name = string(value)
+		case fieldOptionsNumber:
+			return readProtoFields(value, func(num, wireType int, _ uint64, value []byte) error {
+				if num != optionNumber || wireType != protoWireLengthDelimit {
+					return nil
+				}
+				return readProtoFields(value, func(num, wireType int, varint uint64, _ []byte) error {
+					if wireType != protoWireVarint || varint == 0 {
+						return nil
+					}
+					switch num {
+					case encxEncryptNumber:
+						encxTags = append(encxTags, "encrypt")
+					case encxHashBasicNumber:
+						encxTags = append(encxTags, "hash_basic")
+					case encxHashSecureNumber:
+						encxTags = append(encxTags, "hash_secure")
+					}
+					return nil
+				})
+			})
+		}
+		return nil
+	})
+	return name, encxTags, err
+}
+
+// readProtoFields calls fn with each field of an encoded protobuf message: its number,
+// its wire type, and its value as a varint or as the bytes of a length-delimited field
+func readProtoFields(data []byte, fn func(num, wireType int, varint uint64, value []byte) error) error {
+	for len(data) > 0 {
+		key, n := readProtoVarint(data)
+		if n == 0 {
+			return errors.New("truncated field key")
+		}
+		data = data[n:]
+		num, wireType := int(key>>3), int(key&7)
+
+		var varint uint64
+		var value []byte
+		switch wireType {
+		case protoWireVarint:
+			varint, n = readProtoVarint(data)
+			if n == 0 {
+				return errors.New("truncated varint")
+			}
+		case protoWireFixed64:
+			n = 8
+		case protoWireFixed32:
+			n = 4
+		case protoWireLengthDelimit:
+			length, size := readProtoVarint(data)
+			if size == 0 || length > uint64(len(data)-size) {
+				return errors.New("truncated length-delimited field")
+			}
+			value = data[size : size+int(length)]
+			n = size + int(length)
+		default:
+			return fmt.Errorf("unsupported wire type %d", wireType)
+		}
+		if n > len(data) {
+			return errors.New("truncated field")
+		}
+		data = data[n:]
+
+		if err := fn(num, wireType, varint, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readProtoVarint decodes a varint, and returns its size, or 0 if it is truncated
+func readProtoVarint(data []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < len(data) && i < 10; i++ {
+		value |= uint64(data[i]&0x7f) << (7 * i)
+		if data[i] < 0x80 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// protoFieldName returns the proto name of a field from its protobuf struct tag, e.g.
+// "email" for `protobuf:"bytes,2,opt,name=email,proto3"`
+func protoFieldName(tagValue string) string {
+	for _, option := range strings.Split(reflect.StructTag(tagValue).Get("protobuf"), ",") {
+		if name, found := strings.CutPrefix(option, "name="); found {
+			return name
+		}
+	}
+	return ""
+}
+
+// protoGoName returns the Go name protoc-gen-go gives a message from its name relative
+// to its package, e.g. "User_Address" for "User.Address"
+func protoGoName(name string) string {
+	var b []byte
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '.' && i+1 < len(name) && isASCIILower(name[i+1]):
+			// Skip over '.' in ".{{lowercase}}"
+		case c == '.':
+			b = append(b, '_')
+		case c == '_' && (i == 0 || name[i-1] == '.'):
+			// Convert initial '_' to ensure we start with a capital letter
+			b = append(b, 'X')
+		case c == '_' && i+1 < len(name) && isASCIILower(name[i+1]):
+			// Skip over '_' in "_{{lowercase}}"
+		case c >= '0' && c <= '9':
+			b = append(b, c)
+		default:
+			// Assume we have a letter now - if not, it's a bogus identifier
+			if isASCIILower(c) {
+				c -= 'a' - 'A'
+			}
+			b = append(b, c)
+			// Accept lower case sequence that follows
+			for ; i+1 < len(name) && isASCIILower(name[i+1]); i++ {
+				b = append(b, name[i+1])
+			}
+		}
+	}
+	return string(b)
+}
+
+// isASCIILower reports whether c is a lowercase ASCII letter
+func isASCIILower(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+// isProtoInternalField reports whether a field is an internal field of a protobuf
+// message, such as state or unknownFields, which generated code must not copy
+func isProtoInternalField(field *ast.Field, fileImports map[string]string) bool {
+	pkgNames := extractPackageNamesFromType(getTypeString(field.Type))
+	return len(pkgNames) == 1 && fileImports[pkgNames[0]] == protoimplPath
+}
@@ -0,0 +1,245 @@
+package codegen
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// protoField encodes a length-delimited protobuf field
+func protoField(num int, value []byte) []byte {
+	data := protoVarint(uint64(num)<<3 | protoWireLengthDelimit)
+	data = append(data, protoVarint(uint64(len(value)))...)
+	return append(data, value...)
+}
+
+// protoBool encodes a true bool protobuf field
+func protoBool(num int) []byte {
+	return append(protoVarint(uint64(num)<<3|protoWireVarint), 1)
+}
+
+func protoVarint(value uint64) []byte {
+	var data []byte
+	for value >= 0x80 {
+		data = append(data, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(data, byte(value))
+}
+
+// protoFieldDescriptor encodes a FieldDescriptorProto with the given encx.FieldOptions,
+// set in the extension numbered optionNumber
+func protoFieldDescriptor(name string, number, optionNumber int, encxOptions ...int) []byte {
+	data := protoField(fieldNameNumber, []byte(name))
+	data = append(data, protoVarint(3<<3|protoWireVarint)...)
+	data = append(data, protoVarint(uint64(number))...)
+	if len(encxOptions) > 0 {
+		var options []byte
+		for _, option := range encxOptions {
+			options = append(options, protoBool(option)...)
+		}
+		// Other options are skipped, e.g. deprecated = true
+		fieldOptions := append(protoBool(3), protoField(optionNumber, options)...)
+		data = append(data, protoField(fieldOptionsNumber, fieldOptions)...)
+	}
+	return data
+}
+
+// userProtoDescriptor encodes the descriptor of the following messages, with the
+// encx.field extension numbered optionNumber:
+//
+//	message User {
+//	  string email = 1 [(encx.field) = {encrypt: true, hash_basic: true}];
+//	  string name = 2;
+//	  Address address = 3;
+//	  message Address {
+//	    string street = 1 [(encx.field) = {encrypt: true}];
+//	  }
+//	}
+func userProtoDescriptor(optionNumber int) []byte {
+	address := protoField(messageNameNumber, []byte("Address"))
+	address = append(address, protoField(messageFieldNumber, protoFieldDescriptor("street", 1, optionNumber, encxEncryptNumber))...)
+
+	user := protoField(messageNameNumber, []byte("User"))
+	user = append(user, protoField(messageFieldNumber, protoFieldDescriptor("email", 1, optionNumber, encxEncryptNumber, encxHashBasicNumber))...)
+	user = append(user, protoField(messageFieldNumber, protoFieldDescriptor("name", 2, optionNumber))...)
+	user = append(user, protoField(messageFieldNumber, protoFieldDescriptor("address", 3, optionNumber))...)
+	user = append(user, protoField(messageNestedNumber, address)...)
+
+	file := protoField(1, []byte("user.proto"))
+	file = append(file, protoField(2, []byte("test"))...)
+	return append(file, protoField(fileMessageTypeNumber, user)...)
+}
+
+const userProtoStructs = `
+type User struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Email   string        ` + "`protobuf:\"bytes,1,opt,name=email,proto3\" json:\"email,omitempty\"`" + `
+	Name    string        ` + "`protobuf:\"bytes,2,opt,name=name,proto3\" json:\"name,omitempty\"`" + `
+	Address *User_Address ` + "`protobuf:\"bytes,3,opt,name=address,proto3\" json:\"address,omitempty\"`" + `
+}
+
+type User_Address struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Street string ` + "`protobuf:\"bytes,1,opt,name=street,proto3\" json:\"street,omitempty\"`" + `
+}
+`
+
+func TestDiscoverStructsFromProto(t *testing.T) {
+	rawDesc := userProtoDescriptor(ProtoFieldOptionNumber)
+
+	// Newer versions of protoc-gen-go declare the raw descriptor as a string constant,
+	// older ones as a []byte variable
+	var stringDesc []string
+	for _, line := range strings.SplitAfter(string(rawDesc), "\n") {
+		stringDesc = append(stringDesc, strconv.Quote(line))
+	}
+	var bytesDesc []string
+	for _, b := range rawDesc {
+		bytesDesc = append(bytesDesc, fmt.Sprintf("0x%02x", b))
+	}
+	declarations := map[string]string{
+		"string": "const file_user_proto_rawDesc = \"\" +\n\t" + strings.Join(stringDesc, " +\n\t"),
+		"bytes":  "var file_user_proto_rawDesc = []byte{\n\t" + strings.Join(bytesDesc, ", ") + ",\n}",
+	}
+
+	for name, declaration := range declarations {
+		for _, sourceOnly := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/sourceOnly=%t", name, sourceOnly), func(t *testing.T) {
+				tempDir := t.TempDir()
+				source := "// Code generated by protoc-gen-go. DO NOT EDIT.\n// source: user.proto\n\npackage test\n\n" +
+					"import protoimpl \"google.golang.org/protobuf/runtime/protoimpl\"\n" + userProtoStructs + "\n" + declaration + "\n"
+				require.NoError(t, os.WriteFile(filepath.Join(tempDir, "user.pb.go"), []byte(source), 0644))
+
+				structs, err := DiscoverStructs(tempDir, &DiscoveryConfig{SourceOnly: sourceOnly})
+				require.NoError(t, err)
+				require.Len(t, structs, 2)
+
+				byName := make(map[string]StructInfo)
+				for _, s := range structs {
+					byName[s.StructName] = s
+				}
+				user := byName["User"]
+				assert.Equal(t, "user.pb.go", user.SourceFile)
+				require.Len(t, user.Fields, 3, "internal fields of messages are skipped")
+				assert.Equal(t, []string{"encrypt", "hash_basic"}, findField(user.Fields, "Email").EncxTags)
+				assert.Equal(t, "email,omitempty", findField(user.Fields, "Email").JSONTag)
+				assert.Empty(t, findField(user.Fields, "Name").EncxTags)
+				assert.Equal(t, "User_Address", findField(user.Fields, "Address").NestedType)
+				assert.NotContains(t, user.RequiredImports, "protoimpl")
+
+				address := byName["User_Address"]
+				assert.True(t, address.IsNested)
+				assert.Equal(t, []string{"encrypt"}, findField(address.Fields, "Street").EncxTags)
+			})
+		}
+	}
+}
+
+func TestDiscoverStructsWithProtoFieldOption(t *testing.T) {
+	var bytesDesc []string
+	for _, b := range userProtoDescriptor(70123) {
+		bytesDesc = append(bytesDesc, fmt.Sprintf("0x%02x", b))
+	}
+	tempDir := t.TempDir()
+	source := "// Code generated by protoc-gen-go. DO NOT EDIT.\n// source: user.proto\n\npackage test\n\n" +
+		"import protoimpl \"google.golang.org/protobuf/runtime/protoimpl\"\n" + userProtoStructs + "\n" +
+		"var file_user_proto_rawDesc = []byte{\n\t" + strings.Join(bytesDesc, ", ") + ",\n}\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "user.pb.go"), []byte(source), 0644))
+
+	// Options of extensions with another number are not read
+	structs, err := DiscoverStructs(tempDir, &DiscoveryConfig{SourceOnly: true})
+	require.NoError(t, err)
+	assert.Empty(t, structs)
+
+	structs, err = DiscoverStructs(tempDir, &DiscoveryConfig{SourceOnly: true, ProtoFieldOption: 70123})
+	require.NoError(t, err)
+	require.Len(t, structs, 2)
+	for _, s := range structs {
+		if s.StructName == "User" {
+			assert.Equal(t, []string{"encrypt", "hash_basic"}, findField(s.Fields, "Email").EncxTags)
+		}
+	}
+}
+
+func TestDiscoverStructsWithConfiguredTags(t *testing.T) {
+	tempDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(tempDir, "user.go"), []byte(`package test
+
+type User struct {
+	Email string `+"`json:\"email\"`"+`
+	Phone string `+"`encx:\"encrypt\"`"+`
+}
+`), 0644)
+	require.NoError(t, err)
+
+	structs, err := DiscoverStructs(tempDir, &DiscoveryConfig{Tags: map[string]map[string][]string{
+		"User": {"Email": {"encrypt", "hash_basic"}, "Phone": {"hash_basic"}},
+	}})
+	require.NoError(t, err)
+	require.Len(t, structs, 1)
+	assert.Equal(t, []string{"encrypt", "hash_basic"}, findField(structs[0].Fields, "Email").EncxTags)
+	// Configured tags take precedence over struct tags
+	assert.Equal(t, []string{"hash_basic"}, findField(structs[0].Fields, "Phone").EncxTags)
+
+	// Configured tags are validated
+	structs, err = DiscoverStructs(tempDir, &DiscoveryConfig{Tags: map[string]map[string][]string{
+		"User": {"Email": {"encrypt", "unknown"}},
+	}})
+	require.NoError(t, err)
+	assert.False(t, findField(structs[0].Fields, "Email").IsValid)
+
+	// Configured tags must name existing structs and fields
+	_, err = DiscoverStructs(tempDir, &DiscoveryConfig{Tags: map[string]map[string][]string{
+		"Customer": {"Email": {"encrypt"}},
+	}})
+	assert.EqualError(t, err, "tags: struct Customer not found")
+	_, err = DiscoverStructs(tempDir, &DiscoveryConfig{Tags: map[string]map[string][]string{
+		"User": {"Mail": {"encrypt"}},
+	}})
+	assert.EqualError(t, err, "tags: struct User has no field Mail")
+}
+
+func TestProtoGoName(t *testing.T) {
+	tests := map[string]string{
+		"User":            "User",
+		"user_profile":    "UserProfile",
+		"User.Address":    "User_Address",
+		"User.address":    "UserAddress",
+		"_internal":       "XInternal",
+		"HTTPRequest":     "HTTPRequest",
+		"Order.Line.Item": "Order_Line_Item",
+		"v2_message":      "V2Message",
+	}
+	for name, expected := range tests {
+		assert.Equal(t, expected, protoGoName(name), name)
+	}
+}
+
+func TestProtoRawDescriptorInvalid(t *testing.T) {
+	tempDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(tempDir, "user.pb.go"), []byte(`package test
+
+type User struct {
+	Email string `+"`protobuf:\"bytes,1,opt,name=email,proto3\"`"+`
+}
+
+var file_user_proto_rawDesc = []byte{0x22, 0x05, 0x0a}
+`), 0644)
+	require.NoError(t, err)
+
+	_, err = DiscoverStructs(tempDir, &DiscoveryConfig{SourceOnly: true})
+	assert.EqualError(t, err, "user.pb.go: invalid protobuf descriptor: truncated length-delimited field")
+}
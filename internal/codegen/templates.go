@@ -2,10 +2,15 @@ package codegen
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"slices"
+	"sort"
 	"strings"
 	"text/template"
-	"time"
+
+	"github.com/hengadev/encx/internal/schema"
 )
 
 // TemplateData contains all data needed for code generation
@@ -13,44 +18,262 @@ type TemplateData struct {
 	PackageName        string
 	StructName         string
 	SourceFile         string
-	GeneratedTime      string
 	GeneratorVersion   string
+	IsNested           bool // Generated as helpers using the DEK of the enclosing struct
 	Imports            []string
 	EncryptedFields    []TemplateField
 	PlainFields        []TemplateField // Non-encx fields copied as-is
+	NestedFields       []TemplateField // Fields holding the Encx types of nested structs
 	PlainFieldCopies   []string        // Copy statements for plain fields in Process function
 	PlainFieldRestores []string        // Copy statements for plain fields in Decrypt function
 	ProcessingSteps    []string
 	DecryptionSteps    []string
+	EncryptionContext  []ContextEntry // Static encryption context from //encx:options, sorted by key
+	SQLHelpers         bool           // Generate the Columns, ScanRow and InsertArgs methods
+	SQLColumns         []SQLColumn    // Columns of the fields, before the essential encryption columns
+	LookupFields       []LookupField  // Fields with a hash_basic tag of top-level structs, queryable by hash
+	DecryptFields      []DecryptField // Fields of top-level structs decryptable one by one
+	Redact             bool           // Generate the redacting String, GoString, LogValue and MarshalJSON methods
+	RedactFields       []RedactField  // All fields of the source struct, for the redacting methods
+	TestFields         []TestField    // Fields with builtin tags or nested structs, checked by the generated tests
+	TestImports        []string       // Import paths of the sample values of the generated tests
+}
+
+// TestField is a field with builtin encx tags, checked by the generated round-trip and fuzz tests
+type TestField struct {
+	Name       string
+	BaseType   string // Type of the field, without pointer
+	Pointer    bool
+	Encrypt    bool
+	HashBasic  bool
+	HashSecure bool
+	Condition  string // Condition on source for the values Process processes, empty if values are always processed
+	Sample     string // Expression of a sample value of BaseType, empty if the field is left zero
+	Fuzz       bool   // BaseType is a fuzzing argument type
+	NestedType string // Struct held by the field, checked by its own helpers, empty for fields with encx tags
+	// The field is a slice of NestedType, and its elements are pointers
+	NestedSlice   bool
+	NestedPointer bool
+}
+
+// RedactField is a field of a source struct with //encx:options redact=true
+type RedactField struct {
+	Name    string
+	Type    string
+	JSONTag string // json tag of the field, reduced to its name for masked fields
+	Masked  bool   // The field has encx tags or holds a nested struct, and its value is replaced by encx.Redacted
+}
+
+// DecryptField is an encrypted or nested field, selectable in Decrypt<Name>EncxFields
+type DecryptField struct {
+	FieldName string
+	Step      string // The rendered decryption step of the field
+}
+
+// LookupField is a field with a hash_basic tag, whose hash is computed by the lookup helpers
+type LookupField struct {
+	FieldName string
+	FieldType string
+	DBColumn  string // Column of the hash
+	Skip      string // Expression on value true for the values Process leaves unhashed, empty if values are always hashed
+}
+
+// SQLColumn is a database column of a field of the generated struct
+type SQLColumn struct {
+	Name     string // Field name
+	DBColumn string
+	JSON     bool // Stored as JSON through encx.JSONColumn
+}
+
+// ContextEntry is a key-value pair of the encryption context bound to a struct's DEK
+type ContextEntry struct {
+	Key   string
+	Value string
 }
 
 // TemplateField represents a field in the generated struct
 type TemplateField struct {
-	Name      string
-	Type      string
-	DBColumn  string
-	JSONField string
+	Name       string
+	Type       string
+	ColumnType string // Go type whose column stores the field, see FieldInfo.ColumnType
+	DBColumn   string
+	JSONField  string
+}
+
+// StoredType returns the Go type whose column stores the field, as passed to
+// schema.ColumnForGoType
+func (f TemplateField) StoredType() string {
+	if f.ColumnType != "" {
+		return f.ColumnType
+	}
+	return f.Type
 }
 
-// Code generation template
-const processTemplate = `// Code generated by encx-gen. DO NOT EDIT.
+// FileTemplateData contains the data of a generated file
+type FileTemplateData struct {
+	PackageName string
+	SourceFile  string
+	ContentHash string // Hash of the file content, stamped instead of the generation time for reproducible output
+	Imports     []string
+	Structs     []TemplateData
+}
+
+// File template, shared by all the structs of a source file
+const fileTemplate = `// Code generated by encx-gen. DO NOT EDIT.
 // Source: {{.SourceFile}}
-// Generated: {{.GeneratedTime}}
+// Generated: {{.ContentHash}}
 
 package {{.PackageName}}
 
 import (
 	"context"
-	"time"
 
 	"github.com/hengadev/errsx"
 	"github.com/hengadev/encx"
 	{{range .Imports}}
 	"{{.}}"
 	{{end}}
+	{{template "imports" .}}
+)
+{{range .Structs}}{{template "struct" .}}{{if .IsNested}}{{template "nested" .}}{{else}}{{template "process" .}}{{template "batch" .}}{{if .DecryptFields}}{{template "decrypt_fields" .}}{{end}}{{if .LookupFields}}{{template "lookup" .}}{{end}}{{if .SQLHelpers}}{{template "sql_helpers" .}}{{end}}{{end}}{{if .Redact}}{{template "redact" .}}{{end}}{{end}}`
+
+// Test file template - round-trip and fuzz tests of the top-level structs of a source file
+const testsTemplate = `// Code generated by encx-gen. DO NOT EDIT.
+// Source: {{.SourceFile}}
+
+package {{.PackageName}}
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hengadev/encx"
+	{{range .Imports}}
+	"{{.}}"
+	{{end}}
 )
+{{range .Structs}}
+// check{{.StructName}}EncxFields checks that the encrypted fields of source round-trip to decrypted,
+// and that the hashes of encrypted match their values, recursing into nested structs
+func check{{.StructName}}EncxFields(t *testing.T, ctx context.Context, crypto *encx.Crypto, source *{{.StructName}}, encrypted *{{.StructName}}Encx, decrypted *{{.StructName}}) {
+	t.Helper()
+	{{range .TestFields}}{{if .NestedType}}
+	// {{.Name}} (nested {{.NestedType}})
+	{{if .NestedSlice}}if len(encrypted.{{.Name}}) != len(source.{{.Name}}) || len(decrypted.{{.Name}}) != len(source.{{.Name}}) {
+		t.Errorf("{{.Name}} has %d elements after the round-trip, want %d", len(decrypted.{{.Name}}), len(source.{{.Name}}))
+	} else {
+		for i := range source.{{.Name}} {
+			{{if .NestedPointer}}if source.{{.Name}}[i] == nil {
+				if decrypted.{{.Name}}[i] != nil {
+					t.Errorf("{{.Name}}[%d] is not nil after the round-trip", i)
+				}
+			} else if encrypted.{{.Name}}[i] == nil || decrypted.{{.Name}}[i] == nil {
+				t.Errorf("{{.Name}}[%d] is nil after the round-trip", i)
+			} else {
+				check{{.NestedType}}EncxFields(t, ctx, crypto, source.{{.Name}}[i], encrypted.{{.Name}}[i], decrypted.{{.Name}}[i])
+			}{{else}}check{{.NestedType}}EncxFields(t, ctx, crypto, &source.{{.Name}}[i], &encrypted.{{.Name}}[i], &decrypted.{{.Name}}[i]){{end}}
+		}
+	}{{else if .NestedPointer}}if source.{{.Name}} == nil {
+		if decrypted.{{.Name}} != nil {
+			t.Errorf("{{.Name}} is not nil after the round-trip")
+		}
+	} else if encrypted.{{.Name}} == nil || decrypted.{{.Name}} == nil {
+		t.Errorf("{{.Name}} is nil after the round-trip")
+	} else {
+		check{{.NestedType}}EncxFields(t, ctx, crypto, source.{{.Name}}, encrypted.{{.Name}}, decrypted.{{.Name}})
+	}{{else}}check{{.NestedType}}EncxFields(t, ctx, crypto, &source.{{.Name}}, &encrypted.{{.Name}}, &decrypted.{{.Name}}){{end}}
+	{{end}}{{if .Encrypt}}
+	// {{.Name}} (encrypt)
+	if want, err := encx.SerializeValue(source.{{.Name}}); err != nil {
+		t.Errorf("{{.Name}} serialization failed: %v", err)
+	} else if got, err := encx.SerializeValue(decrypted.{{.Name}}); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("{{.Name}} does not round-trip: got %v, want %v", decrypted.{{.Name}}, source.{{.Name}})
+	}
+	{{end}}{{if or .HashBasic .HashSecure}}
+	// {{.Name}} ({{if .HashBasic}}hash_basic{{end}}{{if and .HashBasic .HashSecure}} + {{end}}{{if .HashSecure}}hash_secure{{end}})
+	{{if .Condition}}if {{.Condition}} {
+	{{end}}{{if .HashBasic}}if ok, err := crypto.CompareBasicHashAndValue(ctx, source.{{.Name}}, encrypted.{{.Name}}Hash); err != nil || !ok {
+		t.Errorf("{{.Name}}Hash does not match {{.Name}}: %v", err)
+	}
+	{{end}}{{if .HashSecure}}if ok, err := crypto.CompareSecureHashAndValue(ctx, source.{{.Name}}, encrypted.{{.Name}}HashSecure); err != nil || !ok {
+		t.Errorf("{{.Name}}HashSecure does not match {{.Name}}: %v", err)
+	}
+	{{end}}{{if .Condition}}}
+	{{end}}{{end}}{{end}}
+}
 
-// {{.StructName}}Encx represents the encrypted version of {{.StructName}}
+// fill{{.StructName}}EncxSample sets the fields of source with encx tags to sample values, and fills
+// its nested structs down to depth levels
+func fill{{.StructName}}EncxSample(source *{{.StructName}}, depth int) {
+	{{range .TestFields}}{{if .NestedType}}if depth > 0 {
+		{{if .NestedSlice}}source.{{.Name}} = make([]{{if .NestedPointer}}*{{end}}{{.NestedType}}, 2)
+		{{if .NestedPointer}}source.{{.Name}}[0] = &{{.NestedType}}{}
+		fill{{.NestedType}}EncxSample(source.{{.Name}}[0], depth-1){{else}}fill{{.NestedType}}EncxSample(&source.{{.Name}}[0], depth-1){{end}}{{else if .NestedPointer}}source.{{.Name}} = &{{.NestedType}}{}
+		fill{{.NestedType}}EncxSample(source.{{.Name}}, depth-1){{else}}fill{{.NestedType}}EncxSample(&source.{{.Name}}, depth-1){{end}}
+	}
+	{{else if .Sample}}source.{{.Name}} = {{if .Pointer}}func() *{{.BaseType}} { v := {{.Sample}}; return &v }(){{else}}{{.Sample}}{{end}}
+	{{end}}{{end}}
+}
+{{if not .IsNested}}
+// check{{.StructName}}EncxRoundTrip processes and decrypts source, and checks that its
+// encrypted fields round-trip and that its hashes match their values
+func check{{.StructName}}EncxRoundTrip(t *testing.T, crypto *encx.Crypto, source *{{.StructName}}) {
+	t.Helper()
+	ctx := context.Background()
+
+	encrypted, err := Process{{.StructName}}Encx(ctx, crypto, source)
+	if err != nil {
+		t.Fatalf("Process{{.StructName}}Encx failed: %v", err)
+	}
+	decrypted, err := Decrypt{{.StructName}}Encx(ctx, crypto, encrypted)
+	if err != nil {
+		t.Fatalf("Decrypt{{.StructName}}Encx failed: %v", err)
+	}
+	check{{.StructName}}EncxFields(t, ctx, crypto, source, encrypted, decrypted)
+}
+
+// Test{{.StructName}}EncxRoundTrip checks that {{.StructName}} round-trips through Process{{.StructName}}Encx
+// and Decrypt{{.StructName}}Encx, with zero and sample values
+func Test{{.StructName}}EncxRoundTrip(t *testing.T) {
+	crypto, err := encx.NewTestCrypto(t)
+	if err != nil {
+		t.Fatalf("NewTestCrypto failed: %v", err)
+	}
+
+	t.Run("zero", func(t *testing.T) {
+		check{{.StructName}}EncxRoundTrip(t, crypto, &{{.StructName}}{})
+	})
+	t.Run("sample", func(t *testing.T) {
+		source := &{{.StructName}}{}
+		fill{{.StructName}}EncxSample(source, 2)
+		check{{.StructName}}EncxRoundTrip(t, crypto, source)
+	})
+}
+{{$fuzz := false}}{{range .TestFields}}{{if .Fuzz}}{{$fuzz = true}}{{end}}{{end}}{{if $fuzz}}
+// Fuzz{{.StructName}}Encx checks that fuzzed values of the fields of {{.StructName}} round-trip
+// through Process{{.StructName}}Encx and Decrypt{{.StructName}}Encx
+func Fuzz{{.StructName}}Encx(f *testing.F) {
+	crypto, err := encx.NewTestCrypto(f)
+	if err != nil {
+		f.Fatalf("NewTestCrypto failed: %v", err)
+	}
+
+	f.Add({{$first := true}}{{range .TestFields}}{{if .Fuzz}}{{if not $first}}, {{end}}{{$first = false}}{{.Sample}}{{end}}{{end}})
+	f.Fuzz(func(t *testing.T{{range .TestFields}}{{if .Fuzz}}, {{.Name}} {{.BaseType}}{{end}}{{end}}) {
+		source := &{{.StructName}}{}
+		{{range .TestFields}}{{if .Fuzz}}source.{{.Name}} = {{if .Pointer}}&{{end}}{{.Name}}
+		{{end}}{{end}}
+		check{{.StructName}}EncxRoundTrip(t, crypto, source)
+	})
+}
+{{end}}{{end}}{{end}}`
+
+// Imports template - extra import specs for code added by custom templates
+const importsTemplate = ``
+
+// Encx struct template, shared by top-level and nested structs
+const structTemplate = `
+// {{.StructName}}Encx represents the encrypted version of {{.StructName}}{{if .IsNested}}, nested in other encx structs{{end}}
 type {{.StructName}}Encx struct {
 	{{range .PlainFields}}
 	{{.Name}} {{.Type}} ` + "`" + `db:"{{.DBColumn}}" json:"{{.JSONField}}"` + "`" + `
@@ -58,19 +281,32 @@ type {{.StructName}}Encx struct {
 	{{range .EncryptedFields}}
 	{{.Name}} {{.Type}} ` + "`" + `db:"{{.DBColumn}}" json:"{{.JSONField}}"` + "`" + `
 	{{end}}
-
+	{{range .NestedFields}}
+	{{.Name}} {{.Type}} ` + "`" + `db:"{{.DBColumn}}" json:"{{.JSONField}}"` + "`" + `
+	{{end}}
+	{{if not .IsNested}}
 	// Essential encryption fields
 	DEKEncrypted  []byte ` + "`" + `db:"dek_encrypted" json:"dek_encrypted"` + "`" + `
 	KeyVersion    int    ` + "`" + `db:"key_version" json:"key_version"` + "`" + `
 
 	// Metadata
 	Metadata      encx.EncryptionMetadata ` + "`" + `db:"metadata" json:"metadata"` + "`" + `
+	{{end}}
 }
+`
 
+// Process and Decrypt function template
+const processTemplate = `
 // Process{{.StructName}}Encx encrypts and hashes fields based on encx tags
 func Process{{.StructName}}Encx(ctx context.Context, crypto encx.CryptoService, source *{{.StructName}}) (*{{.StructName}}Encx, error) {
 	var errs errsx.Map
-
+	{{if .EncryptionContext}}
+	// Bind the DEK to the encryption context of {{.StructName}}
+	ctx = encx.WithEncryptionContext(ctx, map[string]string{
+		{{range .EncryptionContext}}{{printf "%q" .Key}}: {{printf "%q" .Value}},
+		{{end}}
+	})
+	{{end}}
 	// Initialize result struct
 	result := &{{.StructName}}Encx{
 		Metadata: encx.EncryptionMetadata{
@@ -96,25 +332,25 @@ func Process{{.StructName}}Encx(ctx context.Context, crypto encx.CryptoService,
 	{{.}}
 	{{end}}
 
-	// Encrypt and store DEK
-	result.DEKEncrypted, err = crypto.EncryptDEK(ctx, dek)
+	// Encrypt and store DEK, with the version of the KEK that encrypted it
+	result.DEKEncrypted, result.KeyVersion, err = crypto.EncryptDEKVersioned(ctx, dek)
 	if err != nil {
 		errs.Set("DEK encryption", err)
 	}
 
-	// Get and set the current KEK version
-	result.KeyVersion, err = crypto.GetCurrentKEKVersion(ctx, crypto.GetAlias())
-	if err != nil {
-		errs.Set("KEK version retrieval", err)
-	}
-
 	return result, errs.AsError()
 }
 
 // Decrypt{{.StructName}}Encx decrypts the encrypted struct back to original
 func Decrypt{{.StructName}}Encx(ctx context.Context, crypto encx.CryptoService, source *{{.StructName}}Encx) (*{{.StructName}}, error) {
 	var errs errsx.Map
-
+	{{if .EncryptionContext}}
+	// The DEK is bound to the encryption context of {{.StructName}}
+	ctx = encx.WithEncryptionContext(ctx, map[string]string{
+		{{range .EncryptionContext}}{{printf "%q" .Key}}: {{printf "%q" .Value}},
+		{{end}}
+	})
+	{{end}}
 	// Initialize result struct
 	result := &{{.StructName}}{}
 
@@ -138,17 +374,54 @@ func Decrypt{{.StructName}}Encx(ctx context.Context, crypto encx.CryptoService,
 }
 `
 
+// Nested struct template - for structs used as fields of other encx structs.
+// The helpers reuse the DEK of the enclosing struct, and key their errors by
+// the path of the nested value (e.g. "Contacts[0].Phone encryption").
+const nestedTemplate = `
+// process{{.StructName}}Encx encrypts and hashes the fields of a nested {{.StructName}} with the DEK of the enclosing struct
+func process{{.StructName}}Encx(ctx context.Context, crypto encx.CryptoService, dek []byte, source *{{.StructName}}, errs *errsx.Map, path string) {{.StructName}}Encx {
+	var result {{.StructName}}Encx
+
+	// Copy plain fields (non-encx fields)
+	{{range .PlainFieldCopies}}
+	{{.}}
+	{{end}}
+
+	{{range .ProcessingSteps}}
+	{{.}}
+	{{end}}
+
+	return result
+}
+
+// decrypt{{.StructName}}Encx decrypts a nested {{.StructName}}Encx with the DEK of the enclosing struct
+func decrypt{{.StructName}}Encx(ctx context.Context, crypto encx.CryptoService, dek []byte, source *{{.StructName}}Encx, errs *errsx.Map, path string) {{.StructName}} {
+	var result {{.StructName}}
+
+	// Copy plain fields (non-encx fields)
+	{{range .PlainFieldRestores}}
+	{{.}}
+	{{end}}
+
+	{{range .DecryptionSteps}}
+	{{.}}
+	{{end}}
+
+	return result
+}
+`
+
 // Processing step templates
 const encryptStepTemplate = `
 	// Process {{.FieldName}} (encrypt)
 	{{if .Condition}}if {{.Condition}} {
 	{{end}}{{.FieldName}}Bytes, err := encx.SerializeValue(source.{{.FieldName}})
 	if err != nil {
-		errs.Set("{{.FieldName}} serialization", err)
+		errs.Set({{.ErrPrefix}}{{.FieldName}} serialization", err)
 	} else {
 		result.{{.FieldName}}Encrypted, err = crypto.EncryptData(ctx, {{.FieldName}}Bytes, dek)
 		if err != nil {
-			errs.Set("{{.FieldName}} encryption", err)
+			errs.Set({{.ErrPrefix}}{{.FieldName}} encryption", err)
 		}
 	}
 	{{if .Condition}}}
@@ -159,7 +432,7 @@ const hashBasicStepTemplate = `
 	{{if .Condition}}if {{.Condition}} {
 	{{end}}{{.FieldName}}Bytes, err := encx.SerializeValue(source.{{.FieldName}})
 	if err != nil {
-		errs.Set("{{.FieldName}} serialization", err)
+		errs.Set({{.ErrPrefix}}{{.FieldName}} serialization", err)
 	} else {
 		result.{{.FieldName}}Hash = crypto.HashBasic(ctx, {{.FieldName}}Bytes)
 	}
@@ -171,11 +444,11 @@ const hashSecureStepTemplate = `
 	{{if .Condition}}if {{.Condition}} {
 	{{end}}{{.FieldName}}Bytes, err := encx.SerializeValue(source.{{.FieldName}})
 	if err != nil {
-		errs.Set("{{.FieldName}} serialization", err)
+		errs.Set({{.ErrPrefix}}{{.FieldName}} serialization", err)
 	} else {
 		result.{{.FieldName}}HashSecure, err = crypto.HashSecure(ctx, {{.FieldName}}Bytes)
 		if err != nil {
-			errs.Set("{{.FieldName}} secure hash", err)
+			errs.Set({{.ErrPrefix}}{{.FieldName}} secure hash", err)
 		}
 	}
 	{{if .Condition}}}
@@ -188,7 +461,7 @@ const multiOpStepTemplate = `
 	{{if .Condition}}if {{.Condition}} {
 	{{end}}{{.FieldName}}Bytes, err := encx.SerializeValue(source.{{.FieldName}})
 	if err != nil {
-		errs.Set("{{.FieldName}} serialization", err)
+		errs.Set({{.ErrPrefix}}{{.FieldName}} serialization", err)
 	} else {
 		{{range .OpSteps}}{{.}}
 		{{end}}
@@ -196,42 +469,461 @@ const multiOpStepTemplate = `
 	{{if .Condition}}}
 	{{end}}`
 
+// User-defined operation step template - calls the function of the operation with the field value
+const operationStepTemplate = `
+	// Process {{.FieldName}} ({{.Operation}})
+	{{if .Condition}}if {{.Condition}} {
+	{{end}}{{.CompanionField}}, err := {{.Function}}(ctx, {{.Value}})
+	if err != nil {
+		errs.Set({{.ErrPrefix}}{{.FieldName}} {{.Operation}}", err)
+	} else {
+		result.{{.CompanionField}} = {{.CompanionField}}
+	}
+	{{if .Condition}}}
+	{{end}}`
+
 // Decryption step templates
 const decryptStepTemplate = `
 	// Decrypt {{.FieldName}}
 	if len(source.{{.FieldName}}Encrypted) > 0 {
 		{{.FieldName}}Bytes, err := crypto.DecryptData(ctx, source.{{.FieldName}}Encrypted, dek)
 		if err != nil {
-			errs.Set("{{.FieldName}} decryption", err)
+			errs.Set({{.ErrPrefix}}{{.FieldName}} decryption", err)
 		} else {
 			err = encx.DeserializeValue({{.FieldName}}Bytes, &result.{{.FieldName}})
 			if err != nil {
-				errs.Set("{{.FieldName}} deserialization", err)
+				errs.Set({{.ErrPrefix}}{{.FieldName}} deserialization", err)
 			}
 		}
 	}`
 
+// Nested field step templates - process or decrypt the Encx value of a nested struct
+const nestedProcessStepTemplate = `
+	// Process {{.FieldName}} (nested {{.TypeName}})
+	{{if .Slice}}if source.{{.FieldName}} != nil {
+		result.{{.FieldName}} = make([]{{if .Pointer}}*{{end}}{{.TypeName}}Encx, len(source.{{.FieldName}}))
+		for i := range source.{{.FieldName}} {
+			{{if .Pointer}}if source.{{.FieldName}}[i] != nil {
+				{{.FieldName}}Encx := process{{.TypeName}}Encx(ctx, crypto, dek, source.{{.FieldName}}[i], {{.Errs}}, {{.ErrPrefix}}{{.FieldName}}["+strconv.Itoa(i)+"]")
+				result.{{.FieldName}}[i] = &{{.FieldName}}Encx
+			}{{else}}result.{{.FieldName}}[i] = process{{.TypeName}}Encx(ctx, crypto, dek, &source.{{.FieldName}}[i], {{.Errs}}, {{.ErrPrefix}}{{.FieldName}}["+strconv.Itoa(i)+"]"){{end}}
+		}
+	}{{else if .Pointer}}if source.{{.FieldName}} != nil {
+		{{.FieldName}}Encx := process{{.TypeName}}Encx(ctx, crypto, dek, source.{{.FieldName}}, {{.Errs}}, {{.ErrPrefix}}{{.FieldName}}")
+		result.{{.FieldName}} = &{{.FieldName}}Encx
+	}{{else}}result.{{.FieldName}} = process{{.TypeName}}Encx(ctx, crypto, dek, &source.{{.FieldName}}, {{.Errs}}, {{.ErrPrefix}}{{.FieldName}}"){{end}}`
+
+const nestedDecryptStepTemplate = `
+	// Decrypt {{.FieldName}} (nested {{.TypeName}})
+	{{if .Slice}}if source.{{.FieldName}} != nil {
+		result.{{.FieldName}} = make([]{{if .Pointer}}*{{end}}{{.TypeName}}, len(source.{{.FieldName}}))
+		for i := range source.{{.FieldName}} {
+			{{if .Pointer}}if source.{{.FieldName}}[i] != nil {
+				{{.FieldName}}Value := decrypt{{.TypeName}}Encx(ctx, crypto, dek, source.{{.FieldName}}[i], {{.Errs}}, {{.ErrPrefix}}{{.FieldName}}["+strconv.Itoa(i)+"]")
+				result.{{.FieldName}}[i] = &{{.FieldName}}Value
+			}{{else}}result.{{.FieldName}}[i] = decrypt{{.TypeName}}Encx(ctx, crypto, dek, &source.{{.FieldName}}[i], {{.Errs}}, {{.ErrPrefix}}{{.FieldName}}["+strconv.Itoa(i)+"]"){{end}}
+		}
+	}{{else if .Pointer}}if source.{{.FieldName}} != nil {
+		{{.FieldName}}Value := decrypt{{.TypeName}}Encx(ctx, crypto, dek, source.{{.FieldName}}, {{.Errs}}, {{.ErrPrefix}}{{.FieldName}}")
+		result.{{.FieldName}} = &{{.FieldName}}Value
+	}{{else}}result.{{.FieldName}} = decrypt{{.TypeName}}Encx(ctx, crypto, dek, &source.{{.FieldName}}, {{.Errs}}, {{.ErrPrefix}}{{.FieldName}}"){{end}}`
+
+// Batch template - Process and Decrypt functions for slices of top-level structs
+const batchTemplate = `
+// Process{{.StructName}}EncxBatch processes sources concurrently, each with its own DEK wrapped with
+// the KEK version resolved once for the batch, and returns the errors keyed by the index of their source
+func Process{{.StructName}}EncxBatch(ctx context.Context, crypto encx.CryptoService, sources []*{{.StructName}}, opts ...encx.BatchOption) ([]*{{.StructName}}Encx, error) {
+	crypto = encx.WithKEKCache(crypto)
+	results := make([]*{{.StructName}}Encx, len(sources))
+	errs := encx.RunBatch(ctx, len(sources), func(i int) error {
+		if sources[i] == nil {
+			return encx.ErrNilPointer
+		}
+		var err error
+		results[i], err = Process{{.StructName}}Encx(ctx, crypto, sources[i])
+		return err
+	}, opts...)
+	return results, errs.AsError()
+}
+
+// Decrypt{{.StructName}}EncxBatch decrypts sources concurrently, unwrapping each distinct DEK once,
+// and returns the errors keyed by the index of their source
+func Decrypt{{.StructName}}EncxBatch(ctx context.Context, crypto encx.CryptoService, sources []*{{.StructName}}Encx, opts ...encx.BatchOption) ([]*{{.StructName}}, error) {
+	crypto = encx.WithDEKCache(encx.WithKEKCache(crypto))
+	results := make([]*{{.StructName}}, len(sources))
+	errs := encx.RunBatch(ctx, len(sources), func(i int) error {
+		if sources[i] == nil {
+			return encx.ErrNilPointer
+		}
+		var err error
+		results[i], err = Decrypt{{.StructName}}Encx(ctx, crypto, sources[i])
+		return err
+	}, opts...)
+	return results, errs.AsError()
+}
+`
+
+// Selective decryption template - field constants and Decrypt<Name>EncxFields of top-level structs
+const decryptFieldsTemplate = `
+// {{.StructName}}Field is an encrypted field of {{.StructName}}, to decrypt with Decrypt{{.StructName}}EncxFields
+type {{.StructName}}Field string
+
+// Encrypted fields of {{.StructName}}
+const (
+	{{range .DecryptFields}}{{$.StructName}}Field{{.FieldName}} {{$.StructName}}Field = "{{.FieldName}}"
+	{{end}}
+)
+
+// Decrypt{{.StructName}}EncxFields decrypts the given fields of the encrypted struct, leaving its other
+// encrypted fields at their zero value. Each decrypted field is reported to the observability hook of crypto.
+func Decrypt{{.StructName}}EncxFields(ctx context.Context, crypto encx.CryptoService, source *{{.StructName}}Encx, fields ...{{.StructName}}Field) (*{{.StructName}}, error) {
+	var errs errsx.Map
+	{{if .EncryptionContext}}
+	// The DEK is bound to the encryption context of {{.StructName}}
+	ctx = encx.WithEncryptionContext(ctx, map[string]string{
+		{{range .EncryptionContext}}{{printf "%q" .Key}}: {{printf "%q" .Value}},
+		{{end}}
+	})
+	{{end}}
+	// Initialize result struct
+	result := &{{.StructName}}{}
+
+	// Copy plain fields (non-encx fields)
+	{{range .PlainFieldRestores}}
+	{{.}}
+	{{end}}
+	if len(fields) == 0 {
+		return result, nil
+	}
+
+	// Decrypt DEK
+	dek, err := crypto.DecryptDEKWithVersion(ctx, source.DEKEncrypted, source.KeyVersion)
+	if err != nil {
+		errs.Set("DEK decryption", err)
+		return result, errs.AsError()
+	}
+
+	for _, field := range fields {
+		start := time.Now()
+		var fieldErrs errsx.Map
+		switch field {
+		{{range .DecryptFields}}case {{$.StructName}}Field{{.FieldName}}:
+			fieldErrs = func() (errs errsx.Map) {
+				{{.Step}}
+				return errs
+			}()
+		{{end}}default:
+			errs.Set(string(field), encx.ErrUnknownField)
+			continue
+		}
+
+		encx.ReportFieldDecryption(ctx, crypto, "{{.StructName}}", string(field), time.Since(start), fieldErrs.AsError())
+		for key, err := range fieldErrs {
+			errs.Set(key, err)
+		}
+	}
+
+	return result, errs.AsError()
+}
+`
+
+// Lookup template - hashes values like Process, to query top-level structs by their hash_basic fields
+const lookupTemplate = `
+// {{.StructName}}Lookup computes the hash_basic hashes of {{.StructName}} values, to query {{.StructName}}Encx by hash
+type {{.StructName}}Lookup struct{}
+{{range .LookupFields}}
+// {{.FieldName}}Hash hashes a value of {{.FieldName}} as Process{{$.StructName}}Encx does, and returns it with its column
+func ({{$.StructName}}Lookup) {{.FieldName}}Hash(ctx context.Context, crypto encx.CryptoService, value {{.FieldType}}) (column, hash string, err error) {
+	{{if .Skip}}if {{.Skip}} {
+		return "{{.DBColumn}}", "", nil
+	}
+	{{end}}valueBytes, err := encx.SerializeValue(value)
+	if err != nil {
+		return "", "", err
+	}
+	return "{{.DBColumn}}", crypto.HashBasic(ctx, valueBytes), nil
+}
+{{end}}`
+
+// Redact template - methods of source structs masking their fields with encx tags, with //encx:options redact=true
+const redactTemplate = `
+// String implements fmt.Stringer, masking the fields of {{.StructName}} with encx tags
+func (s {{.StructName}}) String() string {
+	return fmt.Sprintf("{{"{"}}{{range $i, $f := .RedactFields}}{{if $i}} {{end}}{{.Name}}:%v{{end}}}",
+		{{range .RedactFields}}{{if .Masked}}encx.Redacted{{else}}s.{{.Name}}{{end}},
+		{{end}})
+}
+
+// GoString implements fmt.GoStringer, masking the fields of {{.StructName}} with encx tags
+func (s {{.StructName}}) GoString() string {
+	return fmt.Sprintf("{{.PackageName}}.{{.StructName}}{{"{"}}{{range $i, $f := .RedactFields}}{{if $i}}, {{end}}{{.Name}}:%#v{{end}}}",
+		{{range .RedactFields}}{{if .Masked}}encx.Redacted{{else}}s.{{.Name}}{{end}},
+		{{end}})
+}
+
+// LogValue implements slog.LogValuer, masking the fields of {{.StructName}} with encx tags
+func (s {{.StructName}}) LogValue() slog.Value {
+	return slog.GroupValue(
+		{{range .RedactFields}}{{if .Masked}}slog.String("{{.Name}}", encx.Redacted){{else}}slog.Any("{{.Name}}", s.{{.Name}}){{end}},
+		{{end}})
+}
+
+// MarshalJSON implements json.Marshaler, masking the fields of {{.StructName}} with encx tags
+func (s {{.StructName}}) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		{{range .RedactFields}}{{.Name}} {{if .Masked}}string{{else}}{{.Type}}{{end}}{{if .JSONTag}} ` + "`" + `json:"{{.JSONTag}}"` + "`" + `{{end}}
+		{{end}}
+	}{
+		{{range .RedactFields}}{{.Name}}: {{if .Masked}}encx.Redacted{{else}}s.{{.Name}}{{end}},
+		{{end}}
+	})
+}
+`
+
+// SQL helpers template - column list, row scanning and insert arguments of top-level structs
+const sqlHelpersTemplate = `
+// Columns returns the database columns of {{.StructName}}Encx, in the order of ScanRow and InsertArgs
+func ({{.StructName}}Encx) Columns() []string {
+	return []string{
+		{{range .SQLColumns}}"{{.DBColumn}}",
+		{{end}}"dek_encrypted",
+		"key_version",
+		"metadata",
+	}
+}
+
+// ScanRow scans a row selected with the columns of Columns into {{.StructName}}Encx
+func (e *{{.StructName}}Encx) ScanRow(row encx.RowScanner) error {
+	return row.Scan(
+		{{range .SQLColumns}}{{if .JSON}}encx.NewJSONColumn(&e.{{.Name}}){{else}}&e.{{.Name}}{{end}},
+		{{end}}&e.DEKEncrypted,
+		&e.KeyVersion,
+		&e.Metadata,
+	)
+}
+
+// InsertArgs returns the values of the columns of Columns, e.g. for an INSERT statement
+func (e *{{.StructName}}Encx) InsertArgs() []any {
+	return []any{
+		{{range .SQLColumns}}{{if .JSON}}encx.NewJSONColumn(e.{{.Name}}){{else}}e.{{.Name}}{{end}},
+		{{end}}e.DEKEncrypted,
+		e.KeyVersion,
+		e.Metadata,
+	}
+}
+`
+
+// stepScope describes the function a processing step is generated in
+type stepScope struct {
+	// ErrPrefix opens the string literal of the error keys. Top-level functions key
+	// errors by field name, and nested helpers by the path of the nested value.
+	ErrPrefix string
+	// Errs is the expression passing the error map to nested helpers
+	Errs string
+}
+
+var (
+	// topLevelScope is the scope of the Process and Decrypt functions of a struct
+	topLevelScope = stepScope{ErrPrefix: `"`, Errs: "&errs"}
+	// nestedScope is the scope of the helpers of a nested struct
+	nestedScope = stepScope{ErrPrefix: `path+".`, Errs: "errs"}
+)
+
+// StepData is the data of the encrypt_step, hash_basic_step, hash_secure_step,
+// multi_op_step, operation_step and decrypt_step templates
+type StepData struct {
+	FieldName      string
+	FieldType      string
+	Condition      string   // Expression guarding the step, empty if the field is always processed
+	Operations     string   // multi_op_step only: the operations joined with " + "
+	OpSteps        []string // multi_op_step only: the code of each operation
+	Operation      string   // operation_step only: the tag of the user-defined operation
+	Function       string   // operation_step only: the expression of the function to call
+	CompanionField string   // operation_step only: the field of the Encx struct holding the result
+	Value          string   // operation_step only: the value passed to the function, dereferenced for pointer fields
+	ErrPrefix      string   // Opens the string literal of the error keys, e.g. errs.Set({{.ErrPrefix}}Email encryption", err)
+	Errs           string   // Expression of the *errsx.Map, for passing it to nested helpers
+}
+
+// NestedStepData is the data of the nested_process_step and nested_decrypt_step templates
+type NestedStepData struct {
+	FieldName string
+	TypeName  string // Name of the nested struct type
+	Slice     bool   // The field is a slice of the nested struct
+	Pointer   bool   // The field, or the slice elements, are pointers to the nested struct
+	ErrPrefix string
+	Errs      string
+}
+
+// defaultTemplates are the named templates of the engine, in parse order
+var defaultTemplates = []struct {
+	name string
+	text string
+}{
+	{"file", fileTemplate},
+	{"imports", importsTemplate},
+	{"struct", structTemplate},
+	{"process", processTemplate},
+	{"nested", nestedTemplate},
+	{"encrypt_step", encryptStepTemplate},
+	{"hash_basic_step", hashBasicStepTemplate},
+	{"hash_secure_step", hashSecureStepTemplate},
+	{"multi_op_step", multiOpStepTemplate},
+	{"operation_step", operationStepTemplate},
+	{"decrypt_step", decryptStepTemplate},
+	{"nested_process_step", nestedProcessStepTemplate},
+	{"nested_decrypt_step", nestedDecryptStepTemplate},
+	{"batch", batchTemplate},
+	{"decrypt_fields", decryptFieldsTemplate},
+	{"lookup", lookupTemplate},
+	{"sql_helpers", sqlHelpersTemplate},
+	{"redact", redactTemplate},
+	{"tests", testsTemplate},
+}
+
 // TemplateEngine manages code generation templates
 type TemplateEngine struct {
-	processTemplate *template.Template
+	templates *template.Template
+	hash      string
 }
 
 // NewTemplateEngine creates a new template engine
 func NewTemplateEngine() (*TemplateEngine, error) {
-	tmpl, err := template.New("process").Parse(processTemplate)
-	if err != nil {
-		return nil, err
+	return newTemplateEngine(nil)
+}
+
+// newTemplateEngine creates a template engine with the default templates, replacing
+// those that have an override
+func newTemplateEngine(overrides map[string]string) (*TemplateEngine, error) {
+	var tmpl *template.Template
+	hash := sha256.New()
+	for _, def := range defaultTemplates {
+		text := def.text
+		if override, found := overrides[def.name]; found {
+			text = override
+		}
+		fmt.Fprintf(hash, "%s\x00%s\x00", def.name, text)
+
+		if tmpl == nil {
+			tmpl = template.New(def.name)
+		} else {
+			tmpl = tmpl.New(def.name)
+		}
+		if _, err := tmpl.Parse(text); err != nil {
+			return nil, fmt.Errorf("failed to parse %s template: %w", def.name, err)
+		}
 	}
 
 	return &TemplateEngine{
-		processTemplate: tmpl,
+		templates: tmpl.Lookup("file"),
+		hash:      hex.EncodeToString(hash.Sum(nil)),
 	}, nil
 }
 
+// Hash returns a hash of the templates of the engine, which changes when they are overridden
+func (te *TemplateEngine) Hash() string {
+	return te.hash
+}
+
+// defaultEngine renders the processing steps of BuildTemplateData
+var defaultEngine = func() *TemplateEngine {
+	engine, err := NewTemplateEngine()
+	if err != nil {
+		panic(err)
+	}
+	return engine
+}()
+
+// renderStep renders a processing step with the named template
+func (te *TemplateEngine) renderStep(name string, data any) (string, error) {
+	var buf bytes.Buffer
+	if err := te.templates.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
 // GenerateCode generates code for a struct using the template
 func (te *TemplateEngine) GenerateCode(data TemplateData) ([]byte, error) {
+	return te.GenerateFile([]TemplateData{data})
+}
+
+// GenerateFile generates a single file with the code of several structs of the same
+// source file, such as a struct and the structs nested in it
+func (te *TemplateEngine) GenerateFile(structs []TemplateData) ([]byte, error) {
+	if len(structs) == 0 {
+		return nil, fmt.Errorf("no structs to generate")
+	}
+
+	// Merge the imports of all structs; the Process functions need "time"
+	importSet := make(map[string]bool)
+	for _, data := range structs {
+		for _, importPath := range data.Imports {
+			importSet[importPath] = true
+		}
+		if !data.IsNested {
+			importSet["time"] = true
+		}
+	}
+	imports := make([]string, 0, len(importSet))
+	for importPath := range importSet {
+		imports = append(imports, importPath)
+	}
+	sort.Strings(imports)
+
+	fileData := FileTemplateData{
+		PackageName: structs[0].PackageName,
+		SourceFile:  structs[0].SourceFile,
+		Imports:     imports,
+		Structs:     structs,
+	}
+
+	// Render without the stamp first, and stamp the hash of that content
+	var buf bytes.Buffer
+	if err := te.templates.Execute(&buf, fileData); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	fileData.ContentHash = "sha256:" + hex.EncodeToString(sum[:])
+
+	buf.Reset()
+	if err := te.templates.Execute(&buf, fileData); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GenerateTestFile generates the round-trip and fuzz tests of the top-level structs of
+// a source file, with the code of GenerateFile, and the helpers checking every struct,
+// which the tests of enclosing structs call. It returns nil if there is no struct.
+func (te *TemplateEngine) GenerateTestFile(structs []TemplateData) ([]byte, error) {
+	if len(structs) == 0 {
+		return nil, nil
+	}
+	importSet := make(map[string]bool)
+	for _, data := range structs {
+		for _, importPath := range data.TestImports {
+			importSet[importPath] = true
+		}
+		for _, field := range data.TestFields {
+			if field.Encrypt {
+				importSet["bytes"] = true // Comparison of the serialized values
+			}
+		}
+	}
+	imports := make([]string, 0, len(importSet))
+	for importPath := range importSet {
+		imports = append(imports, importPath)
+	}
+	sort.Strings(imports)
+
 	var buf bytes.Buffer
-	err := te.processTemplate.Execute(&buf, data)
+	err := te.templates.ExecuteTemplate(&buf, "tests", FileTemplateData{
+		PackageName: structs[0].PackageName,
+		SourceFile:  structs[0].SourceFile,
+		Imports:     imports,
+		Structs:     structs,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -242,16 +934,29 @@ func (te *TemplateEngine) GenerateCode(data TemplateData) ([]byte, error) {
 type GenerationConfig struct {
 	OutputSuffix string
 	PackageName  string
+	Operations   *OperationRegistry // User-defined operations applied besides the builtin tags
+	// SQLHelpers generates the Columns, ScanRow and InsertArgs methods of top-level structs
+	SQLHelpers bool
+	// NamingStrategy names the db columns and JSON fields of the fields without db or
+	// json tags, and of companion fields. Empty is NamingLowercase.
+	NamingStrategy NamingStrategy
 }
 
-// BuildTemplateData builds template data from struct info
+// BuildTemplateData builds template data from struct info, with the processing steps
+// rendered by the default templates
 func BuildTemplateData(structInfo StructInfo, config GenerationConfig) TemplateData {
+	data, _ := defaultEngine.BuildTemplateData(structInfo, config)
+	return data
+}
+
+// BuildTemplateData builds template data from struct info, with the processing steps
+// rendered by the templates of the engine
+func (te *TemplateEngine) BuildTemplateData(structInfo StructInfo, config GenerationConfig) (TemplateData, error) {
 	// Hardcoded imports that are always included in the template
 	hardcodedImports := map[string]bool{
-		"context":                     true,
-		"time":                        true,
-		"github.com/hengadev/errsx":   true,
-		"github.com/hengadev/encx":    true,
+		"context":                   true,
+		"github.com/hengadev/errsx": true,
+		"github.com/hengadev/encx":  true,
 	}
 
 	// Collect required imports from the struct, excluding hardcoded ones
@@ -262,37 +967,233 @@ func BuildTemplateData(structInfo StructInfo, config GenerationConfig) TemplateD
 		}
 	}
 
+	// The redacting methods format, log and marshal the source struct
+	redact := structInfo.GenerationOptions["redact"] == "true"
+	if redact {
+		for _, importPath := range []string{"encoding/json", "fmt", "log/slog"} {
+			if !slices.Contains(imports, importPath) {
+				imports = append(imports, importPath)
+			}
+		}
+	}
+
+	// Slices of nested structs key their errors by index, and user-defined operations
+	// call functions of other packages
+	companionFields := make(map[string]bool)
+	for _, field := range structInfo.Fields {
+		if field.NestedSlice && len(field.EncxTags) == 0 && !slices.Contains(imports, "strconv") {
+			imports = append(imports, "strconv")
+		}
+		for _, tag := range field.EncxTags {
+			if op, found := config.Operations.Lookup(tag); found {
+				companionFields[field.Name+op.Suffix] = true
+				if importPath := op.importPath(); importPath != "" && !slices.Contains(imports, importPath) {
+					imports = append(imports, importPath)
+				}
+			}
+		}
+	}
+	sort.Strings(imports)
+
+	scope := topLevelScope
+	if structInfo.IsNested {
+		scope = nestedScope
+	}
+
 	data := TemplateData{
 		PackageName:        structInfo.PackageName,
 		StructName:         structInfo.StructName,
 		SourceFile:         structInfo.SourceFile,
-		GeneratedTime:      time.Now().Format(time.RFC3339),
 		GeneratorVersion:   "1.0.0",
+		IsNested:           structInfo.IsNested,
 		Imports:            imports,
 		EncryptedFields:    []TemplateField{},
 		PlainFields:        []TemplateField{},
+		NestedFields:       []TemplateField{},
 		PlainFieldCopies:   []string{},
 		PlainFieldRestores: []string{},
 		ProcessingSteps:    []string{},
 		DecryptionSteps:    []string{},
+		EncryptionContext:  buildEncryptionContext(structInfo.GenerationOptions),
 	}
 
 	// Process ALL fields (both with and without encx tags)
 	for _, field := range structInfo.Fields {
+		var err error
 		if len(field.EncxTags) > 0 {
 			// Field has encx tags - apply encryption/hashing transformations
-			processFieldForTemplate(&data, field)
-		} else {
-			// Field has no encx tags - copy as-is
-			processPlainFieldForTemplate(&data, field)
+			err = te.processFieldForTemplate(&data, field, scope, config)
+		} else if field.NestedType != "" {
+			// Field holds a struct with encx tags - process it with the same DEK
+			err = te.processNestedFieldForTemplate(&data, field, scope, config.NamingStrategy)
+		} else if !companionFields[field.Name] {
+			// Field has no encx tags - copy as-is, unless it is the companion field of an operation
+			processPlainFieldForTemplate(&data, field, config.NamingStrategy)
+		}
+		if err != nil {
+			return data, fmt.Errorf("field %s.%s: %w", structInfo.StructName, field.Name, err)
 		}
 	}
 
-	return data
+	if redact {
+		data.Redact = true
+		data.RedactFields = buildRedactFields(structInfo.Fields)
+	}
+
+	if config.SQLHelpers && !structInfo.IsNested {
+		data.SQLHelpers = true
+		data.SQLColumns = buildSQLColumns(data)
+	}
+
+	data.TestFields, data.TestImports = buildTestFields(structInfo)
+
+	return data, nil
+}
+
+// testSamples are the sample values the generated round-trip tests assign to fields,
+// by type without pointer. Fields of other types are left zero.
+var testSamples = map[string]string{
+	"string":    `"encx"`,
+	"[]byte":    `[]byte("encx")`,
+	"[]string":  `[]string{"encx"}`,
+	"bool":      "true",
+	"int":       "42",
+	"int8":      "int8(42)",
+	"int16":     "int16(42)",
+	"int32":     "int32(42)",
+	"int64":     "int64(42)",
+	"uint":      "uint(42)",
+	"uint8":     "uint8(42)",
+	"uint16":    "uint16(42)",
+	"uint32":    "uint32(42)",
+	"uint64":    "uint64(42)",
+	"byte":      "byte(42)",
+	"rune":      "rune(42)",
+	"float32":   "float32(4.2)",
+	"float64":   "4.2",
+	"time.Time": "time.Unix(1700000000, 0)",
+	"uuid.UUID": `uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")`,
+}
+
+// buildTestFields returns the fields with builtin tags of a top-level struct, checked by
+// the generated tests, and the import paths of their sample values. Fields whose type
+// is a fuzzing argument type are also fuzzed.
+func buildTestFields(structInfo StructInfo) ([]TestField, []string) {
+	var fields []TestField
+	var imports []string
+	for _, field := range structInfo.Fields {
+		if len(field.EncxTags) == 0 && field.NestedType != "" {
+			fields = append(fields, TestField{
+				Name:          field.Name,
+				NestedType:    field.NestedType,
+				NestedSlice:   field.NestedSlice,
+				NestedPointer: field.NestedPointer,
+			})
+			continue
+		}
+		testField := TestField{
+			Name:      field.Name,
+			BaseType:  strings.TrimPrefix(field.Type, "*"),
+			Pointer:   strings.HasPrefix(field.Type, "*"),
+			Condition: getNonZeroCondition(field.Name, field.Type),
+		}
+		for _, tag := range field.EncxTags {
+			switch tag {
+			case "encrypt":
+				testField.Encrypt = true
+			case "hash_basic":
+				testField.HashBasic = true
+			case "hash_secure":
+				testField.HashSecure = true
+			}
+		}
+		if !testField.Encrypt && !testField.HashBasic && !testField.HashSecure {
+			continue
+		}
+
+		testField.Sample = testSamples[testField.BaseType]
+		if pkgName, _, found := strings.Cut(testField.BaseType, "."); found && testField.Sample != "" {
+			importPath := structInfo.RequiredImports[pkgName]
+			if pkgName == "time" {
+				importPath = "time"
+			}
+			if importPath == "" {
+				// The package of the sample is imported under another name
+				testField.Sample = ""
+			} else if !slices.Contains(imports, importPath) {
+				imports = append(imports, importPath)
+			}
+		}
+		testField.Fuzz = testField.Sample != "" && !strings.Contains(testField.BaseType, ".") && testField.BaseType != "[]string"
+
+		fields = append(fields, testField)
+	}
+	sort.Strings(imports)
+	return fields, imports
+}
+
+// buildSQLColumns returns the columns of the fields of the generated struct, skipping
+// the fields tagged db:"-". Nested structs, and fields without a native column type,
+// are stored as JSON. Types implementing driver.Valuer and sql.Scanner are stored
+// natively, through their own methods.
+func buildSQLColumns(data TemplateData) []SQLColumn {
+	var columns []SQLColumn
+	for _, fields := range [][]TemplateField{data.PlainFields, data.EncryptedFields} {
+		for _, field := range fields {
+			if field.DBColumn != "-" {
+				columns = append(columns, SQLColumn{Name: field.Name, DBColumn: field.DBColumn, JSON: schema.IsJSONGoType(field.StoredType())})
+			}
+		}
+	}
+	for _, field := range data.NestedFields {
+		if field.DBColumn != "-" {
+			columns = append(columns, SQLColumn{Name: field.Name, DBColumn: field.DBColumn, JSON: true})
+		}
+	}
+	return columns
+}
+
+// buildRedactFields returns the fields of a source struct for the redacting methods,
+// masking the fields with encx tags and those holding nested structs
+func buildRedactFields(fields []FieldInfo) []RedactField {
+	var redactFields []RedactField
+	for _, field := range fields {
+		redactField := RedactField{
+			Name:    field.Name,
+			Type:    field.Type,
+			JSONTag: field.JSONTag,
+			Masked:  len(field.EncxTags) > 0 || field.NestedType != "",
+		}
+		if redactField.Masked {
+			// Options such as omitempty and string do not apply to the mask
+			redactField.JSONTag, _, _ = strings.Cut(field.JSONTag, ",")
+		}
+		redactFields = append(redactFields, redactField)
+	}
+	return redactFields
+}
+
+// buildEncryptionContext builds the static encryption context from generation options.
+//
+// Every "context.<key>" option is bound as the "<key>" entry. Other options, such as
+// "table", are not bound, so that adding them does not change the context of existing
+// records. Entries are sorted by key for reproducible output.
+func buildEncryptionContext(options map[string]string) []ContextEntry {
+	var entries []ContextEntry
+	for key, value := range options {
+		if name, found := strings.CutPrefix(key, "context."); found {
+			entries = append(entries, ContextEntry{Key: name, Value: value})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
 }
 
 // processPlainFieldForTemplate processes a field without encx tags
-func processPlainFieldForTemplate(data *TemplateData, field FieldInfo) {
+func processPlainFieldForTemplate(data *TemplateData, field FieldInfo, naming NamingStrategy) {
 	// Skip companion fields (these are generated fields, not source fields)
 	// Companion fields end with: Encrypted, Hash, HashSecure
 	if isCompanionField(field.Name) {
@@ -300,11 +1201,13 @@ func processPlainFieldForTemplate(data *TemplateData, field FieldInfo) {
 	}
 
 	// Add field to PlainFields (will be included in generated struct as-is)
+	names := naming.namesOf(field)
 	plainField := TemplateField{
-		Name:      field.Name,
-		Type:      field.Type,
-		DBColumn:  strings.ToLower(field.Name),
-		JSONField: strings.ToLower(field.Name),
+		Name:       field.Name,
+		Type:       field.Type,
+		ColumnType: field.ColumnType,
+		DBColumn:   names.dbColumn,
+		JSONField:  names.jsonField,
 	}
 	data.PlainFields = append(data.PlainFields, plainField)
 
@@ -317,6 +1220,50 @@ func processPlainFieldForTemplate(data *TemplateData, field FieldInfo) {
 	data.PlainFieldRestores = append(data.PlainFieldRestores, restoreStmt)
 }
 
+// processNestedFieldForTemplate processes a field whose type is a nested struct with encx tags
+func (te *TemplateEngine) processNestedFieldForTemplate(data *TemplateData, field FieldInfo, scope stepScope, naming NamingStrategy) error {
+	// The Encx type keeps the shape of the field, e.g. []*Contact -> []*ContactEncx
+	names := naming.namesOf(field)
+	nestedField := TemplateField{
+		Name:      field.Name,
+		Type:      strings.TrimSuffix(field.Type, field.NestedType) + field.NestedType + "Encx",
+		DBColumn:  names.dbColumn,
+		JSONField: names.jsonField,
+	}
+	data.NestedFields = append(data.NestedFields, nestedField)
+
+	stepData := NestedStepData{
+		FieldName: field.Name,
+		TypeName:  field.NestedType,
+		Slice:     field.NestedSlice,
+		Pointer:   field.NestedPointer,
+		ErrPrefix: scope.ErrPrefix,
+		Errs:      scope.Errs,
+	}
+
+	processStep, err := te.renderStep("nested_process_step", stepData)
+	if err != nil {
+		return err
+	}
+	decryptStep, err := te.renderStep("nested_decrypt_step", stepData)
+	if err != nil {
+		return err
+	}
+
+	data.ProcessingSteps = append(data.ProcessingSteps, processStep)
+	addDecryptionStep(data, field.Name, decryptStep)
+	return nil
+}
+
+// addDecryptionStep adds the decryption step of a field, which top-level structs can
+// also decrypt on its own
+func addDecryptionStep(data *TemplateData, fieldName, step string) {
+	data.DecryptionSteps = append(data.DecryptionSteps, step)
+	if !data.IsNested {
+		data.DecryptFields = append(data.DecryptFields, DecryptField{FieldName: fieldName, Step: step})
+	}
+}
+
 // isCompanionField checks if a field name looks like a generated companion field
 func isCompanionField(fieldName string) bool {
 	return strings.HasSuffix(fieldName, "Encrypted") ||
@@ -325,45 +1272,45 @@ func isCompanionField(fieldName string) bool {
 }
 
 // processFieldForTemplate processes a field and adds template data
-func processFieldForTemplate(data *TemplateData, field FieldInfo) {
+func (te *TemplateEngine) processFieldForTemplate(data *TemplateData, field FieldInfo, scope stepScope, config GenerationConfig) error {
 	hasEncryption := false
 	var operations []string
+	var userOperations []Operation
 
 	// First pass: add encrypted/hashed fields to struct and collect operations
 	for _, tag := range field.EncxTags {
+		if op, found := config.Operations.Lookup(tag); found {
+			// User-defined operations apply to the value, not the serialized bytes
+			userOperations = append(userOperations, op)
+			data.EncryptedFields = append(data.EncryptedFields, config.NamingStrategy.companionField(field, op.Suffix, op.Type))
+			continue
+		}
 		operations = append(operations, tag)
 
 		switch tag {
 		case "encrypt":
 			hasEncryption = true
 			// Add encrypted field to struct
-			encryptedField := TemplateField{
-				Name:      field.Name + "Encrypted",
-				Type:      "[]byte",
-				DBColumn:  strings.ToLower(field.Name) + "_encrypted",
-				JSONField: strings.ToLower(field.Name) + "_encrypted",
-			}
-			data.EncryptedFields = append(data.EncryptedFields, encryptedField)
+			data.EncryptedFields = append(data.EncryptedFields, config.NamingStrategy.companionField(field, "Encrypted", "[]byte"))
 
 		case "hash_basic":
 			// Add hash field to struct
-			hashField := TemplateField{
-				Name:      field.Name + "Hash",
-				Type:      "string",
-				DBColumn:  strings.ToLower(field.Name) + "_hash",
-				JSONField: strings.ToLower(field.Name) + "_hash",
-			}
+			hashField := config.NamingStrategy.companionField(field, "Hash", "string")
 			data.EncryptedFields = append(data.EncryptedFields, hashField)
 
+			// Hashes of nested structs are stored in the JSON column of the enclosing struct
+			if !data.IsNested {
+				data.LookupFields = append(data.LookupFields, LookupField{
+					FieldName: field.Name,
+					FieldType: field.Type,
+					DBColumn:  hashField.DBColumn,
+					Skip:      zeroCondition("value", field.Type),
+				})
+			}
+
 		case "hash_secure":
 			// Add secure hash field to struct
-			hashField := TemplateField{
-				Name:      field.Name + "HashSecure",
-				Type:      "string",
-				DBColumn:  strings.ToLower(field.Name) + "_hash_secure",
-				JSONField: strings.ToLower(field.Name) + "_hash_secure",
-			}
-			data.EncryptedFields = append(data.EncryptedFields, hashField)
+			data.EncryptedFields = append(data.EncryptedFields, config.NamingStrategy.companionField(field, "HashSecure", "string"))
 		}
 	}
 
@@ -372,95 +1319,121 @@ func processFieldForTemplate(data *TemplateData, field FieldInfo) {
 	// Otherwise, use individual templates (backward compatible)
 	if len(operations) > 1 {
 		// Multi-operation: serialize once and apply all operations
-		step := generateMultiOpStep(field.Name, field.Type, operations)
+		step, err := te.generateMultiOpStep(field.Name, field.Type, operations, scope)
+		if err != nil {
+			return err
+		}
 		data.ProcessingSteps = append(data.ProcessingSteps, step)
 	} else if len(operations) == 1 {
 		// Single operation: use existing templates
+		var stepTemplate string
 		switch operations[0] {
 		case "encrypt":
-			step := generateProcessingStep(encryptStepTemplate, field.Name, field.Type)
-			data.ProcessingSteps = append(data.ProcessingSteps, step)
+			stepTemplate = "encrypt_step"
 		case "hash_basic":
-			step := generateProcessingStep(hashBasicStepTemplate, field.Name, field.Type)
-			data.ProcessingSteps = append(data.ProcessingSteps, step)
+			stepTemplate = "hash_basic_step"
 		case "hash_secure":
-			step := generateProcessingStep(hashSecureStepTemplate, field.Name, field.Type)
+			stepTemplate = "hash_secure_step"
+		}
+		if stepTemplate != "" {
+			step, err := te.generateProcessingStep(stepTemplate, field.Name, field.Type, scope)
+			if err != nil {
+				return err
+			}
 			data.ProcessingSteps = append(data.ProcessingSteps, step)
 		}
 	}
 
+	for _, op := range userOperations {
+		step, err := te.renderStep("operation_step", StepData{
+			FieldName:      field.Name,
+			FieldType:      field.Type,
+			Condition:      getNonZeroCondition(field.Name, field.Type),
+			Operation:      op.Tag,
+			Function:       op.callExpr(),
+			CompanionField: field.Name + op.Suffix,
+			Value:          operationValue(field),
+			ErrPrefix:      scope.ErrPrefix,
+			Errs:           scope.Errs,
+		})
+		if err != nil {
+			return err
+		}
+		data.ProcessingSteps = append(data.ProcessingSteps, step)
+	}
+
 	// Add decryption step if field has encryption
 	if hasEncryption {
-		decryptStep := generateProcessingStep(decryptStepTemplate, field.Name, field.Type)
-		data.DecryptionSteps = append(data.DecryptionSteps, decryptStep)
+		decryptStep, err := te.generateProcessingStep("decrypt_step", field.Name, field.Type, scope)
+		if err != nil {
+			return err
+		}
+		addDecryptionStep(data, field.Name, decryptStep)
 	}
+
+	return nil
 }
 
-// generateProcessingStep generates a processing step from template
-func generateProcessingStep(stepTemplate, fieldName, fieldType string) string {
-	tmpl, _ := template.New("step").Parse(stepTemplate)
+// operationValue returns the expression of the value passed to the function of a
+// user-defined operation. Pointer fields are dereferenced, as nil pointers are skipped.
+func operationValue(field FieldInfo) string {
+	if strings.HasPrefix(field.Type, "*") {
+		return "*source." + field.Name
+	}
+	return "source." + field.Name
+}
 
-	stepData := struct {
-		FieldName string
-		Condition string
-	}{
+// generateProcessingStep generates a processing step with the named template
+func (te *TemplateEngine) generateProcessingStep(stepTemplate, fieldName, fieldType string, scope stepScope) (string, error) {
+	return te.renderStep(stepTemplate, StepData{
 		FieldName: fieldName,
+		FieldType: fieldType,
 		Condition: getNonZeroCondition(fieldName, fieldType),
-	}
-
-	var buf bytes.Buffer
-	tmpl.Execute(&buf, stepData)
-	return buf.String()
+		ErrPrefix: scope.ErrPrefix,
+		Errs:      scope.Errs,
+	})
 }
 
 // generateOperationCode generates the code for a specific operation (encrypt, hash_basic, hash_secure)
 // This is used when multiple operations are performed on the same serialized bytes
-func generateOperationCode(operation, fieldName string) string {
+func generateOperationCode(operation, fieldName, errPrefix string) string {
 	switch operation {
 	case "encrypt":
 		return fmt.Sprintf(`result.%sEncrypted, err = crypto.EncryptData(ctx, %sBytes, dek)
 		if err != nil {
-			errs.Set("%s encryption", err)
-		}`, fieldName, fieldName, fieldName)
+			errs.Set(%s%s encryption", err)
+		}`, fieldName, fieldName, errPrefix, fieldName)
 	case "hash_basic":
 		return fmt.Sprintf(`result.%sHash = crypto.HashBasic(ctx, %sBytes)`, fieldName, fieldName)
 	case "hash_secure":
 		return fmt.Sprintf(`result.%sHashSecure, err = crypto.HashSecure(ctx, %sBytes)
 		if err != nil {
-			errs.Set("%s secure hash", err)
-		}`, fieldName, fieldName, fieldName)
+			errs.Set(%s%s secure hash", err)
+		}`, fieldName, fieldName, errPrefix, fieldName)
 	default:
 		return ""
 	}
 }
 
 // generateMultiOpStep generates a processing step for fields with multiple operations
-func generateMultiOpStep(fieldName, fieldType string, operations []string) string {
-	tmpl, _ := template.New("multiop").Parse(multiOpStepTemplate)
-
+func (te *TemplateEngine) generateMultiOpStep(fieldName, fieldType string, operations []string, scope stepScope) (string, error) {
 	// Generate operation code for each operation
 	var opSteps []string
 	var opNames []string
 	for _, op := range operations {
-		opSteps = append(opSteps, generateOperationCode(op, fieldName))
+		opSteps = append(opSteps, generateOperationCode(op, fieldName, scope.ErrPrefix))
 		opNames = append(opNames, op)
 	}
 
-	stepData := struct {
-		FieldName  string
-		Condition  string
-		Operations string
-		OpSteps    []string
-	}{
+	return te.renderStep("multi_op_step", StepData{
 		FieldName:  fieldName,
+		FieldType:  fieldType,
 		Condition:  getNonZeroCondition(fieldName, fieldType),
 		Operations: strings.Join(opNames, " + "),
 		OpSteps:    opSteps,
-	}
-
-	var buf bytes.Buffer
-	tmpl.Execute(&buf, stepData)
-	return buf.String()
+		ErrPrefix:  scope.ErrPrefix,
+		Errs:       scope.Errs,
+	})
 }
 
 // getNonZeroCondition returns a condition expression to check if a field should be processed
@@ -483,3 +1456,18 @@ func getNonZeroCondition(fieldName, typeName string) string {
 	// Empty strings, zero integers, and false booleans are valid values
 	return ""
 }
+
+// zeroCondition returns the negation of the condition of getNonZeroCondition, for a
+// value expression. Returns empty string if the value is always processed.
+func zeroCondition(expr, typeName string) string {
+	if strings.HasPrefix(typeName, "*") {
+		return expr + " == nil"
+	}
+	if strings.Contains(typeName, "uuid.UUID") {
+		return expr + " == uuid.Nil"
+	}
+	if strings.Contains(typeName, "time.Time") {
+		return expr + ".IsZero()"
+	}
+	return ""
+}
@@ -1,8 +1,11 @@
 package codegen
 
 import (
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
 	"testing"
-	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -23,7 +26,6 @@ func TestGenerateCodeSimpleStruct(t *testing.T) {
 		PackageName:      "test",
 		StructName:       "User",
 		SourceFile:       "user.go",
-		GeneratedTime:    time.Now().Format(time.RFC3339),
 		GeneratorVersion: "1.0.0",
 		EncryptedFields: []TemplateField{
 			{
@@ -78,6 +80,10 @@ func TestGenerateCodeSimpleStruct(t *testing.T) {
 	// Verify encryption logic
 	assert.Contains(t, codeStr, "crypto.EncryptData(ctx, EmailBytes, dek)")
 
+	// Verify the DEK is stored with the version of the KEK that encrypted it
+	assert.Contains(t, codeStr, "result.DEKEncrypted, result.KeyVersion, err = crypto.EncryptDEKVersioned(ctx, dek)")
+	assert.NotContains(t, codeStr, "GetCurrentKEKVersion")
+
 	// Verify decryption logic
 	assert.Contains(t, codeStr, "crypto.DecryptData(ctx, source.EmailEncrypted, dek)")
 
@@ -99,7 +105,6 @@ func TestGenerateCodeWithMultipleFields(t *testing.T) {
 		PackageName:      "test",
 		StructName:       "User",
 		SourceFile:       "user.go",
-		GeneratedTime:    time.Now().Format(time.RFC3339),
 		GeneratorVersion: "1.0.0",
 		EncryptedFields: []TemplateField{
 			{
@@ -144,7 +149,6 @@ func TestGenerateCodeEmpty(t *testing.T) {
 		PackageName:      "test",
 		StructName:       "Empty",
 		SourceFile:       "empty.go",
-		GeneratedTime:    time.Now().Format(time.RFC3339),
 		GeneratorVersion: "1.0.0",
 		EncryptedFields:  []TemplateField{},
 		ProcessingSteps:  []string{},
@@ -162,3 +166,495 @@ func TestGenerateCodeEmpty(t *testing.T) {
 	assert.Contains(t, codeStr, "func ProcessEmptyEncx")
 	assert.Contains(t, codeStr, "func DecryptEmptyEncx")
 }
+
+func TestBuildTemplateDataEncryptionContext(t *testing.T) {
+	structInfo := StructInfo{
+		PackageName: "test",
+		StructName:  "User",
+		SourceFile:  "user.go",
+		GenerationOptions: map[string]string{
+			"table":          "users",
+			"context.domain": "billing",
+			"context.table":  "accounts",
+			"unrelated":      "ignored",
+		},
+		Fields: []FieldInfo{
+			{Name: "Email", Type: "string", EncxTags: []string{"encrypt"}, IsValid: true},
+		},
+	}
+
+	data := BuildTemplateData(structInfo, GenerationConfig{})
+	assert.Equal(t, []ContextEntry{
+		{Key: "domain", Value: "billing"},
+		{Key: "table", Value: "accounts"},
+	}, data.EncryptionContext)
+
+	engine, err := NewTemplateEngine()
+	require.NoError(t, err)
+	code, err := engine.GenerateCode(data)
+	require.NoError(t, err)
+
+	// The context is bound in Process, Decrypt and DecryptFields
+	codeStr := string(code)
+	assert.Equal(t, 3, strings.Count(codeStr, "ctx = encx.WithEncryptionContext(ctx, map[string]string{"))
+	assert.Contains(t, codeStr, `"domain": "billing",`)
+	assert.Contains(t, codeStr, `"table": "accounts",`)
+	// The table option is not bound
+	assert.NotContains(t, codeStr, `"users"`)
+}
+
+func TestBuildTemplateDataWithoutEncryptionContext(t *testing.T) {
+	structInfo := StructInfo{
+		PackageName:       "test",
+		StructName:        "User",
+		SourceFile:        "user.go",
+		GenerationOptions: map[string]string{"table": "users"},
+		Fields: []FieldInfo{
+			{Name: "Email", Type: "string", EncxTags: []string{"encrypt"}, IsValid: true},
+		},
+	}
+
+	// Only context.* options are bound
+	data := BuildTemplateData(structInfo, GenerationConfig{})
+	assert.Empty(t, data.EncryptionContext)
+
+	engine, err := NewTemplateEngine()
+	require.NoError(t, err)
+	code, err := engine.GenerateCode(data)
+	require.NoError(t, err)
+	assert.NotContains(t, string(code), "WithEncryptionContext")
+}
+
+func TestGenerateFileWithNestedStructs(t *testing.T) {
+	address := StructInfo{
+		PackageName: "test",
+		StructName:  "Address",
+		SourceFile:  "patient.go",
+		IsNested:    true,
+		Fields: []FieldInfo{
+			{Name: "Street", Type: "string", EncxTags: []string{"encrypt"}, IsValid: true},
+			{Name: "City", Type: "string", IsValid: true},
+		},
+	}
+	contact := StructInfo{
+		PackageName: "test",
+		StructName:  "EmergencyContact",
+		SourceFile:  "patient.go",
+		IsNested:    true,
+		Fields: []FieldInfo{
+			{Name: "Phone", Type: "string", EncxTags: []string{"encrypt", "hash_basic"}, IsValid: true},
+			{Name: "Address", Type: "*Address", IsValid: true, NestedType: "Address", NestedPointer: true},
+		},
+	}
+	patient := StructInfo{
+		PackageName: "test",
+		StructName:  "Patient",
+		SourceFile:  "patient.go",
+		Fields: []FieldInfo{
+			{Name: "SSN", Type: "string", EncxTags: []string{"encrypt"}, IsValid: true},
+			{Name: "HomeAddress", Type: "Address", IsValid: true, NestedType: "Address"},
+			{Name: "Contacts", Type: "[]EmergencyContact", IsValid: true, NestedType: "EmergencyContact", NestedSlice: true},
+			{Name: "Others", Type: "[]*EmergencyContact", IsValid: true, NestedType: "EmergencyContact", NestedSlice: true, NestedPointer: true},
+		},
+	}
+
+	var data []TemplateData
+	for _, structInfo := range []StructInfo{address, contact, patient} {
+		data = append(data, BuildTemplateData(structInfo, GenerationConfig{}))
+	}
+	assert.Equal(t, []TemplateField{
+		{Name: "HomeAddress", Type: "AddressEncx", DBColumn: "homeaddress", JSONField: "homeaddress"},
+		{Name: "Contacts", Type: "[]EmergencyContactEncx", DBColumn: "contacts", JSONField: "contacts"},
+		{Name: "Others", Type: "[]*EmergencyContactEncx", DBColumn: "others", JSONField: "others"},
+	}, data[2].NestedFields)
+	assert.Equal(t, []string{"strconv"}, data[2].Imports)
+
+	engine, err := NewTemplateEngine()
+	require.NoError(t, err)
+	code, err := engine.GenerateFile(data)
+	require.NoError(t, err)
+
+	// The generated file must be valid Go
+	_, err = parser.ParseFile(token.NewFileSet(), "patient_encx.go", code, 0)
+	require.NoError(t, err)
+
+	codeStr := string(code)
+	assert.Equal(t, 1, strings.Count(codeStr, "package test"))
+	assert.Contains(t, codeStr, `"strconv"`)
+	assert.Contains(t, codeStr, `"time"`)
+
+	// Nested structs get helpers using the DEK of the enclosing struct
+	assert.Contains(t, codeStr, "func processAddressEncx(ctx context.Context, crypto encx.CryptoService, dek []byte, source *Address, errs *errsx.Map, path string) AddressEncx")
+	assert.Contains(t, codeStr, "func decryptEmergencyContactEncx(ctx context.Context, crypto encx.CryptoService, dek []byte, source *EmergencyContactEncx, errs *errsx.Map, path string) EmergencyContact")
+	assert.NotContains(t, codeStr, "func ProcessAddressEncx")
+	assert.Equal(t, 1, strings.Count(codeStr, "DEKEncrypted  []byte"))
+	assert.Contains(t, codeStr, "func ProcessPatientEncx")
+
+	// Errors are keyed by the path of the nested value
+	assert.Contains(t, codeStr, `errs.Set(path+".Street encryption", err)`)
+	assert.Contains(t, codeStr, `errs.Set("SSN encryption", err)`)
+	assert.Contains(t, codeStr, `result.HomeAddress = processAddressEncx(ctx, crypto, dek, &source.HomeAddress, &errs, "HomeAddress")`)
+	assert.Contains(t, codeStr, `result.Contacts[i] = processEmergencyContactEncx(ctx, crypto, dek, &source.Contacts[i], &errs, "Contacts["+strconv.Itoa(i)+"]")`)
+	assert.Contains(t, codeStr, `AddressEncx := processAddressEncx(ctx, crypto, dek, source.Address, errs, path+".Address")`)
+	assert.Contains(t, codeStr, "if source.Others[i] != nil {")
+	assert.Contains(t, codeStr, "result.Others = make([]*EmergencyContact, len(source.Others))")
+}
+
+func TestGenerateFileNestedOnly(t *testing.T) {
+	data := BuildTemplateData(StructInfo{
+		PackageName: "test",
+		StructName:  "Address",
+		SourceFile:  "address.go",
+		IsNested:    true,
+		Fields: []FieldInfo{
+			{Name: "Street", Type: "string", EncxTags: []string{"encrypt"}, IsValid: true},
+		},
+	}, GenerationConfig{})
+
+	engine, err := NewTemplateEngine()
+	require.NoError(t, err)
+	code, err := engine.GenerateFile([]TemplateData{data})
+	require.NoError(t, err)
+
+	_, err = parser.ParseFile(token.NewFileSet(), "address_encx.go", code, 0)
+	require.NoError(t, err)
+
+	// Only the Process functions use "time"
+	assert.NotContains(t, string(code), `"time"`)
+
+	_, err = engine.GenerateFile(nil)
+	assert.Error(t, err)
+}
+
+func TestGenerateFileWithSQLHelpers(t *testing.T) {
+	address := StructInfo{
+		PackageName: "test",
+		StructName:  "Address",
+		SourceFile:  "user.go",
+		IsNested:    true,
+		Fields: []FieldInfo{
+			{Name: "Street", Type: "string", EncxTags: []string{"encrypt"}, IsValid: true},
+		},
+	}
+	user := StructInfo{
+		PackageName: "test",
+		StructName:  "User",
+		SourceFile:  "user.go",
+		Fields: []FieldInfo{
+			{Name: "ID", Type: "int", IsValid: true},
+			{Name: "Email", Type: "string", EncxTags: []string{"encrypt", "hash_basic"}, IsValid: true},
+			{Name: "Tags", Type: "[]string", IsValid: true},
+			{Name: "Note", Type: "string", DBTag: "-", IsValid: true},
+			{Name: "Home", Type: "*Address", IsValid: true, NestedType: "Address", NestedPointer: true},
+		},
+	}
+
+	config := GenerationConfig{SQLHelpers: true}
+	var data []TemplateData
+	for _, structInfo := range []StructInfo{address, user} {
+		data = append(data, BuildTemplateData(structInfo, config))
+	}
+
+	// Nested structs are stored in the columns of their enclosing struct
+	assert.False(t, data[0].SQLHelpers)
+	assert.Equal(t, []SQLColumn{
+		{Name: "ID", DBColumn: "id"},
+		{Name: "Tags", DBColumn: "tags", JSON: true},
+		{Name: "EmailEncrypted", DBColumn: "email_encrypted"},
+		{Name: "EmailHash", DBColumn: "email_hash"},
+		{Name: "Home", DBColumn: "home", JSON: true},
+	}, data[1].SQLColumns)
+
+	code, err := defaultEngine.GenerateFile(data)
+	require.NoError(t, err)
+	_, err = parser.ParseFile(token.NewFileSet(), "user_encx.go", code, 0)
+	require.NoError(t, err)
+
+	codeStr := string(code)
+	assert.Contains(t, codeStr, "func (UserEncx) Columns() []string")
+	assert.Contains(t, codeStr, "\"email_hash\",\n\t\t\"home\",\n\t\t\"dek_encrypted\",\n\t\t\"key_version\",\n\t\t\"metadata\",")
+	assert.Contains(t, codeStr, "func (e *UserEncx) ScanRow(row encx.RowScanner) error")
+	assert.Contains(t, codeStr, "encx.NewJSONColumn(&e.Home),")
+	assert.Contains(t, codeStr, "func (e *UserEncx) InsertArgs() []any")
+	assert.Contains(t, codeStr, "encx.NewJSONColumn(e.Tags),")
+	assert.NotContains(t, codeStr, "&e.Note")
+	assert.NotContains(t, codeStr, "func (AddressEncx) Columns")
+
+	// The helpers are opt-in
+	code, err = defaultEngine.GenerateCode(BuildTemplateData(user, GenerationConfig{}))
+	require.NoError(t, err)
+	assert.NotContains(t, string(code), "Columns()")
+}
+
+func TestGenerateFileWithLookup(t *testing.T) {
+	user := StructInfo{
+		PackageName: "test",
+		StructName:  "User",
+		SourceFile:  "user.go",
+		Fields: []FieldInfo{
+			{Name: "Email", Type: "string", EncxTags: []string{"encrypt", "hash_basic"}, IsValid: true},
+			{Name: "Phone", Type: "*string", DBTag: "phone_number", EncxTags: []string{"hash_basic"}, IsValid: true},
+			{Name: "SSN", Type: "string", EncxTags: []string{"hash_secure"}, IsValid: true},
+		},
+	}
+
+	data := BuildTemplateData(user, GenerationConfig{})
+	assert.Equal(t, []LookupField{
+		{FieldName: "Email", FieldType: "string", DBColumn: "email_hash"},
+		{FieldName: "Phone", FieldType: "*string", DBColumn: "phone_number_hash", Skip: "value == nil"},
+	}, data.LookupFields)
+
+	code, err := defaultEngine.GenerateCode(data)
+	require.NoError(t, err)
+	_, err = parser.ParseFile(token.NewFileSet(), "user_encx.go", code, 0)
+	require.NoError(t, err)
+
+	codeStr := string(code)
+	assert.Contains(t, codeStr, "type UserLookup struct{}")
+	assert.Contains(t, codeStr, "func (UserLookup) EmailHash(ctx context.Context, crypto encx.CryptoService, value string) (column, hash string, err error)")
+	assert.Contains(t, codeStr, "return \"email_hash\", crypto.HashBasic(ctx, valueBytes), nil")
+	// Nil pointers are not hashed by ProcessUserEncx
+	assert.Contains(t, codeStr, "if value == nil {\n\t\treturn \"phone_number_hash\", \"\", nil")
+	assert.NotContains(t, codeStr, "SSNHash(")
+
+	// Hashes of nested structs are stored in the column of the enclosing struct
+	user.IsNested = true
+	assert.Empty(t, BuildTemplateData(user, GenerationConfig{}).LookupFields)
+}
+
+func TestGenerateFileWithDecryptFields(t *testing.T) {
+	address := StructInfo{
+		PackageName: "test",
+		StructName:  "Address",
+		SourceFile:  "user.go",
+		IsNested:    true,
+		Fields: []FieldInfo{
+			{Name: "Street", Type: "string", EncxTags: []string{"encrypt"}, IsValid: true},
+		},
+	}
+	user := StructInfo{
+		PackageName: "test",
+		StructName:  "User",
+		SourceFile:  "user.go",
+		Fields: []FieldInfo{
+			{Name: "ID", Type: "int", IsValid: true},
+			{Name: "Name", Type: "string", EncxTags: []string{"encrypt"}, IsValid: true},
+			{Name: "SSN", Type: "string", EncxTags: []string{"encrypt", "hash_secure"}, IsValid: true},
+			{Name: "Email", Type: "string", EncxTags: []string{"hash_basic"}, IsValid: true},
+			{Name: "Home", Type: "*Address", IsValid: true, NestedType: "Address", NestedPointer: true},
+		},
+	}
+
+	var data []TemplateData
+	for _, structInfo := range []StructInfo{address, user} {
+		data = append(data, BuildTemplateData(structInfo, GenerationConfig{}))
+	}
+
+	// Nested structs are decrypted as a whole with the field holding them
+	assert.Empty(t, data[0].DecryptFields)
+	var fieldNames []string
+	for _, field := range data[1].DecryptFields {
+		fieldNames = append(fieldNames, field.FieldName)
+	}
+	assert.Equal(t, []string{"Name", "SSN", "Home"}, fieldNames)
+	assert.Equal(t, data[1].DecryptionSteps, []string{data[1].DecryptFields[0].Step, data[1].DecryptFields[1].Step, data[1].DecryptFields[2].Step})
+
+	code, err := defaultEngine.GenerateFile(data)
+	require.NoError(t, err)
+	_, err = parser.ParseFile(token.NewFileSet(), "user_encx.go", code, 0)
+	require.NoError(t, err)
+
+	codeStr := string(code)
+	assert.Contains(t, codeStr, "type UserField string")
+	assert.Contains(t, codeStr, `UserFieldSSN UserField = "SSN"`)
+	assert.NotContains(t, codeStr, "UserFieldEmail")
+	assert.Contains(t, codeStr, "func DecryptUserEncxFields(ctx context.Context, crypto encx.CryptoService, source *UserEncx, fields ...UserField) (*User, error)")
+	assert.Contains(t, codeStr, `encx.ReportFieldDecryption(ctx, crypto, "User", string(field), time.Since(start), fieldErrs.AsError())`)
+	assert.NotContains(t, codeStr, "AddressField")
+}
+
+func TestGenerateFileWithRedact(t *testing.T) {
+	user := StructInfo{
+		PackageName:       "test",
+		StructName:        "User",
+		SourceFile:        "user.go",
+		GenerationOptions: map[string]string{"redact": "true"},
+		Fields: []FieldInfo{
+			{Name: "ID", Type: "int", JSONTag: "id", IsValid: true},
+			{Name: "Email", Type: "string", JSONTag: "email,omitempty", EncxTags: []string{"encrypt", "hash_basic"}, IsValid: true},
+			{Name: "Home", Type: "Address", IsValid: true, NestedType: "Address"},
+		},
+	}
+
+	data := BuildTemplateData(user, GenerationConfig{})
+	assert.True(t, data.Redact)
+	assert.Equal(t, []RedactField{
+		{Name: "ID", Type: "int", JSONTag: "id"},
+		{Name: "Email", Type: "string", JSONTag: "email", Masked: true},
+		{Name: "Home", Type: "Address", Masked: true},
+	}, data.RedactFields)
+	assert.Equal(t, []string{"encoding/json", "fmt", "log/slog"}, data.Imports)
+
+	code, err := defaultEngine.GenerateCode(data)
+	require.NoError(t, err)
+	_, err = parser.ParseFile(token.NewFileSet(), "user_encx.go", code, 0)
+	require.NoError(t, err)
+
+	codeStr := string(code)
+	assert.Contains(t, codeStr, `return fmt.Sprintf("{ID:%v Email:%v Home:%v}",`)
+	assert.Contains(t, codeStr, `return fmt.Sprintf("test.User{ID:%#v, Email:%#v, Home:%#v}",`)
+	assert.Contains(t, codeStr, `slog.String("Email", encx.Redacted),`)
+	assert.Contains(t, codeStr, `slog.Any("ID", s.ID),`)
+	assert.Contains(t, codeStr, "Email string `json:\"email\"`")
+	assert.Contains(t, codeStr, "func (s User) MarshalJSON() ([]byte, error)")
+
+	// Redaction is opt-in
+	user.GenerationOptions = nil
+	data = BuildTemplateData(user, GenerationConfig{})
+	assert.False(t, data.Redact)
+	assert.Empty(t, data.Imports)
+}
+
+func TestGenerateFileWithBatch(t *testing.T) {
+	address := StructInfo{
+		PackageName: "test",
+		StructName:  "Address",
+		SourceFile:  "user.go",
+		IsNested:    true,
+		Fields: []FieldInfo{
+			{Name: "Street", Type: "string", EncxTags: []string{"encrypt"}, IsValid: true},
+		},
+	}
+	user := StructInfo{
+		PackageName: "test",
+		StructName:  "User",
+		SourceFile:  "user.go",
+		Fields: []FieldInfo{
+			{Name: "Email", Type: "string", EncxTags: []string{"encrypt"}, IsValid: true},
+			{Name: "Home", Type: "Address", IsValid: true, NestedType: "Address"},
+		},
+	}
+
+	code, err := defaultEngine.GenerateFile([]TemplateData{
+		BuildTemplateData(address, GenerationConfig{}),
+		BuildTemplateData(user, GenerationConfig{}),
+	})
+	require.NoError(t, err)
+	_, err = parser.ParseFile(token.NewFileSet(), "user_encx.go", code, 0)
+	require.NoError(t, err)
+
+	codeStr := string(code)
+	assert.Contains(t, codeStr, "func ProcessUserEncxBatch(ctx context.Context, crypto encx.CryptoService, sources []*User, opts ...encx.BatchOption) ([]*UserEncx, error)")
+	assert.Contains(t, codeStr, "func DecryptUserEncxBatch(ctx context.Context, crypto encx.CryptoService, sources []*UserEncx, opts ...encx.BatchOption) ([]*User, error)")
+	assert.Contains(t, codeStr, "crypto = encx.WithKEKCache(crypto)")
+	assert.Contains(t, codeStr, "crypto = encx.WithDEKCache(encx.WithKEKCache(crypto))")
+	assert.Equal(t, 2, strings.Count(codeStr, "encx.RunBatch(ctx, len(sources), func(i int) error {"))
+	// Nested structs are processed with their enclosing struct
+	assert.NotContains(t, codeStr, "AddressEncxBatch")
+}
+
+func TestGenerateTestFile(t *testing.T) {
+	address := StructInfo{
+		PackageName: "test",
+		StructName:  "Address",
+		SourceFile:  "user.go",
+		IsNested:    true,
+		Fields: []FieldInfo{
+			{Name: "Street", Type: "string", EncxTags: []string{"encrypt"}, IsValid: true},
+		},
+	}
+	user := StructInfo{
+		PackageName:     "test",
+		StructName:      "User",
+		SourceFile:      "user.go",
+		RequiredImports: map[string]string{"uuid": "github.com/google/uuid"},
+		Fields: []FieldInfo{
+			{Name: "ID", Type: "int", IsValid: true},
+			{Name: "Email", Type: "string", EncxTags: []string{"encrypt", "hash_basic"}, IsValid: true},
+			{Name: "Nickname", Type: "*string", EncxTags: []string{"encrypt"}, IsValid: true},
+			{Name: "Ref", Type: "uuid.UUID", EncxTags: []string{"hash_basic"}, IsValid: true},
+			{Name: "Home", Type: "Address", IsValid: true, NestedType: "Address"},
+		},
+	}
+
+	data := BuildTemplateData(user, GenerationConfig{})
+	assert.Equal(t, []TestField{
+		{Name: "Email", BaseType: "string", Encrypt: true, HashBasic: true, Sample: `"encx"`, Fuzz: true},
+		{Name: "Nickname", BaseType: "string", Pointer: true, Encrypt: true, Condition: "source.Nickname != nil", Sample: `"encx"`, Fuzz: true},
+		{Name: "Ref", BaseType: "uuid.UUID", HashBasic: true, Condition: "source.Ref != uuid.Nil", Sample: `uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")`},
+		{Name: "Home", NestedType: "Address"},
+	}, data.TestFields)
+	assert.Equal(t, []string{"github.com/google/uuid"}, data.TestImports)
+
+	code, err := defaultEngine.GenerateTestFile([]TemplateData{
+		BuildTemplateData(address, GenerationConfig{}),
+		data,
+	})
+	require.NoError(t, err)
+	file, err := parser.ParseFile(token.NewFileSet(), "user_encx_test.go", code, 0)
+	require.NoError(t, err)
+	var imports []string
+	for _, spec := range file.Imports {
+		imports = append(imports, spec.Path.Value)
+	}
+	assert.ElementsMatch(t, []string{`"context"`, `"testing"`, `"github.com/hengadev/encx"`, `"bytes"`, `"github.com/google/uuid"`}, imports)
+
+	codeStr := string(code)
+	assert.Contains(t, codeStr, "func checkUserEncxRoundTrip(t *testing.T, crypto *encx.Crypto, source *User)")
+	assert.Contains(t, codeStr, "crypto.CompareBasicHashAndValue(ctx, source.Email, encrypted.EmailHash)")
+	assert.Contains(t, codeStr, "if source.Ref != uuid.Nil {")
+	assert.Contains(t, codeStr, "func TestUserEncxRoundTrip(t *testing.T)")
+	assert.Contains(t, codeStr, "source.Nickname = func() *string { v := \"encx\"; return &v }()")
+	assert.Contains(t, codeStr, "func FuzzUserEncx(f *testing.F)")
+	assert.Contains(t, codeStr, `f.Add("encx", "encx")`)
+	assert.Contains(t, codeStr, "f.Fuzz(func(t *testing.T, Email string, Nickname string) {")
+	// Nested structs are checked and filled with their enclosing struct
+	assert.Contains(t, codeStr, "checkAddressEncxFields(t, ctx, crypto, &source.Home, &encrypted.Home, &decrypted.Home)")
+	assert.Contains(t, codeStr, "fillAddressEncxSample(&source.Home, depth-1)")
+	assert.Contains(t, codeStr, "func checkAddressEncxFields(t *testing.T, ctx context.Context, crypto *encx.Crypto, source *Address, encrypted *AddressEncx, decrypted *Address)")
+	assert.NotContains(t, codeStr, "TestAddressEncxRoundTrip")
+
+	// Files without top-level structs only have the helpers of their structs
+	code, err = defaultEngine.GenerateTestFile([]TemplateData{BuildTemplateData(address, GenerationConfig{})})
+	require.NoError(t, err)
+	assert.Contains(t, string(code), "func fillAddressEncxSample(source *Address, depth int)")
+	assert.NotContains(t, string(code), "func Test")
+
+	// Files without structs have no tests
+	code, err = defaultEngine.GenerateTestFile(nil)
+	require.NoError(t, err)
+	assert.Nil(t, code)
+}
+
+func TestGenerateFileReproducible(t *testing.T) {
+	structInfo := StructInfo{
+		PackageName: "test",
+		StructName:  "User",
+		SourceFile:  "user.go",
+		RequiredImports: map[string]string{
+			"uuid": "github.com/google/uuid",
+			"big":  "math/big",
+		},
+		GenerationOptions: map[string]string{"table": "users", "context.domain": "billing"},
+		Fields: []FieldInfo{
+			{Name: "Email", Type: "string", EncxTags: []string{"encrypt", "hash_basic"}, IsValid: true},
+		},
+	}
+
+	engine, err := NewTemplateEngine()
+	require.NoError(t, err)
+
+	first, err := engine.GenerateCode(BuildTemplateData(structInfo, GenerationConfig{}))
+	require.NoError(t, err)
+	second, err := engine.GenerateCode(BuildTemplateData(structInfo, GenerationConfig{}))
+	require.NoError(t, err)
+	assert.Equal(t, string(first), string(second))
+	assert.Regexp(t, `(?m)^// Generated: sha256:[0-9a-f]{64}$`, string(first))
+
+	// The stamp changes with the content
+	structInfo.Fields[0].EncxTags = []string{"encrypt"}
+	third, err := engine.GenerateCode(BuildTemplateData(structInfo, GenerationConfig{}))
+	require.NoError(t, err)
+	stamp := regexp.MustCompile(`// Generated: .*`)
+	assert.NotEqual(t, stamp.Find(first), stamp.Find(third))
+}
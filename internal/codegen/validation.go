@@ -2,6 +2,7 @@ package codegen
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 )
 
@@ -14,7 +15,7 @@ type TagValidator struct {
 // NewTagValidator creates a new tag validator
 func NewTagValidator() *TagValidator {
 	return &TagValidator{
-		knownTags: []string{"encrypt", "hash_basic", "hash_secure"},
+		knownTags: slices.Clone(builtinTags),
 		invalidCombos: map[string][]string{
 			"hash_basic,hash_secure": {"hash_basic", "hash_secure"},
 			"hash_secure,hash_basic": {"hash_basic", "hash_secure"},
@@ -22,6 +23,19 @@ func NewTagValidator() *TagValidator {
 	}
 }
 
+// NewTagValidatorWithOperations creates a tag validator that also accepts the tags of
+// user-defined operations, and rejects the combinations they conflict with
+func NewTagValidatorWithOperations(registry *OperationRegistry) *TagValidator {
+	tv := NewTagValidator()
+	for _, op := range registry.Operations() {
+		tv.knownTags = append(tv.knownTags, op.Tag)
+		for _, tag := range op.ConflictsWith {
+			tv.invalidCombos[op.Tag+","+tag] = []string{op.Tag, tag}
+		}
+	}
+	return tv
+}
+
 // ValidateFieldTags validates the tags for a single field
 func (tv *TagValidator) ValidateFieldTags(fieldName string, tags []string) []string {
 	var errors []string
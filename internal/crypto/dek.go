@@ -48,19 +48,27 @@ func (d *DEKOperations) GenerateDEK() ([]byte, error) {
 
 // EncryptDEK encrypts the DEK using the current active KEK.
 func (d *DEKOperations) EncryptDEK(ctx context.Context, plaintextDEK []byte, versionManager KMSVersionManager) ([]byte, error) {
+	ciphertextDEK, _, err := d.EncryptDEKVersioned(ctx, plaintextDEK, versionManager)
+	return ciphertextDEK, err
+}
+
+// EncryptDEKVersioned encrypts the DEK using the current active KEK, and returns the
+// version of that KEK. The version is resolved once, so it always matches the KEK that
+// encrypted the DEK, even if the KEK is rotated concurrently.
+func (d *DEKOperations) EncryptDEKVersioned(ctx context.Context, plaintextDEK []byte, versionManager KMSVersionManager) ([]byte, int, error) {
 	currentVersion, err := versionManager.GetCurrentKEKVersion(ctx, d.kekAlias)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	kmsKeyID, err := versionManager.GetKMSKeyIDForVersion(ctx, d.kekAlias, currentVersion)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	ciphertextDEK, err := d.kmsService.EncryptDEK(ctx, kmsKeyID, plaintextDEK)
 	if err != nil {
-		return nil, fmt.Errorf("failed to encrypt DEK with KMS (version %d): %w", currentVersion, err)
+		return nil, 0, fmt.Errorf("failed to encrypt DEK with KMS (version %d): %w", currentVersion, err)
 	}
-	return ciphertextDEK, nil
+	return ciphertextDEK, currentVersion, nil
 }
 
 // DecryptDEKWithVersion decrypts the DEK using the KEK version it was encrypted with.
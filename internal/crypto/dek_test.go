@@ -181,6 +181,34 @@ func TestDEKOperations_EncryptDEK_KMSError(t *testing.T) {
 	mockVersionManager.AssertExpectations(t)
 }
 
+func TestDEKOperations_EncryptDEKVersioned_Success(t *testing.T) {
+	mockKMS := &MockKMSService{}
+	mockVersionManager := &MockVersionManager{}
+	dekOps, err := NewDEKOperations(mockKMS, "test-alias")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	plaintextDEK := []byte("test-dek-32-bytes-for-encryption!")
+	expectedCiphertext := []byte("encrypted-dek-data")
+
+	// The version is resolved once, for both the KEK and the returned version
+	mockVersionManager.On("GetCurrentKEKVersion", ctx, "test-alias").Return(3, nil).Once()
+	mockVersionManager.On("GetKMSKeyIDForVersion", ctx, "test-alias", 3).Return("kms-key-id-3", nil)
+	mockKMS.On("EncryptDEK", ctx, "kms-key-id-3", plaintextDEK).Return(expectedCiphertext, nil)
+
+	// Execute
+	ciphertext, version, err := dekOps.EncryptDEKVersioned(ctx, plaintextDEK, mockVersionManager)
+
+	// Verify
+	require.NoError(t, err)
+	assert.Equal(t, expectedCiphertext, ciphertext)
+	assert.Equal(t, 3, version)
+
+	// Verify all expectations were met
+	mockKMS.AssertExpectations(t)
+	mockVersionManager.AssertExpectations(t)
+}
+
 func TestDEKOperations_DecryptDEKWithVersion_Success(t *testing.T) {
 	mockKMS := &MockKMSService{}
 	mockVersionManager := &MockVersionManager{}
@@ -23,6 +23,14 @@ type KeyRotationService interface {
 	GetKeyID(ctx context.Context, alias string) (string, error)
 }
 
+// KeyRotator is implemented by KMS services that version keys natively.
+//
+// When the KMS service implements it, RotateKEK rotates the current key in place
+// instead of creating a new key.
+type KeyRotator interface {
+	RotateKey(ctx context.Context, keyID string) (string, error)
+}
+
 // ObservabilityHook defines observability operations for monitoring
 type ObservabilityHook interface {
 	OnProcessStart(ctx context.Context, operation string, metadata map[string]any)
@@ -69,9 +77,8 @@ func (kr *KeyRotationOperations) RotateKEK(ctx context.Context, versionManager K
 	metadata["old_version"] = currentVersion
 	metadata["new_version"] = newVersion
 
-	kmsKeyID, err := kr.kmsService.CreateKey(ctx, kr.kekAlias) // KMS might handle rotation internally based on alias
+	kmsKeyID, err := kr.newKEKVersion(ctx, versionManager, currentVersion)
 	if err != nil {
-		err = fmt.Errorf("failed to create new KEK version in KMS: %w", err)
 		if kr.observability != nil {
 			kr.observability.OnError(ctx, "RotateKEK", err, metadata)
 			kr.observability.OnProcessComplete(ctx, "RotateKEK", time.Since(start), err, metadata)
@@ -116,6 +123,30 @@ func (kr *KeyRotationOperations) RotateKEK(ctx context.Context, versionManager K
 	return nil
 }
 
+// newKEKVersion creates the KMS key backing a new KEK version.
+//
+// KMS services implementing KeyRotator rotate the key of the current version;
+// other services create a new key.
+func (kr *KeyRotationOperations) newKEKVersion(ctx context.Context, versionManager KMSVersionManager, currentVersion int) (string, error) {
+	if rotator, ok := kr.kmsService.(KeyRotator); ok && currentVersion > 0 {
+		currentKeyID, err := versionManager.GetKMSKeyIDForVersion(ctx, kr.kekAlias, currentVersion)
+		if err != nil {
+			return "", err
+		}
+		kmsKeyID, err := rotator.RotateKey(ctx, currentKeyID)
+		if err != nil {
+			return "", fmt.Errorf("failed to rotate KEK in KMS: %w", err)
+		}
+		return kmsKeyID, nil
+	}
+
+	kmsKeyID, err := kr.kmsService.CreateKey(ctx, kr.kekAlias)
+	if err != nil {
+		return "", fmt.Errorf("failed to create new KEK version in KMS: %w", err)
+	}
+	return kmsKeyID, nil
+}
+
 // EnsureInitialKEK checks if a KEK exists for the given alias and creates one if not.
 func (kr *KeyRotationOperations) EnsureInitialKEK(ctx context.Context, versionManager KMSVersionManager) error {
 	kmsKeyID, err := kr.kmsService.GetKeyID(ctx, kr.kekAlias)
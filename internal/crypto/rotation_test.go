@@ -226,6 +226,82 @@ func TestRotateKEK_CreateKeyError(t *testing.T) {
 	assert.Contains(t, obs.errors, "RotateKEK")
 }
 
+// mockNativeRotationService implements KeyRotator on top of mockKeyRotationService
+type mockNativeRotationService struct {
+	mockKeyRotationService
+	rotateKeyFunc func(ctx context.Context, keyID string) (string, error)
+}
+
+func (m *mockNativeRotationService) RotateKey(ctx context.Context, keyID string) (string, error) {
+	return m.rotateKeyFunc(ctx, keyID)
+}
+
+func TestRotateKEK_NativeRotation(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, err := db.Exec(`
+		INSERT INTO kek_versions (alias, version, kms_key_id)
+		VALUES ('test-alias', 1, 'kms-key-id')
+	`)
+	require.NoError(t, err)
+
+	var rotatedKeyID string
+	kms := &mockNativeRotationService{
+		mockKeyRotationService: mockKeyRotationService{
+			createKeyFunc: func(ctx context.Context, alias string) (string, error) {
+				t.Fatal("CreateKey must not be called when the KMS rotates natively")
+				return "", nil
+			},
+		},
+		rotateKeyFunc: func(ctx context.Context, keyID string) (string, error) {
+			rotatedKeyID = keyID
+			return "kms-key-id:v2", nil
+		},
+	}
+	obs := &mockObservabilityHook{}
+	versionMgr := &mockVersionManager{currentVersion: 1}
+
+	kr, err := NewKeyRotationOperations(kms, "test-alias", db, obs)
+	require.NoError(t, err)
+	err = kr.RotateKEK(ctx, versionMgr)
+	require.NoError(t, err)
+
+	// The key of the current version is rotated in place
+	assert.Equal(t, "kms-key-id", rotatedKeyID)
+
+	var kmsKeyID string
+	err = db.QueryRow(`
+		SELECT kms_key_id FROM kek_versions
+		WHERE alias = 'test-alias' AND version = 2
+	`).Scan(&kmsKeyID)
+	require.NoError(t, err)
+	assert.Equal(t, "kms-key-id:v2", kmsKeyID)
+}
+
+func TestRotateKEK_NativeRotationError(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	defer db.Close()
+
+	kms := &mockNativeRotationService{
+		rotateKeyFunc: func(ctx context.Context, keyID string) (string, error) {
+			return "", errors.New("rotate failed")
+		},
+	}
+	obs := &mockObservabilityHook{}
+	versionMgr := &mockVersionManager{currentVersion: 1}
+
+	kr, err := NewKeyRotationOperations(kms, "test-alias", db, obs)
+	require.NoError(t, err)
+	err = kr.RotateKEK(ctx, versionMgr)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to rotate KEK in KMS")
+	assert.Contains(t, obs.errors, "RotateKEK")
+}
+
 func TestRotateKEK_DeprecateOldVersionError(t *testing.T) {
 	ctx := context.Background()
 	db := setupTestDB(t)
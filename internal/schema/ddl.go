@@ -0,0 +1,297 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Column is a column of a table
+type Column struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	PrimaryKey bool   `json:"primary_key,omitempty"`
+	NotNull    bool   `json:"not_null,omitempty"`
+	Default    string `json:"default,omitempty"`
+	Check      string `json:"check,omitempty"`
+}
+
+// Index is a single-column index of a table
+type Index struct {
+	Name   string `json:"name"`
+	Column string `json:"column"`
+}
+
+// Table is a table storing the Encx type of a struct
+type Table struct {
+	Name    string   `json:"name"`
+	Columns []Column `json:"columns"`
+	Indexes []Index  `json:"indexes,omitempty"`
+}
+
+// Snapshot is the schema of all tables for a database type. Migrations are computed
+// between the snapshot of the previous generation and the current one.
+type Snapshot struct {
+	Dialect DatabaseType `json:"dialect"`
+	Tables  []Table      `json:"tables"`
+}
+
+// GetHashColumnType returns the column type of hex-encoded SHA-256 hashes, which can
+// be indexed on all databases
+func (dt DatabaseType) GetHashColumnType() string {
+	switch dt {
+	case SQLite:
+		return "TEXT"
+	default:
+		return "VARCHAR(64)"
+	}
+}
+
+// GetJSONDefault returns the default value expression of an empty JSON object
+func (dt DatabaseType) GetJSONDefault() string {
+	switch dt {
+	case MySQL:
+		return "(JSON_OBJECT())" // MySQL only allows expression defaults on JSON columns
+	default:
+		return "'{}'"
+	}
+}
+
+// GetNullableJSONValidationConstraint returns the JSON validation constraint of a
+// nullable column, for databases that need it
+func (dt DatabaseType) GetNullableJSONValidationConstraint(columnName string) string {
+	switch dt {
+	case SQLite:
+		// json_valid(NULL) is false on older SQLite versions
+		return "CHECK (" + columnName + " IS NULL OR json_valid(" + columnName + "))"
+	default:
+		return ""
+	}
+}
+
+// QuoteIdentifier quotes a table, column or index name unless it is a lowercase
+// identifier. Unquoted names are case-insensitive, e.g. PostgreSQL folds userId to userid.
+func (dt DatabaseType) QuoteIdentifier(name string) string {
+	plain := name != ""
+	for i, r := range name {
+		if !(r >= 'a' && r <= 'z' || r == '_' || i > 0 && r >= '0' && r <= '9') {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		return name
+	}
+
+	if dt == MySQL {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// ColumnForGoType returns the nullable column storing values of a Go type. Types
+// without a native column type, such as structs, slices and maps, are stored as JSON.
+func (dt DatabaseType) ColumnForGoType(name, goType string) Column {
+	column := Column{Name: name}
+
+	switch strings.TrimPrefix(goType, "*") {
+	case "string":
+		column.Type = "TEXT"
+	case "bool":
+		column.Type = "BOOLEAN"
+		if dt == SQLite {
+			column.Type = "INTEGER"
+		}
+	case "int8", "int16", "int32", "uint8", "uint16", "byte", "rune":
+		column.Type = dt.GetIntegerColumnType()
+	case "int", "int64", "uint", "uint32", "uint64":
+		column.Type = "BIGINT"
+		if dt == SQLite {
+			column.Type = "INTEGER"
+		}
+	case "float32", "float64":
+		switch dt {
+		case PostgreSQL:
+			column.Type = "DOUBLE PRECISION"
+		case MySQL:
+			column.Type = "DOUBLE"
+		default:
+			column.Type = "REAL"
+		}
+	case "[]byte":
+		column.Type = dt.GetBlobColumnType()
+	case "time.Time":
+		column.Type = dt.GetTimestampColumnType()
+	case "uuid.UUID":
+		switch dt {
+		case PostgreSQL:
+			column.Type = "UUID"
+		case MySQL:
+			column.Type = "CHAR(36)"
+		default:
+			column.Type = "TEXT"
+		}
+	default:
+		column.Type = dt.GetJSONColumnType()
+		column.Check = dt.GetNullableJSONValidationConstraint(dt.QuoteIdentifier(name))
+	}
+
+	return column
+}
+
+// IsJSONGoType reports whether values of a Go type have no native column type, and
+// are stored as JSON
+func IsJSONGoType(goType string) bool {
+	return PostgreSQL.ColumnForGoType("", goType).Type == PostgreSQL.GetJSONColumnType()
+}
+
+// ColumnSQL returns the definition of a column in CREATE TABLE and ALTER TABLE statements
+func (dt DatabaseType) ColumnSQL(column Column) string {
+	def := dt.QuoteIdentifier(column.Name) + " " + column.Type
+	if column.PrimaryKey {
+		def += " PRIMARY KEY"
+	}
+	if column.NotNull {
+		def += " NOT NULL"
+	}
+	if column.Default != "" {
+		def += " DEFAULT " + column.Default
+	}
+	if column.Check != "" {
+		def += " " + column.Check
+	}
+	return def
+}
+
+// CreateTableSQL returns the statements creating a table and its indexes
+func (dt DatabaseType) CreateTableSQL(table Table) []string {
+	var b strings.Builder
+	b.WriteString("CREATE TABLE " + dt.QuoteIdentifier(table.Name) + " (\n")
+	for i, column := range table.Columns {
+		b.WriteString("    " + dt.ColumnSQL(column))
+		if i < len(table.Columns)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(");")
+
+	statements := []string{b.String()}
+	for _, index := range table.Indexes {
+		statements = append(statements, dt.CreateIndexSQL(table.Name, index))
+	}
+	return statements
+}
+
+// CreateIndexSQL returns the statement creating an index
+func (dt DatabaseType) CreateIndexSQL(tableName string, index Index) string {
+	return "CREATE INDEX " + dt.QuoteIdentifier(index.Name) + " ON " + dt.QuoteIdentifier(tableName) + " (" + dt.QuoteIdentifier(index.Column) + ");"
+}
+
+// DropIndexSQL returns the statement dropping an index
+func (dt DatabaseType) DropIndexSQL(tableName string, index Index) string {
+	if dt == MySQL {
+		return "DROP INDEX " + dt.QuoteIdentifier(index.Name) + " ON " + dt.QuoteIdentifier(tableName) + ";"
+	}
+	return "DROP INDEX " + dt.QuoteIdentifier(index.Name) + ";"
+}
+
+// Migrate returns the statements migrating the previous snapshot to the current one.
+// A nil previous snapshot creates all tables.
+//
+// New tables, columns and indexes are created, and removed indexes dropped. Removed
+// tables and columns, and columns whose definition changed, may hold encrypted data
+// that must be migrated first, so they are reported as SQL comments to act on manually.
+func Migrate(previous *Snapshot, current Snapshot) ([]string, error) {
+	if previous == nil {
+		previous = &Snapshot{Dialect: current.Dialect}
+	}
+	if previous.Dialect != current.Dialect {
+		return nil, fmt.Errorf("snapshot is for %s, not %s", previous.Dialect, current.Dialect)
+	}
+	dt := current.Dialect
+
+	previousTables := make(map[string]Table, len(previous.Tables))
+	for _, table := range previous.Tables {
+		previousTables[table.Name] = table
+	}
+
+	var statements []string
+	currentTables := make(map[string]bool, len(current.Tables))
+	for _, table := range sortedTables(current.Tables) {
+		currentTables[table.Name] = true
+
+		previousTable, exists := previousTables[table.Name]
+		if !exists {
+			statements = append(statements, dt.CreateTableSQL(table)...)
+			continue
+		}
+		statements = append(statements, dt.alterTableSQL(previousTable, table)...)
+	}
+
+	for _, table := range sortedTables(previous.Tables) {
+		if !currentTables[table.Name] {
+			statements = append(statements, fmt.Sprintf("-- Table %s was removed; drop it once its data is migrated:\n-- DROP TABLE %s;", table.Name, dt.QuoteIdentifier(table.Name)))
+		}
+	}
+
+	return statements, nil
+}
+
+// alterTableSQL returns the statements migrating a table to its current definition
+func (dt DatabaseType) alterTableSQL(previous, current Table) []string {
+	var statements []string
+
+	previousColumns := make(map[string]Column, len(previous.Columns))
+	for _, column := range previous.Columns {
+		previousColumns[column.Name] = column
+	}
+	currentColumns := make(map[string]bool, len(current.Columns))
+	for _, column := range current.Columns {
+		currentColumns[column.Name] = true
+
+		previousColumn, exists := previousColumns[column.Name]
+		switch {
+		case !exists:
+			statements = append(statements, "ALTER TABLE "+dt.QuoteIdentifier(current.Name)+" ADD COLUMN "+dt.ColumnSQL(column)+";")
+		case previousColumn != column:
+			statements = append(statements, fmt.Sprintf("-- Column %s.%s changed from %q to %q; migrate it manually.",
+				current.Name, column.Name, dt.ColumnSQL(previousColumn), dt.ColumnSQL(column)))
+		}
+	}
+	for _, column := range previous.Columns {
+		if !currentColumns[column.Name] {
+			statements = append(statements, fmt.Sprintf("-- Column %s.%s was removed; drop it once its data is migrated:\n-- ALTER TABLE %s DROP COLUMN %s;",
+				current.Name, column.Name, dt.QuoteIdentifier(current.Name), dt.QuoteIdentifier(column.Name)))
+		}
+	}
+
+	previousIndexes := make(map[Index]bool, len(previous.Indexes))
+	for _, index := range previous.Indexes {
+		previousIndexes[index] = true
+	}
+	currentIndexes := make(map[Index]bool, len(current.Indexes))
+	for _, index := range current.Indexes {
+		currentIndexes[index] = true
+		if !previousIndexes[index] {
+			statements = append(statements, dt.CreateIndexSQL(current.Name, index))
+		}
+	}
+	for _, index := range previous.Indexes {
+		if !currentIndexes[index] {
+			statements = append(statements, dt.DropIndexSQL(current.Name, index))
+		}
+	}
+
+	return statements
+}
+
+// sortedTables returns the tables sorted by name
+func sortedTables(tables []Table) []Table {
+	sorted := make([]Table, len(tables))
+	copy(sorted, tables)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
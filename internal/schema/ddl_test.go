@@ -0,0 +1,124 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func usersTable() Table {
+	return Table{
+		Name: "users",
+		Columns: []Column{
+			{Name: "id", Type: "BIGINT", PrimaryKey: true},
+			{Name: "email_encrypted", Type: "BYTEA"},
+			{Name: "email_hash", Type: "VARCHAR(64)"},
+			{Name: "dek_encrypted", Type: "BYTEA", NotNull: true},
+			{Name: "metadata", Type: "JSONB", NotNull: true, Default: "'{}'"},
+		},
+		Indexes: []Index{{Name: "idx_users_email_hash", Column: "email_hash"}},
+	}
+}
+
+func TestDatabaseType_ColumnForGoType(t *testing.T) {
+	tests := []struct {
+		name   string
+		dt     DatabaseType
+		goType string
+		want   Column
+	}{
+		{"string", PostgreSQL, "string", Column{Name: "col", Type: "TEXT"}},
+		{"pointer", PostgreSQL, "*int64", Column{Name: "col", Type: "BIGINT"}},
+		{"SQLite bool", SQLite, "bool", Column{Name: "col", Type: "INTEGER"}},
+		{"MySQL float", MySQL, "float64", Column{Name: "col", Type: "DOUBLE"}},
+		{"time", PostgreSQL, "time.Time", Column{Name: "col", Type: "TIMESTAMP WITH TIME ZONE"}},
+		{"bytes", MySQL, "[]byte", Column{Name: "col", Type: "BLOB"}},
+		{"uuid", PostgreSQL, "uuid.UUID", Column{Name: "col", Type: "UUID"}},
+		{"JSON", PostgreSQL, "[]string", Column{Name: "col", Type: "JSONB"}},
+		{"SQLite JSON", SQLite, "map[string]string", Column{Name: "col", Type: "TEXT", Check: "CHECK (col IS NULL OR json_valid(col))"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.dt.ColumnForGoType("col", tt.goType))
+		})
+	}
+}
+
+func TestDatabaseType_CreateTableSQL(t *testing.T) {
+	statements := PostgreSQL.CreateTableSQL(usersTable())
+
+	assert.Equal(t, []string{
+		`CREATE TABLE users (
+    id BIGINT PRIMARY KEY,
+    email_encrypted BYTEA,
+    email_hash VARCHAR(64),
+    dek_encrypted BYTEA NOT NULL,
+    metadata JSONB NOT NULL DEFAULT '{}'
+);`,
+		"CREATE INDEX idx_users_email_hash ON users (email_hash);",
+	}, statements)
+
+	column := Column{Name: "metadata", Type: "TEXT", NotNull: true, Default: "'{}'", Check: SQLite.GetJSONValidationConstraint("metadata")}
+	assert.Equal(t, "metadata TEXT NOT NULL DEFAULT '{}' CHECK (json_valid(metadata))", SQLite.ColumnSQL(column))
+}
+
+func TestMigrate(t *testing.T) {
+	previous := Snapshot{Dialect: PostgreSQL, Tables: []Table{usersTable()}}
+
+	// Without a previous snapshot, all tables are created
+	statements, err := Migrate(nil, previous)
+	require.NoError(t, err)
+	assert.Len(t, statements, 2)
+	assert.Contains(t, statements[0], "CREATE TABLE users (")
+
+	// An unchanged schema needs no migration
+	statements, err = Migrate(&previous, previous)
+	require.NoError(t, err)
+	assert.Empty(t, statements)
+
+	current := Snapshot{Dialect: PostgreSQL, Tables: []Table{usersTable(), {Name: "orders", Columns: []Column{{Name: "id", Type: "BIGINT"}}}}}
+	users := &current.Tables[0]
+	users.Columns = append(users.Columns[:1], users.Columns[3:]...) // email_encrypted and email_hash removed
+	users.Columns[0].Type = "TEXT"
+	users.Columns = append(users.Columns, Column{Name: "phone_hash", Type: "VARCHAR(64)"})
+	users.Indexes = []Index{{Name: "idx_users_phone_hash", Column: "phone_hash"}}
+
+	statements, err = Migrate(&previous, current)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"CREATE TABLE orders (\n    id BIGINT\n);",
+		`-- Column users.id changed from "id BIGINT PRIMARY KEY" to "id TEXT PRIMARY KEY"; migrate it manually.`,
+		"ALTER TABLE users ADD COLUMN phone_hash VARCHAR(64);",
+		"-- Column users.email_encrypted was removed; drop it once its data is migrated:\n-- ALTER TABLE users DROP COLUMN email_encrypted;",
+		"-- Column users.email_hash was removed; drop it once its data is migrated:\n-- ALTER TABLE users DROP COLUMN email_hash;",
+		"CREATE INDEX idx_users_phone_hash ON users (phone_hash);",
+		"DROP INDEX idx_users_email_hash;",
+	}, statements)
+
+	// Removed tables are reported
+	statements, err = Migrate(&current, Snapshot{Dialect: PostgreSQL, Tables: current.Tables[1:]})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-- Table users was removed; drop it once its data is migrated:\n-- DROP TABLE users;"}, statements)
+
+	_, err = Migrate(&previous, Snapshot{Dialect: MySQL})
+	assert.ErrorContains(t, err, "snapshot is for postgresql, not mysql")
+}
+
+func TestDatabaseType_DropIndexSQL(t *testing.T) {
+	index := Index{Name: "idx_users_email_hash", Column: "email_hash"}
+	assert.Equal(t, "DROP INDEX idx_users_email_hash;", PostgreSQL.DropIndexSQL("users", index))
+	assert.Equal(t, "DROP INDEX idx_users_email_hash ON users;", MySQL.DropIndexSQL("users", index))
+}
+
+func TestDatabaseType_QuoteIdentifier(t *testing.T) {
+	assert.Equal(t, "user_id_encrypted", PostgreSQL.QuoteIdentifier("user_id_encrypted"))
+	assert.Equal(t, "last4", PostgreSQL.QuoteIdentifier("last4"))
+	assert.Equal(t, `"userIdEncrypted"`, PostgreSQL.QuoteIdentifier("userIdEncrypted"))
+	assert.Equal(t, `"2fa"`, SQLite.QuoteIdentifier("2fa"))
+	assert.Equal(t, "`userIdEncrypted`", MySQL.QuoteIdentifier("userIdEncrypted"))
+
+	column := Column{Name: "userIdEncrypted", Type: "BYTEA"}
+	assert.Equal(t, `"userIdEncrypted" BYTEA`, PostgreSQL.ColumnSQL(column))
+}
@@ -557,7 +557,12 @@ func deserializeWithReflection(data []byte, target any) error {
 			if err := Deserialize(data, &slice); err != nil {
 				return err
 			}
-			elem.Set(reflect.ValueOf(slice))
+			// Elements may be of a named string type, e.g. []Tag with type Tag string
+			result := reflect.MakeSlice(elem.Type(), len(slice), len(slice))
+			for i, s := range slice {
+				result.Index(i).SetString(s)
+			}
+			elem.Set(result)
 			return nil
 		}
 		return fmt.Errorf("unsupported target type for compact deserialization: %T (slice of %v)", target, elemKind)
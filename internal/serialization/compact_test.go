@@ -567,6 +567,32 @@ func TestSerializeDeserializeTypeAliases(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:  "Slice of Role type alias ([]Role)",
+			value: []Role{RoleAdmin, Role("guest")},
+			check: func(t *testing.T, original any) {
+				data, err := Serialize(original)
+				if err != nil {
+					t.Fatalf("Serialize failed: %v", err)
+				}
+
+				var result []Role
+				err = Deserialize(data, &result)
+				if err != nil {
+					t.Fatalf("Deserialize failed: %v", err)
+				}
+
+				orig := original.([]Role)
+				if len(result) != len(orig) {
+					t.Fatalf("Expected length %d, got %d", len(orig), len(result))
+				}
+				for i := range orig {
+					if result[i] != orig[i] {
+						t.Errorf("Expected %v at index %d, got %v", orig[i], i, result[i])
+					}
+				}
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -1,7 +1,9 @@
 package encx
 
 import (
+	"database/sql/driver"
 	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -23,6 +25,34 @@ func (em *EncryptionMetadata) FromJSON(data []byte) error {
 	return json.Unmarshal(data, em)
 }
 
+// Scan implements sql.Scanner, reading the metadata from a JSON column such as
+// PostgreSQL JSONB, MySQL JSON or SQLite TEXT. NULL and empty values scan as zero metadata.
+func (em *EncryptionMetadata) Scan(value any) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*em = EncryptionMetadata{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into EncryptionMetadata", value)
+	}
+
+	*em = EncryptionMetadata{}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, em)
+}
+
+// Value implements driver.Valuer, storing the metadata as JSON
+func (em EncryptionMetadata) Value() (driver.Value, error) {
+	return json.Marshal(em)
+}
+
 // NewEncryptionMetadata creates a new EncryptionMetadata instance
 func NewEncryptionMetadata(kekAlias, generatorVersion string, pepperVersion int) *EncryptionMetadata {
 	return &EncryptionMetadata{
@@ -1,6 +1,7 @@
 package encx
 
 import (
+	"database/sql/driver"
 	"encoding/json"
 	"testing"
 	"time"
@@ -159,6 +160,38 @@ func TestEncryptionMetadata_JSONRoundTrip(t *testing.T) {
 	assert.Equal(t, original.GeneratorVersion, deserialized.GeneratorVersion)
 }
 
+func TestEncryptionMetadata_SQLRoundTrip(t *testing.T) {
+	original := EncryptionMetadata{
+		PepperVersion:    1,
+		KEKAlias:         "test-alias",
+		EncryptionTime:   1640995200,
+		GeneratorVersion: "v1.0.0",
+	}
+
+	// Value implements driver.Valuer, so EncryptionMetadata is accepted as a query argument
+	var valuer driver.Valuer = original
+	value, err := valuer.Value()
+	require.NoError(t, err)
+
+	// JSON columns are scanned as []byte or string depending on the driver
+	for _, scanned := range []any{value, string(value.([]byte))} {
+		metadata := EncryptionMetadata{KEKAlias: "stale"}
+		require.NoError(t, metadata.Scan(scanned))
+		assert.Equal(t, original, metadata)
+	}
+
+	// NULL and empty values scan as zero metadata
+	for _, scanned := range []any{nil, []byte{}} {
+		metadata := original
+		require.NoError(t, metadata.Scan(scanned))
+		assert.Equal(t, EncryptionMetadata{}, metadata)
+	}
+
+	var metadata EncryptionMetadata
+	assert.ErrorContains(t, metadata.Scan(42), "cannot scan int into EncryptionMetadata")
+	assert.Error(t, metadata.Scan("{invalid"))
+}
+
 func TestErrorConstants(t *testing.T) {
 	// Verify error constants are defined and have meaningful messages
 	assert.Equal(t, "KEK alias is required", ErrMissingKEKAlias.Error())
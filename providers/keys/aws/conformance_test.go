@@ -0,0 +1,143 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/hengadev/encx"
+	"github.com/hengadev/encx/encxtest"
+)
+
+// fakeKMSClient is a stateful in-memory AWS KMS that encrypts with AES-GCM.
+//
+// Like AWS KMS, the ciphertext blob identifies its key and the encryption context
+// is bound as additional authenticated data.
+type fakeKMSClient struct {
+	mu   sync.RWMutex
+	keys map[string][]byte
+}
+
+func newFakeKMSClient() *fakeKMSClient {
+	return &fakeKMSClient{keys: make(map[string][]byte)}
+}
+
+func (f *fakeKMSClient) DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if _, err := f.key(aws.ToString(params.KeyId)); err != nil {
+		return nil, err
+	}
+	return &kms.DescribeKeyOutput{KeyMetadata: &types.KeyMetadata{KeyId: params.KeyId}}, nil
+}
+
+func (f *fakeKMSClient) CreateKey(ctx context.Context, params *kms.CreateKeyInput, optFns ...func(*kms.Options)) (*kms.CreateKeyOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keyID := fmt.Sprintf("key-%d", len(f.keys)+1)
+	f.keys[keyID] = key
+
+	return &kms.CreateKeyOutput{KeyMetadata: &types.KeyMetadata{KeyId: aws.String(keyID)}}, nil
+}
+
+func (f *fakeKMSClient) Encrypt(ctx context.Context, params *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	keyID := aws.ToString(params.KeyId)
+	aead, err := f.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Blob layout: key ID length, key ID, nonce, sealed plaintext
+	blob := append([]byte{byte(len(keyID))}, keyID...)
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	blob = append(blob, nonce...)
+	blob = aead.Seal(blob, nonce, params.Plaintext, fakeAAD(keyID, params.EncryptionContext))
+
+	return &kms.EncryptOutput{CiphertextBlob: blob, KeyId: params.KeyId}, nil
+}
+
+func (f *fakeKMSClient) Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	blob := params.CiphertextBlob
+	if len(blob) == 0 || len(blob) < 1+int(blob[0]) {
+		return nil, &types.InvalidCiphertextException{Message: aws.String("malformed ciphertext")}
+	}
+	keyID, blob := string(blob[1:1+int(blob[0])]), blob[1+int(blob[0]):]
+	if params.KeyId != nil && aws.ToString(params.KeyId) != keyID {
+		return nil, &types.IncorrectKeyException{Message: aws.String("ciphertext was encrypted under a different key")}
+	}
+
+	aead, err := f.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(blob) < aead.NonceSize() {
+		return nil, &types.InvalidCiphertextException{Message: aws.String("malformed ciphertext")}
+	}
+	plaintext, err := aead.Open(nil, blob[:aead.NonceSize()], blob[aead.NonceSize():], fakeAAD(keyID, params.EncryptionContext))
+	if err != nil {
+		return nil, &types.InvalidCiphertextException{Message: aws.String(err.Error())}
+	}
+
+	return &kms.DecryptOutput{Plaintext: plaintext, KeyId: aws.String(keyID)}, nil
+}
+
+func (f *fakeKMSClient) key(keyID string) ([]byte, error) {
+	if keyID == "" {
+		return nil, errors.New("ValidationException: KeyId is required")
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	key, ok := f.keys[keyID]
+	if !ok {
+		return nil, &types.NotFoundException{Message: aws.String("key not found: " + keyID)}
+	}
+	return key, nil
+}
+
+func (f *fakeKMSClient) aead(keyID string) (cipher.AEAD, error) {
+	key, err := f.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func fakeAAD(keyID string, encryptionContext map[string]string) []byte {
+	return bytes.Join([][]byte{[]byte(keyID), encx.MarshalEncryptionContext(encryptionContext)}, []byte{0})
+}
+
+func TestKMSService_Conformance(t *testing.T) {
+	encxtest.RunKMSConformance(t, func(t *testing.T) encx.KeyManagementService {
+		return &KMSService{client: newFakeKMSClient(), region: "us-east-1"}
+	})
+}
@@ -68,6 +68,17 @@
 //	    ]
 //	}
 //
+// # Encryption Context
+//
+// The encryption context carried by the context passed to encx (see
+// encx.WithEncryptionContext) is sent as the KMS EncryptionContext on both
+// Encrypt and Decrypt. Use it to scope IAM policies with the
+// kms:EncryptionContext:<key> condition key and to attribute CloudTrail records:
+//
+//	ctx = encx.WithEncryptionContext(ctx, map[string]string{"tenant": tenantID})
+//
+// Generated code binds the context declared with //encx:options (e.g., table=users).
+//
 // # Error Handling
 //
 // Operations return wrapped errors from the encx package:
@@ -138,6 +138,10 @@ func (k *KMSService) CreateKey(ctx context.Context, description string) (string,
 //   - Alias name: "alias/my-key"
 //   - Alias ARN: "arn:aws:kms:us-east-1:123456789012:alias/my-key"
 //
+// The encryption context carried by ctx (see encx.WithEncryptionContext) is sent as the
+// KMS EncryptionContext. It can be used in IAM policy conditions (kms:EncryptionContext:<key>)
+// and is recorded in CloudTrail.
+//
 // Returns the encrypted DEK as a base64-encoded ciphertext blob.
 func (k *KMSService) EncryptDEK(ctx context.Context, keyID string, plaintext []byte) ([]byte, error) {
 	if len(plaintext) == 0 {
@@ -145,8 +149,9 @@ func (k *KMSService) EncryptDEK(ctx context.Context, keyID string, plaintext []b
 	}
 
 	input := &kms.EncryptInput{
-		KeyId:     aws.String(keyID),
-		Plaintext: plaintext,
+		KeyId:             aws.String(keyID),
+		Plaintext:         plaintext,
+		EncryptionContext: encx.EncryptionContextFromContext(ctx),
 	}
 
 	result, err := k.client.Encrypt(ctx, input)
@@ -169,6 +174,7 @@ func (k *KMSService) EncryptDEK(ctx context.Context, keyID string, plaintext []b
 // use the correct key based on the ciphertext metadata.
 //
 // The ciphertext should be base64-encoded (as returned by EncryptDEK).
+// ctx must carry the same encryption context as when the DEK was encrypted.
 // Returns the decrypted DEK in plaintext.
 func (k *KMSService) DecryptDEK(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
 	if len(ciphertext) == 0 {
@@ -182,7 +188,8 @@ func (k *KMSService) DecryptDEK(ctx context.Context, keyID string, ciphertext []
 	}
 
 	input := &kms.DecryptInput{
-		CiphertextBlob: decoded,
+		CiphertextBlob:    decoded,
+		EncryptionContext: encx.EncryptionContextFromContext(ctx),
 	}
 
 	// If keyID is provided, include it (though AWS KMS doesn't require it)
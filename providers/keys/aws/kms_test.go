@@ -606,3 +606,40 @@ func TestEncryptDecryptRoundTrip(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, plainDEK, decrypted)
 }
+
+func TestEncryptionContext(t *testing.T) {
+	plainDEK := []byte("my-secret-dek-32-bytes-length!")
+	encryptionContext := map[string]string{"table": "users", "tenant": "acme"}
+
+	var encryptContext, decryptContext map[string]string
+	mock := &mockKMSClient{
+		encryptFunc: func(ctx context.Context, params *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error) {
+			encryptContext = params.EncryptionContext
+			return &kms.EncryptOutput{CiphertextBlob: params.Plaintext}, nil
+		},
+		decryptFunc: func(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+			decryptContext = params.EncryptionContext
+			return &kms.DecryptOutput{Plaintext: params.CiphertextBlob}, nil
+		},
+	}
+
+	svc := &KMSService{
+		client: mock,
+		region: "us-east-1",
+	}
+
+	ctx := encx.WithEncryptionContext(context.Background(), encryptionContext)
+
+	ciphertext, err := svc.EncryptDEK(ctx, "test-key", plainDEK)
+	require.NoError(t, err)
+	assert.Equal(t, encryptionContext, encryptContext)
+
+	_, err = svc.DecryptDEK(ctx, "test-key", ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, encryptionContext, decryptContext)
+
+	// Without an encryption context, none is sent
+	_, err = svc.EncryptDEK(context.Background(), "test-key", plainDEK)
+	require.NoError(t, err)
+	assert.Nil(t, encryptContext)
+}
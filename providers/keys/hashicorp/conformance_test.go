@@ -0,0 +1,16 @@
+package hashicorp
+
+import (
+	"testing"
+
+	"github.com/hengadev/encx"
+	"github.com/hengadev/encx/encxtest"
+)
+
+func TestTransitService_Conformance(t *testing.T) {
+	// Keys created by CreateKey are not derived, so Transit ignores the encryption context
+	encxtest.RunKMSConformance(t, func(t *testing.T) encx.KeyManagementService {
+		vs, _ := newFakeTransitService(t)
+		return vs
+	}, encxtest.WithoutEncryptionContextBinding())
+}
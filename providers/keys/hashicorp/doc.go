@@ -40,7 +40,7 @@
 //
 //	// Required
 //	export VAULT_ADDR="https://vault.example.com:8200"
-//	export VAULT_TOKEN="hvs.your-token-here"
+//	export VAULT_TOKEN="hvs.your-token-here"  // or VAULT_ROLE_ID+VAULT_SECRET_ID, VAULT_K8S_ROLE, VAULT_CERT_ROLE
 //
 //	// Optional
 //	export VAULT_NAMESPACE="my-namespace"  // For Vault Enterprise
@@ -69,7 +69,7 @@
 //	}
 //
 //	path "transit/keys/*" {
-//	    capabilities = ["read", "create"]
+//	    capabilities = ["read", "create", "update"]
 //	}
 //
 // Save this as transit-policy.hcl and apply:
@@ -114,12 +114,24 @@
 //
 // # Automatic Token Renewal
 //
-// The TransitService automatically renews Vault tokens in the background.
+// The TransitService automatically renews Vault tokens in the background and
+// re-authenticates when a token reaches its maximum TTL (see providers/vault).
 // Always call Close() when shutting down to stop the renewal goroutine:
 //
 //	transit, _ := vaulttransit.NewTransitService()
 //	defer transit.Close()  // IMPORTANT: Stops token renewal
 //
+// To configure authentication in code (AppRole, Kubernetes, TLS certificate) or to
+// share one client between the Transit and KV providers, create a vault.Client and
+// pass it to NewTransitServiceWithClient. The caller then owns the client:
+//
+//	client, err := vault.NewClient(ctx, vault.Config{
+//	    Auth: &vault.KubernetesAuth{Role: "my-app"},
+//	})
+//	defer client.Close()
+//
+//	transit := vaulttransit.NewTransitServiceWithClient(client)
+//
 // # Key Rotation
 //
 // Vault Transit supports key rotation:
@@ -129,6 +141,17 @@
 // After rotation, Vault automatically uses the latest version for encryption
 // while maintaining the ability to decrypt with older versions.
 //
+// TransitService implements encx.KeyRotator, so encx's RotateKEK uses Transit's
+// native versioning instead of creating a new key per rotation. Each encx KEK version
+// records a versioned key ID ("my-app-key:v2", see FormatVersionedKeyID) matching the
+// "vault:v2:" ciphertext prefix:
+//
+//	err := crypto.RotateKEK(ctx) // rotates transit/keys/my-app-key in place
+//
+// Once data wrapped by older KEK versions has been re-encrypted, retire them:
+//
+//	err := transit.SetMinDecryptionVersion(ctx, "my-app-key", 2)
+//
 // # Testing
 //
 // For testing without Vault dependencies, use encx.NewTestCrypto():
@@ -4,24 +4,32 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"sync"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/hengadev/encx"
+	"github.com/hengadev/encx/providers/vault"
 )
 
 // TransitService implements encx.KeyManagementService using HashiCorp Vault Transit Engine.
 //
 // This service provides cryptographic operations (encrypt/decrypt DEKs) using Vault's
 // Transit Engine. It does NOT handle secret storage - use KVStore for that.
+//
+// Key rotation uses Transit's native key versioning: see RotateKey.
 type TransitService struct {
 	client     *api.Client
-	renewalCtx context.Context
-	cancelFunc context.CancelFunc
+	vault      *vault.Client
+	ownsClient bool
+
+	mu                    sync.RWMutex
+	minDecryptionVersions map[string]int // key name -> cached min_decryption_version
 }
 
 // NewTransitService creates a new TransitService instance.
 //
-// The service uses environment variables for configuration (see createVaultClient).
+// The service uses environment variables for configuration (see vault.ConfigFromEnvironment)
+// and owns its Vault client: Close stops token renewal.
 //
 // Usage:
 //
@@ -35,16 +43,39 @@ type TransitService struct {
 //
 //	vault secrets enable transit
 func NewTransitService() (*TransitService, error) {
-	client, renewalCtx, cancelFunc, err := createVaultClientWithContext()
+	client, err := vault.NewClientFromEnvironment(context.Background())
 	if err != nil {
 		return nil, err
 	}
 
+	t := NewTransitServiceWithClient(client)
+	t.ownsClient = true
+	return t, nil
+}
+
+// NewTransitServiceWithClient creates a TransitService using an existing Vault client.
+//
+// Use it to configure authentication explicitly, or to share one client (and its
+// token lifecycle) with the KV secrets provider. The caller remains responsible for
+// closing the client.
+//
+// Usage:
+//
+//	client, err := vault.NewClient(ctx, vault.Config{
+//	    Address: "https://vault.example.com:8200",
+//	    Auth:    &vault.KubernetesAuth{Role: "my-app"},
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer client.Close()
+//
+//	transit := hashicorp.NewTransitServiceWithClient(client)
+func NewTransitServiceWithClient(client *vault.Client) *TransitService {
 	return &TransitService{
-		client:     client,
-		renewalCtx: renewalCtx,
-		cancelFunc: cancelFunc,
-	}, nil
+		client: client.API(),
+		vault:  client,
+	}
 }
 
 // GetKeyID returns the key ID for a given alias.
@@ -71,7 +102,7 @@ func (t *TransitService) CreateKey(ctx context.Context, description string) (str
 		return "", fmt.Errorf("%w: description (key name) cannot be empty", encx.ErrInvalidConfiguration)
 	}
 
-	_, err := t.client.Logical().Write(fmt.Sprintf("transit/keys/%s", description), map[string]interface{}{
+	_, err := t.client.Logical().WriteWithContext(ctx, fmt.Sprintf("transit/keys/%s", description), map[string]interface{}{
 		"type": "aes256-gcm96", // AES-256-GCM with 96-bit nonce
 	})
 	if err != nil {
@@ -84,7 +115,14 @@ func (t *TransitService) CreateKey(ctx context.Context, description string) (str
 
 // EncryptDEK encrypts a Data Encryption Key using the Vault Transit Engine.
 //
-// The keyID is the name of the Transit Engine key.
+// The keyID is the name of the Transit Engine key, optionally pinned to a key
+// version (e.g., "my-app-key:v2", see FormatVersionedKeyID). Unversioned key IDs
+// encrypt with the latest key version.
+//
+// The encryption context carried by ctx (see encx.WithEncryptionContext) is sent as the
+// key derivation context, so keys created with derived=true derive a distinct key per
+// context. Vault ignores the context for non-derived keys.
+//
 // Returns Vault-formatted ciphertext (e.g., "vault:v1:base64...").
 //
 // Example:
@@ -98,10 +136,20 @@ func (t *TransitService) EncryptDEK(ctx context.Context, keyID string, plaintext
 		return nil, fmt.Errorf("%w: keyID cannot be empty", encx.ErrInvalidConfiguration)
 	}
 
+	name, version := ParseVersionedKeyID(keyID)
+
 	// Vault Transit expects base64-encoded plaintext
-	resp, err := t.client.Logical().Write(fmt.Sprintf("transit/encrypt/%s", keyID), map[string]interface{}{
+	data := map[string]interface{}{
 		"plaintext": base64.StdEncoding.EncodeToString(plaintextDEK),
-	})
+	}
+	if version > 0 {
+		data["key_version"] = version
+	}
+	if encryptionContext := encx.MarshalEncryptionContext(encx.EncryptionContextFromContext(ctx)); encryptionContext != nil {
+		data["context"] = base64.StdEncoding.EncodeToString(encryptionContext)
+	}
+
+	resp, err := t.client.Logical().WriteWithContext(ctx, fmt.Sprintf("transit/encrypt/%s", name), data)
 	if err != nil {
 		return nil, fmt.Errorf("%w: failed to encrypt with key '%s': %w", encx.ErrEncryptionFailed, keyID, err)
 	}
@@ -120,9 +168,16 @@ func (t *TransitService) EncryptDEK(ctx context.Context, keyID string, plaintext
 
 // DecryptDEK decrypts a Data Encryption Key using the Vault Transit Engine.
 //
-// The keyID is the name of the Transit Engine key.
+// The keyID is the name of the Transit Engine key, optionally pinned to a key version.
 // The ciphertext should be in Vault format (e.g., "vault:v1:base64...").
 //
+// For versioned key IDs, the version in the ciphertext prefix must match the key ID
+// version, so that a DEK is only ever decrypted with the encx KEK version it was
+// recorded under. Ciphertexts older than the minimum decryption version set through
+// SetMinDecryptionVersion are rejected without calling Vault.
+//
+// For derived keys, ctx must carry the same encryption context as when the DEK was encrypted.
+//
 // Example:
 //
 //	dek, err := transit.DecryptDEK(ctx, "my-app-key", encryptedDEK)
@@ -134,9 +189,28 @@ func (t *TransitService) DecryptDEK(ctx context.Context, keyID string, ciphertex
 		return nil, fmt.Errorf("%w: keyID cannot be empty", encx.ErrInvalidConfiguration)
 	}
 
-	resp, err := t.client.Logical().Write(fmt.Sprintf("transit/decrypt/%s", keyID), map[string]interface{}{
+	name, version := ParseVersionedKeyID(keyID)
+	ciphertextKeyVersion, err := ciphertextVersion(ciphertextDEK)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", encx.ErrDecryptionFailed, err)
+	}
+	if version > 0 && ciphertextKeyVersion != version {
+		return nil, fmt.Errorf("%w: ciphertext was encrypted with version %d of key '%s', expected version %d",
+			encx.ErrDecryptionFailed, ciphertextKeyVersion, name, version)
+	}
+	if minVersion := t.cachedMinDecryptionVersion(name); ciphertextKeyVersion < minVersion {
+		return nil, fmt.Errorf("%w: key version %d of '%s' is below the minimum decryption version %d",
+			encx.ErrDecryptionFailed, ciphertextKeyVersion, name, minVersion)
+	}
+
+	data := map[string]interface{}{
 		"ciphertext": string(ciphertextDEK),
-	})
+	}
+	if encryptionContext := encx.MarshalEncryptionContext(encx.EncryptionContextFromContext(ctx)); encryptionContext != nil {
+		data["context"] = base64.StdEncoding.EncodeToString(encryptionContext)
+	}
+
+	resp, err := t.client.Logical().WriteWithContext(ctx, fmt.Sprintf("transit/decrypt/%s", name), data)
 	if err != nil {
 		return nil, fmt.Errorf("%w: failed to decrypt with key '%s': %w", encx.ErrDecryptionFailed, keyID, err)
 	}
@@ -159,11 +233,12 @@ func (t *TransitService) DecryptDEK(ctx context.Context, keyID string, ciphertex
 	return plaintext, nil
 }
 
-// Close cancels the renewal context and cleans up resources.
+// Close stops background token renewal if the service owns its Vault client.
 //
-// Call this when shutting down to stop any background token renewal.
+// Call this when shutting down. Services created with NewTransitServiceWithClient
+// leave the shared client open; close it directly instead.
 func (t *TransitService) Close() {
-	if t.cancelFunc != nil {
-		t.cancelFunc()
+	if t.ownsClient && t.vault != nil {
+		t.vault.Close()
 	}
 }
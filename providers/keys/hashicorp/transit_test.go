@@ -3,12 +3,15 @@ package hashicorp
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/vault/api"
+	"github.com/hengadev/encx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -191,3 +194,44 @@ func TestDecryptDEK(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []byte("decrypted-data"), plaintext)
 }
+
+func TestEncryptionContext(t *testing.T) {
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body)
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasPrefix(r.URL.Path, "/v1/transit/encrypt/") {
+			w.Write([]byte(`{"data": {"ciphertext": "vault:v1:mockencrypteddata"}}`))
+			return
+		}
+		plaintext := base64.StdEncoding.EncodeToString([]byte("decrypted-data"))
+		w.Write([]byte(`{"data": {"plaintext": "` + plaintext + `"}}`))
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	client, err := api.NewClient(config)
+	require.NoError(t, err)
+
+	vs := &TransitService{client: client}
+	ctx := encx.WithEncryptionContext(context.Background(), map[string]string{"tenant": "acme", "table": "users"})
+
+	ciphertext, err := vs.EncryptDEK(ctx, "test-key", []byte("plaintext-dek"))
+	require.NoError(t, err)
+	_, err = vs.DecryptDEK(ctx, "test-key", ciphertext)
+	require.NoError(t, err)
+
+	expected := base64.StdEncoding.EncodeToString([]byte(`{"table":"users","tenant":"acme"}`))
+	require.Len(t, requests, 2)
+	assert.Equal(t, expected, requests[0]["context"])
+	assert.Equal(t, expected, requests[1]["context"])
+
+	// Without an encryption context, none is sent
+	_, err = vs.EncryptDEK(context.Background(), "test-key", []byte("plaintext-dek"))
+	require.NoError(t, err)
+	assert.NotContains(t, requests[2], "context")
+}
@@ -0,0 +1,181 @@
+package hashicorp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hengadev/encx"
+)
+
+// FormatVersionedKeyID returns a key ID pinned to a specific Transit key version.
+//
+// Versioned key IDs have the form "<name>:v<version>" (e.g., "my-app-key:v2").
+// They are returned by RotateKey and recorded by encx as the KMS key ID of a KEK version.
+func FormatVersionedKeyID(name string, version int) string {
+	return fmt.Sprintf("%s:v%d", name, version)
+}
+
+// ParseVersionedKeyID splits a key ID into the Transit key name and version.
+//
+// Key IDs without a version suffix (e.g., "my-app-key") return version 0,
+// meaning the latest version of the key.
+func ParseVersionedKeyID(keyID string) (string, int) {
+	idx := strings.LastIndex(keyID, ":v")
+	if idx <= 0 {
+		return keyID, 0
+	}
+	version, err := strconv.Atoi(keyID[idx+2:])
+	if err != nil || version <= 0 {
+		return keyID, 0
+	}
+	return keyID[:idx], version
+}
+
+// ciphertextVersion extracts the key version from a Vault ciphertext ("vault:v<version>:...").
+func ciphertextVersion(ciphertext []byte) (int, error) {
+	parts := strings.SplitN(string(ciphertext), ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" || !strings.HasPrefix(parts[1], "v") {
+		return 0, fmt.Errorf("ciphertext is not in Vault format")
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(parts[1], "v"))
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("invalid key version in ciphertext: %s", parts[1])
+	}
+	return version, nil
+}
+
+// RotateKey rotates a Transit key and returns a key ID pinned to the new version.
+//
+// The key ID may be versioned or not; only its key name is used. Rotation uses
+// Transit's native key versioning (transit/keys/<name>/rotate), so no new key is
+// created. TransitService implements encx.KeyRotator, which makes encx's RotateKEK
+// use this method instead of CreateKey.
+//
+// Example:
+//
+//	keyID, err := transit.RotateKey(ctx, "my-app-key:v1")
+//	// keyID == "my-app-key:v2"
+func (t *TransitService) RotateKey(ctx context.Context, keyID string) (string, error) {
+	if keyID == "" {
+		return "", fmt.Errorf("%w: keyID cannot be empty", encx.ErrInvalidConfiguration)
+	}
+	name, _ := ParseVersionedKeyID(keyID)
+
+	_, err := t.client.Logical().WriteWithContext(ctx, fmt.Sprintf("transit/keys/%s/rotate", name), nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to rotate transit key '%s': %w", encx.ErrKMSUnavailable, name, err)
+	}
+
+	latest, _, err := t.readKeyVersions(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	return FormatVersionedKeyID(name, latest), nil
+}
+
+// SetMinDecryptionVersion sets the minimum key version Vault accepts for decryption.
+//
+// Ciphertexts produced by older versions can no longer be decrypted, so only raise
+// it once all DEKs wrapped by older KEK versions have been re-encrypted. The minimum
+// is also enforced client-side: DecryptDEK rejects older ciphertexts without calling Vault.
+//
+// Example:
+//
+//	// After re-encrypting all data under KEK version 3
+//	err := transit.SetMinDecryptionVersion(ctx, "my-app-key", 3)
+func (t *TransitService) SetMinDecryptionVersion(ctx context.Context, keyID string, version int) error {
+	if keyID == "" {
+		return fmt.Errorf("%w: keyID cannot be empty", encx.ErrInvalidConfiguration)
+	}
+	if version <= 0 {
+		return fmt.Errorf("%w: min decryption version must be positive, got %d", encx.ErrInvalidConfiguration, version)
+	}
+	name, _ := ParseVersionedKeyID(keyID)
+
+	_, err := t.client.Logical().WriteWithContext(ctx, fmt.Sprintf("transit/keys/%s/config", name), map[string]interface{}{
+		"min_decryption_version": version,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: failed to configure transit key '%s': %w", encx.ErrKMSUnavailable, name, err)
+	}
+
+	t.setMinDecryptionVersion(name, version)
+	return nil
+}
+
+// MinDecryptionVersion returns the minimum key version Vault accepts for decryption.
+func (t *TransitService) MinDecryptionVersion(ctx context.Context, keyID string) (int, error) {
+	if keyID == "" {
+		return 0, fmt.Errorf("%w: keyID cannot be empty", encx.ErrInvalidConfiguration)
+	}
+	name, _ := ParseVersionedKeyID(keyID)
+
+	_, minVersion, err := t.readKeyVersions(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	return minVersion, nil
+}
+
+// readKeyVersions reads the latest and minimum decryption versions of a Transit key
+// and refreshes the cached minimum decryption version.
+func (t *TransitService) readKeyVersions(ctx context.Context, name string) (int, int, error) {
+	resp, err := t.client.Logical().ReadWithContext(ctx, fmt.Sprintf("transit/keys/%s", name))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: failed to read transit key '%s': %w", encx.ErrKMSUnavailable, name, err)
+	}
+	if resp == nil || resp.Data == nil {
+		return 0, 0, fmt.Errorf("%w: transit key '%s' not found", encx.ErrKMSUnavailable, name)
+	}
+
+	latest, err := intField(resp.Data, "latest_version")
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: transit key '%s': %w", encx.ErrKMSUnavailable, name, err)
+	}
+	minVersion, err := intField(resp.Data, "min_decryption_version")
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: transit key '%s': %w", encx.ErrKMSUnavailable, name, err)
+	}
+
+	t.setMinDecryptionVersion(name, minVersion)
+	return latest, minVersion, nil
+}
+
+// setMinDecryptionVersion caches the minimum decryption version of a key.
+func (t *TransitService) setMinDecryptionVersion(name string, version int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.minDecryptionVersions == nil {
+		t.minDecryptionVersions = make(map[string]int)
+	}
+	t.minDecryptionVersions[name] = version
+}
+
+// cachedMinDecryptionVersion returns the cached minimum decryption version of a key, or 0 if unknown.
+func (t *TransitService) cachedMinDecryptionVersion(name string) int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.minDecryptionVersions[name]
+}
+
+// intField reads an integer from a Vault response, which may be decoded as json.Number.
+func intField(data map[string]interface{}, key string) (int, error) {
+	switch v := data[key].(type) {
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		return int(n), nil
+	case float64:
+		return int(v), nil
+	case int:
+		return v, nil
+	default:
+		return 0, fmt.Errorf("%s not found in response", key)
+	}
+}
@@ -0,0 +1,358 @@
+package hashicorp
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hengadev/encx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTransitKey is the state of a key in fakeTransit.
+type fakeTransitKey struct {
+	latestVersion        int
+	minDecryptionVersion int
+	material             [][]byte // AES-256 key per version, oldest first
+}
+
+func newFakeTransitKey() *fakeTransitKey {
+	key := &fakeTransitKey{minDecryptionVersion: 1}
+	key.rotate()
+	return key
+}
+
+func (k *fakeTransitKey) rotate() {
+	material := make([]byte, 32)
+	rand.Read(material)
+	k.material = append(k.material, material)
+	k.latestVersion = len(k.material)
+}
+
+func (k *fakeTransitKey) aead(version int) cipher.AEAD {
+	block, _ := aes.NewCipher(k.material[version-1])
+	aead, _ := cipher.NewGCM(block)
+	return aead
+}
+
+// fakeTransit is a minimal stateful Vault Transit Engine.
+//
+// Ciphertexts are "vault:v<version>:<base64 nonce and AES-GCM ciphertext>". Like
+// non-derived Transit keys, the fake ignores the encryption context.
+type fakeTransit struct {
+	mu          sync.Mutex
+	keys        map[string]*fakeTransitKey
+	decryptions int
+}
+
+func newFakeTransitService(t *testing.T) (*TransitService, *fakeTransit) {
+	t.Helper()
+
+	fake := &fakeTransit{keys: make(map[string]*fakeTransitKey)}
+	server := httptest.NewServer(http.HandlerFunc(fake.handle))
+	t.Cleanup(server.Close)
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	client, err := api.NewClient(config)
+	require.NoError(t, err)
+
+	return &TransitService{client: client}, fake
+}
+
+func (f *fakeTransit) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var body map[string]interface{}
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/transit/")
+	parts := strings.Split(path, "/")
+	if len(parts) < 2 {
+		writeVaultError(w, http.StatusNotFound, "unsupported path")
+		return
+	}
+
+	switch {
+	case parts[0] == "keys" && len(parts) == 2 && r.Method == http.MethodGet:
+		key, ok := f.keys[parts[1]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeVaultData(w, map[string]interface{}{
+			"latest_version":         key.latestVersion,
+			"min_decryption_version": key.minDecryptionVersion,
+		})
+
+	case parts[0] == "keys" && len(parts) == 2:
+		f.keys[parts[1]] = newFakeTransitKey()
+		w.WriteHeader(http.StatusNoContent)
+
+	case parts[0] == "keys" && len(parts) == 3 && parts[2] == "rotate":
+		key, ok := f.keys[parts[1]]
+		if !ok {
+			writeVaultError(w, http.StatusBadRequest, "key not found")
+			return
+		}
+		key.rotate()
+		w.WriteHeader(http.StatusNoContent)
+
+	case parts[0] == "keys" && len(parts) == 3 && parts[2] == "config":
+		key, ok := f.keys[parts[1]]
+		if !ok {
+			writeVaultError(w, http.StatusBadRequest, "key not found")
+			return
+		}
+		key.minDecryptionVersion = int(body["min_decryption_version"].(float64))
+		w.WriteHeader(http.StatusNoContent)
+
+	case parts[0] == "encrypt":
+		key, ok := f.keys[parts[1]]
+		if !ok {
+			// Transit creates keys on first use by default
+			key = newFakeTransitKey()
+			f.keys[parts[1]] = key
+		}
+		version := key.latestVersion
+		if v, ok := body["key_version"].(float64); ok {
+			version = int(v)
+		}
+		if version > key.latestVersion {
+			writeVaultError(w, http.StatusBadRequest, "requested version is greater than latest version")
+			return
+		}
+		plaintext, err := base64.StdEncoding.DecodeString(body["plaintext"].(string))
+		if err != nil {
+			writeVaultError(w, http.StatusBadRequest, "failed to base64-decode plaintext")
+			return
+		}
+		aead := key.aead(version)
+		nonce := make([]byte, aead.NonceSize())
+		rand.Read(nonce)
+		sealed := aead.Seal(nonce, nonce, plaintext, nil)
+		writeVaultData(w, map[string]interface{}{
+			"ciphertext": fmt.Sprintf("vault:v%d:%s", version, base64.StdEncoding.EncodeToString(sealed)),
+		})
+
+	case parts[0] == "decrypt":
+		f.decryptions++
+		key, ok := f.keys[parts[1]]
+		if !ok {
+			writeVaultError(w, http.StatusBadRequest, "key not found")
+			return
+		}
+		segments := strings.SplitN(body["ciphertext"].(string), ":", 3)
+		var version int
+		fmt.Sscanf(segments[1], "v%d", &version)
+		if version < key.minDecryptionVersion {
+			writeVaultError(w, http.StatusBadRequest, "ciphertext version is disallowed by policy (too old)")
+			return
+		}
+		if version > key.latestVersion {
+			writeVaultError(w, http.StatusBadRequest, "invalid ciphertext: version is greater than latest version")
+			return
+		}
+		sealed, err := base64.StdEncoding.DecodeString(segments[2])
+		aead := key.aead(version)
+		if err != nil || len(sealed) < aead.NonceSize() {
+			writeVaultError(w, http.StatusBadRequest, "invalid ciphertext")
+			return
+		}
+		plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+		if err != nil {
+			writeVaultError(w, http.StatusBadRequest, "cipher: message authentication failed")
+			return
+		}
+		writeVaultData(w, map[string]interface{}{"plaintext": base64.StdEncoding.EncodeToString(plaintext)})
+
+	default:
+		writeVaultError(w, http.StatusNotFound, "unsupported path")
+	}
+}
+
+func writeVaultData(w http.ResponseWriter, data map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func writeVaultError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{message}})
+}
+
+func TestParseVersionedKeyID(t *testing.T) {
+	tests := []struct {
+		keyID       string
+		wantName    string
+		wantVersion int
+	}{
+		{"my-app-key", "my-app-key", 0},
+		{"my-app-key:v1", "my-app-key", 1},
+		{"my-app-key:v42", "my-app-key", 42},
+		{"my-app-key:v0", "my-app-key:v0", 0},
+		{"my-app-key:vx", "my-app-key:vx", 0},
+		{":v3", ":v3", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.keyID, func(t *testing.T) {
+			name, version := ParseVersionedKeyID(tt.keyID)
+			assert.Equal(t, tt.wantName, name)
+			assert.Equal(t, tt.wantVersion, version)
+		})
+	}
+
+	assert.Equal(t, "my-app-key:v3", FormatVersionedKeyID("my-app-key", 3))
+}
+
+func TestRotateKey(t *testing.T) {
+	vs, fake := newFakeTransitService(t)
+	ctx := context.Background()
+
+	_, err := vs.CreateKey(ctx, "app-key")
+	require.NoError(t, err)
+
+	keyID, err := vs.RotateKey(ctx, "app-key")
+	require.NoError(t, err)
+	assert.Equal(t, "app-key:v2", keyID)
+
+	keyID, err = vs.RotateKey(ctx, keyID)
+	require.NoError(t, err)
+	assert.Equal(t, "app-key:v3", keyID)
+
+	// Rotation does not create new keys
+	assert.Len(t, fake.keys, 1)
+
+	_, err = vs.RotateKey(ctx, "missing-key")
+	assert.True(t, errors.Is(err, encx.ErrKMSUnavailable))
+
+	_, err = vs.RotateKey(ctx, "")
+	assert.True(t, errors.Is(err, encx.ErrInvalidConfiguration))
+}
+
+func TestVersionedEncryptDecrypt(t *testing.T) {
+	vs, _ := newFakeTransitService(t)
+	ctx := context.Background()
+	dek := []byte("0123456789abcdef0123456789abcdef")
+
+	_, err := vs.CreateKey(ctx, "app-key")
+	require.NoError(t, err)
+	v2, err := vs.RotateKey(ctx, "app-key")
+	require.NoError(t, err)
+
+	// Versioned key IDs pin the encryption key version
+	ciphertext, err := vs.EncryptDEK(ctx, "app-key:v1", dek)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(ciphertext), "vault:v1:"))
+
+	ciphertext2, err := vs.EncryptDEK(ctx, v2, dek)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(ciphertext2), "vault:v2:"))
+
+	plaintext, err := vs.DecryptDEK(ctx, "app-key:v1", ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, dek, plaintext)
+
+	// Unversioned key IDs accept any version
+	plaintext, err = vs.DecryptDEK(ctx, "app-key", ciphertext2)
+	require.NoError(t, err)
+	assert.Equal(t, dek, plaintext)
+
+	// Mismatched versions are rejected
+	_, err = vs.DecryptDEK(ctx, v2, ciphertext)
+	assert.True(t, errors.Is(err, encx.ErrDecryptionFailed))
+
+	_, err = vs.DecryptDEK(ctx, "app-key", []byte("not-a-vault-ciphertext"))
+	assert.True(t, errors.Is(err, encx.ErrDecryptionFailed))
+}
+
+func TestSetMinDecryptionVersion(t *testing.T) {
+	vs, fake := newFakeTransitService(t)
+	ctx := context.Background()
+	dek := []byte("0123456789abcdef0123456789abcdef")
+
+	ciphertext, err := vs.EncryptDEK(ctx, "app-key", dek)
+	require.NoError(t, err)
+	_, err = vs.RotateKey(ctx, "app-key")
+	require.NoError(t, err)
+
+	minVersion, err := vs.MinDecryptionVersion(ctx, "app-key")
+	require.NoError(t, err)
+	assert.Equal(t, 1, minVersion)
+
+	require.NoError(t, vs.SetMinDecryptionVersion(ctx, "app-key:v2", 2))
+
+	minVersion, err = vs.MinDecryptionVersion(ctx, "app-key")
+	require.NoError(t, err)
+	assert.Equal(t, 2, minVersion)
+
+	// Rejected client-side, without a round trip to Vault
+	decryptions := fake.decryptions
+	_, err = vs.DecryptDEK(ctx, "app-key", ciphertext)
+	assert.True(t, errors.Is(err, encx.ErrDecryptionFailed))
+	assert.Equal(t, decryptions, fake.decryptions)
+
+	err = vs.SetMinDecryptionVersion(ctx, "app-key", 0)
+	assert.True(t, errors.Is(err, encx.ErrInvalidConfiguration))
+}
+
+func TestRotateKEK_WithTransitVersioning(t *testing.T) {
+	vs, fake := newFakeTransitService(t)
+	ctx := context.Background()
+
+	crypto, err := encx.NewCrypto(ctx, vs, encx.NewInMemorySecretStore(), encx.Config{
+		KEKAlias:    "app-kek",
+		PepperAlias: "transit-versioning-test",
+		DBPath:      t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	dek, err := crypto.GenerateDEK()
+	require.NoError(t, err)
+	encryptedV1, err := crypto.EncryptDEK(ctx, dek)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(encryptedV1), "vault:v1:"))
+
+	require.NoError(t, crypto.RotateKEK(ctx))
+
+	// Rotation used Transit versioning instead of creating a new key
+	assert.Len(t, fake.keys, 1)
+	assert.Equal(t, 2, fake.keys["app-kek"].latestVersion)
+
+	version, err := crypto.GetCurrentKEKVersion(ctx, "app-kek")
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	encryptedV2, err := crypto.EncryptDEK(ctx, dek)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(encryptedV2), "vault:v2:"))
+
+	// DEKs wrapped before the rotation still decrypt under their KEK version
+	decrypted, err := crypto.DecryptDEKWithVersion(ctx, encryptedV1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, dek, decrypted)
+
+	decrypted, err = crypto.DecryptDEKWithVersion(ctx, encryptedV2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, dek, decrypted)
+
+	_, err = crypto.DecryptDEKWithVersion(ctx, encryptedV1, 2)
+	assert.Error(t, err)
+}
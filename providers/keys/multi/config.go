@@ -0,0 +1,32 @@
+package multi
+
+import "github.com/hengadev/encx"
+
+// Provider describes a single KMS participating in the composite service.
+type Provider struct {
+	// Name uniquely identifies the provider (e.g., "aws-us-east-1", "vault").
+	// It is recorded in every wrapped DEK blob, so it must stay stable once
+	// data has been written.
+	Name string
+
+	// Service is the underlying KeyManagementService.
+	Service encx.KeyManagementService
+
+	// Alias optionally overrides the KEK alias passed to GetKeyID for this provider.
+	// Use it when providers name the same logical KEK differently
+	// (e.g., "alias/my-app-kek" in AWS KMS and "my-app-kek" in Vault Transit).
+	// If empty, the alias from encx.Config.KEKAlias is used as-is.
+	Alias string
+}
+
+// Config holds configuration for the composite KMS service.
+type Config struct {
+	// Providers lists the KMS providers in priority order.
+	// Decryption tries each provider in this order until one succeeds.
+	Providers []Provider
+
+	// MinWrapped is the minimum number of providers that must successfully wrap
+	// a DEK for EncryptDEK to succeed.
+	// If zero, every provider must succeed.
+	MinWrapped int
+}
@@ -0,0 +1,20 @@
+package multi
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hengadev/encx"
+	"github.com/hengadev/encx/encxtest"
+)
+
+func TestKMSService_Conformance(t *testing.T) {
+	for _, minWrapped := range []int{1, 2} {
+		t.Run(fmt.Sprintf("MinWrapped=%d", minWrapped), func(t *testing.T) {
+			encxtest.RunKMSConformance(t, func(t *testing.T) encx.KeyManagementService {
+				service, _, _ := newTestService(t, minWrapped)
+				return service
+			})
+		})
+	}
+}
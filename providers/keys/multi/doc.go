@@ -0,0 +1,79 @@
+// Package multi provides a composite KeyManagementService for encx.
+//
+// This package implements the encx.KeyManagementService interface on top of several
+// other KeyManagementService implementations. Every Data Encryption Key (DEK) is
+// wrapped under the Key Encryption Key (KEK) of each provider, so that any single
+// provider can unwrap it on its own.
+//
+// # Features
+//
+//   - Redundant DEK wrapping across providers (e.g., AWS KMS in two regions plus Vault Transit)
+//   - Priority-ordered failover on decryption
+//   - Configurable minimum number of successful wraps on encryption
+//   - Degraded provider reporting through encx health checks
+//
+// # Basic Usage
+//
+//	import (
+//	    "github.com/hengadev/encx"
+//	    awskms "github.com/hengadev/encx/providers/keys/aws"
+//	    vaulttransit "github.com/hengadev/encx/providers/keys/hashicorp"
+//	    "github.com/hengadev/encx/providers/keys/multi"
+//	)
+//
+//	east, err := awskms.NewKMSService(ctx, awskms.Config{Region: "us-east-1"})
+//	west, err := awskms.NewKMSService(ctx, awskms.Config{Region: "us-west-2"})
+//	transit, err := vaulttransit.NewTransitService()
+//
+//	kms, err := multi.NewKMSService(multi.Config{
+//	    Providers: []multi.Provider{
+//	        {Name: "aws-us-east-1", Service: east, Alias: "alias/my-app-kek"},
+//	        {Name: "aws-us-west-2", Service: west, Alias: "alias/my-app-kek"},
+//	        {Name: "vault", Service: transit, Alias: "my-app-kek"},
+//	    },
+//	})
+//
+//	crypto, err := encx.NewCrypto(ctx, kms, secretsStore, encx.Config{
+//	    KEKAlias:    "my-app-kek",
+//	    PepperAlias: "my-app",
+//	})
+//
+// # Wrapped DEK Format
+//
+// EncryptDEK returns a JSON document holding one ciphertext per provider:
+//
+//	{"version":1,"wraps":[{"provider":"aws-us-east-1","ciphertext":"..."},{"provider":"vault","ciphertext":"..."}]}
+//
+// The key IDs recorded in the encx key metadata database are JSON objects mapping
+// provider names to provider-specific key IDs. Provider names are part of the
+// stored data and must not be renamed once DEKs have been written.
+//
+// # Failover
+//
+// DecryptDEK tries providers in the order of Config.Providers and returns the first
+// successful unwrap. Encryption requires Config.MinWrapped successful wraps
+// (all providers by default); lowering it keeps writes available during an outage
+// at the cost of DEKs that are not wrapped by every provider.
+//
+// # Health Reporting
+//
+// Each provider's status is derived from the outcome of real operations. Register
+// the checks with an encx.HealthChecker to expose them:
+//
+//	checker := encx.NewHealthChecker("my-service", "1.0.0")
+//	kms.RegisterHealthChecks(checker)
+//
+// The "multi-kms" check reports degraded while at least one provider is failing
+// and unhealthy once all providers fail.
+//
+// # Error Handling
+//
+// Operations return wrapped errors from the encx package:
+//
+//   - encx.ErrKMSUnavailable: a provider failed to resolve or create a key
+//   - encx.ErrEncryptionFailed: fewer than MinWrapped providers wrapped the DEK
+//   - encx.ErrDecryptionFailed: no provider could unwrap the DEK
+//   - encx.ErrInvalidConfiguration: invalid configuration or composite key ID
+//
+// For more information, see https://github.com/hengadev/encx
+package multi
@@ -0,0 +1,152 @@
+package multi
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hengadev/encx"
+)
+
+// providerState tracks the outcome of the most recent operations of a provider.
+type providerState struct {
+	mu                  sync.RWMutex
+	consecutiveFailures int
+	lastError           error
+	lastFailure         time.Time
+	lastSuccess         time.Time
+}
+
+// ProviderStatus is a snapshot of a provider's health as observed by the composite service.
+type ProviderStatus struct {
+	Name                string
+	Status              encx.HealthStatus
+	ConsecutiveFailures int
+	LastError           error
+	LastFailure         time.Time
+	LastSuccess         time.Time
+}
+
+func (m *KMSService) recordSuccess(name string) {
+	state := m.status[name]
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.consecutiveFailures = 0
+	state.lastSuccess = time.Now()
+}
+
+func (m *KMSService) recordFailure(name string, err error) {
+	state := m.status[name]
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.consecutiveFailures++
+	state.lastError = err
+	state.lastFailure = time.Now()
+}
+
+// ProviderStatuses returns the observed status of every provider in priority order.
+//
+// A provider is healthy until an operation against it fails, and becomes healthy
+// again after its next successful operation.
+func (m *KMSService) ProviderStatuses() []ProviderStatus {
+	statuses := make([]ProviderStatus, len(m.providers))
+	for i, p := range m.providers {
+		state := m.status[p.Name]
+		state.mu.RLock()
+		status := ProviderStatus{
+			Name:                p.Name,
+			Status:              encx.HealthStatusHealthy,
+			ConsecutiveFailures: state.consecutiveFailures,
+			LastError:           state.lastError,
+			LastFailure:         state.lastFailure,
+			LastSuccess:         state.lastSuccess,
+		}
+		state.mu.RUnlock()
+
+		if status.ConsecutiveFailures > 0 {
+			status.Status = encx.HealthStatusUnhealthy
+		}
+		statuses[i] = status
+	}
+	return statuses
+}
+
+// HealthChecks returns health checks describing the composite service.
+//
+// The first check ("multi-kms") is critical and reports:
+//   - healthy when every provider is healthy
+//   - degraded when at least one provider fails but another one still works
+//   - unhealthy when every provider fails
+//
+// It is followed by one non-critical check per provider ("multi-kms/{name}").
+//
+// The checks are passive: they report the outcome of real DEK operations and do
+// not call the underlying providers.
+func (m *KMSService) HealthChecks() []*encx.HealthCheck {
+	checks := []*encx.HealthCheck{
+		{
+			Name:        "multi-kms",
+			Description: "Composite KMS availability across all providers",
+			Critical:    true,
+			Timeout:     time.Second,
+			CheckFunc: func(ctx context.Context) (encx.HealthStatus, error) {
+				var failing []string
+				for _, status := range m.ProviderStatuses() {
+					if status.Status != encx.HealthStatusHealthy {
+						failing = append(failing, status.Name)
+					}
+				}
+
+				switch {
+				case len(failing) == 0:
+					return encx.HealthStatusHealthy, nil
+				case len(failing) == len(m.providers):
+					return encx.HealthStatusUnhealthy, fmt.Errorf("all providers are failing: %v", failing)
+				default:
+					return encx.HealthStatusDegraded, fmt.Errorf("degraded providers: %v", failing)
+				}
+			},
+		},
+	}
+
+	for _, p := range m.providers {
+		name := p.Name
+		checks = append(checks, &encx.HealthCheck{
+			Name:        "multi-kms/" + name,
+			Description: fmt.Sprintf("KMS provider %s", name),
+			Critical:    false,
+			Timeout:     time.Second,
+			CheckFunc: func(ctx context.Context) (encx.HealthStatus, error) {
+				state := m.status[name]
+				state.mu.RLock()
+				defer state.mu.RUnlock()
+				if state.consecutiveFailures > 0 {
+					return encx.HealthStatusUnhealthy, fmt.Errorf("%d consecutive failures, last error: %w",
+						state.consecutiveFailures, state.lastError)
+				}
+				return encx.HealthStatusHealthy, nil
+			},
+		})
+	}
+
+	return checks
+}
+
+// RegisterHealthChecks registers all checks returned by HealthChecks with the given checker.
+//
+// Usage:
+//
+//	checker := encx.NewHealthChecker("my-service", "1.0.0")
+//	if err := kms.RegisterHealthChecks(checker); err != nil {
+//	    log.Fatal(err)
+//	}
+//	http.Handle("/health", encx.NewHealthEndpoint(checker))
+func (m *KMSService) RegisterHealthChecks(checker *encx.HealthChecker) error {
+	for _, check := range m.HealthChecks() {
+		if err := checker.RegisterCheck(check); err != nil {
+			return fmt.Errorf("failed to register health check %s: %w", check.Name, err)
+		}
+	}
+	return nil
+}
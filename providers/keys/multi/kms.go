@@ -0,0 +1,282 @@
+// Package multi provides a composite KeyManagementService that wraps every DEK
+// under several KEKs at once.
+//
+// This provider implements the KeyManagementService interface on top of other
+// KeyManagementService implementations, so that a regional KMS outage does not
+// take the read path down.
+package multi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hengadev/encx"
+)
+
+// blobVersion is the format version of multi-wrapped DEK blobs.
+const blobVersion = 1
+
+// wrappedDEK is a DEK wrapped by a single provider.
+type wrappedDEK struct {
+	Provider   string `json:"provider"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// wrappedDEKBlob is the stored representation of a multi-wrapped DEK.
+type wrappedDEKBlob struct {
+	Version int          `json:"version"`
+	Wraps   []wrappedDEK `json:"wraps"`
+}
+
+// KMSService implements encx.KeyManagementService by fanning out to several providers.
+//
+// Key IDs returned by GetKeyID and CreateKey are JSON objects mapping provider
+// names to provider-specific key IDs. They are opaque to encx and are stored
+// in the key metadata database like any other KMS key ID.
+type KMSService struct {
+	providers  []Provider
+	minWrapped int
+	status     map[string]*providerState
+}
+
+// NewKMSService creates a new composite KMS service.
+//
+// Usage:
+//
+//	east, _ := awskms.NewKMSService(ctx, awskms.Config{Region: "us-east-1"})
+//	west, _ := awskms.NewKMSService(ctx, awskms.Config{Region: "us-west-2"})
+//	transit, _ := vaulttransit.NewTransitService()
+//
+//	kms, err := multi.NewKMSService(multi.Config{
+//	    Providers: []multi.Provider{
+//	        {Name: "aws-us-east-1", Service: east},
+//	        {Name: "aws-us-west-2", Service: west},
+//	        {Name: "vault", Service: transit, Alias: "my-app-kek"},
+//	    },
+//	})
+func NewKMSService(cfg Config) (*KMSService, error) {
+	if len(cfg.Providers) == 0 {
+		return nil, fmt.Errorf("%w: at least one provider is required", encx.ErrInvalidConfiguration)
+	}
+
+	status := make(map[string]*providerState, len(cfg.Providers))
+	for i, p := range cfg.Providers {
+		if p.Name == "" {
+			return nil, fmt.Errorf("%w: provider %d has no name", encx.ErrInvalidConfiguration, i)
+		}
+		if p.Service == nil {
+			return nil, fmt.Errorf("%w: provider %s has no service", encx.ErrInvalidConfiguration, p.Name)
+		}
+		if _, exists := status[p.Name]; exists {
+			return nil, fmt.Errorf("%w: duplicate provider name %s", encx.ErrInvalidConfiguration, p.Name)
+		}
+		status[p.Name] = &providerState{}
+	}
+
+	minWrapped := cfg.MinWrapped
+	if minWrapped == 0 {
+		minWrapped = len(cfg.Providers)
+	}
+	if minWrapped < 0 || minWrapped > len(cfg.Providers) {
+		return nil, fmt.Errorf("%w: MinWrapped must be between 1 and %d, got %d",
+			encx.ErrInvalidConfiguration, len(cfg.Providers), cfg.MinWrapped)
+	}
+
+	providers := make([]Provider, len(cfg.Providers))
+	copy(providers, cfg.Providers)
+
+	return &KMSService{
+		providers:  providers,
+		minWrapped: minWrapped,
+		status:     status,
+	}, nil
+}
+
+// GetKeyID resolves the alias with every provider and returns a composite key ID.
+//
+// Each provider resolves its own alias (Provider.Alias if set, otherwise the given alias).
+// An error is returned if any provider cannot resolve its key.
+func (m *KMSService) GetKeyID(ctx context.Context, alias string) (string, error) {
+	if alias == "" {
+		return "", fmt.Errorf("%w: alias cannot be empty", encx.ErrInvalidConfiguration)
+	}
+
+	keyIDs := make(map[string]string, len(m.providers))
+	for _, p := range m.providers {
+		keyID, err := p.Service.GetKeyID(ctx, p.aliasFor(alias))
+		if err != nil {
+			m.recordFailure(p.Name, err)
+			return "", fmt.Errorf("%w: provider %s failed to resolve key: %w", encx.ErrKMSUnavailable, p.Name, err)
+		}
+		m.recordSuccess(p.Name)
+		keyIDs[p.Name] = keyID
+	}
+
+	return encodeKeyID(keyIDs)
+}
+
+// CreateKey creates a new key in every provider and returns a composite key ID.
+//
+// The description is passed to each provider, except for providers with an Alias
+// override, which receive their alias instead.
+func (m *KMSService) CreateKey(ctx context.Context, description string) (string, error) {
+	keyIDs := make(map[string]string, len(m.providers))
+	for _, p := range m.providers {
+		keyID, err := p.Service.CreateKey(ctx, p.aliasFor(description))
+		if err != nil {
+			m.recordFailure(p.Name, err)
+			return "", fmt.Errorf("%w: provider %s failed to create key: %w", encx.ErrKMSUnavailable, p.Name, err)
+		}
+		m.recordSuccess(p.Name)
+		keyIDs[p.Name] = keyID
+	}
+
+	return encodeKeyID(keyIDs)
+}
+
+// EncryptDEK wraps the DEK under the KEK of every provider.
+//
+// The result is a JSON blob holding one ciphertext per provider. Encryption
+// succeeds as long as at least Config.MinWrapped providers wrapped the DEK;
+// failing providers are reported as degraded.
+func (m *KMSService) EncryptDEK(ctx context.Context, keyID string, plaintext []byte) ([]byte, error) {
+	if len(plaintext) == 0 {
+		return nil, fmt.Errorf("%w: plaintext cannot be empty", encx.ErrEncryptionFailed)
+	}
+
+	keyIDs, err := decodeKeyID(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := wrappedDEKBlob{Version: blobVersion}
+	var errs []error
+	for _, p := range m.providers {
+		providerKeyID, ok := keyIDs[p.Name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("provider %s: no key ID in composite key", p.Name))
+			continue
+		}
+
+		ciphertext, err := p.Service.EncryptDEK(ctx, providerKeyID, plaintext)
+		if err != nil {
+			m.recordFailure(p.Name, err)
+			errs = append(errs, fmt.Errorf("provider %s: %w", p.Name, err))
+			continue
+		}
+		m.recordSuccess(p.Name)
+		blob.Wraps = append(blob.Wraps, wrappedDEK{Provider: p.Name, Ciphertext: ciphertext})
+	}
+
+	if len(blob.Wraps) < m.minWrapped {
+		return nil, fmt.Errorf("%w: DEK wrapped by %d of %d required providers: %w",
+			encx.ErrEncryptionFailed, len(blob.Wraps), m.minWrapped, errors.Join(errs...))
+	}
+
+	data, err := json.Marshal(blob)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to encode wrapped DEK: %w", encx.ErrEncryptionFailed, err)
+	}
+	return data, nil
+}
+
+// DecryptDEK unwraps the DEK using the first provider, in priority order, that succeeds.
+//
+// Providers that fail are reported as degraded and the next provider is tried.
+// An error is returned only when every provider holding a wrap of the DEK fails.
+func (m *KMSService) DecryptDEK(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) == 0 {
+		return nil, fmt.Errorf("%w: ciphertext cannot be empty", encx.ErrDecryptionFailed)
+	}
+
+	keyIDs, err := decodeKeyID(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var blob wrappedDEKBlob
+	if err := json.Unmarshal(ciphertext, &blob); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode wrapped DEK: %w", encx.ErrDecryptionFailed, err)
+	}
+	if blob.Version != blobVersion {
+		return nil, fmt.Errorf("%w: unsupported wrapped DEK version %d", encx.ErrDecryptionFailed, blob.Version)
+	}
+
+	wraps := make(map[string][]byte, len(blob.Wraps))
+	for _, w := range blob.Wraps {
+		wraps[w.Provider] = w.Ciphertext
+	}
+
+	var errs []error
+	for _, p := range m.providers {
+		wrapped, ok := wraps[p.Name]
+		if !ok {
+			continue
+		}
+		providerKeyID, ok := keyIDs[p.Name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("provider %s: no key ID in composite key", p.Name))
+			continue
+		}
+
+		plaintext, err := p.Service.DecryptDEK(ctx, providerKeyID, wrapped)
+		if err != nil {
+			m.recordFailure(p.Name, err)
+			errs = append(errs, fmt.Errorf("provider %s: %w", p.Name, err))
+
+			// Do not fail over once the caller has given up
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		m.recordSuccess(p.Name)
+		return plaintext, nil
+	}
+
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("%w: no configured provider holds a wrap of this DEK", encx.ErrDecryptionFailed)
+	}
+	return nil, fmt.Errorf("%w: all providers failed to unwrap DEK: %w", encx.ErrDecryptionFailed, errors.Join(errs...))
+}
+
+// Providers returns the names of the configured providers in priority order.
+func (m *KMSService) Providers() []string {
+	names := make([]string, len(m.providers))
+	for i, p := range m.providers {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// aliasFor returns the provider-specific alias, falling back to the given alias.
+func (p Provider) aliasFor(alias string) string {
+	if p.Alias != "" {
+		return p.Alias
+	}
+	return alias
+}
+
+// encodeKeyID encodes per-provider key IDs into a composite key ID.
+func encodeKeyID(keyIDs map[string]string) (string, error) {
+	data, err := json.Marshal(keyIDs)
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to encode composite key ID: %w", encx.ErrKMSUnavailable, err)
+	}
+	return string(data), nil
+}
+
+// decodeKeyID decodes a composite key ID into per-provider key IDs.
+func decodeKeyID(keyID string) (map[string]string, error) {
+	if keyID == "" {
+		return nil, fmt.Errorf("%w: keyID cannot be empty", encx.ErrInvalidConfiguration)
+	}
+
+	var keyIDs map[string]string
+	if err := json.Unmarshal([]byte(keyID), &keyIDs); err != nil {
+		return nil, fmt.Errorf("%w: invalid composite key ID: %w", encx.ErrInvalidConfiguration, err)
+	}
+	return keyIDs, nil
+}
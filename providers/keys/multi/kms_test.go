@@ -0,0 +1,332 @@
+package multi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/hengadev/encx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// toggleKMS wraps a KMS and fails every operation while down is set.
+type toggleKMS struct {
+	encx.KeyManagementService
+	down bool
+}
+
+var errProviderDown = errors.New("provider down")
+
+func (k *toggleKMS) GetKeyID(ctx context.Context, alias string) (string, error) {
+	if k.down {
+		return "", errProviderDown
+	}
+	return k.KeyManagementService.GetKeyID(ctx, alias)
+}
+
+func (k *toggleKMS) CreateKey(ctx context.Context, description string) (string, error) {
+	if k.down {
+		return "", errProviderDown
+	}
+	return k.KeyManagementService.CreateKey(ctx, description)
+}
+
+func (k *toggleKMS) EncryptDEK(ctx context.Context, keyID string, plaintext []byte) ([]byte, error) {
+	if k.down {
+		return nil, errProviderDown
+	}
+	return k.KeyManagementService.EncryptDEK(ctx, keyID, plaintext)
+}
+
+func (k *toggleKMS) DecryptDEK(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	if k.down {
+		return nil, errProviderDown
+	}
+	return k.KeyManagementService.DecryptDEK(ctx, keyID, ciphertext)
+}
+
+func newTestService(t *testing.T, minWrapped int) (*KMSService, *toggleKMS, *toggleKMS) {
+	t.Helper()
+
+	primary := &toggleKMS{KeyManagementService: encx.NewSimpleTestKMS()}
+	secondary := &toggleKMS{KeyManagementService: encx.NewSimpleTestKMS()}
+
+	service, err := NewKMSService(Config{
+		Providers: []Provider{
+			{Name: "primary", Service: primary},
+			{Name: "secondary", Service: secondary, Alias: "secondary-kek"},
+		},
+		MinWrapped: minWrapped,
+	})
+	require.NoError(t, err)
+
+	return service, primary, secondary
+}
+
+func healthStatuses(t *testing.T, service *KMSService) map[string]encx.HealthStatus {
+	t.Helper()
+
+	statuses := make(map[string]encx.HealthStatus)
+	for _, check := range service.HealthChecks() {
+		status, _ := check.CheckFunc(context.Background())
+		statuses[check.Name] = status
+	}
+	return statuses
+}
+
+func TestNewKMSService(t *testing.T) {
+	kms := encx.NewSimpleTestKMS()
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{
+			name:   "valid configuration",
+			config: Config{Providers: []Provider{{Name: "a", Service: kms}, {Name: "b", Service: kms}}},
+		},
+		{
+			name:    "no providers",
+			config:  Config{},
+			wantErr: true,
+		},
+		{
+			name:    "missing name",
+			config:  Config{Providers: []Provider{{Service: kms}}},
+			wantErr: true,
+		},
+		{
+			name:    "missing service",
+			config:  Config{Providers: []Provider{{Name: "a"}}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate name",
+			config:  Config{Providers: []Provider{{Name: "a", Service: kms}, {Name: "a", Service: kms}}},
+			wantErr: true,
+		},
+		{
+			name:    "MinWrapped greater than providers",
+			config:  Config{Providers: []Provider{{Name: "a", Service: kms}}, MinWrapped: 2},
+			wantErr: true,
+		},
+		{
+			name:    "negative MinWrapped",
+			config:  Config{Providers: []Provider{{Name: "a", Service: kms}}, MinWrapped: -1},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, err := NewKMSService(tt.config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.True(t, errors.Is(err, encx.ErrInvalidConfiguration))
+				assert.Nil(t, service)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"a", "b"}, service.Providers())
+		})
+	}
+}
+
+func TestKMSService_GetKeyID(t *testing.T) {
+	service, _, secondary := newTestService(t, 0)
+	ctx := context.Background()
+
+	keyID, err := service.GetKeyID(ctx, "my-kek")
+	require.NoError(t, err)
+
+	var keyIDs map[string]string
+	require.NoError(t, json.Unmarshal([]byte(keyID), &keyIDs))
+	assert.Equal(t, map[string]string{"primary": "test-key-id", "secondary": "test-key-id"}, keyIDs)
+
+	_, err = service.GetKeyID(ctx, "")
+	assert.True(t, errors.Is(err, encx.ErrInvalidConfiguration))
+
+	secondary.down = true
+	_, err = service.GetKeyID(ctx, "my-kek")
+	assert.True(t, errors.Is(err, encx.ErrKMSUnavailable))
+	assert.True(t, errors.Is(err, errProviderDown))
+}
+
+func TestKMSService_EncryptDecryptDEK(t *testing.T) {
+	service, _, _ := newTestService(t, 0)
+	ctx := context.Background()
+
+	keyID, err := service.GetKeyID(ctx, "my-kek")
+	require.NoError(t, err)
+
+	dek := []byte("0123456789abcdef0123456789abcdef")
+	ciphertext, err := service.EncryptDEK(ctx, keyID, dek)
+	require.NoError(t, err)
+
+	var blob wrappedDEKBlob
+	require.NoError(t, json.Unmarshal(ciphertext, &blob))
+	assert.Equal(t, blobVersion, blob.Version)
+	require.Len(t, blob.Wraps, 2)
+	assert.Equal(t, "primary", blob.Wraps[0].Provider)
+	assert.Equal(t, "secondary", blob.Wraps[1].Provider)
+
+	plaintext, err := service.DecryptDEK(ctx, keyID, ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, dek, plaintext)
+
+	statuses := healthStatuses(t, service)
+	assert.Equal(t, encx.HealthStatusHealthy, statuses["multi-kms"])
+}
+
+func TestKMSService_DecryptFailover(t *testing.T) {
+	service, primary, secondary := newTestService(t, 0)
+	ctx := context.Background()
+
+	keyID, err := service.GetKeyID(ctx, "my-kek")
+	require.NoError(t, err)
+
+	dek := []byte("0123456789abcdef0123456789abcdef")
+	ciphertext, err := service.EncryptDEK(ctx, keyID, dek)
+	require.NoError(t, err)
+
+	// Primary outage: the secondary unwraps the DEK
+	primary.down = true
+	plaintext, err := service.DecryptDEK(ctx, keyID, ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, dek, plaintext)
+
+	statuses := healthStatuses(t, service)
+	assert.Equal(t, encx.HealthStatusDegraded, statuses["multi-kms"])
+	assert.Equal(t, encx.HealthStatusUnhealthy, statuses["multi-kms/primary"])
+	assert.Equal(t, encx.HealthStatusHealthy, statuses["multi-kms/secondary"])
+
+	// Total outage
+	secondary.down = true
+	_, err = service.DecryptDEK(ctx, keyID, ciphertext)
+	assert.True(t, errors.Is(err, encx.ErrDecryptionFailed))
+	assert.True(t, errors.Is(err, errProviderDown))
+
+	statuses = healthStatuses(t, service)
+	assert.Equal(t, encx.HealthStatusUnhealthy, statuses["multi-kms"])
+
+	// Recovery
+	primary.down = false
+	secondary.down = false
+	_, err = service.DecryptDEK(ctx, keyID, ciphertext)
+	require.NoError(t, err)
+	_, err = service.EncryptDEK(ctx, keyID, dek)
+	require.NoError(t, err)
+
+	statuses = healthStatuses(t, service)
+	assert.Equal(t, encx.HealthStatusHealthy, statuses["multi-kms"])
+}
+
+func TestKMSService_MinWrapped(t *testing.T) {
+	ctx := context.Background()
+	dek := []byte("0123456789abcdef0123456789abcdef")
+
+	t.Run("all providers required by default", func(t *testing.T) {
+		service, _, secondary := newTestService(t, 0)
+		keyID, err := service.GetKeyID(ctx, "my-kek")
+		require.NoError(t, err)
+
+		secondary.down = true
+		_, err = service.EncryptDEK(ctx, keyID, dek)
+		assert.True(t, errors.Is(err, encx.ErrEncryptionFailed))
+		assert.True(t, errors.Is(err, errProviderDown))
+	})
+
+	t.Run("partial wrapping allowed", func(t *testing.T) {
+		service, primary, secondary := newTestService(t, 1)
+		keyID, err := service.GetKeyID(ctx, "my-kek")
+		require.NoError(t, err)
+
+		primary.down = true
+		ciphertext, err := service.EncryptDEK(ctx, keyID, dek)
+		require.NoError(t, err)
+
+		var blob wrappedDEKBlob
+		require.NoError(t, json.Unmarshal(ciphertext, &blob))
+		require.Len(t, blob.Wraps, 1)
+		assert.Equal(t, "secondary", blob.Wraps[0].Provider)
+
+		// The DEK is only recoverable through the provider that wrapped it
+		primary.down = false
+		secondary.down = true
+		_, err = service.DecryptDEK(ctx, keyID, ciphertext)
+		assert.True(t, errors.Is(err, encx.ErrDecryptionFailed))
+	})
+}
+
+func TestKMSService_CreateKey(t *testing.T) {
+	service, _, _ := newTestService(t, 0)
+	ctx := context.Background()
+
+	keyID, err := service.CreateKey(ctx, "my-kek")
+	require.NoError(t, err)
+
+	dek := []byte("0123456789abcdef0123456789abcdef")
+	ciphertext, err := service.EncryptDEK(ctx, keyID, dek)
+	require.NoError(t, err)
+
+	plaintext, err := service.DecryptDEK(ctx, keyID, ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, dek, plaintext)
+}
+
+func TestKMSService_InvalidInput(t *testing.T) {
+	service, _, _ := newTestService(t, 0)
+	ctx := context.Background()
+
+	keyID, err := service.GetKeyID(ctx, "my-kek")
+	require.NoError(t, err)
+
+	_, err = service.EncryptDEK(ctx, keyID, nil)
+	assert.True(t, errors.Is(err, encx.ErrEncryptionFailed))
+
+	_, err = service.EncryptDEK(ctx, "not-json", []byte("dek"))
+	assert.True(t, errors.Is(err, encx.ErrInvalidConfiguration))
+
+	_, err = service.DecryptDEK(ctx, keyID, []byte("not-json"))
+	assert.True(t, errors.Is(err, encx.ErrDecryptionFailed))
+
+	_, err = service.DecryptDEK(ctx, keyID, []byte(`{"version":99,"wraps":[]}`))
+	assert.True(t, errors.Is(err, encx.ErrDecryptionFailed))
+}
+
+func TestKMSService_WithCrypto(t *testing.T) {
+	service, primary, _ := newTestService(t, 0)
+	ctx := context.Background()
+
+	crypto, err := encx.NewCrypto(ctx, service, encx.NewInMemorySecretStore(), encx.Config{
+		KEKAlias:    "my-kek",
+		PepperAlias: "multi-test",
+		DBPath:      t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	dek, err := crypto.GenerateDEK()
+	require.NoError(t, err)
+
+	encryptedDEK, err := crypto.EncryptDEK(ctx, dek)
+	require.NoError(t, err)
+
+	primary.down = true
+	decryptedDEK, err := crypto.DecryptDEKWithVersion(ctx, encryptedDEK, 1)
+	require.NoError(t, err)
+	assert.Equal(t, dek, decryptedDEK)
+}
+
+func TestKMSService_RegisterHealthChecks(t *testing.T) {
+	service, _, _ := newTestService(t, 0)
+	checker := encx.NewHealthChecker("test", "1.0.0")
+
+	require.NoError(t, service.RegisterHealthChecks(checker))
+
+	report := checker.CheckHealth(context.Background())
+	assert.Equal(t, encx.HealthStatusHealthy, report.Status)
+	assert.Len(t, report.Results, 3)
+}
@@ -0,0 +1,86 @@
+package aws
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/hengadev/encx"
+	"github.com/hengadev/encx/encxtest"
+)
+
+// fakeSecretsManagerClient is a stateful in-memory AWS Secrets Manager.
+type fakeSecretsManagerClient struct {
+	mu      sync.RWMutex
+	secrets map[string]string
+}
+
+func newFakeSecretsManagerClient() *fakeSecretsManagerClient {
+	return &fakeSecretsManagerClient{secrets: make(map[string]string)}
+}
+
+func (f *fakeSecretsManagerClient) CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := aws.ToString(params.Name)
+	if _, ok := f.secrets[name]; ok {
+		return nil, &types.ResourceExistsException{Message: aws.String("secret already exists: " + name)}
+	}
+	f.secrets[name] = aws.ToString(params.SecretString)
+	return &secretsmanager.CreateSecretOutput{Name: params.Name}, nil
+}
+
+func (f *fakeSecretsManagerClient) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	value, ok := f.secrets[aws.ToString(params.SecretId)]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("secret not found")}
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(value)}, nil
+}
+
+func (f *fakeSecretsManagerClient) PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := aws.ToString(params.SecretId)
+	if _, ok := f.secrets[name]; !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("secret not found")}
+	}
+	f.secrets[name] = aws.ToString(params.SecretString)
+	return &secretsmanager.PutSecretValueOutput{Name: params.SecretId}, nil
+}
+
+func (f *fakeSecretsManagerClient) DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if _, ok := f.secrets[aws.ToString(params.SecretId)]; !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("secret not found")}
+	}
+	return &secretsmanager.DescribeSecretOutput{Name: params.SecretId}, nil
+}
+
+func TestSecretsManagerStore_Conformance(t *testing.T) {
+	encxtest.RunSecretStoreConformance(t, func(t *testing.T) encx.SecretManagementService {
+		return &SecretsManagerStore{client: newFakeSecretsManagerClient(), region: "us-east-1"}
+	})
+}
@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/hengadev/encx/providers/secrets/file"
+)
+
+// DefaultTTL is the default time a cached pepper is served without contacting the underlying store.
+const DefaultTTL = time.Hour
+
+// Config holds configuration for the caching secret store.
+type Config struct {
+	// TTL is how long a cached pepper is served without contacting the underlying
+	// store. After the TTL, GetPepper refreshes the pepper; if the refresh fails,
+	// the cached pepper keeps being served until MaxStaleness. Default: DefaultTTL.
+	TTL time.Duration
+
+	// RefreshInterval enables background refresh of every cached pepper (optional).
+	// Set it below TTL so that reads never wait for the underlying store.
+	RefreshInterval time.Duration
+
+	// MaxStaleness is the maximum age of a cached pepper (optional). Once a pepper
+	// is older and cannot be refreshed, GetPepper fails closed with
+	// encx.ErrSecretStorageUnavailable. Zero means no limit. Must not be below TTL.
+	MaxStaleness time.Duration
+
+	// DiskCache enables a local disk cache that survives restarts (optional),
+	// e.g. /tmp on serverless platforms. KMS and KeyID are required: peppers
+	// are always encrypted on disk.
+	DiskCache *file.Config
+}
@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/hengadev/encx"
+	"github.com/hengadev/encx/encxtest"
+	"github.com/hengadev/encx/providers/secrets/file"
+)
+
+func TestCachingStore_Conformance(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		encxtest.RunSecretStoreConformance(t, func(t *testing.T) encx.SecretManagementService {
+			c, _ := newTestStore(t, encx.NewInMemorySecretStore(), Config{})
+			return c
+		})
+	})
+
+	t.Run("DiskCache", func(t *testing.T) {
+		encxtest.RunSecretStoreConformance(t, func(t *testing.T) encx.SecretManagementService {
+			c, _ := newTestStore(t, encx.NewInMemorySecretStore(), Config{
+				DiskCache: &file.Config{Dir: t.TempDir(), KMS: encx.NewSimpleTestKMS(), KeyID: "test-key-id"},
+			})
+			return c
+		})
+	})
+}
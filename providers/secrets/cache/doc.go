@@ -0,0 +1,39 @@
+// Package cache provides a caching, read-through decorator for any SecretManagementService.
+//
+// This package implements the encx.SecretManagementService interface on top of another
+// SecretManagementService, so that encx.NewCrypto does not hit the remote secret store
+// on every call (e.g. on every serverless cold start).
+//
+// # Features
+//
+//   - Memory cache backed by SecureBuffer, zeroed on replacement and Close
+//   - Single flight: concurrent misses result in one call to the underlying store
+//   - Optional KMS-encrypted disk cache that survives restarts
+//   - Background refresh
+//   - Fail closed once a pepper is older than MaxStaleness
+//   - Staleness metrics (Stats) and a "secret-cache" health check
+//
+// # Basic Usage
+//
+//	secrets, err := cache.NewCachingStore(remoteStore, cache.Config{
+//	    TTL:             time.Hour,
+//	    RefreshInterval: 30 * time.Minute,
+//	    MaxStaleness:    24 * time.Hour,
+//	})
+//	if err != nil {
+//	    // handle error
+//	}
+//	defer secrets.Close()
+//
+//	crypto, err := encx.NewCrypto(ctx, kmsService, secrets, encx.Config{
+//	    KEKAlias:    "my-app-kek",
+//	    PepperAlias: "my-app-pepper",
+//	})
+//
+// # Staleness
+//
+// A pepper younger than TTL is served without contacting the underlying store. An
+// older pepper is refreshed on read; if the underlying store fails, the cached pepper
+// keeps being served until it is older than MaxStaleness, after which GetPepper
+// returns encx.ErrSecretStorageUnavailable.
+package cache
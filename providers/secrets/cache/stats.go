@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hengadev/encx"
+)
+
+// Stats is a snapshot of the cache counters and of the staleness of each cached pepper.
+type Stats struct {
+	// Hits counts GetPepper calls served from the cache without contacting the underlying store.
+	Hits uint64
+	// Misses counts GetPepper calls for peppers that were not cached.
+	Misses uint64
+	// DiskHits counts peppers loaded from the disk cache.
+	DiskHits uint64
+	// Refreshes counts fetches from the underlying store, including failed ones.
+	Refreshes uint64
+	// RefreshFailures counts failed fetches from the underlying store.
+	RefreshFailures uint64
+
+	// Entries describes each cached pepper, sorted by alias.
+	Entries []EntryStats
+}
+
+// EntryStats describes the staleness of a cached pepper.
+type EntryStats struct {
+	Alias string
+
+	// Age is the time since the pepper was last fetched from the underlying store.
+	Age time.Duration
+
+	// Stale is true once Age exceeds the TTL.
+	Stale bool
+
+	// Expired is true once Age exceeds MaxStaleness: GetPepper fails closed until
+	// the pepper can be refreshed.
+	Expired bool
+
+	// LastRefreshError is the error of the last failed refresh since the last successful one.
+	LastRefreshError   error
+	LastRefreshAttempt time.Time
+}
+
+// Stats returns the cache counters and the staleness of each cached pepper.
+func (c *CachingStore) Stats() Stats {
+	stats := Stats{
+		Hits:            c.hits.Load(),
+		Misses:          c.misses.Load(),
+		DiskHits:        c.diskHits.Load(),
+		Refreshes:       c.refreshes.Load(),
+		RefreshFailures: c.refreshFailures.Load(),
+	}
+
+	now := c.now()
+	c.mu.RLock()
+	for alias, e := range c.entries {
+		age := now.Sub(e.fetchedAt)
+		stats.Entries = append(stats.Entries, EntryStats{
+			Alias:              alias,
+			Age:                age,
+			Stale:              age > c.ttl,
+			Expired:            c.maxStaleness > 0 && age > c.maxStaleness,
+			LastRefreshError:   e.lastRefreshError,
+			LastRefreshAttempt: e.lastRefreshAttempt,
+		})
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(stats.Entries, func(i, j int) bool {
+		return stats.Entries[i].Alias < stats.Entries[j].Alias
+	})
+	return stats
+}
+
+// HealthChecks returns health checks describing the cache.
+//
+// The "secret-cache" check is critical and reports:
+//   - healthy when every cached pepper is younger than the TTL
+//   - degraded when a pepper is stale but still served (the underlying store is failing)
+//   - unhealthy when a pepper is older than MaxStaleness (GetPepper fails closed)
+//
+// The check is passive: it does not call the underlying store.
+func (c *CachingStore) HealthChecks() []*encx.HealthCheck {
+	return []*encx.HealthCheck{
+		{
+			Name:        "secret-cache",
+			Description: "Staleness of cached peppers",
+			Critical:    true,
+			Timeout:     time.Second,
+			CheckFunc: func(ctx context.Context) (encx.HealthStatus, error) {
+				var stale, expired []string
+				for _, entry := range c.Stats().Entries {
+					switch {
+					case entry.Expired:
+						expired = append(expired, entry.Alias)
+					case entry.Stale:
+						stale = append(stale, entry.Alias)
+					}
+				}
+
+				switch {
+				case len(expired) > 0:
+					return encx.HealthStatusUnhealthy, fmt.Errorf("peppers older than max staleness: %v", expired)
+				case len(stale) > 0:
+					return encx.HealthStatusDegraded, fmt.Errorf("stale peppers: %v", stale)
+				default:
+					return encx.HealthStatusHealthy, nil
+				}
+			},
+		},
+	}
+}
+
+// RegisterHealthChecks registers all checks returned by HealthChecks with the given checker.
+//
+// Usage:
+//
+//	checker := encx.NewHealthChecker("my-service", "1.0.0")
+//	if err := secrets.RegisterHealthChecks(checker); err != nil {
+//	    log.Fatal(err)
+//	}
+func (c *CachingStore) RegisterHealthChecks(checker *encx.HealthChecker) error {
+	for _, check := range c.HealthChecks() {
+		if err := checker.RegisterCheck(check); err != nil {
+			return fmt.Errorf("failed to register health check %s: %w", check.Name, err)
+		}
+	}
+	return nil
+}
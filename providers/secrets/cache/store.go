@@ -0,0 +1,404 @@
+// Package cache provides a caching, read-through decorator for any SecretManagementService.
+//
+// This provider implements the SecretManagementService interface on top of another
+// SecretManagementService, so that peppers are fetched from the remote store once
+// and then served from memory (and optionally from an encrypted disk cache).
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hengadev/encx"
+	"github.com/hengadev/encx/internal/security"
+	"github.com/hengadev/encx/providers/secrets/file"
+)
+
+// entry is a cached pepper.
+type entry struct {
+	pepper    *security.SecureBuffer
+	fetchedAt time.Time // last successful fetch from the underlying store
+
+	lastRefreshError   error
+	lastRefreshAttempt time.Time
+}
+
+// CachingStore implements encx.SecretManagementService by caching another
+// SecretManagementService.
+//
+// Peppers are held in process memory in a SecureBuffer, which is zeroed when the
+// pepper is replaced or the store is closed. Concurrent cache misses for the same
+// pepper result in a single call to the underlying store.
+type CachingStore struct {
+	store encx.SecretManagementService
+	disk  *file.FileStore
+
+	ttl          time.Duration
+	maxStaleness time.Duration
+	now          func() time.Time
+
+	mu      sync.RWMutex
+	entries map[string]*entry
+
+	fetchMu sync.Mutex // serializes fetches from the underlying store
+
+	hits            atomic.Uint64
+	misses          atomic.Uint64
+	diskHits        atomic.Uint64
+	refreshes       atomic.Uint64
+	refreshFailures atomic.Uint64
+
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewCachingStore wraps a SecretManagementService with a cache.
+//
+// Usage:
+//
+//	remote, err := awssecrets.NewSecretsManagerStore(ctx, awssecrets.Config{})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//
+//	secrets, err := cache.NewCachingStore(remote, cache.Config{
+//	    TTL:             time.Hour,
+//	    RefreshInterval: 30 * time.Minute,
+//	    MaxStaleness:    24 * time.Hour,
+//	    DiskCache: &file.Config{
+//	        Dir:   "/tmp/encx-cache",
+//	        KMS:   kms,
+//	        KeyID: kekID,
+//	    },
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer secrets.Close()
+//
+//	crypto, err := encx.NewCrypto(ctx, kms, secrets, cfg)
+func NewCachingStore(store encx.SecretManagementService, cfg Config) (*CachingStore, error) {
+	if store == nil {
+		return nil, fmt.Errorf("%w: underlying secret store is required", encx.ErrInvalidConfiguration)
+	}
+	if cfg.TTL < 0 || cfg.RefreshInterval < 0 || cfg.MaxStaleness < 0 {
+		return nil, fmt.Errorf("%w: cache durations cannot be negative", encx.ErrInvalidConfiguration)
+	}
+
+	ttl := cfg.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	if cfg.MaxStaleness > 0 && cfg.MaxStaleness < ttl {
+		return nil, fmt.Errorf("%w: max staleness (%s) must not be below TTL (%s)",
+			encx.ErrInvalidConfiguration, cfg.MaxStaleness, ttl)
+	}
+
+	c := &CachingStore{
+		store:        store,
+		ttl:          ttl,
+		maxStaleness: cfg.MaxStaleness,
+		now:          time.Now,
+		entries:      make(map[string]*entry),
+		done:         make(chan struct{}),
+	}
+
+	if cfg.DiskCache != nil {
+		if cfg.DiskCache.KMS == nil {
+			return nil, fmt.Errorf("%w: disk cache requires a KMS to encrypt peppers", encx.ErrInvalidConfiguration)
+		}
+		diskCfg := *cfg.DiskCache
+		diskCfg.ReadOnly = false
+		// The SecureBuffer entry is the only copy of the pepper kept in memory
+		diskCfg.DisableCache = true
+
+		disk, err := file.NewFileStore(diskCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create disk cache: %w", err)
+		}
+		c.disk = disk
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	if cfg.RefreshInterval > 0 {
+		go c.refreshLoop(ctx, cfg.RefreshInterval)
+	} else {
+		close(c.done)
+	}
+
+	return c, nil
+}
+
+// GetStoragePath returns the storage path of the underlying store.
+func (c *CachingStore) GetStoragePath(alias string) string {
+	return c.store.GetStoragePath(alias)
+}
+
+// StorePepper stores a pepper in the underlying store, then caches it.
+func (c *CachingStore) StorePepper(ctx context.Context, alias string, pepper []byte) error {
+	if err := c.store.StorePepper(ctx, alias, pepper); err != nil {
+		return err
+	}
+	c.put(ctx, alias, pepper)
+	return nil
+}
+
+// GetPepper returns the cached pepper, fetching it from the underlying store on a
+// miss or once it is older than the TTL.
+//
+// If the underlying store is unavailable, a cached pepper keeps being served until
+// it is older than MaxStaleness; after that, GetPepper fails closed with
+// encx.ErrSecretStorageUnavailable.
+func (c *CachingStore) GetPepper(ctx context.Context, alias string) ([]byte, error) {
+	if pepper, ok := c.fresh(ctx, alias, false); ok {
+		c.hits.Add(1)
+		return pepper, nil
+	}
+
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+
+	// Another caller may have fetched the pepper while we were waiting
+	if pepper, ok := c.fresh(ctx, alias, true); ok {
+		c.hits.Add(1)
+		return pepper, nil
+	}
+
+	cached, fetchedAt, ok := c.cached(alias)
+	if !ok {
+		c.misses.Add(1)
+	}
+
+	pepper, err := c.fetch(ctx, alias)
+	if err == nil {
+		security.ZeroBytes(cached)
+		return pepper, nil
+	}
+
+	if !ok {
+		return nil, err
+	}
+
+	age := c.now().Sub(fetchedAt)
+	if c.maxStaleness > 0 && age > c.maxStaleness {
+		security.ZeroBytes(cached)
+		return nil, fmt.Errorf("%w: cached pepper for alias %s is %s old (max staleness %s) and refresh failed: %w",
+			encx.ErrSecretStorageUnavailable, alias, age.Round(time.Second), c.maxStaleness, err)
+	}
+
+	// Serve the stale pepper while the underlying store is unavailable
+	return cached, nil
+}
+
+// PepperExists reports whether a pepper is cached or exists in the underlying store.
+func (c *CachingStore) PepperExists(ctx context.Context, alias string) (bool, error) {
+	c.mu.RLock()
+	_, ok := c.entries[alias]
+	c.mu.RUnlock()
+	if ok {
+		return true, nil
+	}
+
+	if c.disk != nil {
+		if exists, err := c.disk.PepperExists(ctx, alias); err == nil && exists {
+			return true, nil
+		}
+	}
+
+	return c.store.PepperExists(ctx, alias)
+}
+
+// Refresh fetches a pepper from the underlying store and updates the cache.
+func (c *CachingStore) Refresh(ctx context.Context, alias string) error {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+
+	pepper, err := c.fetch(ctx, alias)
+	if err != nil {
+		return err
+	}
+	security.ZeroBytes(pepper)
+	return nil
+}
+
+// Invalidate removes a pepper from the memory and disk caches.
+func (c *CachingStore) Invalidate(alias string) {
+	c.mu.Lock()
+	if e, ok := c.entries[alias]; ok {
+		e.pepper.Finalize()
+		delete(c.entries, alias)
+	}
+	c.mu.Unlock()
+
+	if c.disk != nil {
+		os.Remove(c.disk.GetStoragePath(alias))
+	}
+}
+
+// Close stops background refresh and zeroes all cached peppers.
+//
+// The disk cache is kept so that it can be used after a restart. It is safe to
+// call Close more than once.
+func (c *CachingStore) Close() {
+	c.closeOnce.Do(func() {
+		c.cancel()
+		<-c.done
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for alias, e := range c.entries {
+			e.pepper.Finalize()
+			delete(c.entries, alias)
+		}
+	})
+}
+
+// fresh returns a copy of the cached pepper if it is younger than the TTL.
+// If useDisk is set, a pepper that is not in memory is loaded from the disk cache;
+// the caller must then hold fetchMu.
+func (c *CachingStore) fresh(ctx context.Context, alias string, useDisk bool) ([]byte, bool) {
+	pepper, fetchedAt, ok := c.cached(alias)
+	if !ok && useDisk {
+		pepper, fetchedAt, ok = c.loadFromDisk(ctx, alias)
+	}
+	if !ok {
+		return nil, false
+	}
+	if c.now().Sub(fetchedAt) > c.ttl {
+		security.ZeroBytes(pepper)
+		return nil, false
+	}
+	return pepper, true
+}
+
+// cached returns a copy of the pepper held in memory and the time it was fetched.
+func (c *CachingStore) cached(alias string) ([]byte, time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	e, ok := c.entries[alias]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	return e.pepper.Copy(), e.fetchedAt, true
+}
+
+// loadFromDisk loads a pepper from the disk cache into memory.
+//
+// The modification time of the cache file is the time the pepper was fetched.
+func (c *CachingStore) loadFromDisk(ctx context.Context, alias string) ([]byte, time.Time, bool) {
+	if c.disk == nil {
+		return nil, time.Time{}, false
+	}
+
+	info, err := os.Stat(c.disk.GetStoragePath(alias))
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	pepper, err := c.disk.GetPepper(ctx, alias)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	c.diskHits.Add(1)
+
+	fetchedAt := info.ModTime()
+	c.setEntry(alias, pepper, fetchedAt)
+	return pepper, fetchedAt, true
+}
+
+// fetch reads a pepper from the underlying store and caches it.
+// The caller must hold fetchMu.
+func (c *CachingStore) fetch(ctx context.Context, alias string) ([]byte, error) {
+	c.refreshes.Add(1)
+
+	pepper, err := c.store.GetPepper(ctx, alias)
+	if err != nil {
+		c.refreshFailures.Add(1)
+
+		c.mu.Lock()
+		if e, ok := c.entries[alias]; ok {
+			e.lastRefreshError = err
+			e.lastRefreshAttempt = c.now()
+		}
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	c.put(ctx, alias, pepper)
+	return pepper, nil
+}
+
+// put caches a pepper in memory and, if enabled, on disk.
+func (c *CachingStore) put(ctx context.Context, alias string, pepper []byte) {
+	now := c.now()
+	unchanged := c.setEntry(alias, pepper, now)
+
+	if c.disk == nil {
+		return
+	}
+
+	// Only re-encrypt when the pepper changed; otherwise just record the fetch time
+	path := c.disk.GetStoragePath(alias)
+	if unchanged && os.Chtimes(path, now, now) == nil {
+		return
+	}
+
+	// The disk cache is best effort: the pepper is still served from memory
+	if err := c.disk.StorePepper(ctx, alias, pepper); err == nil {
+		os.Chtimes(path, now, now)
+	}
+}
+
+// setEntry replaces the cached pepper of an alias, zeroing the previous one.
+// It reports whether the pepper is unchanged.
+func (c *CachingStore) setEntry(alias string, pepper []byte, fetchedAt time.Time) bool {
+	buf := security.NewSecureBuffer(len(pepper))
+	copy(buf.Bytes(), pepper)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	unchanged := false
+	if old, ok := c.entries[alias]; ok {
+		unchanged = security.ConstantTimeEq(old.pepper.Bytes(), pepper)
+		old.pepper.Finalize()
+	}
+	c.entries[alias] = &entry{pepper: buf, fetchedAt: fetchedAt}
+	return unchanged
+}
+
+// refreshLoop refreshes every cached pepper at the given interval until ctx is cancelled.
+func (c *CachingStore) refreshLoop(ctx context.Context, interval time.Duration) {
+	defer close(c.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.mu.RLock()
+			aliases := make([]string, 0, len(c.entries))
+			for alias := range c.entries {
+				aliases = append(aliases, alias)
+			}
+			c.mu.RUnlock()
+
+			for _, alias := range aliases {
+				// Failures are recorded in Stats and surface through the health check
+				if err := c.Refresh(ctx, alias); err != nil && errors.Is(err, context.Canceled) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hengadev/encx"
+	"github.com/hengadev/encx/providers/secrets/file"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStore is an in-memory secret store that counts GetPepper calls and can be made to fail.
+type countingStore struct {
+	encx.SecretManagementService
+	gets    atomic.Int64
+	failing atomic.Bool
+}
+
+func newCountingStore(t *testing.T, alias string) (*countingStore, []byte) {
+	t.Helper()
+
+	pepper := make([]byte, encx.PepperLength)
+	_, err := rand.Read(pepper)
+	require.NoError(t, err)
+
+	store := &countingStore{SecretManagementService: encx.NewInMemorySecretStore()}
+	require.NoError(t, store.StorePepper(context.Background(), alias, pepper))
+	return store, pepper
+}
+
+func (s *countingStore) GetPepper(ctx context.Context, alias string) ([]byte, error) {
+	s.gets.Add(1)
+	if s.failing.Load() {
+		return nil, fmt.Errorf("%w: throttled", encx.ErrSecretStorageUnavailable)
+	}
+	return s.SecretManagementService.GetPepper(ctx, alias)
+}
+
+// countingKMS counts the peppers decrypted by a KMS.
+type countingKMS struct {
+	encx.KeyManagementService
+	decrypts atomic.Int64
+}
+
+func (k *countingKMS) DecryptDEK(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	k.decrypts.Add(1)
+	return k.KeyManagementService.DecryptDEK(ctx, keyID, ciphertext)
+}
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestStore(t *testing.T, store encx.SecretManagementService, cfg Config) (*CachingStore, *fakeClock) {
+	t.Helper()
+
+	c, err := NewCachingStore(store, cfg)
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+
+	clock := &fakeClock{now: time.Now()}
+	c.now = clock.Now
+	return c, clock
+}
+
+func TestNewCachingStore_Validation(t *testing.T) {
+	store := encx.NewInMemorySecretStore()
+
+	tests := []struct {
+		name  string
+		store encx.SecretManagementService
+		cfg   Config
+	}{
+		{"nil store", nil, Config{}},
+		{"negative TTL", store, Config{TTL: -time.Second}},
+		{"max staleness below TTL", store, Config{TTL: time.Hour, MaxStaleness: time.Minute}},
+		{"disk cache without KMS", store, Config{DiskCache: &file.Config{Dir: t.TempDir()}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewCachingStore(tt.store, tt.cfg)
+			assert.ErrorIs(t, err, encx.ErrInvalidConfiguration)
+		})
+	}
+}
+
+func TestCachingStore_ServesFromMemory(t *testing.T) {
+	ctx := context.Background()
+	upstream, pepper := newCountingStore(t, "svc")
+	c, _ := newTestStore(t, upstream, Config{})
+
+	for i := 0; i < 3; i++ {
+		got, err := c.GetPepper(ctx, "svc")
+		require.NoError(t, err)
+		assert.Equal(t, pepper, got)
+	}
+
+	assert.EqualValues(t, 1, upstream.gets.Load())
+
+	stats := c.Stats()
+	assert.EqualValues(t, 2, stats.Hits)
+	assert.EqualValues(t, 1, stats.Misses)
+	assert.EqualValues(t, 1, stats.Refreshes)
+	require.Len(t, stats.Entries, 1)
+	assert.Equal(t, "svc", stats.Entries[0].Alias)
+	assert.False(t, stats.Entries[0].Stale)
+
+	// Callers cannot modify the cached pepper
+	got, err := c.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+	got[0] ^= 0xff
+	got, err = c.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+	assert.Equal(t, pepper, got)
+}
+
+func TestCachingStore_ConcurrentMissesFetchOnce(t *testing.T) {
+	upstream, pepper := newCountingStore(t, "svc")
+	c, _ := newTestStore(t, upstream, Config{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := c.GetPepper(context.Background(), "svc")
+			assert.NoError(t, err)
+			assert.Equal(t, pepper, got)
+		}()
+	}
+	wg.Wait()
+
+	assert.EqualValues(t, 1, upstream.gets.Load())
+}
+
+func TestCachingStore_RefreshesAfterTTL(t *testing.T) {
+	ctx := context.Background()
+	upstream, _ := newCountingStore(t, "svc")
+	c, clock := newTestStore(t, upstream, Config{TTL: time.Minute})
+
+	_, err := c.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+
+	clock.Advance(2 * time.Minute)
+	assert.True(t, c.Stats().Entries[0].Stale)
+
+	_, err = c.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, upstream.gets.Load())
+	assert.False(t, c.Stats().Entries[0].Stale)
+}
+
+func TestCachingStore_FailsClosedAfterMaxStaleness(t *testing.T) {
+	ctx := context.Background()
+	upstream, pepper := newCountingStore(t, "svc")
+	c, clock := newTestStore(t, upstream, Config{TTL: time.Minute, MaxStaleness: time.Hour})
+
+	_, err := c.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+
+	upstream.failing.Store(true)
+
+	// Stale but within MaxStaleness: the cached pepper is still served
+	clock.Advance(30 * time.Minute)
+	got, err := c.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+	assert.Equal(t, pepper, got)
+
+	entry := c.Stats().Entries[0]
+	assert.True(t, entry.Stale)
+	assert.False(t, entry.Expired)
+	assert.Error(t, entry.LastRefreshError)
+
+	// Beyond MaxStaleness: fail closed
+	clock.Advance(time.Hour)
+	_, err = c.GetPepper(ctx, "svc")
+	assert.ErrorIs(t, err, encx.ErrSecretStorageUnavailable)
+	assert.True(t, c.Stats().Entries[0].Expired)
+
+	// Recovers once the underlying store is back
+	upstream.failing.Store(false)
+	got, err = c.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+	assert.Equal(t, pepper, got)
+}
+
+func TestCachingStore_MissWithUnavailableStore(t *testing.T) {
+	upstream, _ := newCountingStore(t, "svc")
+	upstream.failing.Store(true)
+	c, _ := newTestStore(t, upstream, Config{})
+
+	_, err := c.GetPepper(context.Background(), "svc")
+	assert.ErrorIs(t, err, encx.ErrSecretStorageUnavailable)
+}
+
+func TestCachingStore_DiskCache(t *testing.T) {
+	ctx := context.Background()
+	upstream, pepper := newCountingStore(t, "svc")
+	kms := &countingKMS{KeyManagementService: encx.NewSimpleTestKMS()}
+	diskCfg := &file.Config{Dir: t.TempDir(), KMS: kms, KeyID: "test-key-id"}
+
+	first, _ := newTestStore(t, upstream, Config{DiskCache: diskCfg})
+	_, err := first.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+	first.Close()
+
+	// The pepper is encrypted on disk
+	data, err := os.ReadFile(first.disk.GetStoragePath("svc"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), string(pepper))
+
+	// A new process serves the pepper from disk without calling the underlying store
+	second, err := NewCachingStore(upstream, Config{DiskCache: diskCfg})
+	require.NoError(t, err)
+	defer second.Close()
+
+	got, err := second.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+	assert.Equal(t, pepper, got)
+	assert.EqualValues(t, 1, upstream.gets.Load())
+	assert.EqualValues(t, 1, second.Stats().DiskHits)
+	// The disk cache keeps no plaintext copy of the pepper outside the SecureBuffer,
+	// so reading it again decrypts the file again
+	decrypts := kms.decrypts.Load()
+	_, err = second.disk.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+	assert.Equal(t, decrypts+1, kms.decrypts.Load())
+
+	exists, err := second.PepperExists(ctx, "svc")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestCachingStore_StaleDiskCacheFailsClosed(t *testing.T) {
+	ctx := context.Background()
+	upstream, _ := newCountingStore(t, "svc")
+	diskCfg := &file.Config{Dir: t.TempDir(), KMS: encx.NewSimpleTestKMS(), KeyID: "test-key-id"}
+
+	first, _ := newTestStore(t, upstream, Config{DiskCache: diskCfg})
+	_, err := first.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(first.disk.GetStoragePath("svc"), old, old))
+
+	upstream.failing.Store(true)
+	second, err := NewCachingStore(upstream, Config{DiskCache: diskCfg, MaxStaleness: 24 * time.Hour})
+	require.NoError(t, err)
+	defer second.Close()
+
+	_, err = second.GetPepper(ctx, "svc")
+	assert.ErrorIs(t, err, encx.ErrSecretStorageUnavailable)
+}
+
+func TestCachingStore_BackgroundRefresh(t *testing.T) {
+	ctx := context.Background()
+	upstream, _ := newCountingStore(t, "svc")
+
+	c, err := NewCachingStore(upstream, Config{RefreshInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	_, err = c.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return upstream.gets.Load() >= 3
+	}, time.Second, 5*time.Millisecond)
+
+	c.Close()
+	gets := upstream.gets.Load()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, gets, upstream.gets.Load())
+
+	// Close zeroes cached peppers
+	assert.Empty(t, c.Stats().Entries)
+}
+
+func TestCachingStore_StorePepper(t *testing.T) {
+	ctx := context.Background()
+	upstream := &countingStore{SecretManagementService: encx.NewInMemorySecretStore()}
+	c, _ := newTestStore(t, upstream, Config{})
+
+	pepper := make([]byte, encx.PepperLength)
+	_, err := rand.Read(pepper)
+	require.NoError(t, err)
+	require.NoError(t, c.StorePepper(ctx, "svc", pepper))
+
+	got, err := c.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+	assert.Equal(t, pepper, got)
+	assert.EqualValues(t, 0, upstream.gets.Load())
+
+	stored, err := upstream.SecretManagementService.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+	assert.Equal(t, pepper, stored)
+}
+
+func TestCachingStore_HealthChecks(t *testing.T) {
+	ctx := context.Background()
+	upstream, _ := newCountingStore(t, "svc")
+	c, clock := newTestStore(t, upstream, Config{TTL: time.Minute, MaxStaleness: time.Hour})
+
+	check := c.HealthChecks()[0]
+	assert.Equal(t, "secret-cache", check.Name)
+
+	_, err := c.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+	status, err := check.CheckFunc(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, encx.HealthStatusHealthy, status)
+
+	clock.Advance(30 * time.Minute)
+	status, err = check.CheckFunc(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, encx.HealthStatusDegraded, status)
+
+	clock.Advance(time.Hour)
+	status, err = check.CheckFunc(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, encx.HealthStatusUnhealthy, status)
+
+	checker := encx.NewHealthChecker("test", "1.0.0")
+	require.NoError(t, c.RegisterHealthChecks(checker))
+}
+
+func TestCachingStore_WithCrypto(t *testing.T) {
+	ctx := context.Background()
+	upstream, pepper := newCountingStore(t, "svc")
+	c, _ := newTestStore(t, upstream, Config{})
+
+	for i := 0; i < 3; i++ {
+		crypto, err := encx.NewCrypto(ctx, encx.NewSimpleTestKMS(), c, encx.Config{
+			KEKAlias:    "test-kek",
+			PepperAlias: "svc",
+			DBPath:      t.TempDir(),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, pepper, crypto.GetPepper())
+	}
+
+	assert.EqualValues(t, 1, upstream.gets.Load())
+}
@@ -0,0 +1,17 @@
+package env
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/hengadev/encx"
+	"github.com/hengadev/encx/encxtest"
+)
+
+func TestEnvStore_Conformance(t *testing.T) {
+	encxtest.RunSecretStoreConformance(t, func(t *testing.T) encx.SecretManagementService {
+		return NewEnvStore()
+	}, encxtest.WithReadOnlyStore(func(t *testing.T, store encx.SecretManagementService, alias string, pepper []byte) {
+		t.Setenv(store.GetStoragePath(alias), base64.StdEncoding.EncodeToString(pepper))
+	}))
+}
@@ -0,0 +1,27 @@
+// Package env provides a read-only, environment-variable-based SecretManagementService for encx.
+//
+// This package implements the encx.SecretManagementService interface by reading
+// peppers from environment variables, as injected by most deployment platforms.
+//
+// # Basic Usage
+//
+//	import (
+//	    "github.com/hengadev/encx"
+//	    envsecrets "github.com/hengadev/encx/providers/secrets/env"
+//	)
+//
+//	// export ENCX_PEPPER_MY_APP="$(openssl rand -base64 32)"
+//	crypto, err := encx.NewCrypto(ctx, kmsService, envsecrets.NewEnvStore(), encx.Config{
+//	    KEKAlias:    "my-app-kek",
+//	    PepperAlias: "my-app",
+//	})
+//
+// # Pepper Storage
+//
+// The pepper of an alias is read from ENCX_PEPPER_<ALIAS> (see encx.EnvPepperVariableTemplate),
+// with the alias upper-cased and characters other than letters and digits replaced by
+// underscores. The value must be the base64 encoding of exactly 32 bytes.
+//
+// The store is read-only: StorePepper returns encx.ErrInvalidConfiguration, so the pepper
+// must be provisioned before encx.NewCrypto is called.
+package env
@@ -0,0 +1,110 @@
+// Package env provides a read-only, environment-variable-based SecretManagementService for encx.
+//
+// This provider implements the SecretManagementService interface by reading
+// base64-encoded peppers from environment variables.
+package env
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hengadev/encx"
+)
+
+// EnvStore implements encx.SecretManagementService using environment variables.
+//
+// The store is read-only: peppers must be provisioned up front (e.g., injected from
+// a secret manager by the deployment platform) as the base64 encoding of 32 random bytes:
+//
+//	export ENCX_PEPPER_USER_SERVICE="$(openssl rand -base64 32)"
+//
+// Environment variables are read on every call, so the store never holds a copy
+// of the pepper itself.
+type EnvStore struct{}
+
+// NewEnvStore creates a new environment variable secret store.
+//
+// Usage:
+//
+//	store := env.NewEnvStore()
+//	crypto, err := encx.NewCrypto(ctx, kmsService, store, encx.Config{
+//	    KEKAlias:    "my-app-kek",
+//	    PepperAlias: "user-service", // reads ENCX_PEPPER_USER_SERVICE
+//	})
+func NewEnvStore() *EnvStore {
+	return &EnvStore{}
+}
+
+// GetStoragePath returns the environment variable name for a given alias.
+//
+// The alias is upper-cased, and characters other than letters and digits are
+// replaced by underscores.
+//
+// Examples:
+//   - alias "my-service" → "ENCX_PEPPER_MY_SERVICE"
+//   - alias "payment.api" → "ENCX_PEPPER_PAYMENT_API"
+func (s *EnvStore) GetStoragePath(alias string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, alias)
+	return fmt.Sprintf(encx.EnvPepperVariableTemplate, name)
+}
+
+// StorePepper always fails: environment variables cannot be written durably.
+//
+// Returns encx.ErrInvalidConfiguration with the name of the variable to set.
+func (s *EnvStore) StorePepper(ctx context.Context, alias string, pepper []byte) error {
+	return fmt.Errorf("%w: environment secret store is read-only, set %s to a base64-encoded %d-byte pepper",
+		encx.ErrInvalidConfiguration, s.GetStoragePath(alias), encx.PepperLength)
+}
+
+// GetPepper reads a pepper from its environment variable.
+//
+// Returns an error if the variable is unset, is not valid base64, or does not
+// decode to exactly 32 bytes.
+func (s *EnvStore) GetPepper(ctx context.Context, alias string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", encx.ErrSecretStorageUnavailable, err)
+	}
+
+	name := s.GetStoragePath(alias)
+
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return nil, fmt.Errorf("%w: pepper not found for alias: %s (%s is not set)",
+			encx.ErrSecretStorageUnavailable, alias, name)
+	}
+
+	pepper, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode pepper from %s: %w",
+			encx.ErrSecretStorageUnavailable, name, err)
+	}
+
+	if len(pepper) != encx.PepperLength {
+		return nil, fmt.Errorf("%w: invalid pepper length in %s: expected %d bytes, got %d",
+			encx.ErrSecretStorageUnavailable, name, encx.PepperLength, len(pepper))
+	}
+
+	return pepper, nil
+}
+
+// PepperExists checks if the pepper environment variable is set and non-empty.
+func (s *EnvStore) PepperExists(ctx context.Context, alias string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("%w: %w", encx.ErrSecretStorageUnavailable, err)
+	}
+
+	value, ok := os.LookupEnv(s.GetStoragePath(alias))
+	return ok && value != "", nil
+}
@@ -0,0 +1,97 @@
+package env
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/hengadev/encx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvStore_GetStoragePath(t *testing.T) {
+	store := NewEnvStore()
+
+	assert.Equal(t, "ENCX_PEPPER_USER_SERVICE", store.GetStoragePath("user-service"))
+	assert.Equal(t, "ENCX_PEPPER_PAYMENT_API_V2", store.GetStoragePath("payment.api/v2"))
+	assert.Equal(t, "ENCX_PEPPER_MYAPP", store.GetStoragePath("MyApp"))
+}
+
+func TestEnvStore_GetPepper(t *testing.T) {
+	ctx := context.Background()
+	store := NewEnvStore()
+
+	pepper := make([]byte, encx.PepperLength)
+	_, err := rand.Read(pepper)
+	require.NoError(t, err)
+
+	t.Run("valid", func(t *testing.T) {
+		t.Setenv("ENCX_PEPPER_USER_SERVICE", base64.StdEncoding.EncodeToString(pepper)+"\n")
+
+		exists, err := store.PepperExists(ctx, "user-service")
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		got, err := store.GetPepper(ctx, "user-service")
+		require.NoError(t, err)
+		assert.Equal(t, pepper, got)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		exists, err := store.PepperExists(ctx, "missing-service")
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		_, err = store.GetPepper(ctx, "missing-service")
+		assert.ErrorIs(t, err, encx.ErrSecretStorageUnavailable)
+	})
+
+	t.Run("invalid base64", func(t *testing.T) {
+		t.Setenv("ENCX_PEPPER_USER_SERVICE", "not base64!")
+
+		_, err := store.GetPepper(ctx, "user-service")
+		assert.ErrorIs(t, err, encx.ErrSecretStorageUnavailable)
+	})
+
+	t.Run("invalid length", func(t *testing.T) {
+		t.Setenv("ENCX_PEPPER_USER_SERVICE", base64.StdEncoding.EncodeToString(pepper[:16]))
+
+		_, err := store.GetPepper(ctx, "user-service")
+		assert.ErrorIs(t, err, encx.ErrSecretStorageUnavailable)
+	})
+}
+
+func TestEnvStore_StorePepperIsReadOnly(t *testing.T) {
+	store := NewEnvStore()
+
+	err := store.StorePepper(context.Background(), "user-service", make([]byte, encx.PepperLength))
+	assert.ErrorIs(t, err, encx.ErrInvalidConfiguration)
+	assert.Contains(t, err.Error(), "ENCX_PEPPER_USER_SERVICE")
+}
+
+func TestEnvStore_WithCrypto(t *testing.T) {
+	ctx := context.Background()
+
+	pepper := make([]byte, encx.PepperLength)
+	_, err := rand.Read(pepper)
+	require.NoError(t, err)
+	t.Setenv("ENCX_PEPPER_SVC", base64.StdEncoding.EncodeToString(pepper))
+
+	crypto, err := encx.NewCrypto(ctx, encx.NewSimpleTestKMS(), NewEnvStore(), encx.Config{
+		KEKAlias:    "test-kek",
+		PepperAlias: "svc",
+		DBPath:      t.TempDir(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, pepper, crypto.GetPepper())
+
+	// Without the variable, NewCrypto fails instead of generating a pepper it cannot persist
+	_, err = encx.NewCrypto(ctx, encx.NewSimpleTestKMS(), NewEnvStore(), encx.Config{
+		KEKAlias:    "test-kek",
+		PepperAlias: "unset",
+		DBPath:      t.TempDir(),
+	})
+	assert.ErrorIs(t, err, encx.ErrInvalidConfiguration)
+}
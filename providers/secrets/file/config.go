@@ -0,0 +1,30 @@
+package file
+
+import "github.com/hengadev/encx"
+
+// Config holds configuration for the file secret store.
+type Config struct {
+	// Dir is the directory where peppers are stored, one file per alias
+	// (see encx.FilePepperNameTemplate). Required.
+	//
+	// For Kubernetes, this is the mount path of the Secret volume
+	// (e.g., "/etc/encx/secrets").
+	Dir string
+
+	// ReadOnly disables StorePepper. Set it for Kubernetes-mounted Secret
+	// volumes, which are read-only; the pepper must then be provisioned up front.
+	ReadOnly bool
+
+	// KMS optionally encrypts peppers at rest under a KEK (optional).
+	// When set, KeyID is required.
+	KMS encx.KeyManagementService
+
+	// KeyID is the KMS key ID of the KEK used to encrypt new peppers.
+	// Existing files are decrypted with the key ID recorded in the file.
+	KeyID string
+
+	// DisableCache makes GetPepper read (and decrypt) the file on every call instead
+	// of keeping the pepper in memory. Set it when the caller holds the pepper in
+	// memory itself, e.g. in a SecureBuffer, so that no other copy is kept.
+	DisableCache bool
+}
@@ -0,0 +1,45 @@
+package file
+
+import (
+	"encoding/base64"
+	"os"
+	"testing"
+
+	"github.com/hengadev/encx"
+	"github.com/hengadev/encx/encxtest"
+)
+
+func TestFileStore_Conformance(t *testing.T) {
+	newStore := func(t *testing.T, cfg Config) encx.SecretManagementService {
+		cfg.Dir = t.TempDir()
+		store, err := NewFileStore(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}
+
+	t.Run("Plain", func(t *testing.T) {
+		encxtest.RunSecretStoreConformance(t, func(t *testing.T) encx.SecretManagementService {
+			return newStore(t, Config{})
+		})
+	})
+
+	t.Run("KMS", func(t *testing.T) {
+		encxtest.RunSecretStoreConformance(t, func(t *testing.T) encx.SecretManagementService {
+			return newStore(t, Config{KMS: encx.NewSimpleTestKMS(), KeyID: "test-key-id"})
+		})
+	})
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		encxtest.RunSecretStoreConformance(t, func(t *testing.T) encx.SecretManagementService {
+			return newStore(t, Config{ReadOnly: true})
+		}, encxtest.WithReadOnlyStore(func(t *testing.T, store encx.SecretManagementService, alias string, pepper []byte) {
+			// Mounted secrets are provisioned by the platform, e.g. a Kubernetes Secret volume
+			data := []byte(base64.StdEncoding.EncodeToString(pepper) + "\n")
+			if err := os.WriteFile(store.GetStoragePath(alias), data, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}))
+	})
+}
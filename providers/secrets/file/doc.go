@@ -0,0 +1,45 @@
+// Package file provides a file-based SecretManagementService for encx.
+//
+// This package implements the encx.SecretManagementService interface by storing each
+// pepper in its own file, so that peppers survive restarts without a cloud secret manager.
+//
+// # Features
+//
+//   - Atomic writes (temporary file + rename) with 0600 permissions
+//   - Optional encryption at rest under a KeyManagementService KEK
+//   - Read-only mode for Kubernetes-mounted Secret volumes
+//   - In-memory cache, re-read when the file changes
+//
+// # Basic Usage
+//
+//	import (
+//	    "github.com/hengadev/encx"
+//	    filesecrets "github.com/hengadev/encx/providers/secrets/file"
+//	)
+//
+//	store, err := filesecrets.NewFileStore(filesecrets.Config{
+//	    Dir:   "/var/lib/myapp/secrets",
+//	    KMS:   kmsService, // optional
+//	    KeyID: "alias/myapp-pepper-kek",
+//	})
+//	if err != nil {
+//	    // handle error
+//	}
+//
+//	crypto, err := encx.NewCrypto(ctx, kmsService, store, encx.Config{
+//	    KEKAlias:    "my-app-kek",
+//	    PepperAlias: "my-app-pepper",
+//	})
+//
+// # Pepper Storage
+//
+// Peppers are stored at "{dir}/{alias}.pepper" (see encx.FilePepperNameTemplate). A file
+// may contain the raw 32-byte pepper, its base64 encoding, or a JSON envelope holding the
+// pepper encrypted under a KMS KEK.
+//
+// # Kubernetes
+//
+// Mount a Secret with a "{alias}.pepper" key and set Config.ReadOnly. The kubelet updates
+// Secret volumes by atomically swapping a symlink; the store detects the new file and
+// re-reads the pepper.
+package file
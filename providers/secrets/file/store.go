@@ -0,0 +1,369 @@
+// Package file provides a file-based SecretManagementService for encx.
+//
+// This provider implements the SecretManagementService interface by storing
+// peppers as files in a local or mounted directory.
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/hengadev/encx"
+)
+
+const (
+	// filePermissions is the permission mode of pepper files.
+	filePermissions = 0600
+
+	// dirPermissions is the permission mode of the pepper directory when it is created.
+	dirPermissions = 0700
+
+	// envelopeVersion is the version of the encrypted pepper file format.
+	envelopeVersion = 1
+)
+
+// encryptedPepper is the on-disk format of a pepper encrypted under a KMS KEK.
+type encryptedPepper struct {
+	Version    int    `json:"version"`
+	KMSKeyID   string `json:"kms_key_id"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// cachedPepper is a pepper read from disk, with the file state it was read from.
+type cachedPepper struct {
+	pepper []byte
+	info   os.FileInfo
+}
+
+// FileStore implements encx.SecretManagementService using files on disk.
+//
+// Each pepper is stored in its own file, named after its alias. Writes are atomic
+// (temporary file + rename) and files are created with 0600 permissions. Files
+// contain either the raw 32-byte pepper, its base64 encoding, or (when a KMS is
+// configured) the pepper encrypted under a KEK.
+//
+// Peppers are cached in memory and re-read when the file changes, which includes
+// Kubernetes updating a mounted Secret volume, unless Config.DisableCache is set.
+type FileStore struct {
+	dir      string
+	readOnly bool
+	kms      encx.KeyManagementService
+	keyID    string
+	noCache  bool
+
+	mu    sync.Mutex
+	cache map[string]cachedPepper
+}
+
+// NewFileStore creates a new file secret store.
+//
+// Usage:
+//
+//	// Plaintext peppers in a local directory
+//	store, err := file.NewFileStore(file.Config{Dir: "/var/lib/myapp/secrets"})
+//
+//	// Peppers encrypted under a KMS KEK
+//	store, err := file.NewFileStore(file.Config{
+//	    Dir:   "/var/lib/myapp/secrets",
+//	    KMS:   kmsService,
+//	    KeyID: "alias/myapp-pepper-kek",
+//	})
+//
+//	// Kubernetes-mounted Secret volume
+//	store, err := file.NewFileStore(file.Config{Dir: "/etc/encx/secrets", ReadOnly: true})
+//
+// The directory is created with 0700 permissions if it does not exist, unless the store is read-only.
+func NewFileStore(cfg Config) (*FileStore, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("%w: directory is required", encx.ErrInvalidConfiguration)
+	}
+	if cfg.KMS != nil && cfg.KeyID == "" {
+		return nil, fmt.Errorf("%w: KMS key ID is required when KMS encryption is enabled", encx.ErrInvalidConfiguration)
+	}
+
+	if cfg.ReadOnly {
+		info, err := os.Stat(cfg.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to access secret directory: %w", encx.ErrSecretStorageUnavailable, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%w: %s is not a directory", encx.ErrInvalidConfiguration, cfg.Dir)
+		}
+	} else if err := os.MkdirAll(cfg.Dir, dirPermissions); err != nil {
+		return nil, fmt.Errorf("%w: failed to create secret directory: %w", encx.ErrSecretStorageUnavailable, err)
+	}
+
+	return &FileStore{
+		dir:      cfg.Dir,
+		readOnly: cfg.ReadOnly,
+		kms:      cfg.KMS,
+		keyID:    cfg.KeyID,
+		noCache:  cfg.DisableCache,
+		cache:    make(map[string]cachedPepper),
+	}, nil
+}
+
+// GetStoragePath returns the file path for a given alias.
+//
+// Path format: "{dir}/{alias}.pepper"
+//
+// Examples:
+//   - alias "my-service" → "/etc/encx/secrets/my-service.pepper"
+//   - alias "payment-api" → "/etc/encx/secrets/payment-api.pepper"
+func (s *FileStore) GetStoragePath(alias string) string {
+	return filepath.Join(s.dir, fmt.Sprintf(encx.FilePepperNameTemplate, alias))
+}
+
+// StorePepper writes a pepper to disk.
+//
+// The file is written atomically with 0600 permissions: readers see either the
+// previous pepper or the new one, never a partial write. If a KMS is configured,
+// the pepper is encrypted under the KEK first.
+//
+// Returns encx.ErrInvalidConfiguration if the store is read-only.
+func (s *FileStore) StorePepper(ctx context.Context, alias string, pepper []byte) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %w", encx.ErrSecretStorageUnavailable, err)
+	}
+	if len(pepper) != encx.PepperLength {
+		return fmt.Errorf("%w: pepper must be exactly %d bytes, got %d",
+			encx.ErrInvalidConfiguration, encx.PepperLength, len(pepper))
+	}
+	if err := validateAlias(alias); err != nil {
+		return err
+	}
+	if s.readOnly {
+		return fmt.Errorf("%w: file secret store is read-only, provision the pepper at %s",
+			encx.ErrInvalidConfiguration, s.GetStoragePath(alias))
+	}
+
+	data, err := s.encode(ctx, alias, pepper)
+	if err != nil {
+		return err
+	}
+
+	path := s.GetStoragePath(alias)
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("%w: failed to write pepper file: %w", encx.ErrSecretStorageUnavailable, err)
+	}
+
+	s.mu.Lock()
+	delete(s.cache, alias)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// GetPepper reads a pepper from disk.
+//
+// The pepper is cached and only re-read (and decrypted) when the file changes,
+// unless the cache is disabled.
+//
+// Returns an error if the pepper doesn't exist or has invalid length.
+func (s *FileStore) GetPepper(ctx context.Context, alias string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", encx.ErrSecretStorageUnavailable, err)
+	}
+	if err := validateAlias(alias); err != nil {
+		return nil, err
+	}
+	path := s.GetStoragePath(alias)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: pepper not found for alias: %s", encx.ErrSecretStorageUnavailable, alias)
+		}
+		return nil, fmt.Errorf("%w: failed to stat pepper file: %w", encx.ErrSecretStorageUnavailable, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cached, ok := s.cache[alias]; ok && unchanged(cached, info) {
+		return bytes.Clone(cached.pepper), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read pepper file: %w", encx.ErrSecretStorageUnavailable, err)
+	}
+
+	pepper, err := s.decode(ctx, alias, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.noCache {
+		return pepper, nil
+	}
+	s.cache[alias] = cachedPepper{pepper: pepper, info: info}
+	return bytes.Clone(pepper), nil
+}
+
+// PepperExists checks if a pepper file exists.
+//
+// Returns true if the file exists, false if it doesn't.
+// Returns an error only for actual failures (not for "file not found").
+func (s *FileStore) PepperExists(ctx context.Context, alias string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("%w: %w", encx.ErrSecretStorageUnavailable, err)
+	}
+	if err := validateAlias(alias); err != nil {
+		return false, err
+	}
+
+	_, err := os.Stat(s.GetStoragePath(alias))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: failed to check if pepper exists: %w", encx.ErrSecretStorageUnavailable, err)
+}
+
+// encode returns the file content for a pepper: base64 text, or an encrypted
+// envelope if a KMS is configured.
+func (s *FileStore) encode(ctx context.Context, alias string, pepper []byte) ([]byte, error) {
+	if s.kms == nil {
+		return []byte(base64.StdEncoding.EncodeToString(pepper) + "\n"), nil
+	}
+
+	ciphertext, err := s.kms.EncryptDEK(pepperContext(ctx, alias), s.keyID, pepper)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to encrypt pepper: %w", encx.ErrEncryptionFailed, err)
+	}
+
+	data, err := json.Marshal(encryptedPepper{
+		Version:    envelopeVersion,
+		KMSKeyID:   s.keyID,
+		Ciphertext: ciphertext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to encode encrypted pepper: %w", encx.ErrEncryptionFailed, err)
+	}
+	return data, nil
+}
+
+// decode parses the content of a pepper file.
+//
+// Accepted formats are the raw 32-byte pepper, its base64 encoding (surrounding
+// whitespace is ignored, as written by "kubectl create secret --from-file"), and
+// the encrypted envelope written when a KMS is configured.
+func (s *FileStore) decode(ctx context.Context, alias string, data []byte) ([]byte, error) {
+	var pepper []byte
+
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(data) == encx.PepperLength:
+		pepper = bytes.Clone(data)
+
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var envelope encryptedPepper
+		if err := json.Unmarshal(trimmed, &envelope); err != nil {
+			return nil, fmt.Errorf("%w: invalid encrypted pepper file: %w", encx.ErrSecretStorageUnavailable, err)
+		}
+		if envelope.Version != envelopeVersion {
+			return nil, fmt.Errorf("%w: unsupported encrypted pepper file version %d",
+				encx.ErrSecretStorageUnavailable, envelope.Version)
+		}
+		if s.kms == nil {
+			return nil, fmt.Errorf("%w: pepper for alias %s is encrypted but no KMS is configured",
+				encx.ErrInvalidConfiguration, alias)
+		}
+
+		var err error
+		pepper, err = s.kms.DecryptDEK(pepperContext(ctx, alias), envelope.KMSKeyID, envelope.Ciphertext)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decrypt pepper: %w", encx.ErrDecryptionFailed, err)
+		}
+
+	default:
+		var err error
+		pepper, err = base64.StdEncoding.DecodeString(string(trimmed))
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decode pepper: %w", encx.ErrSecretStorageUnavailable, err)
+		}
+	}
+
+	if len(pepper) != encx.PepperLength {
+		return nil, fmt.Errorf("%w: invalid pepper length: expected %d bytes, got %d",
+			encx.ErrSecretStorageUnavailable, encx.PepperLength, len(pepper))
+	}
+	return pepper, nil
+}
+
+// pepperContext binds the pepper ciphertext to its alias through the KMS encryption context.
+func pepperContext(ctx context.Context, alias string) context.Context {
+	return encx.WithEncryptionContext(ctx, map[string]string{"pepper_alias": alias})
+}
+
+// unchanged reports whether a file still matches the state a pepper was cached from.
+//
+// os.Stat follows symlinks, so when Kubernetes swaps the "..data" symlink of a
+// mounted Secret volume, the pepper path resolves to a new file and is re-read.
+func unchanged(cached cachedPepper, info os.FileInfo) bool {
+	return os.SameFile(cached.info, info) &&
+		cached.info.ModTime().Equal(info.ModTime()) &&
+		cached.info.Size() == info.Size()
+}
+
+// validateAlias rejects aliases that would escape the secret directory.
+func validateAlias(alias string) error {
+	if alias == "" {
+		return fmt.Errorf("%w: alias cannot be empty", encx.ErrInvalidConfiguration)
+	}
+	if strings.ContainsAny(alias, `/\`) || alias == "." || alias == ".." {
+		return fmt.Errorf("%w: invalid alias %q", encx.ErrInvalidConfiguration, alias)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and
+// renames it over path, so that the file is never observed partially written.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op once renamed
+
+	if err := tmp.Chmod(filePermissions); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	// Persist the rename itself
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
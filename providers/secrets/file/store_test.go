@@ -0,0 +1,295 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hengadev/encx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPepper(t *testing.T) []byte {
+	t.Helper()
+	pepper := make([]byte, encx.PepperLength)
+	_, err := rand.Read(pepper)
+	require.NoError(t, err)
+	return pepper
+}
+
+func TestNewFileStore(t *testing.T) {
+	t.Run("creates directory", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "secrets")
+
+		_, err := NewFileStore(Config{Dir: dir})
+		require.NoError(t, err)
+
+		info, err := os.Stat(dir)
+		require.NoError(t, err)
+		assert.True(t, info.IsDir())
+		assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		_, err := NewFileStore(Config{})
+		assert.ErrorIs(t, err, encx.ErrInvalidConfiguration)
+	})
+
+	t.Run("read-only directory must exist", func(t *testing.T) {
+		_, err := NewFileStore(Config{Dir: filepath.Join(t.TempDir(), "missing"), ReadOnly: true})
+		assert.ErrorIs(t, err, encx.ErrSecretStorageUnavailable)
+	})
+
+	t.Run("KMS without key ID", func(t *testing.T) {
+		_, err := NewFileStore(Config{Dir: t.TempDir(), KMS: encx.NewSimpleTestKMS()})
+		assert.ErrorIs(t, err, encx.ErrInvalidConfiguration)
+	})
+}
+
+func TestFileStore_StoreAndGet(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileStore(Config{Dir: dir})
+	require.NoError(t, err)
+
+	exists, err := store.PepperExists(ctx, "user-service")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	pepper := newPepper(t)
+	require.NoError(t, store.StorePepper(ctx, "user-service", pepper))
+
+	exists, err = store.PepperExists(ctx, "user-service")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	got, err := store.GetPepper(ctx, "user-service")
+	require.NoError(t, err)
+	assert.Equal(t, pepper, got)
+
+	path := filepath.Join(dir, "user-service.pepper")
+	assert.Equal(t, path, store.GetStoragePath("user-service"))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestFileStore_Formats(t *testing.T) {
+	ctx := context.Background()
+	pepper := newPepper(t)
+
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"raw bytes", pepper},
+		{"base64", []byte(base64.StdEncoding.EncodeToString(pepper))},
+		{"base64 with newline", []byte(base64.StdEncoding.EncodeToString(pepper) + "\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "svc.pepper"), tt.content, 0600))
+
+			store, err := NewFileStore(Config{Dir: dir, ReadOnly: true})
+			require.NoError(t, err)
+
+			got, err := store.GetPepper(ctx, "svc")
+			require.NoError(t, err)
+			assert.Equal(t, pepper, got)
+		})
+	}
+
+	t.Run("invalid length", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "svc.pepper"),
+			[]byte(base64.StdEncoding.EncodeToString([]byte("too-short"))), 0600))
+
+		store, err := NewFileStore(Config{Dir: dir})
+		require.NoError(t, err)
+
+		_, err = store.GetPepper(ctx, "svc")
+		assert.ErrorIs(t, err, encx.ErrSecretStorageUnavailable)
+	})
+
+	t.Run("missing pepper", func(t *testing.T) {
+		store, err := NewFileStore(Config{Dir: t.TempDir()})
+		require.NoError(t, err)
+
+		_, err = store.GetPepper(ctx, "svc")
+		assert.ErrorIs(t, err, encx.ErrSecretStorageUnavailable)
+	})
+}
+
+func TestFileStore_KMSEncryption(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	kms := encx.NewSimpleTestKMS()
+
+	store, err := NewFileStore(Config{Dir: dir, KMS: kms, KeyID: "test-key-id"})
+	require.NoError(t, err)
+
+	pepper := newPepper(t)
+	require.NoError(t, store.StorePepper(ctx, "svc", pepper))
+
+	// The pepper is not stored in the clear
+	data, err := os.ReadFile(store.GetStoragePath("svc"))
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(data, pepper))
+	assert.NotContains(t, string(data), base64.StdEncoding.EncodeToString(pepper))
+
+	got, err := store.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+	assert.Equal(t, pepper, got)
+
+	t.Run("bound to alias", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(store.GetStoragePath("other"), data, 0600))
+
+		_, err := store.GetPepper(ctx, "other")
+		assert.ErrorIs(t, err, encx.ErrDecryptionFailed)
+	})
+
+	t.Run("requires KMS to read", func(t *testing.T) {
+		plain, err := NewFileStore(Config{Dir: dir})
+		require.NoError(t, err)
+
+		_, err = plain.GetPepper(ctx, "svc")
+		assert.ErrorIs(t, err, encx.ErrInvalidConfiguration)
+	})
+}
+
+func TestFileStore_ReadOnly(t *testing.T) {
+	store, err := NewFileStore(Config{Dir: t.TempDir(), ReadOnly: true})
+	require.NoError(t, err)
+
+	err = store.StorePepper(context.Background(), "svc", newPepper(t))
+	assert.ErrorIs(t, err, encx.ErrInvalidConfiguration)
+}
+
+func TestFileStore_InvalidAlias(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+
+	for _, alias := range []string{"", "..", "../escape", `a\b`} {
+		err := store.StorePepper(ctx, alias, newPepper(t))
+		assert.ErrorIs(t, err, encx.ErrInvalidConfiguration, "alias %q", alias)
+
+		_, err = store.GetPepper(ctx, alias)
+		assert.ErrorIs(t, err, encx.ErrInvalidConfiguration, "alias %q", alias)
+	}
+}
+
+func TestFileStore_ReloadsChangedFile(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "svc.pepper")
+
+	first := newPepper(t)
+	require.NoError(t, os.WriteFile(path, first, 0600))
+
+	store, err := NewFileStore(Config{Dir: dir, ReadOnly: true})
+	require.NoError(t, err)
+
+	got, err := store.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+	assert.Equal(t, first, got)
+
+	second := newPepper(t)
+	require.NoError(t, os.WriteFile(path, second, 0600))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, future, future))
+
+	got, err = store.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+	assert.Equal(t, second, got)
+}
+
+func TestFileStore_DisableCache(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileStore(Config{Dir: dir, KMS: encx.NewSimpleTestKMS(), KeyID: "test-key-id", DisableCache: true})
+	require.NoError(t, err)
+
+	pepper := newPepper(t)
+	require.NoError(t, store.StorePepper(ctx, "svc", pepper))
+	got, err := store.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+	assert.Equal(t, pepper, got)
+
+	// No plaintext copy of the pepper is kept
+	assert.Empty(t, store.cache)
+}
+
+// TestFileStore_KubernetesSecretVolume simulates how the kubelet updates a mounted
+// Secret: keys are symlinks through "..data", which is atomically swapped to a new
+// timestamped directory.
+func TestFileStore_KubernetesSecretVolume(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	writeVersion := func(name string, pepper []byte) {
+		versionDir := filepath.Join(dir, name)
+		require.NoError(t, os.Mkdir(versionDir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(versionDir, "svc.pepper"),
+			[]byte(base64.StdEncoding.EncodeToString(pepper)), 0644))
+
+		tmpLink := filepath.Join(dir, "..data_tmp")
+		require.NoError(t, os.Symlink(name, tmpLink))
+		require.NoError(t, os.Rename(tmpLink, filepath.Join(dir, "..data")))
+	}
+
+	first := newPepper(t)
+	writeVersion("..2024_01_01_00_00_00.1", first)
+	require.NoError(t, os.Symlink(filepath.Join("..data", "svc.pepper"), filepath.Join(dir, "svc.pepper")))
+
+	store, err := NewFileStore(Config{Dir: dir, ReadOnly: true})
+	require.NoError(t, err)
+
+	got, err := store.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+	assert.Equal(t, first, got)
+
+	second := newPepper(t)
+	writeVersion("..2024_01_02_00_00_00.2", second)
+
+	got, err = store.GetPepper(ctx, "svc")
+	require.NoError(t, err)
+	assert.Equal(t, second, got)
+}
+
+func TestFileStore_WithCrypto(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	newCrypto := func() *encx.Crypto {
+		store, err := NewFileStore(Config{Dir: filepath.Join(dir, "secrets")})
+		require.NoError(t, err)
+
+		crypto, err := encx.NewCrypto(ctx, encx.NewSimpleTestKMS(), store, encx.Config{
+			KEKAlias:    "test-kek",
+			PepperAlias: "svc",
+			DBPath:      dir,
+		})
+		require.NoError(t, err)
+		return crypto
+	}
+
+	// The pepper generated on first start is reused after a restart
+	first := newCrypto().GetPepper()
+	second := newCrypto().GetPepper()
+	assert.Equal(t, first, second)
+}
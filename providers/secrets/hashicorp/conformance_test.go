@@ -0,0 +1,76 @@
+package hashicorp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hengadev/encx"
+	"github.com/hengadev/encx/encxtest"
+)
+
+// fakeKV is a minimal stateful Vault KV v2 engine mounted at "secret".
+type fakeKV struct {
+	mu      sync.Mutex
+	secrets map[string]map[string]interface{}
+}
+
+func newFakeKVStore(t *testing.T) *KVStore {
+	t.Helper()
+
+	fake := &fakeKV{secrets: make(map[string]map[string]interface{})}
+	server := httptest.NewServer(http.HandlerFunc(fake.handle))
+	t.Cleanup(server.Close)
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &KVStore{client: client}
+}
+
+func (f *fakeKV) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")
+	switch r.Method {
+	case http.MethodGet:
+		data, ok := f.secrets[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"data": data},
+		})
+
+	case http.MethodPut, http.MethodPost:
+		var body struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.secrets[path] = body.Data
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestKVStore_Conformance(t *testing.T) {
+	encxtest.RunSecretStoreConformance(t, func(t *testing.T) encx.SecretManagementService {
+		return newFakeKVStore(t)
+	})
+}
@@ -41,7 +41,7 @@
 //
 //	// Required
 //	export VAULT_ADDR="https://vault.example.com:8200"
-//	export VAULT_TOKEN="hvs.your-token-here"
+//	export VAULT_TOKEN="hvs.your-token-here"  // or VAULT_ROLE_ID+VAULT_SECRET_ID, VAULT_K8S_ROLE, VAULT_CERT_ROLE
 //
 //	// Optional
 //	export VAULT_NAMESPACE="my-namespace"  // For Vault Enterprise
@@ -128,12 +128,24 @@
 //
 // # Automatic Token Renewal
 //
-// The KVStore automatically renews Vault tokens in the background.
+// The KVStore automatically renews Vault tokens in the background and
+// re-authenticates when a token reaches its maximum TTL (see providers/vault).
 // Always call Close() when shutting down to stop the renewal goroutine:
 //
 //	kv, _ := vaultkv.NewKVStore()
 //	defer kv.Close()  // IMPORTANT: Stops token renewal
 //
+// To configure authentication in code (AppRole, Kubernetes, TLS certificate) or to
+// share one client between the Transit and KV providers, create a vault.Client and
+// pass it to NewKVStoreWithClient. The caller then owns the client:
+//
+//	client, err := vault.NewClient(ctx, vault.Config{
+//	    Auth: &vault.KubernetesAuth{Role: "my-app"},
+//	})
+//	defer client.Close()
+//
+//	kv := vaultkv.NewKVStoreWithClient(client)
+//
 // # Testing
 //
 // For testing without Vault dependencies, use encx.NewTestCrypto():
@@ -7,6 +7,7 @@ import (
 
 	"github.com/hashicorp/vault/api"
 	"github.com/hengadev/encx"
+	"github.com/hengadev/encx/providers/vault"
 )
 
 // KVStore implements encx.SecretManagementService using HashiCorp Vault KV v2 Engine.
@@ -14,12 +15,15 @@ import (
 // This service stores peppers (secret values) in Vault's KV v2 secrets engine for
 // secure, versioned secret storage with audit logging.
 type KVStore struct {
-	client *api.Client
+	client     *api.Client
+	vault      *vault.Client
+	ownsClient bool
 }
 
 // NewKVStore creates a new KVStore instance.
 //
-// The service uses environment variables for configuration (see createVaultClient).
+// The service uses environment variables for configuration (see vault.ConfigFromEnvironment)
+// and owns its Vault client: Close stops token renewal.
 //
 // Usage:
 //
@@ -27,19 +31,41 @@ type KVStore struct {
 //	if err != nil {
 //	    log.Fatal(err)
 //	}
+//	defer kv.Close()
 //
 // The KV v2 engine must be enabled in Vault before use:
 //
 //	vault secrets enable -path=secret kv-v2
 func NewKVStore() (*KVStore, error) {
-	client, err := createVaultClient()
+	client, err := vault.NewClientFromEnvironment(context.Background())
 	if err != nil {
 		return nil, err
 	}
 
+	k := NewKVStoreWithClient(client)
+	k.ownsClient = true
+	return k, nil
+}
+
+// NewKVStoreWithClient creates a KVStore using an existing Vault client.
+//
+// Use it to configure authentication explicitly, or to share one client (and its
+// token lifecycle) with the Transit KMS provider. The caller remains responsible
+// for closing the client.
+func NewKVStoreWithClient(client *vault.Client) *KVStore {
 	return &KVStore{
-		client: client,
-	}, nil
+		client: client.API(),
+		vault:  client,
+	}
+}
+
+// Close stops background token renewal if the store owns its Vault client.
+//
+// Stores created with NewKVStoreWithClient leave the shared client open.
+func (k *KVStore) Close() {
+	if k.ownsClient && k.vault != nil {
+		k.vault.Close()
+	}
 }
 
 // GetStoragePath returns the Vault KV v2 path for a given alias.
@@ -82,7 +108,7 @@ func (k *KVStore) StorePepper(ctx context.Context, alias string, pepper []byte)
 		},
 	}
 
-	_, err := k.client.Logical().Write(path, data)
+	_, err := k.client.Logical().WriteWithContext(ctx, path, data)
 	if err != nil {
 		return fmt.Errorf("%w: failed to store pepper in Vault KV: %w",
 			encx.ErrSecretStorageUnavailable, err)
@@ -104,7 +130,7 @@ func (k *KVStore) StorePepper(ctx context.Context, alias string, pepper []byte)
 func (k *KVStore) GetPepper(ctx context.Context, alias string) ([]byte, error) {
 	path := k.GetStoragePath(alias)
 
-	secret, err := k.client.Logical().Read(path)
+	secret, err := k.client.Logical().ReadWithContext(ctx, path)
 	if err != nil {
 		return nil, fmt.Errorf("%w: failed to read pepper from Vault KV: %w",
 			encx.ErrSecretStorageUnavailable, err)
@@ -162,7 +188,7 @@ func (k *KVStore) GetPepper(ctx context.Context, alias string) ([]byte, error) {
 func (k *KVStore) PepperExists(ctx context.Context, alias string) (bool, error) {
 	path := k.GetStoragePath(alias)
 
-	secret, err := k.client.Logical().Read(path)
+	secret, err := k.client.Logical().ReadWithContext(ctx, path)
 	if err != nil {
 		// Vault returns an error for read failures, but nil secret for "not found"
 		return false, fmt.Errorf("%w: failed to check if pepper exists: %w",
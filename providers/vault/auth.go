@@ -0,0 +1,166 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// AuthMethod authenticates a Vault client and returns the resulting auth secret.
+//
+// It is an alias of api.AuthMethod, so the auth methods of the official
+// github.com/hashicorp/vault/api/auth/* modules can be used as well.
+//
+// Login is called once by NewClient, and again whenever the token can no
+// longer be renewed (re-authentication).
+type AuthMethod = api.AuthMethod
+
+// DefaultKubernetesJWTPath is the path of the projected service account token in Kubernetes pods.
+const DefaultKubernetesJWTPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// TokenAuth authenticates with a static Vault token.
+//
+// The token is looked up to learn its TTL and whether it is renewable; renewable
+// tokens are renewed in the background. A static token cannot be re-obtained once
+// it expires, so prefer AppRole or Kubernetes auth for long-running services.
+type TokenAuth struct {
+	Token string
+}
+
+// Login implements AuthMethod.
+func (a *TokenAuth) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	if a.Token == "" {
+		return nil, fmt.Errorf("token cannot be empty")
+	}
+	client.SetToken(a.Token)
+
+	secret := &api.Secret{Auth: &api.SecretAuth{ClientToken: a.Token}}
+
+	// Best effort: tokens without the lookup-self capability are treated as non-renewable
+	lookup, err := client.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil || lookup == nil {
+		return secret, nil
+	}
+	if renewable, err := lookup.TokenIsRenewable(); err == nil {
+		secret.Auth.Renewable = renewable
+	}
+	if ttl, err := lookup.TokenTTL(); err == nil {
+		secret.Auth.LeaseDuration = int(ttl.Seconds())
+	}
+	return secret, nil
+}
+
+// AppRoleAuth authenticates with the AppRole auth method.
+type AppRoleAuth struct {
+	// RoleID is the AppRole role ID.
+	RoleID string
+
+	// SecretID is the AppRole secret ID.
+	SecretID string
+
+	// SecretIDFile optionally reads the secret ID from a file at every login,
+	// e.g. when it is delivered by a trusted orchestrator. Takes precedence over SecretID.
+	SecretIDFile string
+
+	// MountPath is the mount path of the AppRole auth method. Defaults to "approle".
+	MountPath string
+}
+
+// Login implements AuthMethod.
+func (a *AppRoleAuth) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	if a.RoleID == "" {
+		return nil, fmt.Errorf("AppRole role ID cannot be empty")
+	}
+
+	secretID := a.SecretID
+	if a.SecretIDFile != "" {
+		data, err := os.ReadFile(a.SecretIDFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read AppRole secret ID file: %w", err)
+		}
+		secretID = strings.TrimSpace(string(data))
+	}
+	if secretID == "" {
+		return nil, fmt.Errorf("AppRole secret ID cannot be empty")
+	}
+
+	return client.Logical().WriteWithContext(ctx, loginPath(a.MountPath, "approle"), map[string]interface{}{
+		"role_id":   a.RoleID,
+		"secret_id": secretID,
+	})
+}
+
+// KubernetesAuth authenticates with the Kubernetes auth method using the pod's
+// service account JWT.
+type KubernetesAuth struct {
+	// Role is the Vault role bound to the service account.
+	Role string
+
+	// JWT optionally provides the service account token directly.
+	JWT string
+
+	// JWTPath is read at every login when JWT is empty, so that rotated projected
+	// tokens are picked up. Defaults to DefaultKubernetesJWTPath.
+	JWTPath string
+
+	// MountPath is the mount path of the Kubernetes auth method. Defaults to "kubernetes".
+	MountPath string
+}
+
+// Login implements AuthMethod.
+func (a *KubernetesAuth) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	if a.Role == "" {
+		return nil, fmt.Errorf("kubernetes auth role cannot be empty")
+	}
+
+	jwt := a.JWT
+	if jwt == "" {
+		path := a.JWTPath
+		if path == "" {
+			path = DefaultKubernetesJWTPath
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account token: %w", err)
+		}
+		jwt = strings.TrimSpace(string(data))
+	}
+
+	return client.Logical().WriteWithContext(ctx, loginPath(a.MountPath, "kubernetes"), map[string]interface{}{
+		"role": a.Role,
+		"jwt":  jwt,
+	})
+}
+
+// CertAuth authenticates with the TLS certificate auth method.
+//
+// The client certificate is presented during the TLS handshake, so it must be
+// configured through Config.TLS (or the VAULT_CLIENT_CERT and VAULT_CLIENT_KEY
+// environment variables).
+type CertAuth struct {
+	// Name optionally selects the certificate role to authenticate against.
+	Name string
+
+	// MountPath is the mount path of the cert auth method. Defaults to "cert".
+	MountPath string
+}
+
+// Login implements AuthMethod.
+func (a *CertAuth) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	data := map[string]interface{}{}
+	if a.Name != "" {
+		data["name"] = a.Name
+	}
+	return client.Logical().WriteWithContext(ctx, loginPath(a.MountPath, "cert"), data)
+}
+
+// loginPath returns the login path of an auth method mounted at mountPath.
+func loginPath(mountPath, defaultMountPath string) string {
+	if mountPath == "" {
+		mountPath = defaultMountPath
+	}
+	return fmt.Sprintf("auth/%s/login", strings.Trim(mountPath, "/"))
+}
@@ -0,0 +1,248 @@
+// Package vault provides a shared, authenticated HashiCorp Vault client.
+//
+// The client handles authentication (token, AppRole, Kubernetes, TLS certificate)
+// and the token lifecycle: renewable tokens are renewed in the background, and the
+// client re-authenticates when a token reaches its maximum TTL.
+package vault
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hengadev/encx"
+)
+
+const (
+	// minReauthBackoff and maxReauthBackoff bound the delay between failed re-authentication attempts.
+	minReauthBackoff = time.Second
+	maxReauthBackoff = time.Minute
+
+	// minTokenWatch is how long a token must last for the client to re-authenticate
+	// right away when it must be replaced. Tokens replaced sooner, such as tokens whose
+	// renewal fails, delay the next login by a backoff growing up to maxReauthBackoff.
+	minTokenWatch = 10 * time.Second
+)
+
+// Client is an authenticated Vault client with automatic token lifecycle management.
+//
+// A single Client can be shared by the Transit (keys) and KV (secrets) providers.
+type Client struct {
+	client *api.Client
+	auth   AuthMethod
+
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewClient creates a Vault client, authenticates it and starts background token renewal.
+//
+// Usage:
+//
+//	client, err := vault.NewClient(ctx, vault.Config{
+//	    Address: "https://vault.example.com:8200",
+//	    Auth:    &vault.KubernetesAuth{Role: "my-app"},
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer client.Close()
+//
+//	// keys "github.com/hengadev/encx/providers/keys/hashicorp"
+//	// secrets "github.com/hengadev/encx/providers/secrets/hashicorp"
+//	transit := keys.NewTransitServiceWithClient(client)
+//	kv := secrets.NewKVStoreWithClient(client)
+//
+// The context only bounds the initial login; call Close to stop background renewal.
+func NewClient(ctx context.Context, cfg Config) (*Client, error) {
+	if cfg.Auth == nil {
+		return nil, fmt.Errorf("%w: Vault auth method is required", encx.ErrInvalidConfiguration)
+	}
+
+	config := api.DefaultConfig()
+	if config.Error != nil {
+		return nil, fmt.Errorf("%w: invalid Vault environment configuration: %w", encx.ErrInvalidConfiguration, config.Error)
+	}
+	if cfg.Address != "" {
+		config.Address = cfg.Address
+	}
+	if config.Address == "" {
+		return nil, fmt.Errorf("%w: Vault address is required", encx.ErrInvalidConfiguration)
+	}
+	if cfg.TLS != nil {
+		if err := config.ConfigureTLS(cfg.TLS); err != nil {
+			return nil, fmt.Errorf("%w: invalid Vault TLS configuration: %w", encx.ErrInvalidConfiguration, err)
+		}
+	}
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create Vault client: %w", encx.ErrKMSUnavailable, err)
+	}
+	if cfg.Namespace != "" {
+		client.SetNamespace(cfg.Namespace)
+	}
+
+	secret, err := client.Auth().Login(ctx, cfg.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to authenticate with Vault: %w", encx.ErrAuthenticationFailed, err)
+	}
+
+	renewalCtx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		client: client,
+		auth:   cfg.Auth,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	if cfg.DisableRenewal {
+		close(c.done)
+	} else {
+		go c.manageTokenLifecycle(renewalCtx, secret)
+	}
+
+	return c, nil
+}
+
+// NewClientFromEnvironment creates a Vault client configured from environment variables.
+//
+// See ConfigFromEnvironment for the supported variables.
+func NewClientFromEnvironment(ctx context.Context) (*Client, error) {
+	cfg, err := ConfigFromEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(ctx, cfg)
+}
+
+// API returns the underlying Vault API client.
+func (c *Client) API() *api.Client {
+	return c.client
+}
+
+// Close stops background token renewal and waits for it to exit.
+//
+// Close does not revoke the token. It is safe to call Close more than once.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		c.cancel()
+		<-c.done
+	})
+}
+
+// manageTokenLifecycle keeps the client token valid until ctx is cancelled.
+func (c *Client) manageTokenLifecycle(ctx context.Context, secret *api.Secret) {
+	defer close(c.done)
+
+	var backoff time.Duration
+	for {
+		started := time.Now()
+		if err := c.watchToken(ctx, secret); err != nil && ctx.Err() == nil {
+			log.Printf("Vault token renewal failed, re-authenticating: %v", err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Tokens that must be replaced right away, e.g. because they cannot be renewed,
+		// would otherwise make the client log in continuously
+		if time.Since(started) >= minTokenWatch {
+			backoff = 0
+		} else {
+			backoff = min(max(backoff*2, minReauthBackoff), maxReauthBackoff)
+			log.Printf("Vault token must be replaced after %s, re-authenticating in %s", time.Since(started).Round(time.Millisecond), backoff)
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		secret = c.reauthenticate(ctx)
+		if secret == nil {
+			return
+		}
+	}
+}
+
+// watchToken blocks until the token must be replaced or ctx is cancelled.
+//
+// Renewable tokens are renewed by a lifetime watcher until they reach their
+// maximum TTL. Non-renewable tokens are replaced after two thirds of their TTL.
+// Tokens without a TTL never need to be replaced.
+func (c *Client) watchToken(ctx context.Context, secret *api.Secret) error {
+	if secret == nil || secret.Auth == nil {
+		<-ctx.Done()
+		return nil
+	}
+
+	if secret.Auth.Renewable {
+		watcher, err := c.client.NewLifetimeWatcher(&api.LifetimeWatcherInput{Secret: secret})
+		if err != nil {
+			return err
+		}
+		go watcher.Start()
+		defer watcher.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case err := <-watcher.DoneCh():
+				// nil error means the token reached its max TTL
+				return err
+			case <-watcher.RenewCh():
+			}
+		}
+	}
+
+	ttl := time.Duration(secret.Auth.LeaseDuration) * time.Second
+	if ttl <= 0 {
+		<-ctx.Done()
+		return nil
+	}
+
+	timer := time.NewTimer(ttl * 2 / 3)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+	return nil
+}
+
+// reauthenticate logs in again, retrying with exponential backoff.
+// It returns nil if ctx is cancelled first.
+func (c *Client) reauthenticate(ctx context.Context) *api.Secret {
+	backoff := minReauthBackoff
+	for {
+		secret, err := c.client.Auth().Login(ctx, c.auth)
+		if err == nil {
+			return secret
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("Vault re-authentication failed, retrying in %s: %v", backoff, err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > maxReauthBackoff {
+			backoff = maxReauthBackoff
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hengadev/encx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockVault records login requests and issues tokens with a configurable lease.
+type mockVault struct {
+	mu            sync.Mutex
+	logins        map[string][]map[string]interface{} // login path -> request bodies
+	leaseDuration int
+	renewable     bool
+	failLogins    bool
+	failRenewals  bool
+}
+
+func newMockVault(t *testing.T) (*mockVault, *httptest.Server) {
+	t.Helper()
+
+	m := &mockVault{logins: make(map[string][]map[string]interface{})}
+	server := httptest.NewServer(http.HandlerFunc(m.handle))
+	t.Cleanup(server.Close)
+	return m, server
+}
+
+func (m *mockVault) handle(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var body map[string]interface{}
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/v1/auth/token/lookup-self":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"renewable": m.renewable,
+				"ttl":       m.leaseDuration,
+			},
+		})
+	case "/v1/auth/token/renew-self":
+		if m.failRenewals {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{
+				"client_token":   "renewed-token",
+				"lease_duration": m.leaseDuration,
+				"renewable":      m.renewable,
+			},
+		})
+	default:
+		if m.failLogins {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		m.logins[r.URL.Path] = append(m.logins[r.URL.Path], body)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{
+				"client_token":   "token-" + r.URL.Path,
+				"lease_duration": m.leaseDuration,
+				"renewable":      m.renewable,
+			},
+		})
+	}
+}
+
+func (m *mockVault) loginCount(path string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.logins[path])
+}
+
+func (m *mockVault) lastLogin(path string) map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bodies := m.logins[path]
+	if len(bodies) == 0 {
+		return nil
+	}
+	return bodies[len(bodies)-1]
+}
+
+func TestNewClient_AuthMethods(t *testing.T) {
+	jwtPath := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(jwtPath, []byte("service-account-jwt\n"), 0600))
+
+	tests := []struct {
+		name      string
+		auth      AuthMethod
+		loginPath string
+		payload   map[string]interface{}
+	}{
+		{
+			name:      "approle",
+			auth:      &AppRoleAuth{RoleID: "role", SecretID: "secret"},
+			loginPath: "/v1/auth/approle/login",
+			payload:   map[string]interface{}{"role_id": "role", "secret_id": "secret"},
+		},
+		{
+			name:      "approle custom mount",
+			auth:      &AppRoleAuth{RoleID: "role", SecretID: "secret", MountPath: "/apps/"},
+			loginPath: "/v1/auth/apps/login",
+			payload:   map[string]interface{}{"role_id": "role", "secret_id": "secret"},
+		},
+		{
+			name:      "kubernetes",
+			auth:      &KubernetesAuth{Role: "my-app", JWTPath: jwtPath},
+			loginPath: "/v1/auth/kubernetes/login",
+			payload:   map[string]interface{}{"role": "my-app", "jwt": "service-account-jwt"},
+		},
+		{
+			name:      "cert",
+			auth:      &CertAuth{Name: "web"},
+			loginPath: "/v1/auth/cert/login",
+			payload:   map[string]interface{}{"name": "web"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, server := newMockVault(t)
+
+			client, err := NewClient(context.Background(), Config{Address: server.URL, Auth: tt.auth})
+			require.NoError(t, err)
+			defer client.Close()
+
+			assert.Equal(t, 1, mock.loginCount(tt.loginPath))
+			assert.Equal(t, tt.payload, mock.lastLogin(tt.loginPath))
+			assert.Equal(t, "token-"+tt.loginPath, client.API().Token())
+		})
+	}
+}
+
+func TestNewClient_TokenAuth(t *testing.T) {
+	_, server := newMockVault(t)
+
+	client, err := NewClient(context.Background(), Config{
+		Address:   server.URL,
+		Namespace: "admin/test",
+		Auth:      &TokenAuth{Token: "static-token"},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	assert.Equal(t, "static-token", client.API().Token())
+	assert.Equal(t, "admin/test", client.API().Namespace())
+}
+
+func TestNewClient_Errors(t *testing.T) {
+	t.Run("missing auth", func(t *testing.T) {
+		_, err := NewClient(context.Background(), Config{Address: "http://127.0.0.1:8200"})
+		assert.ErrorIs(t, err, encx.ErrInvalidConfiguration)
+	})
+
+	t.Run("login rejected", func(t *testing.T) {
+		mock, server := newMockVault(t)
+		mock.failLogins = true
+
+		_, err := NewClient(context.Background(), Config{
+			Address: server.URL,
+			Auth:    &AppRoleAuth{RoleID: "role", SecretID: "wrong"},
+		})
+		assert.ErrorIs(t, err, encx.ErrAuthenticationFailed)
+	})
+
+	t.Run("missing kubernetes token", func(t *testing.T) {
+		_, server := newMockVault(t)
+
+		_, err := NewClient(context.Background(), Config{
+			Address: server.URL,
+			Auth:    &KubernetesAuth{Role: "my-app", JWTPath: filepath.Join(t.TempDir(), "missing")},
+		})
+		assert.ErrorIs(t, err, encx.ErrAuthenticationFailed)
+	})
+}
+
+func TestClient_ReauthenticatesBeforeExpiry(t *testing.T) {
+	mock, server := newMockVault(t)
+	mock.leaseDuration = 1 // non-renewable token replaced after ~0.66s
+
+	client, err := NewClient(context.Background(), Config{
+		Address: server.URL,
+		Auth:    &AppRoleAuth{RoleID: "role", SecretID: "secret"},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	assert.Eventually(t, func() bool {
+		return mock.loginCount("/v1/auth/approle/login") >= 2
+	}, 3*time.Second, 50*time.Millisecond)
+}
+
+func TestClient_BacksOffWhenTokensCannotBeRenewed(t *testing.T) {
+	mock, server := newMockVault(t)
+	mock.renewable = true
+	mock.failRenewals = true // tokens cannot be renewed, and expire right away
+
+	client, err := NewClient(context.Background(), Config{
+		Address: server.URL,
+		Auth:    &AppRoleAuth{RoleID: "role", SecretID: "secret"},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	// Logins are spaced by a growing backoff: at 0s, 1s, 3s...
+	time.Sleep(1500 * time.Millisecond)
+	assert.Equal(t, 2, mock.loginCount("/v1/auth/approle/login"))
+}
+
+func TestClient_DisableRenewal(t *testing.T) {
+	mock, server := newMockVault(t)
+	mock.leaseDuration = 1
+
+	client, err := NewClient(context.Background(), Config{
+		Address:        server.URL,
+		Auth:           &AppRoleAuth{RoleID: "role", SecretID: "secret"},
+		DisableRenewal: true,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	time.Sleep(1200 * time.Millisecond)
+	assert.Equal(t, 1, mock.loginCount("/v1/auth/approle/login"))
+}
+
+func TestClient_Close(t *testing.T) {
+	mock, server := newMockVault(t)
+	mock.leaseDuration = 1
+
+	client, err := NewClient(context.Background(), Config{
+		Address: server.URL,
+		Auth:    &AppRoleAuth{RoleID: "role", SecretID: "secret"},
+	})
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		client.Close()
+		client.Close() // idempotent
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not stop token renewal")
+	}
+
+	time.Sleep(1200 * time.Millisecond)
+	assert.Equal(t, 1, mock.loginCount("/v1/auth/approle/login"))
+}
+
+func TestConfigFromEnvironment(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantAuth AuthMethod
+	}{
+		{
+			name:     "token takes precedence",
+			env:      map[string]string{"VAULT_TOKEN": "t", "VAULT_ROLE_ID": "r", "VAULT_SECRET_ID": "s"},
+			wantAuth: &TokenAuth{Token: "t"},
+		},
+		{
+			name:     "approle",
+			env:      map[string]string{"VAULT_ROLE_ID": "r", "VAULT_SECRET_ID": "s", "VAULT_APPROLE_MOUNT_PATH": "apps"},
+			wantAuth: &AppRoleAuth{RoleID: "r", SecretID: "s", MountPath: "apps"},
+		},
+		{
+			name:     "kubernetes",
+			env:      map[string]string{"VAULT_K8S_ROLE": "my-app", "VAULT_K8S_JWT_PATH": "/tmp/jwt"},
+			wantAuth: &KubernetesAuth{Role: "my-app", JWTPath: "/tmp/jwt"},
+		},
+		{
+			name:     "cert",
+			env:      map[string]string{"VAULT_CERT_ROLE": "web"},
+			wantAuth: &CertAuth{Name: "web"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearVaultEnv(t)
+			t.Setenv("VAULT_ADDR", "http://127.0.0.1:8200")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := ConfigFromEnvironment()
+			require.NoError(t, err)
+			assert.Equal(t, "http://127.0.0.1:8200", cfg.Address)
+			assert.Equal(t, tt.wantAuth, cfg.Auth)
+		})
+	}
+
+	t.Run("missing address", func(t *testing.T) {
+		clearVaultEnv(t)
+		t.Setenv("VAULT_TOKEN", "t")
+
+		_, err := ConfigFromEnvironment()
+		assert.ErrorIs(t, err, encx.ErrInvalidConfiguration)
+	})
+
+	t.Run("no auth method", func(t *testing.T) {
+		clearVaultEnv(t)
+		t.Setenv("VAULT_ADDR", "http://127.0.0.1:8200")
+
+		_, err := ConfigFromEnvironment()
+		assert.ErrorIs(t, err, encx.ErrInvalidConfiguration)
+	})
+}
+
+// clearVaultEnv unsets the Vault environment variables for the duration of the test.
+func clearVaultEnv(t *testing.T) {
+	for _, key := range []string{
+		"VAULT_ADDR", "VAULT_NAMESPACE", "VAULT_TOKEN",
+		"VAULT_ROLE_ID", "VAULT_SECRET_ID", "VAULT_APPROLE_MOUNT_PATH",
+		"VAULT_K8S_ROLE", "VAULT_K8S_JWT_PATH", "VAULT_K8S_MOUNT_PATH",
+		"VAULT_CERT_ROLE", "VAULT_CLIENT_CERT", "VAULT_CERT_MOUNT_PATH",
+	} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
@@ -0,0 +1,91 @@
+package vault
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hengadev/encx"
+)
+
+// Config holds configuration for a Vault client.
+type Config struct {
+	// Address is the Vault server address (e.g., "https://vault.example.com:8200").
+	// If empty, the VAULT_ADDR environment variable is used.
+	Address string
+
+	// Namespace is the Vault Enterprise / HCP Vault namespace (optional).
+	Namespace string
+
+	// Auth is the authentication method. Required.
+	Auth AuthMethod
+
+	// TLS optionally configures the CA and client certificates.
+	// The standard VAULT_CACERT, VAULT_CLIENT_CERT, VAULT_CLIENT_KEY and
+	// VAULT_SKIP_VERIFY environment variables are honored when it is nil.
+	TLS *api.TLSConfig
+
+	// DisableRenewal disables background token renewal and re-authentication.
+	DisableRenewal bool
+}
+
+// ConfigFromEnvironment builds a Config from environment variables.
+//
+// Environment Variables:
+//   - VAULT_ADDR: Vault server address (required)
+//   - VAULT_NAMESPACE: Vault namespace (optional)
+//   - VAULT_TOKEN: Static token
+//   - VAULT_ROLE_ID, VAULT_SECRET_ID: AppRole credentials (VAULT_APPROLE_MOUNT_PATH optional)
+//   - VAULT_K8S_ROLE: Kubernetes auth role (VAULT_K8S_JWT_PATH and VAULT_K8S_MOUNT_PATH optional)
+//   - VAULT_CERT_ROLE: TLS certificate auth role, used with VAULT_CLIENT_CERT and
+//     VAULT_CLIENT_KEY (VAULT_CERT_MOUNT_PATH optional)
+//
+// Authentication Priority:
+//  1. VAULT_TOKEN
+//  2. VAULT_ROLE_ID and VAULT_SECRET_ID
+//  3. VAULT_K8S_ROLE
+//  4. VAULT_CERT_ROLE, or VAULT_CLIENT_CERT alone
+//
+// Returns encx.ErrInvalidConfiguration if VAULT_ADDR is missing or no
+// authentication method is configured.
+func ConfigFromEnvironment() (Config, error) {
+	cfg := Config{
+		Address:   os.Getenv("VAULT_ADDR"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+	}
+	if cfg.Address == "" {
+		return Config{}, fmt.Errorf("%w: VAULT_ADDR environment variable is required", encx.ErrInvalidConfiguration)
+	}
+
+	switch {
+	case os.Getenv("VAULT_TOKEN") != "":
+		cfg.Auth = &TokenAuth{Token: os.Getenv("VAULT_TOKEN")}
+
+	case os.Getenv("VAULT_ROLE_ID") != "" && os.Getenv("VAULT_SECRET_ID") != "":
+		cfg.Auth = &AppRoleAuth{
+			RoleID:    os.Getenv("VAULT_ROLE_ID"),
+			SecretID:  os.Getenv("VAULT_SECRET_ID"),
+			MountPath: os.Getenv("VAULT_APPROLE_MOUNT_PATH"),
+		}
+
+	case os.Getenv("VAULT_K8S_ROLE") != "":
+		cfg.Auth = &KubernetesAuth{
+			Role:      os.Getenv("VAULT_K8S_ROLE"),
+			JWTPath:   os.Getenv("VAULT_K8S_JWT_PATH"),
+			MountPath: os.Getenv("VAULT_K8S_MOUNT_PATH"),
+		}
+
+	case os.Getenv("VAULT_CERT_ROLE") != "" || os.Getenv("VAULT_CLIENT_CERT") != "":
+		cfg.Auth = &CertAuth{
+			Name:      os.Getenv("VAULT_CERT_ROLE"),
+			MountPath: os.Getenv("VAULT_CERT_MOUNT_PATH"),
+		}
+
+	default:
+		return Config{}, fmt.Errorf("%w: no Vault authentication method configured "+
+			"(set VAULT_TOKEN, VAULT_ROLE_ID+VAULT_SECRET_ID, VAULT_K8S_ROLE or VAULT_CLIENT_CERT)",
+			encx.ErrInvalidConfiguration)
+	}
+
+	return cfg, nil
+}
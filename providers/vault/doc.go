@@ -0,0 +1,41 @@
+// Package vault provides a shared, authenticated HashiCorp Vault client for encx.
+//
+// The Vault Transit (providers/keys/hashicorp) and Vault KV (providers/secrets/hashicorp)
+// providers can share a single Client, so that the application authenticates once and
+// one background goroutine keeps the token valid.
+//
+// # Basic Usage
+//
+//	client, err := vault.NewClient(ctx, vault.Config{
+//	    Address: "https://vault.example.com:8200",
+//	    Auth:    &vault.AppRoleAuth{RoleID: roleID, SecretID: secretID},
+//	})
+//	if err != nil {
+//	    // handle error
+//	}
+//	defer client.Close()
+//
+//	transit := vaulttransit.NewTransitServiceWithClient(client)
+//	kv := vaultkv.NewKVStoreWithClient(client)
+//
+// # Auth Methods
+//
+//   - TokenAuth: static token
+//   - AppRoleAuth: AppRole role ID and secret ID
+//   - KubernetesAuth: pod service account JWT
+//   - CertAuth: TLS client certificate
+//
+// Any api.AuthMethod can be used as well.
+//
+// # Token Lifecycle
+//
+// Renewable tokens are renewed in the background. When a token reaches its maximum
+// TTL (or, for non-renewable tokens, after two thirds of its TTL), the client logs in
+// again with the same auth method, retrying with exponential backoff on failure.
+// Close stops the background goroutine.
+//
+// # Configuration
+//
+// NewClientFromEnvironment builds the configuration from VAULT_ADDR, VAULT_NAMESPACE
+// and the auth method variables (see ConfigFromEnvironment).
+package vault
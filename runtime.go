@@ -0,0 +1,743 @@
+package encx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hengadev/encx/internal/schema"
+	"github.com/hengadev/errsx"
+)
+
+// Encrypted is the encrypted form of a T, produced at runtime by EncryptStruct. It holds the
+// same fields as the Encx struct generated by encx-gen for T with the default naming
+// strategy, with the same db and json names, so that records written by generated code
+// and at runtime can share a table. Records of packages generated with another naming
+// strategy have other columns.
+//
+// The zero value is ready to be filled by ScanRow or json.Unmarshal.
+type Encrypted[T any] struct {
+	record reflect.Value // Addressable struct with the fields of the generated Encx struct
+}
+
+// EncryptStruct encrypts and hashes the fields of source according to their encx tags, read
+// at runtime, as the generated Process<Name>Encx function does. It is meant for
+// services that cannot add the encx-gen step to their build; the layout of T is
+// analyzed on the first call and cached.
+//
+// Fields are named as with the default naming strategy of encx-gen: from their db and
+// json tags, or their lowercased names. Unexported fields are not stored, and encx
+// tags other than encrypt, hash_basic and hash_secure are not supported. The
+// encryption context of //encx:options is not read either: add the same pairs to ctx
+// with WithEncryptionContext to share records with generated code.
+//
+// It is not named Encrypt, which is the Action constant of encryption.
+func EncryptStruct[T any](ctx context.Context, crypto CryptoService, source *T) (*Encrypted[T], error) {
+	if source == nil {
+		return nil, ErrNilPointer
+	}
+	layout, err := runtimeLayoutOf(reflect.TypeFor[T]())
+	if err != nil {
+		return nil, err
+	}
+
+	var errs errsx.Map
+	result := &Encrypted[T]{record: reflect.New(layout.encxType).Elem()}
+	result.record.FieldByName("Metadata").Set(reflect.ValueOf(EncryptionMetadata{
+		KEKAlias:         crypto.GetAlias(),
+		EncryptionTime:   time.Now().Unix(),
+		GeneratorVersion: Version,
+	}))
+
+	// Copy plain fields (non-encx fields)
+	sourceValue := reflect.ValueOf(source).Elem()
+	layout.copyPlainFields(sourceValue, result.record)
+
+	dek, err := crypto.GenerateDEK()
+	if err != nil {
+		errs.Set("DEK generation", err)
+		return result, errs.AsError()
+	}
+
+	layout.process(ctx, crypto, dek, sourceValue, result.record, &errs, "")
+
+	// Encrypt and store DEK, with the version of the KEK that encrypted it
+	dekEncrypted, keyVersion, err := crypto.EncryptDEKVersioned(ctx, dek)
+	if err != nil {
+		errs.Set("DEK encryption", err)
+	} else {
+		result.record.FieldByName("DEKEncrypted").SetBytes(dekEncrypted)
+		result.record.FieldByName("KeyVersion").SetInt(int64(keyVersion))
+	}
+
+	return result, errs.AsError()
+}
+
+// DecryptStruct decrypts a record encrypted by EncryptStruct, or read from the table of a struct
+// processed by generated code, as the generated Decrypt<Name>Encx function does
+func DecryptStruct[T any](ctx context.Context, crypto CryptoService, source *Encrypted[T]) (*T, error) {
+	if source == nil {
+		return nil, ErrNilPointer
+	}
+	record, err := source.value()
+	if err != nil {
+		return nil, err
+	}
+	layout, err := runtimeLayoutOf(reflect.TypeFor[T]())
+	if err != nil {
+		return nil, err
+	}
+
+	var errs errsx.Map
+	result := new(T)
+	resultValue := reflect.ValueOf(result).Elem()
+
+	// Copy plain fields (non-encx fields)
+	layout.restorePlainFields(record, resultValue)
+
+	dek, err := crypto.DecryptDEKWithVersion(ctx, record.FieldByName("DEKEncrypted").Bytes(), int(record.FieldByName("KeyVersion").Int()))
+	if err != nil {
+		errs.Set("DEK decryption", err)
+		return result, errs.AsError()
+	}
+
+	layout.decrypt(ctx, crypto, dek, record, resultValue, &errs, "")
+
+	return result, errs.AsError()
+}
+
+// value returns the record of e, creating an empty one for the zero value
+func (e *Encrypted[T]) value() (reflect.Value, error) {
+	if e.record.IsValid() {
+		return e.record, nil
+	}
+	layout, err := runtimeLayoutOf(reflect.TypeFor[T]())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	e.record = reflect.New(layout.encxType).Elem()
+	return e.record, nil
+}
+
+// Record returns a pointer to the struct holding the fields of e, which has the fields
+// and tags of the generated Encx struct of T, e.g. to scan it with sqlx. It returns nil
+// if T cannot be processed at runtime.
+func (e *Encrypted[T]) Record() any {
+	record, err := e.value()
+	if err != nil {
+		return nil
+	}
+	return record.Addr().Interface()
+}
+
+// Field returns the value of a field of the generated Encx struct of T, e.g.
+// "EmailEncrypted", "EmailHash" or "KeyVersion"
+func (e *Encrypted[T]) Field(name string) (any, bool) {
+	record, err := e.value()
+	if err != nil {
+		return nil, false
+	}
+	field := record.FieldByName(name)
+	if !field.IsValid() {
+		return nil, false
+	}
+	return field.Interface(), true
+}
+
+// Columns returns the database columns of the record, in the order of ScanRow and
+// InsertArgs, as the Columns method generated with sql_helpers. It returns nil if T
+// cannot be processed at runtime.
+func (e *Encrypted[T]) Columns() []string {
+	layout, err := runtimeLayoutOf(reflect.TypeFor[T]())
+	if err != nil {
+		return nil
+	}
+	columns := make([]string, len(layout.columns))
+	for i, column := range layout.columns {
+		columns[i] = column.name
+	}
+	return columns
+}
+
+// ScanRow scans a row selected with the columns of Columns into the record
+func (e *Encrypted[T]) ScanRow(row RowScanner) error {
+	record, err := e.value()
+	if err != nil {
+		return err
+	}
+	layout, err := runtimeLayoutOf(reflect.TypeFor[T]())
+	if err != nil {
+		return err
+	}
+
+	dest := make([]any, len(layout.columns))
+	for i, column := range layout.columns {
+		dest[i] = record.Field(column.index).Addr().Interface()
+		if column.json {
+			dest[i] = NewJSONColumn(dest[i])
+		}
+	}
+	return row.Scan(dest...)
+}
+
+// InsertArgs returns the values of the columns of Columns, e.g. for an INSERT statement
+func (e *Encrypted[T]) InsertArgs() []any {
+	record, err := e.value()
+	if err != nil {
+		return nil
+	}
+	layout, err := runtimeLayoutOf(reflect.TypeFor[T]())
+	if err != nil {
+		return nil
+	}
+
+	args := make([]any, len(layout.columns))
+	for i, column := range layout.columns {
+		args[i] = record.Field(column.index).Interface()
+		if column.json {
+			args[i] = NewJSONColumn(args[i])
+		}
+	}
+	return args
+}
+
+// MarshalJSON implements json.Marshaler, encoding the record as the generated Encx
+// struct of T is encoded
+func (e *Encrypted[T]) MarshalJSON() ([]byte, error) {
+	record, err := e.value()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(record.Addr().Interface())
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding the JSON of a generated Encx struct of T
+func (e *Encrypted[T]) UnmarshalJSON(data []byte) error {
+	record, err := e.value()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, record.Addr().Interface())
+}
+
+// runtimeLayout is the layout of a struct processed at runtime, and of the struct
+// type standing for its generated Encx struct
+type runtimeLayout struct {
+	encxType reflect.Type
+	fields   []runtimeField
+	columns  []runtimeColumn // Database columns of top-level structs, as with sql_helpers
+	hasTags  bool            // The struct has encx tags, directly or through nested structs
+}
+
+// runtimeField is a field of a struct processed at runtime
+type runtimeField struct {
+	name       string
+	index      []int                    // Index in the source struct, through embedded structs
+	target     int                      // Index in the Encx struct of plain and nested fields
+	companions []runtimeCompanion       // Companion fields of the encx tags, in tag order
+	skip       func(reflect.Value) bool // Reports the values left unprocessed, nil if values are always processed
+	nested     *runtimeLayout           // Layout of the nested struct held by the field
+	slice      bool                     // The field is a slice of nested structs
+	pointer    bool                     // The field holds pointers to nested structs
+}
+
+// runtimeCompanion is the field of the Encx struct storing the result of an encx tag
+type runtimeCompanion struct {
+	tag   string
+	index int
+}
+
+// runtimeColumn is a database column of the Encx struct of a top-level struct
+type runtimeColumn struct {
+	name  string
+	index int
+	json  bool // Stored as JSON through JSONColumn
+}
+
+// runtimeCompanionSuffixes are the Go and column name suffixes of the companion fields
+// of the encx tags supported at runtime
+var runtimeCompanionSuffixes = map[string][2]string{
+	"encrypt":     {"Encrypted", "encrypted"},
+	"hash_basic":  {"Hash", "hash"},
+	"hash_secure": {"HashSecure", "hash_secure"},
+}
+
+// runtimeLayoutKey identifies a cached layout; a struct is laid out differently when
+// it is nested in another one
+type runtimeLayoutKey struct {
+	typ    reflect.Type
+	nested bool
+}
+
+var runtimeLayouts sync.Map // map[runtimeLayoutKey]*runtimeLayout
+
+// runtimeLayoutOf returns the cached layout of a top-level struct type
+func runtimeLayoutOf(t reflect.Type) (*runtimeLayout, error) {
+	return cachedRuntimeLayout(t, false, map[reflect.Type]bool{})
+}
+
+// cachedRuntimeLayout returns the cached layout of a struct type, building it on first
+// use. visiting holds the structs being laid out, as recursive structs are not supported.
+func cachedRuntimeLayout(t reflect.Type, nested bool, visiting map[reflect.Type]bool) (*runtimeLayout, error) {
+	key := runtimeLayoutKey{typ: t, nested: nested}
+	if layout, ok := runtimeLayouts.Load(key); ok {
+		return layout.(*runtimeLayout), nil
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: %s is not a struct", ErrUnsupportedType, t)
+	}
+	if visiting[t] {
+		return nil, fmt.Errorf("%w: %s is recursive", ErrUnsupportedType, t)
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	layout, err := buildRuntimeLayout(t, nested, visiting)
+	if err != nil {
+		return nil, err
+	}
+	cached, _ := runtimeLayouts.LoadOrStore(key, layout)
+	return cached.(*runtimeLayout), nil
+}
+
+// buildRuntimeLayout lays out the fields of a struct as encx-gen does: plain fields
+// first, then companion fields, nested fields and, for top-level structs, the
+// essential encryption fields
+func buildRuntimeLayout(t reflect.Type, nested bool, visiting map[reflect.Type]bool) (*runtimeLayout, error) {
+	layout := &runtimeLayout{}
+	var plainFields, companionFields, nestedFields []reflect.StructField
+	var plainJSON []bool // Whether the plain fields have no native column type
+
+	for _, field := range runtimeSourceFields(t, nil) {
+		dbColumn, jsonField, dbBase, jsonBase := runtimeFieldNames(field)
+		encxTag := field.Tag.Get("encx")
+
+		if encxTag == "" {
+			if nestedLayout, slice, pointer, err := runtimeNestedLayout(t, field.Type, visiting); err != nil {
+				return nil, fmt.Errorf("field %s.%s: %w", t.Name(), field.Name, err)
+			} else if nestedLayout != nil {
+				// Field holds a struct with encx tags - process it with the same DEK
+				encxType := nestedLayout.encxType
+				if pointer {
+					encxType = reflect.PointerTo(encxType)
+				}
+				if slice {
+					encxType = reflect.SliceOf(encxType)
+				}
+				layout.fields = append(layout.fields, runtimeField{
+					name:    field.Name,
+					index:   field.Index,
+					target:  len(nestedFields),
+					nested:  nestedLayout,
+					slice:   slice,
+					pointer: pointer,
+				})
+				nestedFields = append(nestedFields, runtimeStructField(field.Name, encxType, dbColumn, jsonField))
+				layout.hasTags = true
+				continue
+			}
+
+			// Companion fields of the source struct are generated fields, not source fields
+			if strings.HasSuffix(field.Name, "Encrypted") || strings.HasSuffix(field.Name, "Hash") || strings.HasSuffix(field.Name, "HashSecure") {
+				continue
+			}
+
+			// Field has no encx tags - copy as-is
+			layout.fields = append(layout.fields, runtimeField{name: field.Name, index: field.Index, target: len(plainFields)})
+			plainFields = append(plainFields, runtimeStructField(field.Name, field.Type, dbColumn, jsonField))
+			plainJSON = append(plainJSON, schema.IsJSONGoType(runtimeColumnGoType(field.Type)))
+			continue
+		}
+
+		tagged := runtimeField{name: field.Name, index: field.Index, skip: runtimeSkipCondition(field.Type)}
+		for _, tag := range strings.Split(encxTag, ",") {
+			suffix, ok := runtimeCompanionSuffixes[tag]
+			if !ok {
+				return nil, fmt.Errorf("%w: encx tag %q of %s.%s is not supported at runtime", ErrUnsupportedType, tag, t.Name(), field.Name)
+			}
+			companionType := reflect.TypeFor[string]()
+			if tag == "encrypt" {
+				companionType = reflect.TypeFor[[]byte]()
+			}
+			tagged.companions = append(tagged.companions, runtimeCompanion{tag: tag, index: len(companionFields)})
+			companionFields = append(companionFields, runtimeStructField(field.Name+suffix[0], companionType, runtimeCompanionName(dbBase, suffix), runtimeCompanionName(jsonBase, suffix)))
+		}
+		layout.fields = append(layout.fields, tagged)
+		layout.hasTags = true
+	}
+
+	// Companion and nested fields follow the plain fields in the Encx struct
+	for i := range layout.fields {
+		field := &layout.fields[i]
+		switch {
+		case field.nested != nil:
+			field.target += len(plainFields) + len(companionFields)
+		case field.companions != nil:
+			for j := range field.companions {
+				field.companions[j].index += len(plainFields)
+			}
+		}
+	}
+
+	structFields := append(append(append([]reflect.StructField{}, plainFields...), companionFields...), nestedFields...)
+	if !nested {
+		structFields = append(structFields,
+			runtimeStructField("DEKEncrypted", reflect.TypeFor[[]byte](), "dek_encrypted", "dek_encrypted"),
+			runtimeStructField("KeyVersion", reflect.TypeFor[int](), "key_version", "key_version"),
+			runtimeStructField("Metadata", reflect.TypeFor[EncryptionMetadata](), "metadata", "metadata"),
+		)
+	}
+
+	names := make(map[string]bool, len(structFields))
+	for _, field := range structFields {
+		if names[field.Name] {
+			return nil, fmt.Errorf("%w: %s has more than one %s field once encrypted", ErrUnsupportedType, t.Name(), field.Name)
+		}
+		names[field.Name] = true
+	}
+	layout.encxType = reflect.StructOf(structFields)
+
+	if !nested {
+		// Nested structs, and fields without a native column type, are stored as JSON
+		nestedStart := len(plainFields) + len(companionFields)
+		for i, field := range structFields {
+			dbColumn := field.Tag.Get("db")
+			if dbColumn == "-" {
+				continue
+			}
+			json := i >= nestedStart && i < nestedStart+len(nestedFields)
+			if i < len(plainFields) {
+				json = plainJSON[i]
+			}
+			layout.columns = append(layout.columns, runtimeColumn{name: dbColumn, index: i, json: json})
+		}
+	}
+
+	return layout, nil
+}
+
+// runtimeSourceFields returns the fields of a struct, with the fields of embedded
+// structs promoted, skipping unexported fields
+func runtimeSourceFields(t reflect.Type, index []int) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := range t.NumField() {
+		field := t.Field(i)
+		field.Index = append(append([]int{}, index...), i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("encx") == "" {
+			fields = append(fields, runtimeSourceFields(field.Type, field.Index)...)
+			continue
+		}
+		if field.IsExported() {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// runtimeNestedLayout returns the layout of the struct held by a field without encx
+// tags, and the shape of the field, if it is a struct of the package of the enclosing
+// struct with encx tags, e.g. Address, *Address, []Address or []*Address
+func runtimeNestedLayout(enclosing, fieldType reflect.Type, visiting map[reflect.Type]bool) (layout *runtimeLayout, slice, pointer bool, err error) {
+	t := fieldType
+	if t.Kind() == reflect.Slice {
+		t, slice = t.Elem(), true
+	}
+	if t.Kind() == reflect.Pointer {
+		t, pointer = t.Elem(), true
+	}
+	if t.Kind() != reflect.Struct || t.Name() == "" || t.PkgPath() != enclosing.PkgPath() {
+		return nil, false, false, nil
+	}
+
+	layout, err = cachedRuntimeLayout(t, true, visiting)
+	if err != nil || !layout.hasTags {
+		return nil, false, false, err
+	}
+	return layout, slice, pointer, nil
+}
+
+// runtimeStructField returns a field of an Encx struct
+func runtimeStructField(name string, t reflect.Type, dbColumn, jsonField string) reflect.StructField {
+	return reflect.StructField{
+		Name: name,
+		Type: t,
+		Tag:  reflect.StructTag(fmt.Sprintf(`db:"%s" json:"%s"`, dbColumn, jsonField)),
+	}
+}
+
+// runtimeFieldNames returns the db column and JSON field of a source field, and the
+// names its companion fields are named from, as the default naming strategy of
+// encx-gen does
+func runtimeFieldNames(field reflect.StructField) (dbColumn, jsonField, dbBase, jsonBase string) {
+	dbColumn, jsonField = field.Tag.Get("db"), field.Tag.Get("json")
+
+	dbBase, _, _ = strings.Cut(dbColumn, ",")
+	if dbBase == "" || dbBase == "-" {
+		dbBase = strings.ToLower(field.Name)
+	}
+	jsonBase, _, _ = strings.Cut(jsonField, ",")
+	if jsonBase == "" || jsonBase == "-" {
+		jsonBase = strings.ToLower(field.Name)
+	}
+
+	if dbColumn == "" {
+		dbColumn = dbBase
+	}
+	if jsonField == "" || strings.HasPrefix(jsonField, ",") {
+		jsonField = jsonBase + jsonField
+	}
+	return dbColumn, jsonField, dbBase, jsonBase
+}
+
+// runtimeCompanionName returns the name of a companion field from the name of its
+// field, keeping its style: "user_id" gives "user_id_encrypted" and "userId" gives
+// "userIdEncrypted"
+func runtimeCompanionName(name string, suffix [2]string) string {
+	if !strings.Contains(name, "_") && strings.ToLower(name) != name {
+		return name + suffix[0]
+	}
+	return name + "_" + suffix[1]
+}
+
+var (
+	runtimeValuerType  = reflect.TypeFor[driver.Valuer]()
+	runtimeScannerType = reflect.TypeFor[sql.Scanner]()
+)
+
+// runtimeColumnGoType returns the Go type whose column stores values of a type, as
+// encx-gen resolves it from type information: types implementing driver.Valuer, whose
+// pointer implements sql.Scanner, are stored natively, and other types by their
+// underlying type, e.g. "string" for a type Status string
+func runtimeColumnGoType(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == reflect.TypeFor[time.Time]():
+		return "time.Time"
+	case t.PkgPath() == "github.com/google/uuid" && t.Name() == "UUID":
+		return "uuid.UUID"
+	case t.Implements(runtimeValuerType) && reflect.PointerTo(t).Implements(runtimeScannerType):
+		if value := runtimeNullValueType(t); value != nil {
+			return runtimeColumnGoType(value)
+		}
+		if runtimeBasicKind(t.Kind()) {
+			return t.Kind().String()
+		}
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return "[]byte"
+		}
+		return "string"
+	}
+
+	if runtimeBasicKind(t.Kind()) {
+		return t.Kind().String()
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+		return "[]byte"
+	}
+	return t.String()
+}
+
+// runtimeBasicKind reports whether a kind is the kind of a basic type
+func runtimeBasicKind(kind reflect.Kind) bool {
+	return kind >= reflect.Bool && kind <= reflect.Complex128 || kind == reflect.String
+}
+
+// runtimeNullValueType returns the type of the value held by a type shaped like the
+// sql.Null types, a struct of the value and a Valid bool, or nil for other types
+func runtimeNullValueType(t reflect.Type) reflect.Type {
+	if t.Kind() != reflect.Struct || t.NumField() != 2 {
+		return nil
+	}
+	for i := range 2 {
+		if valid := t.Field(i); valid.Name == "Valid" && valid.Type.Kind() == reflect.Bool {
+			return t.Field(1 - i).Type
+		}
+	}
+	return nil
+}
+
+// runtimeSkipCondition returns the condition of the values left unprocessed, as the
+// generated code skips nil pointers, zero UUIDs and zero times. It returns nil if the
+// values are always processed.
+func runtimeSkipCondition(t reflect.Type) func(reflect.Value) bool {
+	switch {
+	case t.Kind() == reflect.Pointer:
+		return reflect.Value.IsNil
+	case t == reflect.TypeFor[time.Time]():
+		return func(v reflect.Value) bool { return v.Interface().(time.Time).IsZero() }
+	case t.String() == "uuid.UUID":
+		return reflect.Value.IsZero
+	default:
+		return nil
+	}
+}
+
+// runtimePath returns the path of a field of the nested value at path, e.g.
+// "Contacts[0].Phone", or its name in top-level structs
+func runtimePath(path, fieldName string) string {
+	if path == "" {
+		return fieldName
+	}
+	return path + "." + fieldName
+}
+
+// errKey returns the key of an error of a field in the error map, e.g.
+// "Contacts[0].Phone encryption"
+func errKey(path, fieldName, operation string) string {
+	return runtimePath(path, fieldName) + " " + operation
+}
+
+// copyPlainFields copies the plain fields of a source struct to its Encx struct
+func (l *runtimeLayout) copyPlainFields(source, target reflect.Value) {
+	for _, field := range l.fields {
+		if field.nested == nil && field.companions == nil {
+			target.Field(field.target).Set(source.FieldByIndex(field.index))
+		}
+	}
+}
+
+// restorePlainFields copies the plain fields of an Encx struct back to its source struct
+func (l *runtimeLayout) restorePlainFields(source, target reflect.Value) {
+	for _, field := range l.fields {
+		if field.nested == nil && field.companions == nil {
+			target.FieldByIndex(field.index).Set(source.Field(field.target))
+		}
+	}
+}
+
+// process encrypts and hashes the fields of a source struct into its Encx struct
+func (l *runtimeLayout) process(ctx context.Context, crypto CryptoService, dek []byte, source, target reflect.Value, errs *errsx.Map, path string) {
+	for _, field := range l.fields {
+		value := source.FieldByIndex(field.index)
+
+		if field.nested != nil {
+			field.processNested(ctx, crypto, dek, value, target.Field(field.target), errs, path)
+			continue
+		}
+		if field.companions == nil || (field.skip != nil && field.skip(value)) {
+			continue
+		}
+
+		// Serialize once and apply all operations
+		valueBytes, err := SerializeValue(value.Interface())
+		if err != nil {
+			errs.Set(errKey(path, field.name, "serialization"), err)
+			continue
+		}
+		for _, companion := range field.companions {
+			companionValue := target.Field(companion.index)
+			switch companion.tag {
+			case "encrypt":
+				encrypted, err := crypto.EncryptData(ctx, valueBytes, dek)
+				if err != nil {
+					errs.Set(errKey(path, field.name, "encryption"), err)
+				}
+				companionValue.SetBytes(encrypted)
+			case "hash_basic":
+				companionValue.SetString(crypto.HashBasic(ctx, valueBytes))
+			case "hash_secure":
+				hash, err := crypto.HashSecure(ctx, valueBytes)
+				if err != nil {
+					errs.Set(errKey(path, field.name, "secure hash"), err)
+				}
+				companionValue.SetString(hash)
+			}
+		}
+	}
+}
+
+// decrypt decrypts the fields of an Encx struct back into its source struct
+func (l *runtimeLayout) decrypt(ctx context.Context, crypto CryptoService, dek []byte, source, target reflect.Value, errs *errsx.Map, path string) {
+	for _, field := range l.fields {
+		if field.nested != nil {
+			field.decryptNested(ctx, crypto, dek, source.Field(field.target), target.FieldByIndex(field.index), errs, path)
+			continue
+		}
+
+		for _, companion := range field.companions {
+			if companion.tag != "encrypt" {
+				continue
+			}
+			encrypted := source.Field(companion.index).Bytes()
+			if len(encrypted) == 0 {
+				continue
+			}
+			valueBytes, err := crypto.DecryptData(ctx, encrypted, dek)
+			if err != nil {
+				errs.Set(errKey(path, field.name, "decryption"), err)
+				continue
+			}
+			if err := DeserializeValue(valueBytes, target.FieldByIndex(field.index).Addr().Interface()); err != nil {
+				errs.Set(errKey(path, field.name, "deserialization"), err)
+			}
+		}
+	}
+}
+
+// processNested processes the nested structs held by a field, keeping its shape
+func (f *runtimeField) processNested(ctx context.Context, crypto CryptoService, dek []byte, source, target reflect.Value, errs *errsx.Map, path string) {
+	processOne := func(source, target reflect.Value, path string) {
+		if f.pointer {
+			if source.IsNil() {
+				return
+			}
+			source = source.Elem()
+			target.Set(reflect.New(target.Type().Elem()))
+			target = target.Elem()
+		}
+		f.nested.copyPlainFields(source, target)
+		f.nested.process(ctx, crypto, dek, source, target, errs, path)
+	}
+
+	fieldPath := runtimePath(path, f.name)
+	if !f.slice {
+		processOne(source, target, fieldPath)
+		return
+	}
+	if source.IsNil() {
+		return
+	}
+	target.Set(reflect.MakeSlice(target.Type(), source.Len(), source.Len()))
+	for i := range source.Len() {
+		processOne(source.Index(i), target.Index(i), fieldPath+"["+strconv.Itoa(i)+"]")
+	}
+}
+
+// decryptNested decrypts the nested structs held by a field, keeping its shape
+func (f *runtimeField) decryptNested(ctx context.Context, crypto CryptoService, dek []byte, source, target reflect.Value, errs *errsx.Map, path string) {
+	decryptOne := func(source, target reflect.Value, path string) {
+		if f.pointer {
+			if source.IsNil() {
+				return
+			}
+			source = source.Elem()
+			target.Set(reflect.New(target.Type().Elem()))
+			target = target.Elem()
+		}
+		f.nested.restorePlainFields(source, target)
+		f.nested.decrypt(ctx, crypto, dek, source, target, errs, path)
+	}
+
+	fieldPath := runtimePath(path, f.name)
+	if !f.slice {
+		decryptOne(source, target, fieldPath)
+		return
+	}
+	if source.IsNil() {
+		return
+	}
+	target.Set(reflect.MakeSlice(target.Type(), source.Len(), source.Len()))
+	for i := range source.Len() {
+		decryptOne(source.Index(i), target.Index(i), fieldPath+"["+strconv.Itoa(i)+"]")
+	}
+}
@@ -0,0 +1,265 @@
+package encx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hengadev/encx/internal/codegen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type runtimeContact struct {
+	Name  string
+	Phone string `json:"phone" encx:"encrypt"`
+}
+
+type runtimeAudit struct {
+	CreatedBy string `db:"created_by"`
+}
+
+type runtimeUser struct {
+	runtimeAudit
+	ID       int     `db:"id"`
+	Email    string  `db:"email" encx:"encrypt,hash_basic"`
+	Password string  `encx:"hash_secure"`
+	Nickname *string `encx:"encrypt"`
+	Tags     []string
+	Contacts []*runtimeContact
+	secret   string
+}
+
+// rowValues is a RowScanner returning fixed values
+type rowValues []any
+
+func (r rowValues) Scan(dest ...any) error {
+	for i, value := range r {
+		if scanner, ok := dest[i].(interface{ Scan(any) error }); ok {
+			if err := scanner.Scan(value); err != nil {
+				return err
+			}
+			continue
+		}
+		reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(value))
+	}
+	return nil
+}
+
+func TestEncryptStruct(t *testing.T) {
+	ctx := context.Background()
+	crypto, err := NewTestCrypto(t)
+	require.NoError(t, err)
+
+	user := &runtimeUser{
+		runtimeAudit: runtimeAudit{CreatedBy: "admin"},
+		ID:           42,
+		Email:        "user@example.com",
+		Password:     "hunter2",
+		Tags:         []string{"a"},
+		Contacts:     []*runtimeContact{{Name: "Bob", Phone: "555-0100"}, nil},
+		secret:       "not stored",
+	}
+
+	encrypted, err := EncryptStruct(ctx, crypto, user)
+	require.NoError(t, err)
+
+	// Fields are laid out and named as in the generated Encx struct
+	assert.Equal(t, []string{"created_by", "id", "tags", "email_encrypted", "email_hash", "password_hash_secure", "nickname_encrypted", "contacts", "dek_encrypted", "key_version", "metadata"}, encrypted.Columns())
+	emailHash, ok := encrypted.Field("EmailHash")
+	require.True(t, ok)
+	expectedHash, err := SerializeValue(user.Email)
+	require.NoError(t, err)
+	assert.Equal(t, crypto.HashBasic(ctx, expectedHash), emailHash)
+	nickname, _ := encrypted.Field("NicknameEncrypted")
+	assert.Empty(t, nickname, "nil pointers are not encrypted")
+	_, ok = encrypted.Field("secret")
+	assert.False(t, ok)
+
+	data, err := json.Marshal(encrypted)
+	require.NoError(t, err)
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal(data, &fields))
+	assert.Contains(t, fields, "email_encrypted")
+	assert.Contains(t, fields["contacts"].([]any)[0], "phone_encrypted")
+	assert.Nil(t, fields["contacts"].([]any)[1])
+
+	decrypted, err := DecryptStruct(ctx, crypto, encrypted)
+	require.NoError(t, err)
+	user.Password, user.secret = "", "" // Hashed and unexported fields are not restored
+	assert.Equal(t, user, decrypted)
+
+	// Records round-trip through JSON and database rows
+	var fromJSON Encrypted[runtimeUser]
+	require.NoError(t, json.Unmarshal(data, &fromJSON))
+	decrypted, err = DecryptStruct(ctx, crypto, &fromJSON)
+	require.NoError(t, err)
+	assert.Equal(t, user, decrypted)
+
+	var row rowValues
+	for _, arg := range encrypted.InsertArgs() {
+		if valuer, ok := arg.(driver.Valuer); ok {
+			value, err := valuer.Value()
+			require.NoError(t, err)
+			arg = value
+		}
+		row = append(row, arg)
+	}
+	var fromRow Encrypted[runtimeUser]
+	require.NoError(t, fromRow.ScanRow(row))
+	decrypted, err = DecryptStruct(ctx, crypto, &fromRow)
+	require.NoError(t, err)
+	assert.Equal(t, user, decrypted)
+}
+
+func TestEncryptStructErrors(t *testing.T) {
+	ctx := context.Background()
+	crypto, err := NewTestCrypto(t)
+	require.NoError(t, err)
+
+	_, err = EncryptStruct[runtimeUser](ctx, crypto, nil)
+	assert.ErrorIs(t, err, ErrNilPointer)
+
+	type withOperation struct {
+		Card string `encx:"mask"`
+	}
+	_, err = EncryptStruct(ctx, crypto, &withOperation{})
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+	assert.ErrorContains(t, err, `encx tag "mask" of withOperation.Card is not supported at runtime`)
+
+	value := 42
+	_, err = EncryptStruct(ctx, crypto, &value)
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+	assert.Nil(t, (&Encrypted[int]{}).Columns())
+}
+
+// runtimeGeneratedSource declares runtimeGenerated, to compare Encrypted[T] with the
+// Encx struct encx-gen generates for it
+const runtimeGeneratedSource = `package encx
+
+import "database/sql"
+
+type runtimeStatus string
+
+type runtimeGeneratedContact struct {
+	Name  string
+	Phone string ` + "`json:\"phone\" encx:\"encrypt\"`" + `
+}
+
+type runtimeGenerated struct {
+	ID        int                        ` + "`db:\"id\"`" + `
+	Email     string                     ` + "`db:\"email\" json:\"emailAddress\" encx:\"encrypt,hash_basic\"`" + `
+	Password  string                     ` + "`encx:\"hash_secure\"`" + `
+	Nickname  *string                    ` + "`encx:\"encrypt\"`" + `
+	BirthDate string                     ` + "`encx:\"encrypt\"`" + `
+	Status    runtimeStatus
+	Nick      sql.NullString
+	Deleted   sql.NullTime
+	Tags      []string
+	Contact   runtimeGeneratedContact
+	Contacts  []*runtimeGeneratedContact
+}
+`
+
+type runtimeStatus string
+
+type runtimeGeneratedContact struct {
+	Name  string
+	Phone string `json:"phone" encx:"encrypt"`
+}
+
+type runtimeGenerated struct {
+	ID        int     `db:"id"`
+	Email     string  `db:"email" json:"emailAddress" encx:"encrypt,hash_basic"`
+	Password  string  `encx:"hash_secure"`
+	Nickname  *string `encx:"encrypt"`
+	BirthDate string  `encx:"encrypt"`
+	Status    runtimeStatus
+	Nick      sql.NullString
+	Deleted   sql.NullTime
+	Tags      []string
+	Contact   runtimeGeneratedContact
+	Contacts  []*runtimeGeneratedContact
+}
+
+func TestEncryptedMatchesGeneratedCode(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/encx\n\ngo 1.23\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "user.go"), []byte(runtimeGeneratedSource), 0644))
+	structs, err := codegen.DiscoverStructs(dir, &codegen.DiscoveryConfig{})
+	require.NoError(t, err)
+
+	var data []codegen.TemplateData
+	for _, structInfo := range structs {
+		data = append(data, codegen.BuildTemplateData(structInfo, codegen.GenerationConfig{SQLHelpers: true}))
+	}
+	engine, err := codegen.NewTemplateEngine()
+	require.NoError(t, err)
+	code, err := engine.GenerateFile(data)
+	require.NoError(t, err)
+
+	// The db columns and JSON names of the generated Encx struct, in order
+	file, err := parser.ParseFile(token.NewFileSet(), "user_encx.go", code, 0)
+	require.NoError(t, err)
+	var columns, jsonNames []string
+	ast.Inspect(file, func(node ast.Node) bool {
+		typeSpec, ok := node.(*ast.TypeSpec)
+		if !ok || typeSpec.Name.Name != "runtimeGeneratedEncx" {
+			return true
+		}
+		for _, field := range typeSpec.Type.(*ast.StructType).Fields.List {
+			tagValue, err := strconv.Unquote(field.Tag.Value)
+			require.NoError(t, err)
+			tag := reflect.StructTag(tagValue)
+			columns = append(columns, tag.Get("db"))
+			jsonName, _, _ := strings.Cut(tag.Get("json"), ",")
+			jsonNames = append(jsonNames, jsonName)
+		}
+		return false
+	})
+	require.NotEmpty(t, columns)
+
+	var encrypted Encrypted[runtimeGenerated]
+	assert.Equal(t, columns, encrypted.Columns())
+
+	record := reflect.TypeOf(encrypted.Record()).Elem()
+	var runtimeJSONNames []string
+	for i := range record.NumField() {
+		jsonName, _, _ := strings.Cut(record.Field(i).Tag.Get("json"), ",")
+		runtimeJSONNames = append(runtimeJSONNames, jsonName)
+	}
+	assert.Equal(t, jsonNames, runtimeJSONNames)
+
+	// The same columns are stored as JSON, and the others natively. The metadata columns
+	// are not part of the generated SQL columns.
+	generatedJSON := map[string]bool{}
+	for _, structData := range data {
+		if structData.StructName == "runtimeGenerated" {
+			for _, column := range structData.SQLColumns {
+				generatedJSON[column.DBColumn] = column.JSON
+			}
+		}
+	}
+	layout, err := runtimeLayoutOf(reflect.TypeFor[runtimeGenerated]())
+	require.NoError(t, err)
+	runtimeJSON := map[string]bool{}
+	for _, column := range layout.columns {
+		if _, found := generatedJSON[column.name]; found {
+			runtimeJSON[column.name] = column.json
+		}
+	}
+	assert.Equal(t, generatedJSON, runtimeJSON)
+	assert.False(t, runtimeJSON["status"])
+	assert.False(t, runtimeJSON["nick"])
+	assert.True(t, runtimeJSON["tags"])
+}
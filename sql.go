@@ -0,0 +1,58 @@
+package encx
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// RowScanner scans the columns of a row, as implemented by *sql.Row, *sql.Rows,
+// *sqlx.Row and pgx.Row. The generated ScanRow helpers accept it.
+type RowScanner interface {
+	Scan(dest ...any) error
+}
+
+// JSONColumn stores a value in a JSON column. The generated ScanRow and InsertArgs
+// helpers use it for nested structs and fields without a native column type.
+type JSONColumn struct {
+	v any
+}
+
+// NewJSONColumn creates the JSON column of a value. Pass a pointer to scan into it.
+func NewJSONColumn(v any) JSONColumn {
+	return JSONColumn{v: v}
+}
+
+// Value implements driver.Valuer, storing the value as JSON and nil values as NULL
+func (c JSONColumn) Value() (driver.Value, error) {
+	data, err := json.Marshal(c.v)
+	if err != nil {
+		return nil, err
+	}
+	if string(data) == "null" {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// Scan implements sql.Scanner, reading JSON into the value pointed to. NULL sets it
+// to its zero value.
+func (c JSONColumn) Scan(value any) error {
+	target := reflect.ValueOf(c.v)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("cannot scan into %T, expected a non-nil pointer", c.v)
+	}
+
+	switch v := value.(type) {
+	case nil:
+		target.Elem().SetZero()
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c.v)
+	case string:
+		return json.Unmarshal([]byte(v), c.v)
+	default:
+		return fmt.Errorf("cannot scan %T into a JSON column", value)
+	}
+}
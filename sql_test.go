@@ -0,0 +1,41 @@
+package encx
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type jsonColumnAddress struct {
+	Street string `json:"street"`
+}
+
+func TestJSONColumn(t *testing.T) {
+	address := &jsonColumnAddress{Street: "Main"}
+
+	value, err := NewJSONColumn(address).Value()
+	require.NoError(t, err)
+	assert.Equal(t, driver.Value([]byte(`{"street":"Main"}`)), value)
+
+	// Nil pointers, slices and maps are stored as NULL
+	value, err = NewJSONColumn((*jsonColumnAddress)(nil)).Value()
+	require.NoError(t, err)
+	assert.Nil(t, value)
+
+	var scanned *jsonColumnAddress
+	require.NoError(t, NewJSONColumn(&scanned).Scan(`{"street":"Main"}`))
+	assert.Equal(t, address, scanned)
+
+	// NULL resets the value
+	require.NoError(t, NewJSONColumn(&scanned).Scan(nil))
+	assert.Nil(t, scanned)
+
+	var tags []string
+	require.NoError(t, NewJSONColumn(&tags).Scan([]byte(`["a","b"]`)))
+	assert.Equal(t, []string{"a", "b"}, tags)
+
+	assert.ErrorContains(t, NewJSONColumn(tags).Scan(`[]`), "expected a non-nil pointer")
+	assert.ErrorContains(t, NewJSONColumn(&tags).Scan(42), "cannot scan int into a JSON column")
+}
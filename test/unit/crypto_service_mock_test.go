@@ -53,6 +53,11 @@ func (m *CryptoServiceMock) EncryptDEK(ctx context.Context, plaintextDEK []byte)
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+func (m *CryptoServiceMock) EncryptDEKVersioned(ctx context.Context, plaintextDEK []byte) ([]byte, int, error) {
+	args := m.Called(ctx, plaintextDEK)
+	return args.Get(0).([]byte), args.Int(1), args.Error(2)
+}
+
 func (m *CryptoServiceMock) DecryptDEKWithVersion(ctx context.Context, ciphertextDEK []byte, kekVersion int) ([]byte, error) {
 	args := m.Called(ctx, ciphertextDEK, kekVersion)
 	return args.Get(0).([]byte), args.Error(1)
@@ -18,6 +18,7 @@ import (
 
 // SimpleTestKMS implements a basic in-memory KMS for testing and examples
 type SimpleTestKMS struct {
+	mu   sync.RWMutex
 	keys map[string][]byte // keyID -> key material
 }
 
@@ -36,47 +37,82 @@ func NewSimpleTestKMS() config.KeyManagementService {
 
 // GetKeyID returns a test key ID for the given alias
 func (s *SimpleTestKMS) GetKeyID(ctx context.Context, alias string) (string, error) {
+	if alias == "" {
+		return "", fmt.Errorf("%w: alias cannot be empty", ErrInvalidConfiguration)
+	}
 	return "test-key-id", nil
 }
 
 // CreateKey creates a new test key and returns its ID
 func (s *SimpleTestKMS) CreateKey(ctx context.Context, description string) (string, error) {
-	keyID := fmt.Sprintf("test-key-%d", len(s.keys))
 	key := make([]byte, 32)
 	rand.Read(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyID := fmt.Sprintf("test-key-%d", len(s.keys))
 	s.keys[keyID] = key
 	return keyID, nil
 }
 
-// EncryptDEK encrypts the DEK using AES-GCM
+// EncryptDEK encrypts the DEK using AES-GCM, binding the encryption context from ctx
 func (s *SimpleTestKMS) EncryptDEK(ctx context.Context, keyID string, plaintext []byte) ([]byte, error) {
-	key, exists := s.keys[keyID]
-	if !exists {
-		return nil, fmt.Errorf("key not found: %s", keyID)
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKMSUnavailable, err)
 	}
-
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	if keyID == "" {
+		return nil, fmt.Errorf("%w: key ID cannot be empty", ErrInvalidConfiguration)
+	}
+	if len(plaintext) == 0 {
+		return nil, fmt.Errorf("%w: plaintext cannot be empty", ErrEncryptionFailed)
 	}
 
-	aesGCM, err := cipher.NewGCM(block)
+	aesGCM, err := s.gcm(keyID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrEncryptionFailed, err)
 	}
 
 	nonce := make([]byte, aesGCM.NonceSize())
 	if _, err := rand.Read(nonce); err != nil {
-		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+		return nil, fmt.Errorf("%w: failed to generate nonce: %w", ErrEncryptionFailed, err)
 	}
 
-	ciphertext := aesGCM.Seal(nonce, nonce, plaintext, nil)
+	// Bind the encryption context as additional authenticated data, like a real KMS
+	ciphertext := aesGCM.Seal(nonce, nonce, plaintext, MarshalEncryptionContext(EncryptionContextFromContext(ctx)))
 	return ciphertext, nil
 }
 
-// DecryptDEK decrypts the DEK using AES-GCM
+// DecryptDEK decrypts the DEK using AES-GCM; ctx must carry the encryption context used to encrypt it
 func (s *SimpleTestKMS) DecryptDEK(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKMSUnavailable, err)
+	}
+
+	aesGCM, err := s.gcm(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
+	}
+
+	nonceSize := aesGCM.NonceSize()
+	if len(ciphertext) < nonceSize+aesGCM.Overhead() {
+		return nil, fmt.Errorf("%w: ciphertext too short", ErrDecryptionFailed)
+	}
+
+	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
+	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, MarshalEncryptionContext(EncryptionContextFromContext(ctx)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decrypt: %w", ErrDecryptionFailed, err)
+	}
+
+	return plaintext, nil
+}
+
+// gcm returns the AES-GCM cipher for keyID
+func (s *SimpleTestKMS) gcm(keyID string) (cipher.AEAD, error) {
+	s.mu.RLock()
 	key, exists := s.keys[keyID]
+	s.mu.RUnlock()
 	if !exists {
 		return nil, fmt.Errorf("key not found: %s", keyID)
 	}
@@ -90,19 +126,7 @@ func (s *SimpleTestKMS) DecryptDEK(ctx context.Context, keyID string, ciphertext
 	if err != nil {
 		return nil, fmt.Errorf("failed to create GCM: %w", err)
 	}
-
-	nonceSize := aesGCM.NonceSize()
-	if len(ciphertext) < nonceSize {
-		return nil, fmt.Errorf("ciphertext too short")
-	}
-
-	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt: %w", err)
-	}
-
-	return plaintext, nil
+	return aesGCM, nil
 }
 
 // InMemorySecretStore implements SecretManagementService for testing
@@ -137,6 +161,9 @@ func (s *InMemorySecretStore) GetStoragePath(alias string) string {
 //
 // The pepper must be exactly 32 bytes (PepperLength).
 func (s *InMemorySecretStore) StorePepper(ctx context.Context, alias string, pepper []byte) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrSecretStorageUnavailable, err)
+	}
 	if len(pepper) != PepperLength {
 		return fmt.Errorf("%w: pepper must be exactly %d bytes, got %d",
 			ErrInvalidConfiguration, PepperLength, len(pepper))
@@ -157,6 +184,10 @@ func (s *InMemorySecretStore) StorePepper(ctx context.Context, alias string, pep
 //
 // Returns an error if the pepper doesn't exist or has invalid length.
 func (s *InMemorySecretStore) GetPepper(ctx context.Context, alias string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSecretStorageUnavailable, err)
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -177,6 +208,10 @@ func (s *InMemorySecretStore) GetPepper(ctx context.Context, alias string) ([]by
 //
 // Returns true if the pepper exists, false if it doesn't.
 func (s *InMemorySecretStore) PepperExists(ctx context.Context, alias string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("%w: %w", ErrSecretStorageUnavailable, err)
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -184,14 +219,47 @@ func (s *InMemorySecretStore) PepperExists(ctx context.Context, alias string) (b
 	return exists, nil
 }
 
+// TestCryptoOption configures NewTestCrypto.
+type TestCryptoOption func(*testCryptoOptions)
+
+type testCryptoOptions struct {
+	kms     KeyManagementService
+	secrets SecretManagementService
+}
+
+// WithTestKMS makes NewTestCrypto use kms instead of a SimpleTestKMS, e.g. a FaultyKMS.
+func WithTestKMS(kms KeyManagementService) TestCryptoOption {
+	return func(o *testCryptoOptions) {
+		o.kms = kms
+	}
+}
+
+// WithTestSecretStore makes NewTestCrypto use store instead of an InMemorySecretStore,
+// e.g. a FaultySecretStore.
+func WithTestSecretStore(store SecretManagementService) TestCryptoOption {
+	return func(o *testCryptoOptions) {
+		o.secrets = store
+	}
+}
+
 // NewTestCrypto creates a simple Crypto instance for testing and examples
 // If t is nil, creates a basic test crypto for examples/demos
-func NewTestCrypto(t interface{}) (*Crypto, error) {
+//
+// By default it uses a SimpleTestKMS and an InMemorySecretStore; options replace them:
+//
+//	kms := encx.NewFaultyKMS(nil, encx.FaultConfig{})
+//	crypto, err := encx.NewTestCrypto(t, encx.WithTestKMS(kms))
+func NewTestCrypto(t interface{}, opts ...TestCryptoOption) (*Crypto, error) {
 	ctx := context.Background()
 
 	// Create test KMS and in-memory secret store
-	kms := NewSimpleTestKMS()
-	secrets := NewInMemorySecretStore()
+	options := testCryptoOptions{
+		kms:     NewSimpleTestKMS(),
+		secrets: NewInMemorySecretStore(),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
 
 	// Create explicit configuration
 	cfg := Config{
@@ -200,7 +268,7 @@ func NewTestCrypto(t interface{}) (*Crypto, error) {
 	}
 
 	// Create crypto instance with test configuration
-	crypto, err := NewCrypto(ctx, kms, secrets, cfg)
+	crypto, err := NewCrypto(ctx, options.kms, options.secrets, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create test crypto: %w", err)
 	}
@@ -0,0 +1,407 @@
+package encx
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Operation names recorded by FaultyKMS and FaultySecretStore, and accepted by FaultConfig.Operations.
+const (
+	FaultOpGetKeyID     = "GetKeyID"
+	FaultOpCreateKey    = "CreateKey"
+	FaultOpEncryptDEK   = "EncryptDEK"
+	FaultOpDecryptDEK   = "DecryptDEK"
+	FaultOpRotateKey    = "RotateKey"
+	FaultOpStorePepper  = "StorePepper"
+	FaultOpGetPepper    = "GetPepper"
+	FaultOpPepperExists = "PepperExists"
+)
+
+// FaultConfig configures the faults injected by FaultyKMS and FaultySecretStore.
+//
+// A call fails if it is the FailEvery-th call subject to faults, or with probability
+// FailRate. The zero value injects no faults.
+type FaultConfig struct {
+	// Latency is added before every call. A call whose context ends while waiting
+	// fails with the context error.
+	Latency time.Duration
+
+	// FailEvery fails every Nth call subject to faults (e.g. 3 fails calls 3, 6, 9...).
+	FailEvery int
+
+	// FailRate is the fraction of calls, between 0 and 1, that fail at random.
+	FailRate float64
+
+	// Seed seeds the random source used by FailRate, for reproducible tests.
+	// Zero uses a random seed.
+	Seed int64
+
+	// Err is wrapped by injected failures. Defaults to ErrKMSUnavailable for FaultyKMS
+	// and ErrSecretStorageUnavailable for FaultySecretStore; use e.g. ErrAuthenticationFailed
+	// to simulate expired credentials.
+	Err error
+
+	// Operations limits faults to the listed operations (see FaultOpEncryptDEK etc.).
+	// Empty means every operation. Latency applies to every operation regardless.
+	Operations []string
+}
+
+// FaultCall records a call made to a FaultyKMS or FaultySecretStore.
+type FaultCall struct {
+	Operation string
+	Key       string // key ID for KMS calls, pepper alias for secret store calls
+	Err       error  // error returned to the caller, nil on success
+	Injected  bool   // whether Err was injected rather than returned by the wrapped service
+}
+
+// faultInjector holds the fault state shared by FaultyKMS and FaultySecretStore.
+type faultInjector struct {
+	mu         sync.Mutex
+	cfg        FaultConfig
+	defaultErr error
+	rng        *rand.Rand
+	count      int
+	calls      []FaultCall
+}
+
+func newFaultInjector(cfg FaultConfig, defaultErr error) *faultInjector {
+	f := &faultInjector{defaultErr: defaultErr}
+	f.configure(cfg)
+	return f
+}
+
+func (f *faultInjector) configure(cfg FaultConfig) {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cfg = cfg
+	f.rng = rand.New(rand.NewSource(seed))
+	f.count = 0
+}
+
+// before applies latency and decides whether the call fails, returning the injected error.
+// Failed calls are recorded. A call whose context ends during the latency fails with
+// the context error, recorded as not injected.
+func (f *faultInjector) before(ctx context.Context, op, key string) error {
+	f.mu.Lock()
+	latency := f.cfg.Latency
+	f.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			f.record(op, key, ctx.Err(), false)
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if err := f.inject(op); err != nil {
+		f.record(op, key, err, true)
+		return err
+	}
+	return nil
+}
+
+// inject decides whether a call fails, returning the injected error
+func (f *faultInjector) inject(op string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.cfg.Operations) > 0 && !slices.Contains(f.cfg.Operations, op) {
+		return nil
+	}
+	f.count++
+
+	fail := f.cfg.FailEvery > 0 && f.count%f.cfg.FailEvery == 0
+	if !fail && f.cfg.FailRate > 0 {
+		fail = f.rng.Float64() < f.cfg.FailRate
+	}
+	if !fail {
+		return nil
+	}
+
+	err := f.cfg.Err
+	if err == nil {
+		err = f.defaultErr
+	}
+	return fmt.Errorf("%w: injected fault in %s", err, op)
+}
+
+func (f *faultInjector) record(op, key string, err error, injected bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, FaultCall{Operation: op, Key: key, Err: err, Injected: injected})
+}
+
+func (f *faultInjector) recordedCalls() []FaultCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+func (f *faultInjector) callCount(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, call := range f.calls {
+		if call.Operation == op {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *faultInjector) resetCalls() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+}
+
+// FaultyKMS wraps a KeyManagementService and injects latency and failures.
+//
+// It exercises the error-handling paths that SimpleTestKMS never triggers: KMS
+// outages, expired credentials, and keys disabled after data was encrypted under them.
+// Every call is recorded for assertions.
+//
+// Usage:
+//
+//	kms := encx.NewFaultyKMS(nil, encx.FaultConfig{})
+//	crypto, _ := encx.NewTestCrypto(t, encx.WithTestKMS(kms))
+//
+//	kms.SetFaults(encx.FaultConfig{FailEvery: 2, Operations: []string{encx.FaultOpDecryptDEK}})
+//	_, err := crypto.DecryptDEKWithVersion(ctx, encryptedDEK, 1)
+type FaultyKMS struct {
+	kms      KeyManagementService
+	faults   *faultInjector
+	mu       sync.RWMutex
+	disabled map[string]bool
+}
+
+// NewFaultyKMS wraps kms with fault injection. A nil kms wraps a new SimpleTestKMS.
+func NewFaultyKMS(kms KeyManagementService, cfg FaultConfig) *FaultyKMS {
+	if kms == nil {
+		kms = NewSimpleTestKMS()
+	}
+	return &FaultyKMS{
+		kms:      kms,
+		faults:   newFaultInjector(cfg, ErrKMSUnavailable),
+		disabled: make(map[string]bool),
+	}
+}
+
+// SetFaults replaces the fault configuration and restarts the FailEvery count.
+//
+// Use it to let NewCrypto initialize before injecting faults.
+func (f *FaultyKMS) SetFaults(cfg FaultConfig) {
+	f.faults.configure(cfg)
+}
+
+// DisableKey simulates a key disabled after use: EncryptDEK and DecryptDEK with keyID
+// fail with ErrEncryptionFailed and ErrDecryptionFailed, as cloud KMS providers do.
+func (f *FaultyKMS) DisableKey(keyID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.disabled[keyID] = true
+}
+
+// EnableKey re-enables a key disabled with DisableKey.
+func (f *FaultyKMS) EnableKey(keyID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.disabled, keyID)
+}
+
+// Calls returns the calls made so far, in order.
+func (f *FaultyKMS) Calls() []FaultCall {
+	return f.faults.recordedCalls()
+}
+
+// CallCount returns the number of calls made to an operation (see FaultOpEncryptDEK etc.).
+func (f *FaultyKMS) CallCount(op string) int {
+	return f.faults.callCount(op)
+}
+
+// ResetCalls clears the recorded calls.
+func (f *FaultyKMS) ResetCalls() {
+	f.faults.resetCalls()
+}
+
+// GetKeyID returns the key ID of the wrapped KMS, unless a fault is injected.
+func (f *FaultyKMS) GetKeyID(ctx context.Context, alias string) (string, error) {
+	if err := f.faults.before(ctx, FaultOpGetKeyID, alias); err != nil {
+		return "", err
+	}
+	keyID, err := f.kms.GetKeyID(ctx, alias)
+	f.faults.record(FaultOpGetKeyID, alias, err, false)
+	return keyID, err
+}
+
+// CreateKey creates a key in the wrapped KMS, unless a fault is injected.
+func (f *FaultyKMS) CreateKey(ctx context.Context, description string) (string, error) {
+	if err := f.faults.before(ctx, FaultOpCreateKey, description); err != nil {
+		return "", err
+	}
+	keyID, err := f.kms.CreateKey(ctx, description)
+	f.faults.record(FaultOpCreateKey, keyID, err, false)
+	return keyID, err
+}
+
+// EncryptDEK encrypts with the wrapped KMS, unless a fault is injected or the key is disabled.
+func (f *FaultyKMS) EncryptDEK(ctx context.Context, keyID string, plaintext []byte) ([]byte, error) {
+	if err := f.faults.before(ctx, FaultOpEncryptDEK, keyID); err != nil {
+		return nil, err
+	}
+	if f.isDisabled(keyID) {
+		err := fmt.Errorf("%w: key %s is disabled", ErrEncryptionFailed, keyID)
+		f.faults.record(FaultOpEncryptDEK, keyID, err, true)
+		return nil, err
+	}
+
+	ciphertext, err := f.kms.EncryptDEK(ctx, keyID, plaintext)
+	f.faults.record(FaultOpEncryptDEK, keyID, err, false)
+	return ciphertext, err
+}
+
+// DecryptDEK decrypts with the wrapped KMS, unless a fault is injected or the key is disabled.
+func (f *FaultyKMS) DecryptDEK(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	if err := f.faults.before(ctx, FaultOpDecryptDEK, keyID); err != nil {
+		return nil, err
+	}
+	if f.isDisabled(keyID) {
+		err := fmt.Errorf("%w: key %s is disabled", ErrDecryptionFailed, keyID)
+		f.faults.record(FaultOpDecryptDEK, keyID, err, true)
+		return nil, err
+	}
+
+	plaintext, err := f.kms.DecryptDEK(ctx, keyID, ciphertext)
+	f.faults.record(FaultOpDecryptDEK, keyID, err, false)
+	return plaintext, err
+}
+
+func (f *FaultyKMS) isDisabled(keyID string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.disabled[keyID]
+}
+
+// FaultyRotatingKMS is a FaultyKMS wrapping a KMS that implements KeyRotator, such as
+// the Vault Transit service. It forwards RotateKey, so that RotateKEK rotates keys
+// natively as with the wrapped KMS.
+//
+// It is a separate type so that FaultyKMS does not claim to implement KeyRotator for
+// KMS services that do not.
+type FaultyRotatingKMS struct {
+	*FaultyKMS
+	rotator KeyRotator
+}
+
+// NewFaultyRotatingKMS wraps kms with fault injection, keeping its key rotation.
+func NewFaultyRotatingKMS(kms interface {
+	KeyManagementService
+	KeyRotator
+}, cfg FaultConfig) *FaultyRotatingKMS {
+	return &FaultyRotatingKMS{FaultyKMS: NewFaultyKMS(kms, cfg), rotator: kms}
+}
+
+// RotateKey rotates the key in the wrapped KMS, unless a fault is injected.
+func (f *FaultyRotatingKMS) RotateKey(ctx context.Context, keyID string) (string, error) {
+	if err := f.faults.before(ctx, FaultOpRotateKey, keyID); err != nil {
+		return "", err
+	}
+	newKeyID, err := f.rotator.RotateKey(ctx, keyID)
+	f.faults.record(FaultOpRotateKey, keyID, err, false)
+	return newKeyID, err
+}
+
+// FaultySecretStore wraps a SecretManagementService and injects latency and failures.
+//
+// Every call is recorded for assertions.
+//
+// Usage:
+//
+//	store := encx.NewFaultySecretStore(nil, encx.FaultConfig{
+//	    FailEvery:  1,
+//	    Operations: []string{encx.FaultOpGetPepper},
+//	})
+type FaultySecretStore struct {
+	store  SecretManagementService
+	faults *faultInjector
+}
+
+// NewFaultySecretStore wraps store with fault injection. A nil store wraps a new InMemorySecretStore.
+func NewFaultySecretStore(store SecretManagementService, cfg FaultConfig) *FaultySecretStore {
+	if store == nil {
+		store = NewInMemorySecretStore()
+	}
+	return &FaultySecretStore{
+		store:  store,
+		faults: newFaultInjector(cfg, ErrSecretStorageUnavailable),
+	}
+}
+
+// SetFaults replaces the fault configuration and restarts the FailEvery count.
+func (s *FaultySecretStore) SetFaults(cfg FaultConfig) {
+	s.faults.configure(cfg)
+}
+
+// Calls returns the calls made so far, in order.
+func (s *FaultySecretStore) Calls() []FaultCall {
+	return s.faults.recordedCalls()
+}
+
+// CallCount returns the number of calls made to an operation (see FaultOpGetPepper etc.).
+func (s *FaultySecretStore) CallCount(op string) int {
+	return s.faults.callCount(op)
+}
+
+// ResetCalls clears the recorded calls.
+func (s *FaultySecretStore) ResetCalls() {
+	s.faults.resetCalls()
+}
+
+// GetStoragePath returns the storage path of the wrapped store.
+func (s *FaultySecretStore) GetStoragePath(alias string) string {
+	return s.store.GetStoragePath(alias)
+}
+
+// StorePepper stores the pepper in the wrapped store, unless a fault is injected.
+func (s *FaultySecretStore) StorePepper(ctx context.Context, alias string, pepper []byte) error {
+	if err := s.faults.before(ctx, FaultOpStorePepper, alias); err != nil {
+		return err
+	}
+	err := s.store.StorePepper(ctx, alias, pepper)
+	s.faults.record(FaultOpStorePepper, alias, err, false)
+	return err
+}
+
+// GetPepper returns the pepper from the wrapped store, unless a fault is injected.
+func (s *FaultySecretStore) GetPepper(ctx context.Context, alias string) ([]byte, error) {
+	if err := s.faults.before(ctx, FaultOpGetPepper, alias); err != nil {
+		return nil, err
+	}
+	pepper, err := s.store.GetPepper(ctx, alias)
+	s.faults.record(FaultOpGetPepper, alias, err, false)
+	return pepper, err
+}
+
+// PepperExists checks the wrapped store, unless a fault is injected.
+func (s *FaultySecretStore) PepperExists(ctx context.Context, alias string) (bool, error) {
+	if err := s.faults.before(ctx, FaultOpPepperExists, alias); err != nil {
+		return false, err
+	}
+	exists, err := s.store.PepperExists(ctx, alias)
+	s.faults.record(FaultOpPepperExists, alias, err, false)
+	return exists, err
+}
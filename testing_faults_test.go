@@ -0,0 +1,203 @@
+package encx_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hengadev/encx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultyKMS_FailEvery(t *testing.T) {
+	ctx := context.Background()
+	kms := encx.NewFaultyKMS(nil, encx.FaultConfig{FailEvery: 3})
+
+	var failed []int
+	for i := 1; i <= 6; i++ {
+		if _, err := kms.EncryptDEK(ctx, "test-key-id", []byte("0123456789abcdef0123456789abcdef")); err != nil {
+			assert.ErrorIs(t, err, encx.ErrKMSUnavailable)
+			assert.True(t, encx.IsRetryableError(err))
+			failed = append(failed, i)
+		}
+	}
+	assert.Equal(t, []int{3, 6}, failed)
+
+	calls := kms.Calls()
+	require.Len(t, calls, 6)
+	assert.Equal(t, encx.FaultOpEncryptDEK, calls[2].Operation)
+	assert.Equal(t, "test-key-id", calls[2].Key)
+	assert.True(t, calls[2].Injected)
+	assert.NoError(t, calls[0].Err)
+	assert.Equal(t, 6, kms.CallCount(encx.FaultOpEncryptDEK))
+
+	kms.ResetCalls()
+	assert.Empty(t, kms.Calls())
+}
+
+func TestFaultyKMS_FailRate(t *testing.T) {
+	ctx := context.Background()
+
+	count := func(cfg encx.FaultConfig) int {
+		kms := encx.NewFaultyKMS(nil, cfg)
+		failures := 0
+		for i := 0; i < 200; i++ {
+			if _, err := kms.GetKeyID(ctx, "alias"); err != nil {
+				failures++
+			}
+		}
+		return failures
+	}
+
+	assert.Equal(t, 0, count(encx.FaultConfig{}))
+	assert.Equal(t, 200, count(encx.FaultConfig{FailRate: 1}))
+
+	// A fixed seed makes failures reproducible
+	half := count(encx.FaultConfig{FailRate: 0.5, Seed: 42})
+	assert.Equal(t, half, count(encx.FaultConfig{FailRate: 0.5, Seed: 42}))
+	assert.InDelta(t, 100, half, 40)
+}
+
+func TestFaultyKMS_ErrorAndOperations(t *testing.T) {
+	ctx := context.Background()
+	kms := encx.NewFaultyKMS(nil, encx.FaultConfig{
+		FailEvery:  1,
+		Err:        encx.ErrAuthenticationFailed,
+		Operations: []string{encx.FaultOpDecryptDEK},
+	})
+
+	ciphertext, err := kms.EncryptDEK(ctx, "test-key-id", []byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+
+	_, err = kms.DecryptDEK(ctx, "test-key-id", ciphertext)
+	assert.ErrorIs(t, err, encx.ErrAuthenticationFailed)
+	assert.True(t, encx.IsAuthError(err))
+}
+
+func TestFaultyKMS_Latency(t *testing.T) {
+	kms := encx.NewFaultyKMS(nil, encx.FaultConfig{Latency: 20 * time.Millisecond})
+
+	start := time.Now()
+	_, err := kms.GetKeyID(context.Background(), "alias")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	kms.SetFaults(encx.FaultConfig{Latency: time.Minute})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = kms.GetKeyID(ctx, "alias")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// The context error is the caller's, not an injected fault
+	calls := kms.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, context.DeadlineExceeded, calls[1].Err)
+	assert.False(t, calls[1].Injected)
+}
+
+func TestFaultyKMS_DisabledKeyWithCrypto(t *testing.T) {
+	ctx := context.Background()
+	kms := encx.NewFaultyKMS(nil, encx.FaultConfig{})
+	crypto, err := encx.NewTestCrypto(t, encx.WithTestKMS(kms))
+	require.NoError(t, err)
+
+	dek, err := crypto.GenerateDEK()
+	require.NoError(t, err)
+	encryptedDEK, err := crypto.EncryptDEK(ctx, dek)
+	require.NoError(t, err)
+
+	calls := kms.Calls()
+	keyID := calls[len(calls)-1].Key
+	kms.DisableKey(keyID)
+
+	_, err = crypto.DecryptDEKWithVersion(ctx, encryptedDEK, 1)
+	assert.ErrorIs(t, err, encx.ErrDecryptionFailed)
+	_, err = crypto.EncryptDEK(ctx, dek)
+	assert.ErrorIs(t, err, encx.ErrEncryptionFailed)
+
+	kms.EnableKey(keyID)
+	decrypted, err := crypto.DecryptDEKWithVersion(ctx, encryptedDEK, 1)
+	require.NoError(t, err)
+	assert.Equal(t, dek, decrypted)
+}
+
+func TestFaultyKMS_DecryptFailuresWithCrypto(t *testing.T) {
+	ctx := context.Background()
+	kms := encx.NewFaultyKMS(nil, encx.FaultConfig{})
+	crypto, err := encx.NewTestCrypto(t, encx.WithTestKMS(kms))
+	require.NoError(t, err)
+
+	dek, err := crypto.GenerateDEK()
+	require.NoError(t, err)
+	encryptedDEK, err := crypto.EncryptDEK(ctx, dek)
+	require.NoError(t, err)
+
+	kms.SetFaults(encx.FaultConfig{FailEvery: 2, Operations: []string{encx.FaultOpDecryptDEK}})
+
+	_, err = crypto.DecryptDEKWithVersion(ctx, encryptedDEK, 1)
+	assert.NoError(t, err)
+	_, err = crypto.DecryptDEKWithVersion(ctx, encryptedDEK, 1)
+	assert.ErrorIs(t, err, encx.ErrKMSUnavailable)
+}
+
+// rotatingTestKMS rotates keys by creating new ones
+type rotatingTestKMS struct {
+	encx.KeyManagementService
+}
+
+func (k *rotatingTestKMS) RotateKey(ctx context.Context, keyID string) (string, error) {
+	return k.CreateKey(ctx, keyID)
+}
+
+func TestFaultyRotatingKMS(t *testing.T) {
+	ctx := context.Background()
+
+	// FaultyKMS does not claim to rotate keys on behalf of the KMS it wraps
+	var kms encx.KeyManagementService = encx.NewFaultyKMS(nil, encx.FaultConfig{})
+	_, ok := kms.(encx.KeyRotator)
+	assert.False(t, ok)
+
+	rotating := encx.NewFaultyRotatingKMS(&rotatingTestKMS{encx.NewSimpleTestKMS()}, encx.FaultConfig{})
+	// Rotations are stored in a database of their own, not shared with other tests
+	crypto, err := encx.NewCrypto(ctx, rotating, encx.NewInMemorySecretStore(), encx.Config{
+		KEKAlias:    "test-kek-alias",
+		PepperAlias: "test-service",
+		DBPath:      t.TempDir(),
+	})
+	require.NoError(t, err)
+	rotating.ResetCalls()
+
+	rotating.SetFaults(encx.FaultConfig{FailEvery: 1, Operations: []string{encx.FaultOpRotateKey}})
+	err = crypto.RotateKEK(ctx)
+	assert.ErrorIs(t, err, encx.ErrKMSUnavailable)
+	assert.Equal(t, 1, rotating.CallCount(encx.FaultOpRotateKey))
+	assert.Zero(t, rotating.CallCount(encx.FaultOpCreateKey))
+
+	rotating.SetFaults(encx.FaultConfig{})
+	require.NoError(t, crypto.RotateKEK(ctx))
+	assert.Equal(t, 2, rotating.CallCount(encx.FaultOpRotateKey))
+}
+
+func TestFaultySecretStore_PepperLoading(t *testing.T) {
+	store := encx.NewFaultySecretStore(nil, encx.FaultConfig{
+		FailEvery:  1,
+		Operations: []string{encx.FaultOpPepperExists},
+	})
+
+	_, err := encx.NewTestCrypto(t, encx.WithTestSecretStore(store))
+	assert.ErrorIs(t, err, encx.ErrSecretStorageUnavailable)
+	assert.Equal(t, 1, store.CallCount(encx.FaultOpPepperExists))
+	assert.Equal(t, 0, store.CallCount(encx.FaultOpStorePepper))
+
+	// Once the store recovers, the pepper is generated and stored
+	store.SetFaults(encx.FaultConfig{})
+	_, err = encx.NewTestCrypto(t, encx.WithTestSecretStore(store))
+	require.NoError(t, err)
+	assert.Equal(t, 1, store.CallCount(encx.FaultOpStorePepper))
+
+	calls := store.Calls()
+	assert.Equal(t, "test-service", calls[len(calls)-1].Key)
+	assert.Equal(t, "memory://test-service/pepper", store.GetStoragePath("test-service"))
+}